@@ -12,6 +12,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 	"unicode"
 
@@ -211,6 +212,55 @@ func (l *lineReader) Read(p []byte) (n int, err error) {
 	return
 }
 
+// lineEndingReader turns bare CR line endings, as written by some old or
+// misconfigured tools, into LF so that bufio.Reader.ReadLine can split
+// them. A run of CRs followed by LF becomes a single LF, which covers CRLF
+// endings as well as the CRCRLF endings of files that were converted twice.
+type lineEndingReader struct {
+	in *bufio.Reader
+	// pendingCRs counts the CRs read that have not yet been emitted.
+	pendingCRs int
+}
+
+func (r *lineEndingReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if n > 0 && r.in.Buffered() == 0 {
+			// Don't block waiting for more input.
+			return
+		}
+		var c byte
+		c, err = r.in.ReadByte()
+		if err == io.EOF && r.pendingCRs > 0 {
+			r.pendingCRs--
+			p[n] = '\n'
+			n++
+			err = nil
+			continue
+		}
+		if err != nil {
+			if n > 0 {
+				err = nil
+			}
+			return
+		}
+		switch {
+		case c == '\r':
+			r.pendingCRs++
+			continue
+		case c == '\n':
+			r.pendingCRs = 0
+		case r.pendingCRs > 0:
+			// Emit one bare CR as LF and look at c again.
+			r.pendingCRs--
+			r.in.UnreadByte()
+			c = '\n'
+		}
+		p[n] = c
+		n++
+	}
+	return
+}
+
 // openpgpReader passes Read calls to the underlying base64 decoder, but keeps
 // a running CRC of the resulting data and checks the CRC against the value
 // found by the lineReader at EOF.
@@ -238,7 +288,7 @@ func (r *openpgpReader) Read(p []byte) (n int, err error) {
 // given Reader is not usable after calling this function: an arbitrary amount
 // of data may have been read past the end of the block.
 func Decode(in io.Reader) (p *Block, err error) {
-	r := bufio.NewReaderSize(in, 100)
+	r := bufio.NewReaderSize(&lineEndingReader{in: bufio.NewReader(in)}, 100)
 	var line []byte
 	ignoreNext := false
 
@@ -300,3 +350,71 @@ TryNextBlock:
 
 	return
 }
+
+// DecodeFromText finds and decodes the first armored block in arbitrary
+// text, such as the body of an email, in which the block may be surrounded
+// by other text and quoted with "> " prefixes. The quote prefix of the BEGIN
+// line is removed from every line of the block, and a quoted empty line
+// counts as empty. It returns io.EOF if there is no armored block in r.
+func DecodeFromText(r io.Reader) (p *Block, err error) {
+	br := bufio.NewReader(r)
+	var block bytes.Buffer
+	var prefix string
+	inBlock := false
+	for {
+		line, readErr := br.ReadString('\n')
+		if len(line) == 0 && readErr != nil {
+			if !inBlock {
+				return nil, readErr
+			}
+			// Let Decode report the missing END line.
+			break
+		}
+		line = strings.TrimRight(line, " \t\r\n")
+		if !inBlock {
+			i := strings.Index(line, string(armorStart))
+			if i < 0 || !isQuotePrefix(line[:i]) || !strings.HasSuffix(line, string(armorEndOfLine)) {
+				continue
+			}
+			prefix, inBlock = line[:i], true
+		}
+
+		switch {
+		case strings.HasPrefix(line, prefix):
+			line = line[len(prefix):]
+		case line == strings.TrimRight(prefix, " \t"):
+			line = ""
+		default:
+			return nil, ArmorCorrupt
+		}
+		block.WriteString(line)
+		block.WriteByte('\n')
+		if strings.HasPrefix(line, string(armorEnd)) || readErr != nil {
+			break
+		}
+	}
+	return Decode(&block)
+}
+
+// isQuotePrefix reports whether s, the text before an armor header line,
+// consists only of email quote markers and whitespace.
+func isQuotePrefix(s string) bool {
+	return strings.Trim(s, "> \t") == ""
+}
+
+// Dearmor decodes the first armored block in armored and returns its
+// contents and block type. It is the inverse of Rearmor.
+func Dearmor(armored string) ([]byte, string, error) {
+	block, err := Decode(strings.NewReader(armored))
+	if err == io.EOF {
+		return nil, "", errors.InvalidArgumentError("no armored data found")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	contents, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return contents, block.Type, nil
+}
@@ -6,6 +6,7 @@ package armor
 
 import (
 	"bytes"
+	"encoding/hex"
 	"hash/adler32"
 	"io"
 	"io/ioutil"
@@ -141,6 +142,30 @@ func decodeAndReadFail(t *testing.T, expectedErr string, armor string) *Block {
 	return result
 }
 
+func TestLineEndings(t *testing.T) {
+	for _, eol := range []string{"\n", "\r\n", "\r", "\r\r\n"} {
+		result, err := Decode(strings.NewReader(strings.Replace(armorExample1, "\n", eol, -1)))
+		if err != nil {
+			t.Errorf("%q: %s", eol, err)
+			continue
+		}
+		if v := result.Header["Version"]; v != "GnuPG v1.4.10 (GNU/Linux)" {
+			t.Errorf("%q: bad Version header: %q", eol, v)
+		}
+		contents, err := ioutil.ReadAll(result.Body)
+		if err != nil {
+			t.Errorf("%q: %s", eol, err)
+			continue
+		}
+		if result.lReader.crc == nil {
+			t.Errorf("%q: expected CRC to be read", eol)
+		}
+		if adler32.Checksum(contents) != 0x27b144be {
+			t.Errorf("%q: bad contents: %x", eol, contents)
+		}
+	}
+}
+
 func TestZeroWidthSpace(t *testing.T) {
 	decodeAndRead(t, armorZeroWidthSpace)
 
@@ -222,6 +247,198 @@ func TestMalformedCRCs(t *testing.T) {
 	decodeAndReadFail(t, armorErrorText, stuffAfterChecksum2)
 }
 
+func TestRearmorDearmor(t *testing.T) {
+	for _, test := range []struct {
+		blockType string
+		hex       string
+	}{
+		// An Ed25519 public key, as exported by GnuPG.
+		{"PGP PUBLIC KEY BLOCK", rearmorKeyHex},
+		// A literal data packet holding "hello world".
+		{"PGP MESSAGE", "cb1162006ad176a568656c6c6f20776f726c64"},
+	} {
+		binary, _ := hex.DecodeString(test.hex)
+		headers := map[string]string{"Comment": "rearmor test"}
+
+		armored, err := Rearmor(binary, test.blockType, headers)
+		if err != nil {
+			t.Fatalf("%s: %s", test.blockType, err)
+		}
+		if !strings.HasPrefix(armored, "-----BEGIN "+test.blockType+"-----\nComment: rearmor test\n") {
+			t.Errorf("%s: unexpected armor:\n%s", test.blockType, armored)
+		}
+
+		dearmored, blockType, err := Dearmor(armored)
+		if err != nil {
+			t.Fatalf("%s: %s", test.blockType, err)
+		}
+		if blockType != test.blockType {
+			t.Errorf("got block type %q, want %q", blockType, test.blockType)
+		}
+		if !bytes.Equal(dearmored, binary) {
+			t.Errorf("%s: got %x, want %x", test.blockType, dearmored, binary)
+		}
+	}
+
+	if _, _, err := Dearmor("no armor here"); err == nil {
+		t.Error("expected an error when there's no armored block")
+	}
+}
+
+func TestLineLengthVariations(t *testing.T) {
+	binary, _ := hex.DecodeString(rearmorKeyHex)
+	armored, err := Rearmor(binary, "PGP PUBLIC KEY BLOCK", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encode wraps at the canonical 64 characters.
+	lines := strings.Split(armored, "\n")
+	var body []string
+	var checksum string
+	for _, line := range lines[2:] {
+		if strings.HasPrefix(line, "=") {
+			checksum = line
+			break
+		}
+		body = append(body, line)
+	}
+	for i, line := range body[:len(body)-1] {
+		if len(line) != 64 {
+			t.Errorf("line %d is %d characters long, want 64", i, len(line))
+		}
+	}
+
+	// Other tools wrap at 76 (PGP Desktop) or 72 characters, or not at
+	// all, and the decoder must not care.
+	joined := strings.Join(body, "")
+	for _, width := range []int{72, 76, len(joined)} {
+		var rewrapped []string
+		for rest := joined; len(rest) > 0; {
+			n := width
+			if n > len(rest) {
+				n = len(rest)
+			}
+			rewrapped = append(rewrapped, rest[:n])
+			rest = rest[n:]
+		}
+		armored := "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\n" +
+			strings.Join(rewrapped, "\n") + "\n" + checksum + "\n" +
+			"-----END PGP PUBLIC KEY BLOCK-----\n"
+
+		dearmored, _, err := Dearmor(armored)
+		if err != nil {
+			t.Fatalf("width %d: %s", width, err)
+		}
+		if !bytes.Equal(dearmored, binary) {
+			t.Errorf("width %d: got %x, want %x", width, dearmored, binary)
+		}
+	}
+}
+
+func TestDecodeFromText(t *testing.T) {
+	want, err := Decode(strings.NewReader(armorExample1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantContents, err := ioutil.ReadAll(want.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quote := func(prefix string) string {
+		lines := strings.Split(strings.TrimSuffix(armorExample1, "\n"), "\n")
+		for i, line := range lines {
+			if line == "" {
+				// Mail clients quote empty lines without the space.
+				lines[i] = strings.TrimRight(prefix, " ")
+			} else {
+				lines[i] = prefix + line
+			}
+		}
+		return strings.Join(lines, "\r\n")
+	}
+
+	for _, test := range []struct {
+		name, text string
+	}{
+		{"unquoted", "Hi,\n\nsee below.\n\n" + armorExample1 + "\nThanks!\n"},
+		{"quoted", "On Monday, Alice wrote:\r\n> Here is my signature:\r\n>\r\n" + quote("> ") + "\r\n>\r\n> Alice\r\n\r\nGot it.\r\n"},
+		{"quoted twice", "Bob wrote:\n> > -----BEGIN PGP not quite\n" + quote("> > ") + "\n"},
+	} {
+		block, err := DecodeFromText(strings.NewReader(test.text))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if block.Type != want.Type || block.Header["Version"] != want.Header["Version"] {
+			t.Errorf("%s: got type %q and headers %v", test.name, block.Type, block.Header)
+		}
+		contents, err := ioutil.ReadAll(block.Body)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !bytes.Equal(contents, wantContents) {
+			t.Errorf("%s: contents differ", test.name)
+		}
+	}
+
+	if _, err := DecodeFromText(strings.NewReader("no armor here\n> -----END PGP SIGNATURE-----\n")); err != io.EOF {
+		t.Errorf("text without armor: got %v, want io.EOF", err)
+	}
+}
+
+func TestEncodeWithStyle(t *testing.T) {
+	headers := map[string]string{
+		"Version": "GoPGP",
+		"Comment": "first line\nsecond line",
+		"Hash":    "SHA256",
+	}
+	for _, test := range []struct {
+		style   Style
+		headers string
+		suffix  string
+	}{
+		{StyleGnuPG, "Comment: first line\nComment: second line\nHash: SHA256\n", "-----\n"},
+		{StyleMinimal, "", "-----"},
+		{StyleRFC, "Version: GoPGP\nComment: first line\nComment: second line\nHash: SHA256\n", "-----\n"},
+	} {
+		var buf bytes.Buffer
+		w, err := EncodeWithStyle(&buf, "PGP MESSAGE", headers, test.style)
+		if err != nil {
+			t.Fatalf("style %d: %s", test.style, err)
+		}
+		w.Write([]byte("hello world"))
+		if err := w.Close(); err != nil {
+			t.Fatalf("style %d: %s", test.style, err)
+		}
+		armored := buf.String()
+
+		prefix := "-----BEGIN PGP MESSAGE-----\n" + test.headers + "\n"
+		if !strings.HasPrefix(armored, prefix) {
+			t.Errorf("style %d: got armor\n%s\nwant prefix\n%s", test.style, armored, prefix)
+		}
+		if !strings.HasSuffix(armored, "-----END PGP MESSAGE"+test.suffix) {
+			t.Errorf("style %d: unexpected end of armor %q", test.style, armored)
+		}
+
+		block, err := Decode(strings.NewReader(armored))
+		if err != nil {
+			t.Fatalf("style %d: %s", test.style, err)
+		}
+		contents, err := ioutil.ReadAll(block.Body)
+		if err != nil {
+			t.Fatalf("style %d: %s", test.style, err)
+		}
+		if string(contents) != "hello world" {
+			t.Errorf("style %d: got %q, want %q", test.style, contents, "hello world")
+		}
+	}
+}
+
+const rearmorKeyHex = "9833046ad176a516092b06010401da470f01010740fcbf04a2ff191f02c95d89185af48839655fd15b85a8a580f5fcebc24e16b1fab41e41726d6f722054657374203c61726d6f72406578616d706c652e636f6d3e8890041316080038162104bf26299d65b9010a57a34d69cfa1d5a84130e8cd05026ad176a5021b03050b0908070206150a09080b020416020301021e01021780000a0910cfa1d5a84130e8cd970d00fd1b4039016d0bc1b21175a4343fb92490b439b767665e73cf6fee2fa1b6c4ce1a010083b6ae51c4268cde238813a9f1e407af36ed8fe100c52291f80dc74c990e880b"
+
 const armorExample1 = `-----BEGIN PGP SIGNATURE-----
 Version: GnuPG v1.4.10 (GNU/Linux)
 
@@ -5,8 +5,11 @@
 package armor
 
 import (
+	"bytes"
 	"encoding/base64"
 	"io"
+	"sort"
+	"strings"
 )
 
 var armorHeaderSep = []byte(": ")
@@ -103,6 +106,8 @@ type encoding struct {
 	b64       io.WriteCloser
 	crc       uint32
 	blockType []byte
+	// noFinalNewline leaves out the newline after the armor trailer.
+	noFinalNewline bool
 }
 
 func (e *encoding) Write(data []byte) (n int, err error) {
@@ -125,20 +130,89 @@ func (e *encoding) Close() (err error) {
 	var b64ChecksumBytes [4]byte
 	base64.StdEncoding.Encode(b64ChecksumBytes[:], checksumBytes[:])
 
-	return writeSlices(e.out, blockEnd, b64ChecksumBytes[:], newline, armorEnd, e.blockType, armorEndOfLine, []byte{'\n'})
+	err = writeSlices(e.out, blockEnd, b64ChecksumBytes[:], newline, armorEnd, e.blockType, armorEndOfLine)
+	if err != nil || e.noFinalNewline {
+		return
+	}
+	_, err = e.out.Write(newline)
+	return
 }
 
 // Encode returns a WriteCloser which will encode the data written to it in
 // OpenPGP armor.
 func Encode(out io.Writer, blockType string, headers map[string]string) (w io.WriteCloser, err error) {
+	var lines []header
+	for k, v := range headers {
+		lines = append(lines, header{k, v})
+	}
+	return encode(out, blockType, lines, false)
+}
+
+// Style selects the conventions that EncodeWithStyle follows, so that its
+// output can match that of another implementation.
+type Style int
+
+const (
+	// StyleGnuPG writes armor like current GnuPG releases, which don't
+	// write a Version header.
+	StyleGnuPG Style = iota
+	// StyleMinimal writes no headers and no newline after the armor
+	// trailer.
+	StyleMinimal
+	// StyleRFC writes armor like the examples in RFC 4880, with the
+	// Version header, if any, first.
+	StyleRFC
+)
+
+// EncodeWithStyle is like Encode, but follows the conventions of style.
+// Headers are written in sorted order, and a Comment header whose value
+// has several lines is written as one Comment header per line, since a
+// header can't span lines.
+func EncodeWithStyle(out io.Writer, blockType string, headers map[string]string, style Style) (w io.WriteCloser, err error) {
+	var lines []header
+	if style != StyleMinimal {
+		keys := make([]string, 0, len(headers))
+		for k := range headers {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if style == StyleRFC && (keys[i] == "Version") != (keys[j] == "Version") {
+				return keys[i] == "Version"
+			}
+			return keys[i] < keys[j]
+		})
+		for _, k := range keys {
+			v := headers[k]
+			switch {
+			case k == "Version" && style == StyleGnuPG:
+			case k == "Comment":
+				for _, line := range strings.Split(v, "\n") {
+					if line = strings.TrimRight(line, "\r"); line != "" {
+						lines = append(lines, header{k, line})
+					}
+				}
+			default:
+				lines = append(lines, header{k, v})
+			}
+		}
+	}
+	return encode(out, blockType, lines, style == StyleMinimal)
+}
+
+// header is a single armor header line.
+type header struct {
+	key, value string
+}
+
+func encode(out io.Writer, blockType string, headers []header, noFinalNewline bool) (w io.WriteCloser, err error) {
 	bType := []byte(blockType)
 	err = writeSlices(out, armorStart, bType, armorEndOfLineOut)
 	if err != nil {
 		return
 	}
 
-	for k, v := range headers {
-		err = writeSlices(out, []byte(k), armorHeaderSep, []byte(v), newline)
+	for _, h := range headers {
+		err = writeSlices(out, []byte(h.key), armorHeaderSep, []byte(h.value), newline)
 		if err != nil {
 			return
 		}
@@ -150,11 +224,29 @@ func Encode(out io.Writer, blockType string, headers map[string]string) (w io.Wr
 	}
 
 	e := &encoding{
-		out:       out,
-		breaker:   newLineBreaker(out, 64),
-		crc:       crc24Init,
-		blockType: bType,
+		out:            out,
+		breaker:        newLineBreaker(out, 64),
+		crc:            crc24Init,
+		blockType:      bType,
+		noFinalNewline: noFinalNewline,
 	}
 	e.b64 = base64.NewEncoder(base64.StdEncoding, e.breaker)
 	return e, nil
 }
+
+// Rearmor returns binary encoded as a single armored block of the given type,
+// with the given headers. Dearmor reverses it.
+func Rearmor(binary []byte, blockType string, headers map[string]string) (string, error) {
+	var buf bytes.Buffer
+	w, err := Encode(&buf, blockType, headers)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(binary); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
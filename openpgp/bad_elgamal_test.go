@@ -1,10 +1,11 @@
-package openpgp
+package openpgp_test
 
 import (
 	"bytes"
 	"strings"
 	"testing"
 
+	"github.com/keybase/go-crypto/openpgp"
 	"github.com/keybase/go-crypto/openpgp/clearsign"
 	"github.com/keybase/go-crypto/openpgp/errors"
 	"github.com/keybase/go-crypto/openpgp/packet"
@@ -14,7 +15,7 @@ func TestBadElgamalSubkey(t *testing.T) {
 	// When algo 20 key is read, we go ahead with parsing and
 	// verifying, but the key ends up in BadSubkeys with
 	// DeprecatedKeyError.
-	entities, err := ReadArmoredKeyRing(strings.NewReader(publicKey))
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
 	if err != nil {
 		t.Fatalf("error opening keys: %v", err)
 	}
@@ -45,7 +46,7 @@ func TestBadElgamalSubkey(t *testing.T) {
 	if b == nil {
 		t.Fatal("Failed to decode clearsign msg")
 	}
-	_, err = CheckDetachedSignature(entities, bytes.NewBuffer(b.Bytes), b.ArmoredSignature.Body)
+	_, err = openpgp.CheckDetachedSignature(entities, bytes.NewBuffer(b.Bytes), b.ArmoredSignature.Body)
 	if err == nil {
 		t.Fatal("Expected to see error when checking clearsign")
 	}
@@ -58,7 +59,7 @@ func TestBadElgamalPrimary(t *testing.T) {
 	// If BadElGamal is primary key, opening should fail with
 	// error opening keys: openpgp: invalid data: primary key cannot be used for signatures
 	// Because PublicKeyBadElGamal is neither valid for Encryption nor Signing.
-	_, err := ReadArmoredKeyRing(strings.NewReader(badPrimaryPublicKey))
+	_, err := openpgp.ReadArmoredKeyRing(strings.NewReader(badPrimaryPublicKey))
 	if err == nil {
 		t.Fatalf("Expected error")
 	}
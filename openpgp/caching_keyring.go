@@ -0,0 +1,61 @@
+package openpgp
+
+import (
+	"sync"
+)
+
+// CachingKeyRing is a KeyRing backed by an EntityList that can be swapped
+// out atomically, for instance when a long-running process periodically
+// reloads its keys from disk. It is safe for concurrent use.
+type CachingKeyRing struct {
+	mu sync.RWMutex
+	el EntityList
+}
+
+// NewCachingKeyRing returns a CachingKeyRing that initially holds el.
+func NewCachingKeyRing(el EntityList) *CachingKeyRing {
+	return &CachingKeyRing{el: el}
+}
+
+// Entities returns the EntityList currently held by the keyring. The
+// returned list must not be mutated by the caller.
+func (kr *CachingKeyRing) Entities() EntityList {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.el
+}
+
+// Replace atomically swaps the held EntityList for el. Lookups that are
+// in flight when Replace is called complete against the old list.
+func (kr *CachingKeyRing) Replace(el EntityList) {
+	kr.mu.Lock()
+	kr.el = el
+	kr.mu.Unlock()
+}
+
+// Refresh calls load and, if it succeeds, replaces the held EntityList
+// with its result. If load returns an error the keyring is left
+// unchanged and the error is returned.
+func (kr *CachingKeyRing) Refresh(load func() (EntityList, error)) error {
+	el, err := load()
+	if err != nil {
+		return err
+	}
+	kr.Replace(el)
+	return nil
+}
+
+// KeysById implements KeyRing.
+func (kr *CachingKeyRing) KeysById(id uint64, fp []byte) []Key {
+	return kr.Entities().KeysById(id, fp)
+}
+
+// KeysByIdUsage implements KeyRing.
+func (kr *CachingKeyRing) KeysByIdUsage(id uint64, fp []byte, requiredUsage byte) []Key {
+	return kr.Entities().KeysByIdUsage(id, fp, requiredUsage)
+}
+
+// DecryptionKeys implements KeyRing.
+func (kr *CachingKeyRing) DecryptionKeys() []Key {
+	return kr.Entities().DecryptionKeys()
+}
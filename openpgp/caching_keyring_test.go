@@ -0,0 +1,74 @@
+package openpgp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCachingKeyRingConcurrentReplace(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCachingKeyRing(kring)
+	var _ KeyRing = cache
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				keys := cache.KeysById(testKey1KeyId, nil)
+				if len(keys) > 1 {
+					t.Errorf("expected at most one key, got %d", len(keys))
+					return
+				}
+				cache.KeysByIdUsage(testKey1KeyId, nil, 0)
+				cache.DecryptionKeys()
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 200; j++ {
+			if j%2 == 0 {
+				cache.Replace(nil)
+			} else {
+				cache.Replace(kring)
+			}
+		}
+	}()
+	wg.Wait()
+
+	cache.Replace(kring)
+	if keys := cache.KeysById(testKey1KeyId, nil); len(keys) != 1 {
+		t.Errorf("expected one key after Replace, got %d", len(keys))
+	}
+}
+
+func TestCachingKeyRingRefresh(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCachingKeyRing(nil)
+	if err := cache.Refresh(func() (EntityList, error) { return kring, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.Entities()) != len(kring) {
+		t.Fatalf("expected %d entities, got %d", len(kring), len(cache.Entities()))
+	}
+
+	loadErr := errors.New("load failed")
+	if err := cache.Refresh(func() (EntityList, error) { return nil, loadErr }); err != loadErr {
+		t.Fatalf("expected load error, got %v", err)
+	}
+	if len(cache.Entities()) != len(kring) {
+		t.Error("failed Refresh should leave the keyring unchanged")
+	}
+}
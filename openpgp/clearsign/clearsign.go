@@ -18,6 +18,7 @@ import (
 	"net/textproto"
 	"strconv"
 
+	"github.com/keybase/go-crypto/openpgp"
 	"github.com/keybase/go-crypto/openpgp/armor"
 	"github.com/keybase/go-crypto/openpgp/errors"
 	"github.com/keybase/go-crypto/openpgp/packet"
@@ -165,6 +166,23 @@ func Decode(data []byte) (b *Block, rest []byte) {
 	return b, rest
 }
 
+// Verify decodes the first clearsigned message in data and checks its
+// signature against kr. On success it returns the signer and the message
+// text, dash-unescaped and with trailing whitespace removed from each line,
+// as it was hashed for signing, apart from using \n line endings.
+// If config is nil, sensible defaults will be used.
+func Verify(data []byte, kr openpgp.KeyRing, config *packet.Config) (*openpgp.Entity, []byte, error) {
+	b, _ := Decode(data)
+	if b == nil {
+		return nil, nil, errors.StructuralError("no clearsigned message found")
+	}
+	signer, err := openpgp.CheckDetachedSignatureWithConfig(kr, bytes.NewReader(b.Bytes), b.ArmoredSignature.Body, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, b.Plaintext, nil
+}
+
 // A dashEscaper is an io.WriteCloser which processes the body of a clear-signed
 // message. The clear-signed message is written to buffered and a hash, suitable
 // for signing, is maintained in h.
@@ -45,6 +45,32 @@ func TestParse(t *testing.T) {
 	testParse(t, clearsignInput2, "\r\n\r\n(This message has a couple of blank lines at the start and end.)\r\n\r\n", "\n\n(This message has a couple of blank lines at the start and end.)\n\n\n")
 }
 
+func TestVerify(t *testing.T) {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(signingKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, plaintext, err := Verify(clearsignInput, keyring, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer != keyring[0] {
+		t.Errorf("unexpected signer %v", signer)
+	}
+	if string(plaintext) != "Hello world\nline 2\n" {
+		t.Errorf("bad plaintext: %q", plaintext)
+	}
+
+	tampered := bytes.Replace(clearsignInput, []byte("Hello world"), []byte("Hello there"), 1)
+	if _, _, err := Verify(tampered, keyring, nil); err == nil {
+		t.Error("tampered message verified")
+	}
+	if _, _, err := Verify([]byte("not clearsigned"), keyring, nil); err == nil {
+		t.Error("expected an error for data without a clearsigned message")
+	}
+}
+
 func TestParseWithNoNewlineAtEnd(t *testing.T) {
 	input := clearsignInput
 	input = input[:len(input)-len("trailing")-1]
@@ -57,6 +83,33 @@ func TestParseWithNoNewlineAtEnd(t *testing.T) {
 	}
 }
 
+func TestDecodeWithTrailingFooter(t *testing.T) {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(signingKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := clearsignInput[:bytes.LastIndex(clearsignInput, []byte("trailing"))]
+	for _, footer := range []string{
+		"-- \nAlice\nSent from my phone\n",
+		"  \r\n\r\n_______________\r\nmailing-list footer\r\n",
+		"-----BEGIN PGP SIGNATURE-----\nnot a signature\n",
+	} {
+		input := append(append([]byte(nil), message...), footer...)
+		b, rest := Decode(input)
+		if b == nil {
+			t.Fatalf("failed to decode clearsigned message followed by %q", footer)
+		}
+		if !bytes.HasSuffix([]byte(footer), rest) || len(rest) == 0 {
+			t.Errorf("got rest %q for footer %q", rest, footer)
+		}
+		if _, plaintext, err := Verify(input, keyring, nil); err != nil {
+			t.Errorf("footer %q: %s", footer, err)
+		} else if string(plaintext) != "Hello world\nline 2\n" {
+			t.Errorf("footer %q: bad plaintext %q", footer, plaintext)
+		}
+	}
+}
+
 var signingTests = []struct {
 	in, signed, plaintext string
 }{
@@ -0,0 +1,170 @@
+package openpgp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keybase/go-crypto/openpgp/packet"
+	"github.com/keybase/go-crypto/ripemd160"
+)
+
+// ColonListing returns a machine-readable listing of e in the format of
+// gpg --with-colons --fixed-list-mode --list-sigs: a pub record for the
+// primary key, followed by uid records for its identities and sub records
+// for its subkeys, each with their signatures in sig and rev records and
+// their fingerprints in fpr records. Only the leading fields that this
+// package can fill in are written. As there is no trust database, the
+// validity of keys and user ids that are neither revoked nor expired at now
+// is unknown ("-").
+func (e *Entity) ColonListing(now time.Time) string {
+	var buf bytes.Buffer
+
+	validity := "-"
+	switch {
+	case e.Revoked(now):
+		validity = "r"
+	case e.primaryKeyExpired(now):
+		validity = "e"
+	}
+
+	caps := colonCapabilities(e.primaryKeyFlags())
+	if validity == "-" {
+		usable := e.primaryKeyFlags()
+		for _, subkey := range e.UsableSubkeys(0, now) {
+			usable |= subkey.Sig.GetKeyFlags().BitField
+		}
+		caps += strings.ToUpper(colonCapabilities(usable))
+	}
+	writeColonKey(&buf, "pub", validity, e.PrimaryKey, e.keyLifetimeSignature(), caps)
+
+	for _, ident := range e.identities() {
+		uidValidity := validity
+		if ident.Revocation != nil && uidValidity == "-" {
+			uidValidity = "r"
+		}
+		h := ripemd160.New()
+		h.Write(ident.UserId.Raw())
+		writeColonRecord(&buf, "uid", uidValidity, "", "", "",
+			colonTime(ident.SelfSignature.CreationTime), "",
+			fmt.Sprintf("%X", h.Sum(nil)), "", colonEscape(ident.Name))
+		e.writeColonSig(&buf, "sig", ident.SelfSignature)
+		for _, sig := range ident.Signatures {
+			e.writeColonSig(&buf, "sig", sig)
+		}
+		if ident.Revocation != nil {
+			e.writeColonSig(&buf, "rev", ident.Revocation)
+		}
+	}
+
+	for _, subkey := range e.Subkeys {
+		subValidity := validity
+		if subValidity == "-" {
+			switch {
+			case subkey.Revoked(now):
+				subValidity = "r"
+			case keyExpired(subkey.PublicKey, subkey.Sig, now):
+				subValidity = "e"
+			}
+		}
+		writeColonKey(&buf, "sub", subValidity, subkey.PublicKey, subkey.Sig,
+			colonCapabilities(subkey.Sig.GetKeyFlags().BitField))
+		e.writeColonSig(&buf, "sig", subkey.Sig)
+		if subkey.Revocation != nil {
+			e.writeColonSig(&buf, "rev", subkey.Revocation)
+		}
+	}
+
+	return buf.String()
+}
+
+// primaryKeyFlags returns the usage flags of e's primary key. As when
+// picking a key for a message, a primary key without key flags is taken to
+// be usable for everything its algorithm allows.
+func (e *Entity) primaryKeyFlags() byte {
+	if selfSig := e.primarySelfSignature(); selfSig != nil && selfSig.FlagsValid {
+		return selfSig.GetKeyFlags().BitField
+	}
+	var flags byte
+	if e.PrimaryKey.PubKeyAlgo.CanSign() {
+		flags |= packet.KeyFlagCertify | packet.KeyFlagSign
+	}
+	if e.PrimaryKey.PubKeyAlgo.CanEncrypt() {
+		flags |= packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage
+	}
+	return flags
+}
+
+func writeColonKey(buf *bytes.Buffer, recordType, validity string, pk *packet.PublicKey, sig *packet.Signature, caps string) {
+	var bits string
+	if bitLength, err := pk.BitLength(); err == nil {
+		bits = strconv.Itoa(int(bitLength))
+	}
+	var expiration string
+	if sig != nil && sig.KeyLifetimeSecs != nil && *sig.KeyLifetimeSecs != 0 {
+		expiration = colonTime(pk.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second))
+	}
+	writeColonRecord(buf, recordType, validity, bits, strconv.Itoa(int(pk.PubKeyAlgo)),
+		pk.KeyIdString(), colonTime(pk.CreationTime), expiration, "", "", "", "", caps)
+	writeColonRecord(buf, "fpr", "", "", "", "", "", "", "", "", fmt.Sprintf("%X", pk.Fingerprint))
+}
+
+func (e *Entity) writeColonSig(buf *bytes.Buffer, recordType string, sig *packet.Signature) {
+	var issuer, signerName string
+	if sig.IssuerKeyId != nil {
+		issuer = fmt.Sprintf("%016X", *sig.IssuerKeyId)
+		if *sig.IssuerKeyId == e.PrimaryKey.KeyId {
+			if ident := e.primaryIdentity(); ident != nil {
+				signerName = colonEscape(ident.Name)
+			}
+		}
+	}
+	var expiration string
+	if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+		expiration = colonTime(sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second))
+	}
+	writeColonRecord(buf, recordType, "", "", strconv.Itoa(int(sig.PubKeyAlgo)), issuer,
+		colonTime(sig.CreationTime), expiration, "", "", signerName,
+		fmt.Sprintf("%02xx", uint8(sig.SigType)))
+}
+
+func writeColonRecord(buf *bytes.Buffer, fields ...string) {
+	buf.WriteString(strings.Join(fields, ":"))
+	buf.WriteString(":\n")
+}
+
+func colonTime(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// colonCapabilities returns the lower case capability letters for the
+// given key flags, in the order used by gpg.
+func colonCapabilities(flags byte) string {
+	var caps string
+	if flags&(packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage) != 0 {
+		caps += "e"
+	}
+	if flags&packet.KeyFlagSign != 0 {
+		caps += "s"
+	}
+	if flags&packet.KeyFlagCertify != 0 {
+		caps += "c"
+	}
+	return caps
+}
+
+// colonEscape escapes s for use in a colon listing field, as gpg does, by
+// writing colons, backslashes and control characters as \xNN.
+func colonEscape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == ':' || c == '\\' || c < 0x20 {
+			fmt.Fprintf(&buf, "\\x%02x", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
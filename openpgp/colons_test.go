@@ -0,0 +1,42 @@
+package openpgp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColonListing(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As listed by gpg --with-colons --fixed-list-mode --list-sigs, up to
+	// the last field that ColonListing fills in.
+	expected := []string{
+		"pub:-:1024:1:A34D7E18C20C31BB:1295801360::::::scESC:",
+		"fpr:::::::::5FB74B1D03B1E3CB31BC2F8AA34D7E18C20C31BB:",
+		"uid:-::::1295801360::0A8ED51B5B38054F9755290D750EA18FEBE97871::Test Key 1 (RSA):",
+		"sig:::1:A34D7E18C20C31BB:1295801360::::Test Key 1 (RSA):13x:",
+		"sub:-:1024:1:FD94408D4543314F:1295801360::::::e:",
+		"fpr:::::::::CFE4A180D580CD6613CA5681FD94408D4543314F:",
+		"sig:::1:A34D7E18C20C31BB:1295801360::::Test Key 1 (RSA):18x:",
+	}
+	listing := kring[0].ColonListing(time.Unix(1500000000, 0))
+	lines := strings.Split(strings.TrimSuffix(listing, "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("got %d records, want %d:\n%s", len(lines), len(expected), listing)
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("record %d: got %q, want %q", i, line, expected[i])
+		}
+	}
+}
+
+func TestColonEscape(t *testing.T) {
+	if got, want := colonEscape("a:b\\c\n"), `a\x3ab\x5cc\x0a`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+// Package eax implements the EAX authenticated encryption mode, as described
+// in "The EAX Mode of Operation" by Bellare, Rogaway and Wagner, for use in
+// OpenPGP AEAD encrypted data packets.
+package eax // import "github.com/keybase/go-crypto/openpgp/eax"
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+const (
+	blockSize = 16
+	nonceSize = 16
+	tagSize   = 16
+)
+
+type eax struct {
+	block  cipher.Block
+	k1, k2 [blockSize]byte // the CMAC subkeys.
+}
+
+// NewEAX returns the block cipher b wrapped in EAX mode, with 16-byte nonces
+// and tags. b must have a block size of 16 bytes.
+func NewEAX(b cipher.Block) (cipher.AEAD, error) {
+	if b.BlockSize() != blockSize {
+		return nil, errors.New("eax: NewEAX requires a 128-bit block cipher")
+	}
+	e := &eax{block: b}
+	b.Encrypt(e.k1[:], e.k1[:])
+	double(&e.k1)
+	e.k2 = e.k1
+	double(&e.k2)
+	return e, nil
+}
+
+func (e *eax) NonceSize() int {
+	return nonceSize
+}
+
+func (e *eax) Overhead() int {
+	return tagSize
+}
+
+func (e *eax) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != nonceSize {
+		panic("eax: incorrect nonce length given to EAX")
+	}
+	n := e.omac(0, nonce)
+	ret, out := sliceForAppend(dst, len(plaintext)+tagSize)
+	cipher.NewCTR(e.block, n[:]).XORKeyStream(out, plaintext)
+
+	tag := e.tag(n, out[:len(plaintext)], additionalData)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (e *eax) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != nonceSize {
+		panic("eax: incorrect nonce length given to EAX")
+	}
+	if len(ciphertext) < tagSize {
+		return nil, errors.New("eax: message authentication failed")
+	}
+	n := e.omac(0, nonce)
+	body := ciphertext[:len(ciphertext)-tagSize]
+	tag := e.tag(n, body, additionalData)
+	if subtle.ConstantTimeCompare(tag[:], ciphertext[len(body):]) != 1 {
+		return nil, errors.New("eax: message authentication failed")
+	}
+
+	ret, out := sliceForAppend(dst, len(body))
+	cipher.NewCTR(e.block, n[:]).XORKeyStream(out, body)
+	return ret, nil
+}
+
+// tag computes the authentication tag of ciphertext and additionalData,
+// given the OMAC of the nonce.
+func (e *eax) tag(n [blockSize]byte, ciphertext, additionalData []byte) [blockSize]byte {
+	h := e.omac(1, additionalData)
+	c := e.omac(2, ciphertext)
+	for i := range n {
+		n[i] ^= h[i] ^ c[i]
+	}
+	return n
+}
+
+// omac computes the CMAC of data prefixed with a block holding t, which
+// EAX uses to derive three independent MACs from a single key.
+func (e *eax) omac(t byte, data []byte) [blockSize]byte {
+	var x [blockSize]byte
+	x[blockSize-1] = t
+	for len(data) > 0 {
+		e.block.Encrypt(x[:], x[:])
+		n := copy(x[:], xorBytes(x[:], data))
+		data = data[n:]
+		if n < blockSize {
+			// A partial final block is padded with a single one
+			// bit followed by zeros.
+			x[n] ^= 0x80
+			xorInto(&x, &e.k2)
+			e.block.Encrypt(x[:], x[:])
+			return x
+		}
+	}
+	xorInto(&x, &e.k1)
+	e.block.Encrypt(x[:], x[:])
+	return x
+}
+
+// xorBytes returns the first min(len(a), len(b)) bytes of a xor b.
+func xorBytes(a, b []byte) []byte {
+	if len(b) < len(a) {
+		a = a[:len(b)]
+	}
+	out := make([]byte, len(a))
+	for i := range out {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+func xorInto(x, k *[blockSize]byte) {
+	for i := range x {
+		x[i] ^= k[i]
+	}
+}
+
+// double multiplies k by x in GF(2^128), as CMAC does to derive its
+// subkeys.
+func double(k *[blockSize]byte) {
+	msb := k[0] >> 7
+	for i := 0; i < blockSize-1; i++ {
+		k[i] = k[i]<<1 | k[i+1]>>7
+	}
+	k[blockSize-1] = k[blockSize-1]<<1 ^ msb*0x87
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and
+// a second slice that aliases into it and contains only the extra bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,72 @@
+package eax
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+// These test vectors have been taken from "The EAX Mode of Operation",
+// appendix A.
+var eaxTestVectors = []struct {
+	key, nonce, header, plaintext, ciphertext string
+}{
+	{
+		"233952DEE4D5ED5F9B9C6D6FF80FF478",
+		"62EC67F9C3A4A407FCB2A8C49031A8B3",
+		"6BFB914FD07EAE6B",
+		"",
+		"E037830E8389F27B025A2D6527E79D01",
+	}, {
+		"91945D3F4DCBEE0BF45EF52255F095A4",
+		"BECAF043B0A23D843194BA972C66DEBD",
+		"FA3BFD4806EB53FA",
+		"F7FB",
+		"19DD5C4C9331049D0BDAB0277408F67967E5",
+	}, {
+		"01F74AD64077F2E704C0F60ADA3DD523",
+		"70C3DB4F0D26368400A10ED05D2BFF5E",
+		"234A3463C1264AC6",
+		"1A47CB4933",
+		"D851D5BAE03A59F238A23E39199DC9266626C40F80",
+	},
+}
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestEAX(t *testing.T) {
+	for i, test := range eaxTestVectors {
+		block, err := aes.NewCipher(fromHex(test.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead, err := NewEAX(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce, header := fromHex(test.nonce), fromHex(test.header)
+		plaintext, ciphertext := fromHex(test.plaintext), fromHex(test.ciphertext)
+
+		if got := aead.Seal(nil, nonce, plaintext, header); !bytes.Equal(got, ciphertext) {
+			t.Errorf("#%d: got ciphertext %X, want %X", i, got, ciphertext)
+		}
+		got, err := aead.Open(nil, nonce, ciphertext, header)
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+		} else if !bytes.Equal(got, plaintext) {
+			t.Errorf("#%d: got plaintext %X, want %X", i, got, plaintext)
+		}
+
+		ciphertext[len(ciphertext)-1] ^= 1
+		if _, err := aead.Open(nil, nonce, ciphertext, header); err == nil {
+			t.Errorf("#%d: modified ciphertext was accepted", i)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package openpgp
+package openpgp_test
 
 import (
 	"bytes"
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/keybase/go-crypto/ed25519"
+	"github.com/keybase/go-crypto/openpgp"
 	"github.com/keybase/go-crypto/openpgp/armor"
 	"github.com/keybase/go-crypto/openpgp/clearsign"
 	"github.com/keybase/go-crypto/openpgp/packet"
@@ -28,7 +29,7 @@ NyJqNA4=
 func TestEd25519RoundTrip(t *testing.T) {
 	testString := "test okokokokokok"
 
-	entities, err := ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey))
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey))
 	if err != nil {
 		t.Fatalf("error opening keys: %v", err)
 	}
@@ -43,7 +44,7 @@ func TestEd25519RoundTrip(t *testing.T) {
 		t.Fatalf("expected PublicKey to be of type ed25519.PublicKey, got %T", pk)
 	}
 	buf := new(bytes.Buffer)
-	err = ArmoredDetachSign(buf, entities[0], bytes.NewBufferString(testString), nil)
+	err = openpgp.ArmoredDetachSign(buf, entities[0], bytes.NewBufferString(testString), nil)
 	if err != nil {
 		t.Fatalf("ArmoredDetachSign fail: %v", err)
 	}
@@ -73,7 +74,7 @@ func TestEd25519RoundTrip(t *testing.T) {
 }
 
 func TestEd25519BitLength(t *testing.T) {
-	entities, _ := ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey))
+	entities, _ := openpgp.ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey))
 	bitLen, err := entities[0].PrimaryKey.BitLength()
 	if err != nil {
 		t.Fatalf("error in BitLength(): %v", err)
@@ -128,12 +129,12 @@ iF4EARYIAAYFAli5YNYACgkQH8B3H/TuEEdFsQEAzTu7RlxmXuZXn4ZDrGHDmm+O
 func readKeysAndCheckSig(clearsigned string, t *testing.T) (err error) {
 	block, _ := clearsign.Decode(bytes.NewBufferString(clearsigned).Bytes())
 
-	entities, err := ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey))
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey))
 	if err != nil {
 		t.Fatalf("error opening keys: %v", err)
 	}
 
-	_, err = CheckDetachedSignature(entities, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body)
+	_, err = openpgp.CheckDetachedSignature(entities, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body)
 	return err
 }
 
@@ -181,7 +182,7 @@ func TestEd25519SerializeKey(t *testing.T) {
 	// Exporting requires us to sign identities and subkeys properly.
 	// If either signing or veryfing does not work, re-importing will fail.
 
-	entities, err := ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey2))
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey2))
 	if err != nil {
 		t.Fatalf("error opening keys: %v", err)
 	}
@@ -199,12 +200,15 @@ func TestEd25519SerializeKey(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	armored, err := rawToArmored(buf.Bytes(), true)
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, "PGP PRIVATE KEY BLOCK", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
+	w.Write(buf.Bytes())
+	w.Close()
 
-	entities, err = ReadArmoredKeyRing(strings.NewReader(armored))
+	entities, err = openpgp.ReadArmoredKeyRing(&armored)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -240,7 +244,7 @@ RsjkLnDJvlLkWvcwC0Hotet7AHO09IMVnYlBCAM/bVXeCGaHy5OOEVai7g7Q8zM=
 func TestEd25519ReadMessage(t *testing.T) {
 	const expectedStr = "looks like its working"
 
-	entities, err := ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey2))
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(ed25519SecretKey2))
 	if err != nil {
 		t.Fatalf("error opening keys: %v", err)
 	}
@@ -249,7 +253,7 @@ func TestEd25519ReadMessage(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error decoding resulting armor: %v", err)
 	}
-	md, err := ReadMessage(block.Body, entities, nil, nil)
+	md, err := openpgp.ReadMessage(block.Body, entities, nil, nil)
 	if err != nil {
 		t.Fatalf("error in ReadMessage: %v", err)
 	}
@@ -313,12 +317,12 @@ AQCR7HWES/PlR1gh33cgHCaCgaVt7TajaSCsj2VmC4StAA==
 func TestEd25519InvalidKeys(t *testing.T) {
 	const expectedStr = "looks like its working"
 
-	_, err := ReadArmoredKeyRing(strings.NewReader(invalidEddsaKey))
+	_, err := openpgp.ReadArmoredKeyRing(strings.NewReader(invalidEddsaKey))
 	if err == nil {
 		t.Fatalf("key should not parse")
 	}
 
-	_, err = ReadArmoredKeyRing(strings.NewReader(invalidEddsaKey2))
+	_, err = openpgp.ReadArmoredKeyRing(strings.NewReader(invalidEddsaKey2))
 	if err == nil {
 		t.Fatalf("key should not parse")
 	}
@@ -345,7 +349,7 @@ AC0Xg++AATao
 -----END PGP PUBLIC KEY BLOCK-----`
 
 func TestEd25519Malformed(t *testing.T) {
-	entities, err := ReadArmoredKeyRing(strings.NewReader(malformedEddsaKey))
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(malformedEddsaKey))
 	if err != nil {
 		t.Fatalf("error opening keys: %v", err)
 	}
@@ -383,7 +387,7 @@ XQyj6vTI33IBAJ/i8LPFWr0izwEMugh+M0OPBaq8RFatsDDZD5K8WgIJ
 `
 
 func TestEd25519Malformed2(t *testing.T) {
-	entities, err := ReadArmoredKeyRing(strings.NewReader(malformedEddsaKey2))
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(malformedEddsaKey2))
 	if err != nil || len(entities) != 1 {
 		t.Fatalf("error opening keys: %v", err)
 	}
@@ -6,7 +6,9 @@
 package errors // import "github.com/keybase/go-crypto/openpgp/errors"
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 )
 
 // A StructuralError is returned when OpenPGP data is found to be syntactically
@@ -41,6 +43,15 @@ func (b SignatureError) Error() string {
 	return "openpgp: invalid signature: " + string(b)
 }
 
+// PolicyError indicates that a signature or key, although valid, was
+// rejected by the policy given in the packet.Config, such as a minimum key
+// size.
+type PolicyError string
+
+func (p PolicyError) Error() string {
+	return "openpgp: rejected by policy: " + string(p)
+}
+
 type keyIncorrectError int
 
 func (ki keyIncorrectError) Error() string {
@@ -49,6 +60,50 @@ func (ki keyIncorrectError) Error() string {
 
 var ErrKeyIncorrect error = keyIncorrectError(0)
 
+// NoMatchingKeyError is returned when a message could not be decrypted by
+// any of the private keys available to the reader.
+type NoMatchingKeyError struct {
+	// EncryptedToKeyIds lists the key ids the message is encrypted to.
+	// An id of zero denotes an anonymous recipient.
+	EncryptedToKeyIds []uint64
+	// TriedKeyIds lists the key ids of the private keys that were tried,
+	// in increasing order: those that matched a recipient, and the other
+	// decryption keys of the keyring.
+	TriedKeyIds []uint64
+	// Errors maps the key id of each tried private key to the reason
+	// decrypting with that key failed.
+	Errors map[uint64]error
+}
+
+func (e *NoMatchingKeyError) Error() string {
+	s := "openpgp: incorrect key: message is encrypted to " + formatKeyIds(e.EncryptedToKeyIds) +
+		", tried " + formatKeyIds(e.TriedKeyIds)
+	for _, id := range e.TriedKeyIds {
+		if err, ok := e.Errors[id]; ok {
+			s += fmt.Sprintf("; %X: %s", id, err)
+		}
+	}
+	return s
+}
+
+// Unwrap returns ErrKeyIncorrect, which was returned in place of a
+// NoMatchingKeyError before, so that errors.Is(err, ErrKeyIncorrect) still
+// holds for it.
+func (e *NoMatchingKeyError) Unwrap() error {
+	return ErrKeyIncorrect
+}
+
+func formatKeyIds(ids []uint64) string {
+	if len(ids) == 0 {
+		return "no keys"
+	}
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = fmt.Sprintf("%X", id)
+	}
+	return strings.Join(strs, ", ")
+}
+
 type unknownIssuerError int
 
 func (unknownIssuerError) Error() string {
@@ -57,6 +112,58 @@ func (unknownIssuerError) Error() string {
 
 var ErrUnknownIssuer error = unknownIssuerError(0)
 
+type keyCannotSignError int
+
+func (keyCannotSignError) Error() string {
+	return "openpgp: signature made by a key that isn't allowed to sign"
+}
+
+// ErrKeyCannotSign is returned when the key that made a signature is
+// known, but its key flags don't include the signing capability.
+var ErrKeyCannotSign error = keyCannotSignError(0)
+
+type unsignedMessageError int
+
+func (unsignedMessageError) Error() string {
+	return "openpgp: message is not signed"
+}
+
+// ErrUnsignedMessage is returned when reading a message that carries no
+// signature while packet.Config.RequireSignature is set.
+var ErrUnsignedMessage error = unsignedMessageError(0)
+
+type unprotectedMessageError int
+
+func (unprotectedMessageError) Error() string {
+	return "openpgp: message is not integrity protected"
+}
+
+// ErrUnprotectedMessage is returned when reading a message that is
+// encrypted without a modification detection code while
+// packet.Config.RejectUnprotected is set.
+var ErrUnprotectedMessage error = unprotectedMessageError(0)
+
+type missingIssuerFingerprintError int
+
+func (missingIssuerFingerprintError) Error() string {
+	return "openpgp: signature has no issuer fingerprint"
+}
+
+// ErrMissingIssuerFingerprint is returned when a signature carries no
+// issuer fingerprint subpacket while
+// packet.Config.RequireIssuerFingerprint is set.
+var ErrMissingIssuerFingerprint error = missingIssuerFingerprintError(0)
+
+type signatureExpiredError int
+
+func (signatureExpiredError) Error() string {
+	return "openpgp: signature expired"
+}
+
+// ErrSignatureExpired is returned when a signature is otherwise valid but
+// its expiration time has passed.
+var ErrSignatureExpired error = signatureExpiredError(0)
+
 type keyRevokedError int
 
 func (keyRevokedError) Error() string {
@@ -65,6 +172,42 @@ func (keyRevokedError) Error() string {
 
 var ErrKeyRevoked error = keyRevokedError(0)
 
+type ecdhKDFMismatchError int
+
+func (ecdhKDFMismatchError) Error() string {
+	return "openpgp: ECDH key unwrap failed: KDF parameters do not match"
+}
+
+// ErrECDHKDFMismatch is returned when the key encryption key derived for an
+// ECDH recipient fails to unwrap the session key, but one derived with other
+// KDF parameters does. This happens when the message was encrypted using
+// different KDF parameters than those of the decrypting key, as opposed to
+// the session key being corrupt or wrapped for another key, which gives
+// ErrKeyIncorrect.
+var ErrECDHKDFMismatch error = ecdhKDFMismatchError(0)
+
+type privateKeyMismatchError int
+
+func (privateKeyMismatchError) Error() string {
+	return "openpgp: private key doesn't match its public key"
+}
+
+// ErrPrivateKeyMismatch is returned by packet.PrivateKey.Validate when the
+// secret key material doesn't belong to the public key.
+var ErrPrivateKeyMismatch error = privateKeyMismatchError(0)
+
+type onePassSignatureHashMismatchError int
+
+func (onePassSignatureHashMismatchError) Error() string {
+	return "openpgp: signature hash doesn't match its one-pass signature"
+}
+
+// ErrOnePassSignatureHashMismatch is returned when the signature that ends a
+// signed message uses a different hash function than the one announced by
+// its OnePassSignature packet, so the message wasn't hashed the way the
+// signature requires.
+var ErrOnePassSignatureHashMismatch error = onePassSignatureHashMismatchError(0)
+
 type UnknownPacketTypeError uint8
 
 func (upte UnknownPacketTypeError) Error() string {
@@ -5,12 +5,26 @@
 package openpgp
 
 import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
+	"crypto/rand"
+	gorsa "crypto/rsa"
 	"encoding/binary"
+	"fmt"
 	"io"
+	"math/big"
+	"sort"
+	"strconv"
 	"time"
 
+	"github.com/keybase/go-crypto/ed25519"
 	"github.com/keybase/go-crypto/openpgp/armor"
+	"github.com/keybase/go-crypto/openpgp/elgamal"
 	"github.com/keybase/go-crypto/openpgp/errors"
 	"github.com/keybase/go-crypto/openpgp/packet"
 	"github.com/keybase/go-crypto/rsa"
@@ -37,6 +51,28 @@ type Entity struct {
 	UnverifiedRevocations []*packet.Signature
 	Subkeys               []Subkey
 	BadSubkeys            []BadSubkey
+	BadSelfSignatures     []BadSelfSignature
+
+	// DirectSignature is the newest direct-key self-signature (type
+	// 0x1F) of the primary key, if any. The key flags, key expiration,
+	// features and algorithm preferences it carries apply when the
+	// self-signature of the primary identity doesn't state them.
+	DirectSignature *packet.Signature
+	// OtherDirectSignatures holds the other valid direct-key
+	// self-signatures of the primary key, such as older ones or those
+	// naming designated revokers, so that they are written out again
+	// when e is serialized.
+	OtherDirectSignatures []*packet.Signature
+
+	// UnknownPackets records, as warnings, the packets of types this
+	// package doesn't know, such as those of newer versions of OpenPGP,
+	// that were skipped while reading the entity. The packets around
+	// them are read as if they weren't there.
+	UnknownPackets []errors.UnknownPacketTypeError
+
+	// userIds holds every user id packet read with the entity, in
+	// order, including those without a valid self-signature.
+	userIds []*packet.UserId
 }
 
 // An Identity represents an identity claimed by an Entity and zero or more
@@ -58,6 +94,70 @@ type Subkey struct {
 	Revocation *packet.Signature
 }
 
+// Revoked reports whether the subkey had been revoked by now, that is,
+// whether it has a valid revocation signature created no later than now.
+// It doesn't consider revocations of the primary key; see Entity.Revoked.
+func (s *Subkey) Revoked(now time.Time) bool {
+	return s.Revocation != nil && !s.Revocation.CreationTime.After(now)
+}
+
+// HardRevoked reports whether the subkey has a hard revocation, see
+// packet.Signature.IsHardRevocation, which means that it may have been
+// compromised, so that even signatures it made before the revocation
+// shouldn't be trusted.
+func (s *Subkey) HardRevoked() bool {
+	return s.Revocation != nil && s.Revocation.IsHardRevocation()
+}
+
+// FingerprintString returns the fingerprint of the subkey in capital hex,
+// as shown by gpg --with-subkey-fingerprints.
+func (s *Subkey) FingerprintString() string {
+	return fmt.Sprintf("%X", s.PublicKey.Fingerprint)
+}
+
+// BindingAlgorithms returns the public key algorithm and hash function of
+// the binding signature of the subkey.
+func (s *Subkey) BindingAlgorithms() (pub packet.PublicKeyAlgorithm, hash crypto.Hash) {
+	return s.Sig.PubKeyAlgo, s.Sig.Hash
+}
+
+// UserIdInfo describes a user id claimed by an Entity.
+type UserIdInfo struct {
+	Name   string
+	UserId *packet.UserId
+	// Verified is true if the user id has a valid self-signature, and
+	// so also appears in Entity.Identities.
+	Verified bool
+}
+
+// AllUserIds returns every user id of e, including those that were dropped
+// from e.Identities while reading the key because their self-signature was
+// missing or invalid. User ids read with the key come first, in the order
+// they were read.
+func (e *Entity) AllUserIds() []UserIdInfo {
+	var infos []UserIdInfo
+	seen := make(map[string]bool)
+	for _, uid := range e.userIds {
+		if seen[uid.Id] {
+			continue
+		}
+		seen[uid.Id] = true
+		_, verified := e.Identities[uid.Id]
+		infos = append(infos, UserIdInfo{Name: uid.Id, UserId: uid, Verified: verified})
+	}
+	var added []string
+	for name := range e.Identities {
+		if !seen[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		infos = append(infos, UserIdInfo{Name: name, UserId: e.Identities[name].UserId, Verified: true})
+	}
+	return infos
+}
+
 // BadSubkey is one that failed reconstruction, but we'll keep it around for
 // informational purposes.
 type BadSubkey struct {
@@ -65,6 +165,15 @@ type BadSubkey struct {
 	Err error
 }
 
+// BadSelfSignature is a self-signature over a user id that failed to
+// verify while the entity was read. It is kept so that the reason a user id
+// wasn't accepted can be explained.
+type BadSelfSignature struct {
+	Name      string
+	Signature *packet.Signature
+	Err       error
+}
+
 // A Key identifies a specific public key in an Entity. This is either the
 // Entity's primary key or a subkey.
 type Key struct {
@@ -102,7 +211,7 @@ type KeyRing interface {
 // if none are so marked.
 func (e *Entity) primaryIdentity() *Identity {
 	var firstIdentity *Identity
-	for _, ident := range e.Identities {
+	for _, ident := range e.identities() {
 		if firstIdentity == nil {
 			firstIdentity = ident
 		}
@@ -113,6 +222,103 @@ func (e *Entity) primaryIdentity() *Identity {
 	return firstIdentity
 }
 
+// primarySelfSignature returns the self-signature of e's primary identity,
+// or nil if e has no identities. Key flags, features and algorithm
+// preferences missing from it are filled in from e's direct-key signature,
+// in a copy, so that callers needn't look in both places. The key lifetime
+// isn't, as it counts from a different time; see primaryKeyExpired.
+func (e *Entity) primarySelfSignature() *packet.Signature {
+	ident := e.primaryIdentity()
+	if ident == nil {
+		return nil
+	}
+	direct := e.DirectSignature
+	if direct == nil {
+		return ident.SelfSignature
+	}
+	sig := *ident.SelfSignature
+	if !sig.FlagsValid && direct.FlagsValid {
+		sig.FlagsValid = true
+		sig.FlagCertify = direct.FlagCertify
+		sig.FlagSign = direct.FlagSign
+		sig.FlagEncryptCommunications = direct.FlagEncryptCommunications
+		sig.FlagEncryptStorage = direct.FlagEncryptStorage
+	}
+	if !sig.MDC && !sig.AEAD {
+		sig.MDC, sig.AEAD = direct.MDC, direct.AEAD
+	}
+	if len(sig.PreferredSymmetric) == 0 {
+		sig.PreferredSymmetric = direct.PreferredSymmetric
+	}
+	if len(sig.PreferredHash) == 0 {
+		sig.PreferredHash = direct.PreferredHash
+	}
+	if len(sig.PreferredCompression) == 0 {
+		sig.PreferredCompression = direct.PreferredCompression
+	}
+	if len(sig.PreferredAEAD) == 0 {
+		sig.PreferredAEAD = direct.PreferredAEAD
+	}
+	return &sig
+}
+
+// keyLifetimeSignature returns the self-signature that states the lifetime
+// of e's primary key: that of the primary identity or, if it doesn't state
+// one, the direct-key signature. It returns nil if neither does.
+func (e *Entity) keyLifetimeSignature() *packet.Signature {
+	if ident := e.primaryIdentity(); ident != nil && ident.SelfSignature.KeyLifetimeSecs != nil {
+		return ident.SelfSignature
+	}
+	if e.DirectSignature != nil && e.DirectSignature.KeyLifetimeSecs != nil {
+		return e.DirectSignature
+	}
+	return nil
+}
+
+// primaryKeyExpired returns whether e's primary key had expired by now. The
+// lifetime given by a direct-key signature counts from the creation of the
+// key, as in RFC 4880, section 5.2.3.6.
+func (e *Entity) primaryKeyExpired(now time.Time) bool {
+	sig := e.keyLifetimeSignature()
+	if sig == nil {
+		return false
+	}
+	if sig == e.DirectSignature {
+		return keyExpired(e.PrimaryKey, sig, now)
+	}
+	return sig.KeyExpired(now)
+}
+
+// keyExpired returns whether pk, with the key lifetime given by sig, had
+// expired at now. The lifetime counts from the creation of the key.
+func keyExpired(pk *packet.PublicKey, sig *packet.Signature, now time.Time) bool {
+	if sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return false
+	}
+	return now.After(pk.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second))
+}
+
+// PrimaryIdentity returns the identity marked as the primary user id, or the
+// first identity if none is marked. If several are marked, the first of them
+// is returned, in the order the user ids were read, so the choice doesn't
+// change when the entity is serialized and read again.
+func (e *Entity) PrimaryIdentity() *Identity {
+	return e.primaryIdentity()
+}
+
+// identities returns the identities of e in a stable order: those read with
+// the key in the order they were read, followed by any added since, sorted by
+// name.
+func (e *Entity) identities() []*Identity {
+	idents := make([]*Identity, 0, len(e.Identities))
+	for _, info := range e.AllUserIds() {
+		if info.Verified {
+			idents = append(idents, e.Identities[info.Name])
+		}
+	}
+	return idents
+}
+
 // encryptionKey returns the best candidate Key for encrypting a message to the
 // given Entity.
 func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
@@ -120,7 +326,6 @@ func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
 
 	// Iterate the keys to find the newest, non-revoked key that can
 	// encrypt.
-	var maxTime time.Time
 	for i, subkey := range e.Subkeys {
 
 		// NOTE(maxtaco)
@@ -139,9 +344,8 @@ func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
 			subkey.PublicKey.PubKeyAlgo.CanEncrypt() &&
 			!subkey.Sig.KeyExpired(now) &&
 			subkey.Revocation == nil &&
-			(maxTime.IsZero() || subkey.Sig.CreationTime.After(maxTime)) {
+			(candidateSubkey == -1 || newerSubkey(subkey, e.Subkeys[candidateSubkey])) {
 			candidateSubkey = i
-			maxTime = subkey.Sig.CreationTime
 		}
 	}
 
@@ -158,16 +362,31 @@ func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
 	// NOTE(maxtaco) - see note above, how this policy is a little too open-ended
 	// for my liking, but leave it for now.
 	i := e.primaryIdentity()
-	if (!i.SelfSignature.FlagsValid || i.SelfSignature.FlagEncryptCommunications) &&
+	selfSig := e.primarySelfSignature()
+	if (!selfSig.FlagsValid || selfSig.FlagEncryptCommunications) &&
 		e.PrimaryKey.PubKeyAlgo.CanEncrypt() &&
-		!i.SelfSignature.KeyExpired(now) {
-		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature, i.SelfSignature.GetKeyFlags()}, true
+		!e.primaryKeyExpired(now) {
+		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature, selfSig.GetKeyFlags()}, true
 	}
 
 	// This Entity appears to be signing only.
 	return Key{}, false
 }
 
+// newerSubkey reports whether a should be preferred over b as the newer
+// subkey: the one whose binding signature was made later, then the one
+// created later. Ties are broken by fingerprint so that the choice doesn't
+// depend on the order of the subkeys in the key.
+func newerSubkey(a, b Subkey) bool {
+	if !a.Sig.CreationTime.Equal(b.Sig.CreationTime) {
+		return a.Sig.CreationTime.After(b.Sig.CreationTime)
+	}
+	if !a.PublicKey.CreationTime.Equal(b.PublicKey.CreationTime) {
+		return a.PublicKey.CreationTime.After(b.PublicKey.CreationTime)
+	}
+	return bytes.Compare(a.PublicKey.Fingerprint[:], b.PublicKey.Fingerprint[:]) > 0
+}
+
 // signingKey return the best candidate Key for signing a message with this
 // Entity.
 func (e *Entity) signingKey(now time.Time) (Key, bool) {
@@ -178,7 +397,7 @@ func (e *Entity) signingKey(now time.Time) (Key, bool) {
 	var maxTime time.Time
 	for i, subkey := range e.Subkeys {
 		if (!subkey.Sig.FlagsValid || subkey.Sig.FlagSign) &&
-			subkey.PrivateKey.PrivateKey != nil &&
+			subkey.PrivateKey != nil && subkey.PrivateKey.PrivateKey != nil &&
 			subkey.PublicKey.PubKeyAlgo.CanSign() &&
 			!subkey.Sig.KeyExpired(now) &&
 			subkey.Revocation == nil &&
@@ -195,18 +414,267 @@ func (e *Entity) signingKey(now time.Time) (Key, bool) {
 	}
 
 	// If we have no candidate subkey then we assume that it's ok to sign
-	// with the primary key.
+	// with the primary key, unless its key flags say otherwise.
 	i := e.primaryIdentity()
-	if (!i.SelfSignature.FlagsValid || i.SelfSignature.FlagSign) &&
+	selfSig := e.primarySelfSignature()
+	if (!selfSig.FlagsValid || selfSig.FlagSign) &&
 		e.PrimaryKey.PubKeyAlgo.CanSign() &&
-		!i.SelfSignature.KeyExpired(now) &&
-		e.PrivateKey.PrivateKey != nil {
-		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature, i.SelfSignature.GetKeyFlags()}, true
+		!e.primaryKeyExpired(now) &&
+		e.PrivateKey != nil && e.PrivateKey.PrivateKey != nil {
+		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature, selfSig.GetKeyFlags()}, true
 	}
 
 	return Key{}, false
 }
 
+// UsableSubkeys returns every subkey of e that isn't revoked or expired at
+// now and can be used for all of the purposes in usage, a combination of the
+// packet.KeyFlag* constants. As when picking a key for a message, subkeys
+// without key flags are taken to be usable for encryption if they are ElGamal
+// keys, and for signing otherwise, if their algorithm can sign.
+func (e *Entity) UsableSubkeys(usage byte, now time.Time) []Subkey {
+	var subkeys []Subkey
+	for _, subkey := range e.Subkeys {
+		if subkey.Revocation != nil || subkey.Sig.KeyExpired(now) {
+			continue
+		}
+
+		var flags byte
+		switch algo := subkey.PublicKey.PubKeyAlgo; {
+		case subkey.Sig.FlagsValid:
+			flags = subkey.Sig.GetKeyFlags().BitField
+		case algo == packet.PubKeyAlgoElGamal:
+			flags = packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage
+		default:
+			flags = packet.KeyFlagSign
+		}
+		if !subkey.PublicKey.PubKeyAlgo.CanEncrypt() {
+			flags &^= packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage
+		}
+		if !subkey.PublicKey.PubKeyAlgo.CanSign() {
+			flags &^= packet.KeyFlagSign
+		}
+
+		if flags&usage == usage {
+			subkeys = append(subkeys, subkey)
+		}
+	}
+	return subkeys
+}
+
+// WeakBindingSignatures returns the subkeys of e whose binding signature,
+// the most recent valid one read with the key, uses the weak SHA-1 or MD5
+// hash. Such subkeys should be bound again with a stronger hash.
+func (e *Entity) WeakBindingSignatures() []*Subkey {
+	var weak []*Subkey
+	for i := range e.Subkeys {
+		switch e.Subkeys[i].Sig.Hash {
+		case crypto.SHA1, crypto.MD5:
+			weak = append(weak, &e.Subkeys[i])
+		}
+	}
+	return weak
+}
+
+// Revoked reports whether the primary key of e had been revoked by now, that
+// is, whether it has a valid revocation signature created no later than now.
+func (e *Entity) Revoked(now time.Time) bool {
+	for _, r := range e.Revocations {
+		if !r.CreationTime.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// HardRevoked reports whether the primary key of e has a hard revocation,
+// see packet.Signature.IsHardRevocation, which means that it may have been
+// compromised, so that even signatures it made before the revocation
+// shouldn't be trusted.
+func (e *Entity) HardRevoked() bool {
+	for _, r := range e.Revocations {
+		if r.IsHardRevocation() {
+			return true
+		}
+	}
+	return false
+}
+
+// revokedAt reports whether a signature made by k at t must be rejected
+// because k is revoked: a hard revocation of k, or of the primary key of its
+// entity, revokes it at any time, while a soft one only revokes it from the
+// creation of the revocation on.
+func (k Key) revokedAt(t time.Time) bool {
+	if k.Entity.HardRevoked() || k.Entity.Revoked(t) {
+		return true
+	}
+	for _, subkey := range k.Entity.Subkeys {
+		if subkey.PublicKey == k.PublicKey {
+			return subkey.HardRevoked() || subkey.Revoked(t)
+		}
+	}
+	return false
+}
+
+// hardRevoked reports whether k, or the primary key of its entity, has a
+// hard revocation.
+func (k Key) hardRevoked() bool {
+	if k.Entity.HardRevoked() {
+		return true
+	}
+	for _, subkey := range k.Entity.Subkeys {
+		if subkey.PublicKey == k.PublicKey {
+			return subkey.HardRevoked()
+		}
+	}
+	return false
+}
+
+// CanCertify reports whether the primary key of e may make certifications,
+// such as the self-signature of a new user id, at now. That is the case when
+// the primary key can sign, isn't revoked or expired, and the key flags of
+// its primary self-signature include the certify flag. A self-signature
+// without key flags allows certifying.
+func (e *Entity) CanCertify(now time.Time) bool {
+	if len(e.Revocations) > 0 || !e.PrimaryKey.PubKeyAlgo.CanSign() {
+		return false
+	}
+	selfSig := e.primarySelfSignature()
+	if selfSig == nil || e.primaryKeyExpired(now) {
+		return false
+	}
+	return !selfSig.FlagsValid || selfSig.FlagCertify
+}
+
+// SelfConsistent reports whether e is fully consistent with its own primary
+// key, for gating imports. That is the case when e has at least one
+// identity, the self-signature of every identity and the binding signature
+// of every subkey verify, none of its user ids or subkeys were dropped as
+// bad when e was read, and every revocation verifies and was made no earlier
+// than the key it revokes. Otherwise it returns false and a reason for each
+// problem found.
+func (e *Entity) SelfConsistent() (bool, []error) {
+	var errs []error
+	fail := func(what string, err error) {
+		errs = append(errs, errors.StructuralError(what+": "+err.Error()))
+	}
+	checkRevocation := func(what string, revoked *packet.PublicKey, sig *packet.Signature, verify func() error) {
+		if err := verify(); err != nil {
+			fail(what+" revocation invalid", err)
+		} else if sig.CreationTime.Before(revoked.CreationTime) {
+			errs = append(errs, errors.StructuralError(what+" revocation predates the key"))
+		}
+	}
+
+	if len(e.Identities) == 0 {
+		errs = append(errs, errors.StructuralError("entity has no identities"))
+	}
+	for name, ident := range e.Identities {
+		what := "user id " + strconv.Quote(name)
+		if ident.SelfSignature == nil {
+			errs = append(errs, errors.StructuralError(what+" has no self-signature"))
+		} else if err := e.PrimaryKey.VerifyUserIdSignature(name, e.PrimaryKey, ident.SelfSignature); err != nil {
+			fail(what+" self-signature invalid", err)
+		}
+		if rev := ident.Revocation; rev != nil {
+			checkRevocation(what, e.PrimaryKey, rev, func() error {
+				return e.PrimaryKey.VerifyUserIdSignature(name, e.PrimaryKey, rev)
+			})
+		}
+	}
+	for _, bad := range e.BadSelfSignatures {
+		fail("user id "+strconv.Quote(bad.Name)+" dropped", bad.Err)
+	}
+
+	for _, rev := range e.Revocations {
+		checkRevocation("primary key", e.PrimaryKey, rev, func() error {
+			return e.PrimaryKey.VerifyRevocationSignature(e.PrimaryKey, rev)
+		})
+	}
+
+	for _, subkey := range e.Subkeys {
+		what := "subkey " + subkey.PublicKey.KeyIdString()
+		if subkey.Sig == nil {
+			errs = append(errs, errors.StructuralError(what+" has no binding signature"))
+		} else if err := e.PrimaryKey.VerifyKeySignature(subkey.PublicKey, subkey.Sig); err != nil {
+			fail(what+" binding signature invalid", err)
+		}
+		if rev := subkey.Revocation; rev != nil {
+			checkRevocation(what, subkey.PublicKey, rev, func() error {
+				return e.PrimaryKey.VerifyKeySignature(subkey.PublicKey, rev)
+			})
+		}
+	}
+	for _, bad := range e.BadSubkeys {
+		fail("subkey "+bad.PublicKey.KeyIdString()+" dropped", bad.Err)
+	}
+
+	return len(errs) == 0, errs
+}
+
+// externalSigningKey returns the signing key of e whose public key matches
+// es. Unlike signingKey it does not require e to hold private key material,
+// since the private key operation is delegated to es.
+func (e *Entity) externalSigningKey(now time.Time, es packet.ExternalSigner) (*packet.PrivateKey, bool) {
+	pub := es.Public()
+
+	for _, subkey := range e.Subkeys {
+		if (!subkey.Sig.FlagsValid || subkey.Sig.FlagSign) &&
+			subkey.PublicKey.PubKeyAlgo.CanSign() &&
+			!subkey.Sig.KeyExpired(now) &&
+			subkey.Revocation == nil &&
+			publicKeyMatches(subkey.PublicKey, pub) {
+			if subkey.PrivateKey != nil {
+				return subkey.PrivateKey, true
+			}
+			return &packet.PrivateKey{PublicKey: *subkey.PublicKey}, true
+		}
+	}
+
+	selfSig := e.primarySelfSignature()
+	if (!selfSig.FlagsValid || selfSig.FlagSign) &&
+		e.PrimaryKey.PubKeyAlgo.CanSign() &&
+		!e.primaryKeyExpired(now) &&
+		publicKeyMatches(e.PrimaryKey, pub) {
+		if e.PrivateKey != nil {
+			return e.PrivateKey, true
+		}
+		return &packet.PrivateKey{PublicKey: *e.PrimaryKey}, true
+	}
+
+	return nil, false
+}
+
+// publicKeyMatches reports whether pub holds the same key material as pk.
+func publicKeyMatches(pk *packet.PublicKey, pub crypto.PublicKey) bool {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k, ok := pk.PublicKey.(*rsa.PublicKey)
+		return ok && k.N.Cmp(pub.N) == 0 && k.E == pub.E
+	case *gorsa.PublicKey:
+		k, ok := pk.PublicKey.(*rsa.PublicKey)
+		return ok && k.N.Cmp(pub.N) == 0 && k.E == int64(pub.E)
+	case *ecdsa.PublicKey:
+		k, ok := pk.PublicKey.(*ecdsa.PublicKey)
+		return ok && sameCurve(k.Curve, pub.Curve) && k.X.Cmp(pub.X) == 0 && k.Y.Cmp(pub.Y) == 0
+	case ed25519.PublicKey:
+		k, ok := pk.PublicKey.(ed25519.PublicKey)
+		return ok && bytes.Equal(k, pub)
+	}
+	return false
+}
+
+// sameCurve reports whether a and b are the same elliptic curve. Curves are
+// compared by their parameters, as implementations of a curve may differ.
+func sameCurve(a, b elliptic.Curve) bool {
+	if a == b {
+		return true
+	}
+	pa, pb := a.Params(), b.Params()
+	return pa.P.Cmp(pb.P) == 0 && pa.N.Cmp(pb.N) == 0 && pa.B.Cmp(pb.B) == 0 &&
+		pa.Gx.Cmp(pb.Gx) == 0 && pa.Gy.Cmp(pb.Gy) == 0
+}
+
 // An EntityList contains one or more Entities.
 type EntityList []*Entity
 
@@ -228,19 +696,19 @@ func (el EntityList) KeysById(id uint64, fp []byte) (keys []Key) {
 	for _, e := range el {
 		if keyMatchesIdAndFingerprint(e.PrimaryKey, id, fp) {
 			var selfSig *packet.Signature
-			for _, ident := range e.Identities {
-				if selfSig == nil {
-					selfSig = ident.SelfSignature
-				} else if ident.SelfSignature.IsPrimaryId != nil && *ident.SelfSignature.IsPrimaryId {
-					selfSig = ident.SelfSignature
-					break
-				}
+			if ident := e.primaryIdentity(); ident != nil {
+				selfSig = ident.SelfSignature
 			}
 
 			var keyFlags packet.KeyFlagBits
 			for _, ident := range e.Identities {
 				keyFlags.Merge(ident.SelfSignature.GetKeyFlags())
 			}
+			// Flags that no identity states may be on the
+			// direct-key signature instead.
+			if !keyFlags.Valid && e.DirectSignature != nil {
+				keyFlags = e.DirectSignature.GetKeyFlags()
+			}
 
 			keys = append(keys, Key{e, e.PrimaryKey, e.PrivateKey, selfSig, keyFlags})
 		}
@@ -249,13 +717,14 @@ func (el EntityList) KeysById(id uint64, fp []byte) (keys []Key) {
 			if keyMatchesIdAndFingerprint(subKey.PublicKey, id, fp) {
 
 				// If there's both a a revocation and a sig, then take the
-				// revocation. Otherwise, we can proceed with the sig.
+				// revocation. Otherwise, we can proceed with the sig. The
+				// key flags always come from the binding signature.
 				sig := subKey.Revocation
 				if sig == nil {
 					sig = subKey.Sig
 				}
 
-				keys = append(keys, Key{e, subKey.PublicKey, subKey.PrivateKey, sig, sig.GetKeyFlags()})
+				keys = append(keys, Key{e, subKey.PublicKey, subKey.PrivateKey, sig, subKey.Sig.GetKeyFlags()})
 			}
 		}
 	}
@@ -278,44 +747,49 @@ func (el EntityList) KeysByIdUsage(id uint64, fp []byte, requiredUsage byte) (ke
 			continue
 		}
 
-		if requiredUsage != 0 {
-			var usage byte
-
-			switch {
-			case key.KeyFlags.Valid:
-				usage = key.KeyFlags.BitField
-
-			case key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoElGamal:
-				// We also need to handle the case where, although the sig's
-				// flags aren't valid, the key can is implicitly usable for
-				// encryption by virtue of being ElGamal. See also the comment
-				// in encryptionKey() above.
-				usage |= packet.KeyFlagEncryptCommunications
-				usage |= packet.KeyFlagEncryptStorage
-
-			case key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoDSA ||
-				key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoECDSA ||
-				key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoEdDSA:
-				usage |= packet.KeyFlagSign
-
-			// For a primary RSA key without any key flags, be as permissiable
-			// as possible.
-			case key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoRSA &&
-				keyMatchesIdAndFingerprint(key.Entity.PrimaryKey, id, fp):
-				usage = (packet.KeyFlagCertify | packet.KeyFlagSign |
-					packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage)
-			}
-
-			if usage&requiredUsage != requiredUsage {
-				continue
-			}
+		if keyHasUsage(key, id, fp, requiredUsage) {
+			keys = append(keys, key)
 		}
-
-		keys = append(keys, key)
 	}
 	return
 }
 
+// keyHasUsage reports whether key, found by id and fp, may be used for all
+// of the purposes in requiredUsage.
+func keyHasUsage(key Key, id uint64, fp []byte, requiredUsage byte) bool {
+	if requiredUsage == 0 {
+		return true
+	}
+	var usage byte
+
+	switch {
+	case key.KeyFlags.Valid:
+		usage = key.KeyFlags.BitField
+
+	case key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoElGamal:
+		// We also need to handle the case where, although the sig's
+		// flags aren't valid, the key can is implicitly usable for
+		// encryption by virtue of being ElGamal. See also the comment
+		// in encryptionKey() above.
+		usage |= packet.KeyFlagEncryptCommunications
+		usage |= packet.KeyFlagEncryptStorage
+
+	case key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoDSA ||
+		key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoECDSA ||
+		key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoEdDSA:
+		usage |= packet.KeyFlagSign
+
+	// For a primary RSA key without any key flags, be as permissiable
+	// as possible.
+	case key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoRSA &&
+		keyMatchesIdAndFingerprint(key.Entity.PrimaryKey, id, fp):
+		usage = (packet.KeyFlagCertify | packet.KeyFlagSign |
+			packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage)
+	}
+
+	return usage&requiredUsage == requiredUsage
+}
+
 // DecryptionKeys returns all private keys that are valid for decryption.
 func (el EntityList) DecryptionKeys() (keys []Key) {
 	for _, e := range el {
@@ -328,6 +802,341 @@ func (el EntityList) DecryptionKeys() (keys []Key) {
 	return
 }
 
+// DecryptionFingerprints returns the fingerprints of the keys in el that can
+// decrypt messages at now: keys that may encrypt, aren't revoked or expired,
+// belong to an entity that isn't revoked or expired either, and whose secret
+// is present, even if still protected by a passphrase. Comparing them with
+// the recipients of a message tells whether el can read it.
+func (el EntityList) DecryptionFingerprints(now time.Time) (fingerprints [][]byte) {
+	for _, e := range el {
+		selfSig := e.primarySelfSignature()
+		if e.Revoked(now) || selfSig == nil || e.primaryKeyExpired(now) {
+			continue
+		}
+		if (!selfSig.FlagsValid || selfSig.FlagEncryptStorage || selfSig.FlagEncryptCommunications) &&
+			e.PrimaryKey.PubKeyAlgo.CanEncrypt() && hasSecret(e.PrivateKey) {
+			fingerprints = append(fingerprints, append([]byte(nil), e.PrimaryKey.Fingerprint[:]...))
+		}
+		for _, subkey := range e.Subkeys {
+			if (!subkey.Sig.FlagsValid || subkey.Sig.FlagEncryptStorage || subkey.Sig.FlagEncryptCommunications) &&
+				subkey.PublicKey.PubKeyAlgo.CanEncrypt() &&
+				!subkey.Revoked(now) && !subkey.Sig.KeyExpired(now) &&
+				hasSecret(subkey.PrivateKey) {
+				fingerprints = append(fingerprints, append([]byte(nil), subkey.PublicKey.Fingerprint[:]...))
+			}
+		}
+	}
+	return
+}
+
+// TestPassphrase reports whether pass unlocks the secret primary key of e.
+// If the primary secret is a GNU dummy stub, as for an offline primary key,
+// the first subkey with a secret is tried instead. Decryption is attempted
+// on a copy of the key, so e is left as it was. A key that isn't encrypted
+// is unlocked by any passphrase; one without a secret is unlocked by none.
+func (e *Entity) TestPassphrase(pass []byte) bool {
+	priv := e.PrivateKey
+	if !hasSecret(priv) {
+		priv = nil
+		for _, subkey := range e.Subkeys {
+			if hasSecret(subkey.PrivateKey) {
+				priv = subkey.PrivateKey
+				break
+			}
+		}
+	}
+	if priv == nil {
+		return false
+	}
+	if !priv.Encrypted {
+		return true
+	}
+	c := *priv
+	return c.Decrypt(pass) == nil && c.PrivateKey != nil
+}
+
+// hasSecret reports whether priv holds secret key material, decrypted or
+// not, rather than being absent or a GNU dummy stub.
+func hasSecret(priv *packet.PrivateKey) bool {
+	return priv != nil && (priv.Encrypted || priv.PrivateKey != nil)
+}
+
+// Merge combines the entities in el that share a primary key fingerprint,
+// such as the public and secret forms of a key read from separate armored
+// blocks. The first entity with a given fingerprint is kept, and it gains
+// any private key material that it lacks or only has a GNU dummy stub of,
+// and any identities and subkeys that it lacks, from the
+// later ones, as well as the certifications of identities they share,
+// without duplicating those it already holds, their direct-key signatures
+// and their revocations of the key, its identities and its subkeys. The
+// entities in el may be modified.
+func (el EntityList) Merge() EntityList {
+	var merged EntityList
+	byFingerprint := make(map[[20]byte]*Entity)
+	for _, e := range el {
+		if first, ok := byFingerprint[e.PrimaryKey.Fingerprint]; ok {
+			first.merge(e)
+			continue
+		}
+		byFingerprint[e.PrimaryKey.Fingerprint] = e
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+// PublicFromPrivate returns copies of the entities in el without any private
+// key material, such as for publishing keys read from a secret keyring with
+// SerializeArmored. The entities in el are left as they are.
+func PublicFromPrivate(el EntityList) EntityList {
+	public := make(EntityList, len(el))
+	for i, e := range el {
+		pub := e.Clone()
+		pub.PrivateKey = nil
+		for j := range pub.Subkeys {
+			pub.Subkeys[j].PrivateKey = nil
+		}
+		for j := range pub.BadSubkeys {
+			pub.BadSubkeys[j].PrivateKey = nil
+		}
+		public[i] = pub
+	}
+	return public
+}
+
+// merge adds to e whatever other, which must have the same primary key,
+// has and e lacks.
+func (e *Entity) merge(other *Entity) {
+	if !hasSecret(e.PrivateKey) && other.PrivateKey != nil {
+		e.PrivateKey = other.PrivateKey
+	}
+	e.setDirectSignatures(mergeSignatures(e.directSignatures(), other.directSignatures()))
+	e.Revocations = mergeSignatures(e.Revocations, other.Revocations)
+	e.UnverifiedRevocations = mergeSignatures(e.UnverifiedRevocations, other.UnverifiedRevocations)
+
+	for _, otherIdent := range other.identities() {
+		if ident, ok := e.Identities[otherIdent.Name]; ok {
+			ident.Signatures = mergeSignatures(ident.Signatures, otherIdent.Signatures)
+			if ident.Revocation == nil {
+				ident.Revocation = otherIdent.Revocation
+			}
+			continue
+		}
+		e.Identities[otherIdent.Name] = otherIdent
+	}
+	// Keep the user ids read with other, including those without a valid
+	// self-signature, for AllUserIds.
+	known := make(map[string]bool)
+	for _, uid := range e.userIds {
+		known[uid.Id] = true
+	}
+	for _, uid := range other.userIds {
+		if !known[uid.Id] {
+			known[uid.Id] = true
+			e.userIds = append(e.userIds, uid)
+		}
+	}
+
+NextSubkey:
+	for _, subkey := range other.Subkeys {
+		for i := range e.Subkeys {
+			if e.Subkeys[i].PublicKey.Fingerprint == subkey.PublicKey.Fingerprint {
+				if !hasSecret(e.Subkeys[i].PrivateKey) && subkey.PrivateKey != nil {
+					e.Subkeys[i].PrivateKey = subkey.PrivateKey
+				}
+				if e.Subkeys[i].Revocation == nil {
+					e.Subkeys[i].Revocation = subkey.Revocation
+				}
+				continue NextSubkey
+			}
+		}
+		e.Subkeys = append(e.Subkeys, subkey)
+	}
+}
+
+// directSignatures returns all of e's direct-key signatures, the newest
+// first.
+func (e *Entity) directSignatures() []*packet.Signature {
+	if e.DirectSignature == nil {
+		return e.OtherDirectSignatures
+	}
+	return append([]*packet.Signature{e.DirectSignature}, e.OtherDirectSignatures...)
+}
+
+// setDirectSignatures makes the newest of sigs, the last of them in case of a
+// tie, e's DirectSignature and keeps the others in OtherDirectSignatures.
+func (e *Entity) setDirectSignatures(sigs []*packet.Signature) {
+	newest := -1
+	for i, sig := range sigs {
+		if newest == -1 || !sig.CreationTime.Before(sigs[newest].CreationTime) {
+			newest = i
+		}
+	}
+	if newest == -1 {
+		e.DirectSignature, e.OtherDirectSignatures = nil, nil
+		return
+	}
+	e.DirectSignature = sigs[newest]
+	e.OtherDirectSignatures = nil
+	for i, sig := range sigs {
+		if i != newest {
+			e.OtherDirectSignatures = append(e.OtherDirectSignatures, sig)
+		}
+	}
+}
+
+// serializeDirectSignatures writes all of e's direct-key signatures to w.
+func (e *Entity) serializeDirectSignatures(w io.Writer) error {
+	for _, sig := range e.directSignatures() {
+		if err := sig.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeSignatures appends to sigs those of others that it doesn't already
+// hold.
+func mergeSignatures(sigs, others []*packet.Signature) []*packet.Signature {
+NextSignature:
+	for _, other := range others {
+		for _, sig := range sigs {
+			if sig.EqualTo(other) {
+				continue NextSignature
+			}
+		}
+		sigs = append(sigs, other)
+	}
+	return sigs
+}
+
+// SerializeArmored writes the public part of every Entity in el to w as a
+// single armored public key block, which can be read back with
+// ReadArmoredKeyRing. Public keys are written as Entity.Serialize writes
+// them, which currently doesn't depend on config.
+// If config is nil, sensible defaults will be used.
+func (el EntityList) SerializeArmored(w io.Writer, config *packet.Config) error {
+	return el.serializeArmored(w, PublicKeyType, func(e *Entity, w io.Writer) error {
+		return e.Serialize(w)
+	})
+}
+
+// SerializeArmoredPrivate is like SerializeArmored but includes the private
+// key material, as written by Entity.SerializePrivate, in a single armored
+// private key block.
+// If config is nil, sensible defaults will be used.
+func (el EntityList) SerializeArmoredPrivate(w io.Writer, config *packet.Config) error {
+	return el.serializeArmored(w, PrivateKeyType, func(e *Entity, w io.Writer) error {
+		return e.SerializePrivate(w, config)
+	})
+}
+
+// SerializeArmoredChunked splits the public part of e, as written by
+// Entity.Serialize, into armored public key blocks of at most maxBytes
+// bytes each, for keyservers that limit the size of uploads. Each block is
+// a valid key on its own, holding the primary key, its direct-key signatures
+// and the primary identity, along with as many of the other identities and
+// the subkeys as fit. Reading every block and merging the results with
+// EntityList.Merge gives back e. An InvalidArgumentError is returned if an
+// identity or subkey doesn't fit into a block.
+func SerializeArmoredChunked(e *Entity, maxBytes int) ([]string, error) {
+	primary := e.primaryIdentity()
+	if primary == nil {
+		return nil, errors.InvalidArgumentError("entity without any identities")
+	}
+
+	head := new(bytes.Buffer)
+	if err := e.PrimaryKey.Serialize(head); err != nil {
+		return nil, err
+	}
+	if err := e.serializeDirectSignatures(head); err != nil {
+		return nil, err
+	}
+	if err := primary.serialize(head); err != nil {
+		return nil, err
+	}
+
+	// The rest of the key is split at the boundaries of identities and
+	// subkeys, each of which goes into a block whole, along with the
+	// signatures that follow it.
+	var parts [][]byte
+	for _, ident := range e.identities() {
+		if ident == primary {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := ident.serialize(buf); err != nil {
+			return nil, err
+		}
+		parts = append(parts, buf.Bytes())
+	}
+	for i := range e.Subkeys {
+		buf := new(bytes.Buffer)
+		if err := e.Subkeys[i].serialize(buf); err != nil {
+			return nil, err
+		}
+		parts = append(parts, buf.Bytes())
+	}
+
+	var chunks []string
+	chunk, err := armorPublicKey(head.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(chunk) > maxBytes {
+		return nil, errors.InvalidArgumentError("primary key and identity don't fit into " + strconv.Itoa(maxBytes) + " bytes")
+	}
+	body := head.Bytes()
+	for _, part := range parts {
+		for {
+			candidate := append(body[:len(body):len(body)], part...)
+			armored, err := armorPublicKey(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if len(armored) <= maxBytes {
+				body, chunk = candidate, armored
+				break
+			}
+			if len(body) == head.Len() {
+				return nil, errors.InvalidArgumentError("identity or subkey doesn't fit into " + strconv.Itoa(maxBytes) + " bytes")
+			}
+			// Start a new block for part.
+			chunks = append(chunks, chunk)
+			body = head.Bytes()
+		}
+	}
+	return append(chunks, chunk), nil
+}
+
+// armorPublicKey returns the packets in body as an armored public key block.
+func armorPublicKey(body []byte) (string, error) {
+	buf := new(bytes.Buffer)
+	w, err := armor.Encode(buf, PublicKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(body); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (el EntityList) serializeArmored(w io.Writer, blockType string, serialize func(*Entity, io.Writer) error) error {
+	aw, err := armor.Encode(w, blockType, nil)
+	if err != nil {
+		return err
+	}
+	for _, e := range el {
+		if err := serialize(e, aw); err != nil {
+			return err
+		}
+	}
+	return aw.Close()
+}
+
 // ReadArmoredKeyRing reads one or more public/private keys from an armor keyring file.
 func ReadArmoredKeyRing(r io.Reader) (EntityList, error) {
 	block, err := armor.Decode(r)
@@ -347,12 +1156,19 @@ func ReadArmoredKeyRing(r io.Reader) (EntityList, error) {
 // ReadKeyRing reads one or more public/private keys. Unsupported keys are
 // ignored as long as at least a single valid key is found.
 func ReadKeyRing(r io.Reader) (el EntityList, err error) {
-	packets := packet.NewReader(r)
+	return ReadKeyRingWithConfig(r, nil)
+}
+
+// ReadKeyRingWithConfig is like ReadKeyRing, but verifies self-signatures
+// using config's VerificationCache, if any, and stops with a StructuralError
+// once config's MaxPackets or MaxEntities limit is exceeded.
+func ReadKeyRingWithConfig(r io.Reader, config *packet.Config) (el EntityList, err error) {
+	packets := packet.NewReaderWithConfig(r, config)
 	var lastUnsupportedError error
 
 	for {
 		var e *Entity
-		e, err = ReadEntity(packets)
+		e, err = ReadEntityWithConfig(packets, config)
 		if err != nil {
 			// TODO: warn about skipped unsupported/unreadable keys
 			if _, ok := err.(errors.UnsupportedError); ok {
@@ -372,14 +1188,77 @@ func ReadKeyRing(r io.Reader) (el EntityList, err error) {
 				break
 			}
 		} else {
+			if config != nil && config.MaxEntities > 0 && len(el) >= config.MaxEntities {
+				el, err = nil, errors.StructuralError("too many entities")
+				break
+			}
 			el = append(el, e)
 		}
 	}
 
-	if len(el) == 0 && err == nil {
-		err = lastUnsupportedError
+	if len(el) == 0 && err == nil {
+		err = lastUnsupportedError
+	}
+	return
+}
+
+// SamePrimaryKey reports whether the keys read from a and b, each of which
+// may be armored or binary, have the same primary key. Only the primary key
+// fingerprints are compared, so user ids, subkeys and signatures attached
+// to either key do not matter.
+func SamePrimaryKey(a, b io.Reader) (bool, error) {
+	fa, err := readPrimaryKeyFingerprint(a)
+	if err != nil {
+		return false, err
+	}
+	fb, err := readPrimaryKeyFingerprint(b)
+	if err != nil {
+		return false, err
+	}
+	return fa == fb, nil
+}
+
+// readPrimaryKeyFingerprint returns the fingerprint of the first primary
+// key found in r.
+func readPrimaryKeyFingerprint(r io.Reader) (fp [20]byte, err error) {
+	br := bufio.NewReader(r)
+	armored, err := peekArmored(br)
+	if err != nil {
+		return
+	}
+	var body io.Reader = br
+	if armored {
+		var block *armor.Block
+		if block, err = armor.Decode(br); err != nil {
+			return
+		}
+		if block.Type != PublicKeyType && block.Type != PrivateKeyType {
+			err = errors.InvalidArgumentError("expected public or private key block, got: " + block.Type)
+			return
+		}
+		body = block.Body
+	}
+
+	packets := packet.NewReader(body)
+	for {
+		var p packet.Packet
+		if p, err = packets.Next(); err == io.EOF {
+			err = errors.InvalidArgumentError("no primary key found")
+			return
+		} else if err != nil {
+			return
+		}
+		switch pk := p.(type) {
+		case *packet.PublicKey:
+			if !pk.IsSubkey {
+				return pk.Fingerprint, nil
+			}
+		case *packet.PrivateKey:
+			if !pk.IsSubkey {
+				return pk.Fingerprint, nil
+			}
+		}
 	}
-	return
 }
 
 // readToNextPublicKey reads packets until the start of the entity and leaves
@@ -410,9 +1289,19 @@ func readToNextPublicKey(packets *packet.Reader) (err error) {
 // ReadEntity reads an entity (public key, identities, subkeys etc) from the
 // given Reader.
 func ReadEntity(packets *packet.Reader) (*Entity, error) {
+	return ReadEntityWithConfig(packets, nil)
+}
+
+// ReadEntityWithConfig is like ReadEntity, but verifies self-signatures
+// using config's VerificationCache, if any.
+func ReadEntityWithConfig(packets *packet.Reader, config *packet.Config) (*Entity, error) {
 	e := new(Entity)
 	e.Identities = make(map[string]*Identity)
 
+	// Unknown packets skipped before the entity belong to whatever was
+	// read before it.
+	packets.SkippedUnknown()
+
 	p, err := packets.Next()
 	if err != nil {
 		return nil, err
@@ -453,6 +1342,12 @@ EachPacket:
 			current = new(Identity)
 			current.Name = pkt.Id
 			current.UserId = pkt
+			e.userIds = append(e.userIds, pkt)
+		case *packet.UserAttribute:
+			// Signatures that follow a user attribute are over the
+			// attribute, not the preceding user id, and we don't keep
+			// track of attributes.
+			current = nil
 		case *packet.Signature:
 			if pkt.SigType == packet.SigTypeKeyRevocation {
 				// These revocations won't revoke UIDs (see
@@ -502,7 +1397,7 @@ EachPacket:
 				pkt.IssuerKeyId != nil &&
 				*pkt.IssuerKeyId == e.PrimaryKey.KeyId {
 
-				if err = e.PrimaryKey.VerifyUserIdSignature(current.Name, e.PrimaryKey, pkt); err == nil {
+				if err = e.PrimaryKey.VerifyUserIdSignatureWithConfig(current.Name, e.PrimaryKey, pkt, config); err == nil {
 
 					current.SelfSignature = pkt
 
@@ -517,11 +1412,12 @@ EachPacket:
 					// Google OpenPGP we forked from.
 					e.Identities[current.Name] = current
 				} else {
-					// We really should warn that there was a failure here. Not raise an error
-					// since this really shouldn't be a fail-stop error.
+					// Not a fail-stop error, but keep the reason around
+					// for anyone wondering where the identity went.
+					e.BadSelfSignatures = append(e.BadSelfSignatures, BadSelfSignature{current.Name, pkt, err})
 				}
 			} else if current != nil && pkt.SigType == packet.SigTypeIdentityRevocation {
-				if err = e.PrimaryKey.VerifyUserIdSignature(current.Name, e.PrimaryKey, pkt); err == nil {
+				if err = e.PrimaryKey.VerifyUserIdSignatureWithConfig(current.Name, e.PrimaryKey, pkt, config); err == nil {
 					// Note: we are not removing the identity from
 					// e.Identities. Caller can always filter by Revocation
 					// field to ignore revoked identities.
@@ -529,6 +1425,7 @@ EachPacket:
 				}
 			} else if pkt.SigType == packet.SigTypeDirectSignature {
 				if err = e.PrimaryKey.VerifyRevocationSignature(e.PrimaryKey, pkt); err == nil {
+					e.setDirectSignatures(append(e.directSignatures(), pkt))
 					if desig := pkt.DesignatedRevoker; desig != nil {
 						// If it's a designated revoker signature, take last 8 octects
 						// of fingerprint as Key ID and save it to designatedRevokers
@@ -558,7 +1455,7 @@ EachPacket:
 				packets.Unread(p)
 				break EachPacket
 			}
-			err = addSubkey(e, packets, &pkt.PublicKey, pkt)
+			err = addSubkey(e, packets, &pkt.PublicKey, pkt, config)
 			if err != nil {
 				return nil, err
 			}
@@ -567,7 +1464,7 @@ EachPacket:
 				packets.Unread(p)
 				break EachPacket
 			}
-			err = addSubkey(e, packets, pkt, nil)
+			err = addSubkey(e, packets, pkt, nil, config)
 			if err != nil {
 				return nil, err
 			}
@@ -575,6 +1472,7 @@ EachPacket:
 			// we ignore unknown packets
 		}
 	}
+	e.UnknownPackets = packets.SkippedUnknown()
 
 	if len(e.Identities) == 0 {
 		return nil, errors.StructuralError("entity without any identities")
@@ -601,7 +1499,7 @@ EachPacket:
 	return e, nil
 }
 
-func addSubkey(e *Entity, packets *packet.Reader, pub *packet.PublicKey, priv *packet.PrivateKey) error {
+func addSubkey(e *Entity, packets *packet.Reader, pub *packet.PublicKey, priv *packet.PrivateKey, config *packet.Config) error {
 	var subKey Subkey
 	subKey.PublicKey = pub
 	subKey.PrivateKey = priv
@@ -630,7 +1528,18 @@ func addSubkey(e *Entity, packets *packet.Reader, pub *packet.PublicKey, priv *p
 
 			continue
 		}
-		err = e.PrimaryKey.VerifyKeySignature(subKey.PublicKey, sig)
+		err = e.PrimaryKey.VerifyKeySignatureWithConfig(subKey.PublicKey, sig, config)
+		if err != nil && sig.SigType == packet.SigTypeSubkeyBinding && sig.FlagSign &&
+			(sig.FlagEncryptCommunications || sig.FlagEncryptStorage) {
+			// The cross-signature is only required for the signing
+			// capability. If it's missing or bad, keep the subkey for
+			// encryption as long as the binding itself is good.
+			encryptOnly := *sig
+			encryptOnly.FlagSign = false
+			if e.PrimaryKey.VerifyKeySignatureWithConfig(subKey.PublicKey, &encryptOnly, config) == nil {
+				sig, err = &encryptOnly, nil
+			}
+		}
 		if err != nil {
 			// Non valid signature, so again, no need to abandon all hope, just continue;
 			// make a note of the error we hit.
@@ -676,31 +1585,26 @@ const defaultRSAKeyBits = 2048
 // NewEntity returns an Entity that contains a fresh RSA/RSA keypair with a
 // single identity composed of the given full name, comment and email, any of
 // which may be empty but must not contain any of "()<>\x00".
+// If config.Algorithm is packet.PubKeyAlgoDSA, the keypair is DSA/ElGamal
+// instead.
 // If config is nil, sensible defaults will be used.
 func NewEntity(name, comment, email string, config *packet.Config) (*Entity, error) {
 	currentTime := config.Now()
 
-	bits := defaultRSAKeyBits
-	if config != nil && config.RSABits != 0 {
-		bits = config.RSABits
-	}
-
 	uid := packet.NewUserId(name, comment, email)
 	if uid == nil {
 		return nil, errors.InvalidArgumentError("user id field contained invalid characters")
 	}
-	signingPriv, err := rsa.GenerateKey(config.Random(), bits)
-	if err != nil {
-		return nil, err
-	}
-	encryptingPriv, err := rsa.GenerateKey(config.Random(), bits)
+	signingPriv, encryptingPriv, err := newEntityKeys(currentTime, config)
 	if err != nil {
 		return nil, err
 	}
+	signingPub := signingPriv.PublicKey
+	encryptingPub := encryptingPriv.PublicKey
 
 	e := &Entity{
-		PrimaryKey: packet.NewRSAPublicKey(currentTime, &signingPriv.PublicKey),
-		PrivateKey: packet.NewRSAPrivateKey(currentTime, signingPriv),
+		PrimaryKey: &signingPub,
+		PrivateKey: signingPriv,
 		Identities: make(map[string]*Identity),
 	}
 	isPrimaryId := true
@@ -710,7 +1614,7 @@ func NewEntity(name, comment, email string, config *packet.Config) (*Entity, err
 		SelfSignature: &packet.Signature{
 			CreationTime: currentTime,
 			SigType:      packet.SigTypePositiveCert,
-			PubKeyAlgo:   packet.PubKeyAlgoRSA,
+			PubKeyAlgo:   signingPub.PubKeyAlgo,
 			Hash:         config.Hash(),
 			IsPrimaryId:  &isPrimaryId,
 			FlagsValid:   true,
@@ -731,14 +1635,18 @@ func NewEntity(name, comment, email string, config *packet.Config) (*Entity, err
 		e.Identities[uid.Id].SelfSignature.PreferredSymmetric = []uint8{uint8(config.DefaultCipher)}
 	}
 
+	if config != nil && len(config.PreferredAEAD) > 0 {
+		e.Identities[uid.Id].SelfSignature.PreferredAEAD = config.PreferredAEAD
+	}
+
 	e.Subkeys = make([]Subkey, 1)
 	e.Subkeys[0] = Subkey{
-		PublicKey:  packet.NewRSAPublicKey(currentTime, &encryptingPriv.PublicKey),
-		PrivateKey: packet.NewRSAPrivateKey(currentTime, encryptingPriv),
+		PublicKey:  &encryptingPub,
+		PrivateKey: encryptingPriv,
 		Sig: &packet.Signature{
 			CreationTime:              currentTime,
 			SigType:                   packet.SigTypeSubkeyBinding,
-			PubKeyAlgo:                packet.PubKeyAlgoRSA,
+			PubKeyAlgo:                signingPub.PubKeyAlgo,
 			Hash:                      config.Hash(),
 			FlagsValid:                true,
 			FlagEncryptStorage:        true,
@@ -752,6 +1660,146 @@ func NewEntity(name, comment, email string, config *packet.Config) (*Entity, err
 	return e, nil
 }
 
+// newEntityKeys generates the primary signing key and the encryption
+// subkey of a new entity, of the algorithm and size given by config.
+func newEntityKeys(currentTime time.Time, config *packet.Config) (signing, encrypting *packet.PrivateKey, err error) {
+	algo := packet.PubKeyAlgoRSA
+	if config != nil && config.Algorithm != 0 {
+		algo = config.Algorithm
+	}
+
+	switch algo {
+	case packet.PubKeyAlgoRSA:
+		signingPriv, err := rsa.GenerateKey(config.Random(), rsaKeyBits(config))
+		if err != nil {
+			return nil, nil, err
+		}
+		signing = packet.NewRSAPrivateKey(currentTime, signingPriv)
+	case packet.PubKeyAlgoDSA:
+		signingPriv, err := newDSAKey(config.Random(), dsaKeyBits(config))
+		if err != nil {
+			return nil, nil, err
+		}
+		signing = packet.NewDSAPrivateKey(currentTime, signingPriv)
+	default:
+		return nil, nil, errors.UnsupportedError("public key algorithm for new keys: " + strconv.Itoa(int(algo)))
+	}
+	encrypting, err = newEncryptionKey(currentTime, algo, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signing, encrypting, nil
+}
+
+// newEncryptionKey generates an encryption key to go with a primary key of
+// the given algorithm: RSA for RSA, and ElGamal for DSA.
+func newEncryptionKey(currentTime time.Time, primaryAlgo packet.PublicKeyAlgorithm, config *packet.Config) (*packet.PrivateKey, error) {
+	switch primaryAlgo {
+	case packet.PubKeyAlgoRSA:
+		priv, err := rsa.GenerateKey(config.Random(), rsaKeyBits(config))
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewRSAPrivateKey(currentTime, priv), nil
+	case packet.PubKeyAlgoDSA:
+		priv, err := newElGamalKey(config.Random(), dsaKeyBits(config))
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewElGamalPrivateKey(currentTime, priv), nil
+	}
+	return nil, errors.UnsupportedError("public key algorithm for new keys: " + strconv.Itoa(int(primaryAlgo)))
+}
+
+func rsaKeyBits(config *packet.Config) int {
+	if config != nil && config.RSABits != 0 {
+		return config.RSABits
+	}
+	return defaultRSAKeyBits
+}
+
+func dsaKeyBits(config *packet.Config) int {
+	if config != nil && config.DSABits != 0 {
+		return config.DSABits
+	}
+	return defaultDSAKeyBits
+}
+
+const defaultDSAKeyBits = 2048
+
+// newDSAKey generates a DSA key with fresh domain parameters. The size of
+// the subgroup follows from bits, as in FIPS 186-3.
+func newDSAKey(random io.Reader, bits int) (*dsa.PrivateKey, error) {
+	var sizes dsa.ParameterSizes
+	switch bits {
+	case 1024:
+		sizes = dsa.L1024N160
+	case 2048:
+		sizes = dsa.L2048N256
+	case 3072:
+		sizes = dsa.L3072N256
+	default:
+		return nil, errors.InvalidArgumentError("DSA key size must be 1024, 2048 or 3072 bits")
+	}
+	priv := new(dsa.PrivateKey)
+	if err := dsa.GenerateParameters(&priv.Parameters, random, sizes); err != nil {
+		return nil, err
+	}
+	if err := dsa.GenerateKey(priv, random); err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
+
+// Rather than searching for a fresh prime, ElGamal keys use one of the
+// well-known safe primes of the MODP groups of RFC 3526, with generator 2.
+const (
+	modp2048Prime = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+		"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+		"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+		"3995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF"
+	modp3072Prime = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+		"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+		"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+		"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33" +
+		"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+		"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864" +
+		"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2" +
+		"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
+)
+
+// newElGamalKey generates an ElGamal key in the 2048 bit MODP group, or
+// in the 3072 bit one if bits is larger than 2048.
+func newElGamalKey(random io.Reader, bits int) (*elgamal.PrivateKey, error) {
+	prime := modp2048Prime
+	if bits > 2048 {
+		prime = modp3072Prime
+	}
+	p, _ := new(big.Int).SetString(prime, 16)
+	g := big.NewInt(2)
+
+	// Pick x uniformly from [1, p-2].
+	x, err := rand.Int(random, new(big.Int).Sub(p, big.NewInt(2)))
+	if err != nil {
+		return nil, err
+	}
+	x.Add(x, big.NewInt(1))
+
+	priv := &elgamal.PrivateKey{X: x}
+	priv.G = g
+	priv.P = p
+	priv.Y = new(big.Int).Exp(g, x, p)
+	return priv, nil
+}
+
 // SerializePrivate serializes an Entity, including private key material, to
 // the given Writer. For now, it must only be used on an Entity returned from
 // NewEntity.
@@ -761,12 +1809,16 @@ func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error
 	if err != nil {
 		return
 	}
-	for _, ident := range e.Identities {
+	err = e.serializeDirectSignatures(w)
+	if err != nil {
+		return
+	}
+	for _, ident := range e.identities() {
 		err = ident.UserId.Serialize(w)
 		if err != nil {
 			return
 		}
-		if e.PrivateKey.PrivateKey != nil {
+		if e.PrivateKey.PrivateKey != nil && !config.ReuseSignatures() {
 			err = ident.SelfSignature.SignUserId(ident.UserId.Id, e.PrimaryKey, e.PrivateKey, config)
 			if err != nil {
 				return
@@ -778,7 +1830,11 @@ func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error
 		}
 	}
 	for _, subkey := range e.Subkeys {
-		err = subkey.PrivateKey.Serialize(w)
+		if config != nil && config.OmitDummySubkeys && !hasSecret(subkey.PrivateKey) {
+			err = subkey.PublicKey.Serialize(w)
+		} else {
+			err = subkey.PrivateKey.Serialize(w)
+		}
 		if err != nil {
 			return
 		}
@@ -814,46 +1870,69 @@ func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error
 }
 
 // Serialize writes the public part of the given Entity to w. (No private
-// key material will be output).
+// key material will be output). Certifications that are marked as not
+// exportable are left out.
 func (e *Entity) Serialize(w io.Writer) error {
 	err := e.PrimaryKey.Serialize(w)
 	if err != nil {
 		return err
 	}
-	for _, ident := range e.Identities {
-		err = ident.UserId.Serialize(w)
-		if err != nil {
+	err = e.serializeDirectSignatures(w)
+	if err != nil {
+		return err
+	}
+	for _, ident := range e.identities() {
+		if err := ident.serialize(w); err != nil {
 			return err
 		}
-		err = ident.SelfSignature.Serialize(w)
-		if err != nil {
+	}
+	for i := range e.Subkeys {
+		if err := e.Subkeys[i].serialize(w); err != nil {
 			return err
 		}
-		for _, sig := range ident.Signatures {
-			err = sig.Serialize(w)
-			if err != nil {
-				return err
-			}
-		}
 	}
-	for _, subkey := range e.Subkeys {
-		err = subkey.PublicKey.Serialize(w)
+	return nil
+}
+
+// serialize writes the user id of i, its self-signature and its exportable
+// certifications to w.
+func (i *Identity) serialize(w io.Writer) error {
+	err := i.UserId.Serialize(w)
+	if err != nil {
+		return err
+	}
+	err = i.SelfSignature.Serialize(w)
+	if err != nil {
+		return err
+	}
+	for _, sig := range i.Signatures {
+		// Local certifications stay with the keyring they were
+		// made in.
+		if !sig.IsExportable() {
+			continue
+		}
+		err = sig.Serialize(w)
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		if subkey.Revocation != nil {
-			err = subkey.Revocation.Serialize(w)
-			if err != nil {
-				return err
-			}
-		}
-		err = subkey.Sig.Serialize(w)
+// serialize writes the public part of s, its revocation and its binding
+// signature to w.
+func (s *Subkey) serialize(w io.Writer) error {
+	err := s.PublicKey.Serialize(w)
+	if err != nil {
+		return err
+	}
+	if s.Revocation != nil {
+		err = s.Revocation.Serialize(w)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return s.Sig.Serialize(w)
 }
 
 // SignIdentity adds a signature to e, from signer, attesting that identity is
@@ -887,6 +1966,347 @@ func (e *Entity) SignIdentity(identity string, signer *Entity, config *packet.Co
 	return nil
 }
 
+// ValidCertifications returns the third-party certifications of the given
+// identity of e that verify against a certifying key in keyring and are in
+// effect at now. A certification carries its own signature expiration,
+// independent of the expiration of either key, and one that has expired by
+// now, or that was made after now, is left out as if it were absent.
+func (e *Entity) ValidCertifications(identity string, keyring KeyRing, now time.Time) (certs []*packet.Signature) {
+	ident, ok := e.Identities[identity]
+	if !ok {
+		return nil
+	}
+	for _, sig := range ident.Signatures {
+		if sig.SigType < packet.SigTypeGenericCert || sig.SigType > packet.SigTypePositiveCert {
+			continue
+		}
+		if sig.IssuerKeyId == nil || sig.CreationTime.After(now) || sig.SigExpired(now) {
+			continue
+		}
+		for _, key := range keyring.KeysByIdUsage(*sig.IssuerKeyId, sig.IssuerFingerprint, packet.KeyFlagCertify) {
+			if key.PublicKey.VerifyUserIdSignature(identity, e.PrimaryKey, sig) == nil {
+				certs = append(certs, sig)
+				break
+			}
+		}
+	}
+	return
+}
+
+// AttestCertifications adds an attestation signature to the given identity
+// of e, made by e's own private key, that approves the given third-party
+// certifications of that identity. This lets the key holder choose which
+// certifications keyservers should distribute. The provided identity must
+// already be an element of e.Identities and the private key of e must have
+// been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AttestCertifications(identity string, certs []*packet.Signature, config *packet.Config) error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("attesting Entity must have a private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("attesting Entity's private key must be decrypted")
+	}
+	ident, ok := e.Identities[identity]
+	if !ok {
+		return errors.InvalidArgumentError("given identity string not found in Entity")
+	}
+
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeAttestation,
+		PubKeyAlgo:   e.PrivateKey.PubKeyAlgo,
+		Hash:         config.Hash(),
+		CreationTime: config.Now(),
+		IssuerKeyId:  &e.PrivateKey.KeyId,
+	}
+	for _, cert := range certs {
+		digest, err := cert.AttestationDigest(sig.Hash)
+		if err != nil {
+			return err
+		}
+		sig.AttestedCertifications = append(sig.AttestedCertifications, digest)
+	}
+	if err := sig.SignUserId(identity, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	ident.Signatures = append(ident.Signatures, sig)
+	return nil
+}
+
+// RebindSubkey replaces the binding signature of sub, which must be one of
+// e's subkeys or a copy of one, with a fresh one made with config's hash,
+// such as to move a subkey bound with SHA-1 onto SHA-256. The key flags and
+// key lifetime of the old binding are kept. The private key of e, and for
+// signing subkeys also that of sub, must have been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) RebindSubkey(sub *Subkey, config *packet.Config) error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("binding Entity must have a private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("binding Entity's private key must be decrypted")
+	}
+	found := -1
+	for i := range e.Subkeys {
+		if e.Subkeys[i].PublicKey.Fingerprint == sub.PublicKey.Fingerprint {
+			found = i
+			break
+		}
+	}
+	if found == -1 {
+		return errors.InvalidArgumentError("given subkey not found in Entity")
+	}
+	// sub may be a copy, such as one returned by UsableSubkeys, so work
+	// on the subkey held by e.
+	sub = &e.Subkeys[found]
+
+	old := sub.Sig
+	sig := &packet.Signature{
+		SigType:                   packet.SigTypeSubkeyBinding,
+		PubKeyAlgo:                e.PrivateKey.PubKeyAlgo,
+		Hash:                      config.Hash(),
+		CreationTime:              config.Now(),
+		IssuerKeyId:               &e.PrivateKey.KeyId,
+		KeyLifetimeSecs:           old.KeyLifetimeSecs,
+		FlagsValid:                old.FlagsValid,
+		FlagCertify:               old.FlagCertify,
+		FlagSign:                  old.FlagSign,
+		FlagEncryptCommunications: old.FlagEncryptCommunications,
+		FlagEncryptStorage:        old.FlagEncryptStorage,
+	}
+	if sig.FlagSign {
+		if sub.PrivateKey == nil || sub.PrivateKey.Encrypted {
+			return errors.InvalidArgumentError("signing subkey's private key must be decrypted to cross-sign it")
+		}
+		if err := sig.CrossSignKey(e.PrimaryKey, sub.PrivateKey, config); err != nil {
+			return err
+		}
+	}
+	if err := sig.SignKey(sub.PublicKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	sub.Sig = sig
+	return nil
+}
+
+// RotateEncryptionSubkey generates a fresh encryption subkey for e, binds it
+// to the primary key and adds it to e.Subkeys. Being the newest, it is the
+// subkey that messages are then encrypted to; the older ones are kept so
+// that messages already encrypted to them can still be decrypted. The new
+// subkey is RSA for an RSA primary key and ElGamal for a DSA one, of the
+// size given by config. The private key of e must have been decrypted if
+// necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) RotateEncryptionSubkey(config *packet.Config) (*Subkey, error) {
+	if e.PrivateKey == nil || !hasSecret(e.PrivateKey) {
+		return nil, errors.InvalidArgumentError("binding Entity must have a private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return nil, errors.InvalidArgumentError("binding Entity's private key must be decrypted")
+	}
+
+	currentTime := config.Now()
+	priv, err := newEncryptionKey(currentTime, e.PrimaryKey.PubKeyAlgo, config)
+	if err != nil {
+		return nil, err
+	}
+	priv.IsSubkey = true
+	pub := priv.PublicKey
+
+	sig := &packet.Signature{
+		CreationTime:              currentTime,
+		SigType:                   packet.SigTypeSubkeyBinding,
+		PubKeyAlgo:                e.PrivateKey.PubKeyAlgo,
+		Hash:                      config.Hash(),
+		FlagsValid:                true,
+		FlagEncryptStorage:        true,
+		FlagEncryptCommunications: true,
+		IssuerKeyId:               &e.PrivateKey.KeyId,
+	}
+	if err := sig.SignKey(&pub, e.PrivateKey, config); err != nil {
+		return nil, err
+	}
+
+	e.Subkeys = append(e.Subkeys, Subkey{
+		PublicKey:  &pub,
+		PrivateKey: priv,
+		Sig:        sig,
+	})
+	return &e.Subkeys[len(e.Subkeys)-1], nil
+}
+
+// Clone returns a deep copy of e: its keys, identities, subkeys and
+// signatures are all copies, so that the clone can be changed, re-signed
+// or have its private keys decrypted without affecting e. The underlying
+// key material, which is never changed in place, is shared.
+func (e *Entity) Clone() *Entity {
+	c := &Entity{
+		Identities:            make(map[string]*Identity, len(e.Identities)),
+		Revocations:           cloneSignatures(e.Revocations),
+		UnverifiedRevocations: cloneSignatures(e.UnverifiedRevocations),
+		DirectSignature:       cloneSignature(e.DirectSignature),
+		OtherDirectSignatures: cloneSignatures(e.OtherDirectSignatures),
+	}
+	c.PrimaryKey, c.PrivateKey = cloneKeys(e.PrimaryKey, e.PrivateKey)
+
+	userIds := make(map[*packet.UserId]*packet.UserId)
+	cloneUserId := func(uid *packet.UserId) *packet.UserId {
+		if uid == nil {
+			return nil
+		}
+		if cloned, ok := userIds[uid]; ok {
+			return cloned
+		}
+		cloned := *uid
+		userIds[uid] = &cloned
+		return &cloned
+	}
+	for _, uid := range e.userIds {
+		c.userIds = append(c.userIds, cloneUserId(uid))
+	}
+	for name, ident := range e.Identities {
+		c.Identities[name] = &Identity{
+			Name:          ident.Name,
+			UserId:        cloneUserId(ident.UserId),
+			SelfSignature: cloneSignature(ident.SelfSignature),
+			Signatures:    cloneSignatures(ident.Signatures),
+			Revocation:    cloneSignature(ident.Revocation),
+		}
+	}
+
+	for _, subkey := range e.Subkeys {
+		c.Subkeys = append(c.Subkeys, cloneSubkey(subkey))
+	}
+	for _, bad := range e.BadSubkeys {
+		c.BadSubkeys = append(c.BadSubkeys, BadSubkey{cloneSubkey(bad.Subkey), bad.Err})
+	}
+	for _, bad := range e.BadSelfSignatures {
+		c.BadSelfSignatures = append(c.BadSelfSignatures, BadSelfSignature{bad.Name, cloneSignature(bad.Signature), bad.Err})
+	}
+	c.UnknownPackets = append([]errors.UnknownPacketTypeError(nil), e.UnknownPackets...)
+	return c
+}
+
+// cloneKeys copies a public key and its private key, if any, keeping the
+// public key embedded in the private key if that is what pub refers to.
+func cloneKeys(pub *packet.PublicKey, priv *packet.PrivateKey) (*packet.PublicKey, *packet.PrivateKey) {
+	var clonedPriv *packet.PrivateKey
+	if priv != nil {
+		p := *priv
+		clonedPriv = &p
+		if pub == &priv.PublicKey {
+			return &clonedPriv.PublicKey, clonedPriv
+		}
+	}
+	if pub == nil {
+		return nil, clonedPriv
+	}
+	clonedPub := *pub
+	return &clonedPub, clonedPriv
+}
+
+func cloneSubkey(subkey Subkey) Subkey {
+	pub, priv := cloneKeys(subkey.PublicKey, subkey.PrivateKey)
+	return Subkey{
+		PublicKey:  pub,
+		PrivateKey: priv,
+		Sig:        cloneSignature(subkey.Sig),
+		Revocation: cloneSignature(subkey.Revocation),
+	}
+}
+
+func cloneSignature(sig *packet.Signature) *packet.Signature {
+	if sig == nil {
+		return nil
+	}
+	c := *sig
+	c.HashSuffix = cloneBytes(sig.HashSuffix)
+	c.SigLifetimeSecs = cloneUint32(sig.SigLifetimeSecs)
+	c.KeyLifetimeSecs = cloneUint32(sig.KeyLifetimeSecs)
+	c.PreferredSymmetric = cloneBytes(sig.PreferredSymmetric)
+	c.PreferredHash = cloneBytes(sig.PreferredHash)
+	c.PreferredCompression = cloneBytes(sig.PreferredCompression)
+	if sig.PreferredAEAD != nil {
+		c.PreferredAEAD = append([]packet.AEADMode{}, sig.PreferredAEAD...)
+	}
+	if sig.IssuerKeyId != nil {
+		keyId := *sig.IssuerKeyId
+		c.IssuerKeyId = &keyId
+	}
+	c.IsPrimaryId = cloneBool(sig.IsPrimaryId)
+	c.IssuerFingerprint = cloneBytes(sig.IssuerFingerprint)
+	c.Exportable = cloneBool(sig.Exportable)
+	if sig.SignerUserId != nil {
+		signerUserId := *sig.SignerUserId
+		c.SignerUserId = &signerUserId
+	}
+	if sig.AttestedCertifications != nil {
+		c.AttestedCertifications = make([][]byte, len(sig.AttestedCertifications))
+		for i, digest := range sig.AttestedCertifications {
+			c.AttestedCertifications[i] = cloneBytes(digest)
+		}
+	}
+	if sig.RevocationReason != nil {
+		reason := *sig.RevocationReason
+		c.RevocationReason = &reason
+	}
+	c.EmbeddedSignature = cloneSignature(sig.EmbeddedSignature)
+	if sig.DesignatedRevoker != nil {
+		revoker := *sig.DesignatedRevoker
+		revoker.Fingerprint = cloneBytes(revoker.Fingerprint)
+		c.DesignatedRevoker = &revoker
+	}
+	c.ExtraSubpackets = cloneSubpackets(sig.ExtraSubpackets)
+	c.UnknownSubpackets = cloneSubpackets(sig.UnknownSubpackets)
+	return &c
+}
+
+func cloneSubpackets(subpackets []packet.Subpacket) []packet.Subpacket {
+	if subpackets == nil {
+		return nil
+	}
+	c := make([]packet.Subpacket, len(subpackets))
+	for i, subpacket := range subpackets {
+		c[i] = subpacket
+		c[i].Contents = cloneBytes(subpacket.Contents)
+	}
+	return c
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func cloneUint32(v *uint32) *uint32 {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func cloneBool(v *bool) *bool {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func cloneSignatures(sigs []*packet.Signature) []*packet.Signature {
+	if sigs == nil {
+		return nil
+	}
+	c := make([]*packet.Signature, len(sigs))
+	for i, sig := range sigs {
+		c[i] = cloneSignature(sig)
+	}
+	return c
+}
+
 // CopySubkeyRevocations copies subkey revocations from the src Entity over
 // to the receiver entity. We need this because `gpg --export-secret-key` does
 // not appear to output subkey revocations.  In this case we need to manually
@@ -905,6 +2325,84 @@ func (e *Entity) CopySubkeyRevocations(src *Entity) {
 	}
 }
 
+// StripSignatures returns a copy of e that keeps its key material and user
+// ids but drops all certifications by other keys. Revocations and
+// direct-key signatures are kept as they are. Self signatures are replaced
+// by unsigned placeholders that keep only the key flags, key expiration,
+// preferences, features and primary user id marker, so the result must be
+// signed again (for example with SerializePrivate) before it can be
+// serialized. e is left as it is.
+func (e *Entity) StripSignatures() *Entity {
+	c := e.Clone()
+	stripped := &Entity{
+		PrimaryKey:            c.PrimaryKey,
+		PrivateKey:            c.PrivateKey,
+		Identities:            make(map[string]*Identity),
+		Revocations:           c.Revocations,
+		UnverifiedRevocations: c.UnverifiedRevocations,
+		DirectSignature:       c.DirectSignature,
+		OtherDirectSignatures: c.OtherDirectSignatures,
+		userIds:               c.userIds,
+	}
+	now := time.Now()
+	primary := c.primaryIdentity()
+	for name, ident := range c.Identities {
+		sig := stripSelfSignature(ident.SelfSignature, packet.SigTypePositiveCert, c.PrimaryKey, now)
+		if ident == primary {
+			isPrimaryId := true
+			sig.IsPrimaryId = &isPrimaryId
+		}
+		stripped.Identities[name] = &Identity{
+			Name:          ident.Name,
+			UserId:        ident.UserId,
+			SelfSignature: sig,
+			Revocation:    ident.Revocation,
+		}
+	}
+	for _, subkey := range c.Subkeys {
+		stripped.Subkeys = append(stripped.Subkeys, Subkey{
+			PublicKey:  subkey.PublicKey,
+			PrivateKey: subkey.PrivateKey,
+			Sig:        stripSelfSignature(subkey.Sig, packet.SigTypeSubkeyBinding, c.PrimaryKey, now),
+			Revocation: subkey.Revocation,
+		})
+	}
+	return stripped
+}
+
+// stripSelfSignature returns an unsigned signature of type sigType by
+// primary that carries over the key flags, key expiration, preferences and
+// features of sig, which may be nil. sig must not be shared with another
+// entity, as its fields are reused.
+func stripSelfSignature(sig *packet.Signature, sigType packet.SignatureType, primary *packet.PublicKey, now time.Time) *packet.Signature {
+	stripped := &packet.Signature{
+		SigType:      sigType,
+		PubKeyAlgo:   primary.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: now,
+		IssuerKeyId:  &primary.KeyId,
+	}
+	if sig == nil {
+		return stripped
+	}
+	if sig.FlagsValid {
+		stripped.FlagsValid = true
+		stripped.FlagCertify = sig.FlagCertify
+		stripped.FlagSign = sig.FlagSign
+		stripped.FlagEncryptCommunications = sig.FlagEncryptCommunications
+		stripped.FlagEncryptStorage = sig.FlagEncryptStorage
+	}
+	stripped.KeyLifetimeSecs = sig.KeyLifetimeSecs
+	stripped.PreferredSymmetric = sig.PreferredSymmetric
+	stripped.PreferredHash = sig.PreferredHash
+	stripped.PreferredCompression = sig.PreferredCompression
+	stripped.PreferredAEAD = sig.PreferredAEAD
+	stripped.PreferredKeyServer = sig.PreferredKeyServer
+	stripped.MDC = sig.MDC
+	stripped.AEAD = sig.AEAD
+	return stripped
+}
+
 // CheckDesignatedRevokers will try to confirm any of designated
 // revocation of entity. For this function to work, revocation
 // issuer's key should be found in keyring. First successfully
@@ -3,10 +3,16 @@ package openpgp
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"io"
+	"io/ioutil"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -14,6 +20,7 @@ import (
 	"github.com/keybase/go-crypto/openpgp/armor"
 	pgpErrors "github.com/keybase/go-crypto/openpgp/errors"
 	"github.com/keybase/go-crypto/openpgp/packet"
+	"github.com/keybase/go-crypto/rsa"
 )
 
 func TestKeyExpiry(t *testing.T) {
@@ -133,6 +140,107 @@ func TestGoodCrossSignature(t *testing.T) {
 	}
 }
 
+type mapVerificationCache struct {
+	valid      map[packet.VerificationCacheKey]bool
+	gets, hits int
+}
+
+func (c *mapVerificationCache) Get(key packet.VerificationCacheKey) bool {
+	c.gets++
+	if c.valid[key] {
+		c.hits++
+		return true
+	}
+	return false
+}
+
+func (c *mapVerificationCache) Set(key packet.VerificationCacheKey) {
+	c.valid[key] = true
+}
+
+func TestVerificationCache(t *testing.T) {
+	cache := &mapVerificationCache{valid: make(map[packet.VerificationCacheKey]bool)}
+	config := &packet.Config{VerificationCache: cache}
+
+	kring, err := ReadKeyRingWithConfig(readerFromHex(testKeys1And2Hex), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kring) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(kring))
+	}
+	if cache.gets == 0 || len(cache.valid) == 0 {
+		t.Fatal("expected cache to be consulted and populated")
+	}
+	if cache.hits != 0 {
+		t.Errorf("expected no cache hits on first read, got %d", cache.hits)
+	}
+
+	populated := len(cache.valid)
+	cache.gets = 0
+	if _, err = ReadKeyRingWithConfig(readerFromHex(testKeys1And2Hex), config); err != nil {
+		t.Fatal(err)
+	}
+	if cache.hits != cache.gets {
+		t.Errorf("expected every lookup to hit on second read, got %d of %d", cache.hits, cache.gets)
+	}
+	if len(cache.valid) != populated {
+		t.Errorf("expected no new cache entries, got %d, want %d", len(cache.valid), populated)
+	}
+
+	// A cached signature must not vouch for other signed data.
+	ident := kring[0].primaryIdentity()
+	if err := kring[0].PrimaryKey.VerifyUserIdSignatureWithConfig(ident.Name+"x", kring[0].PrimaryKey, ident.SelfSignature, config); err == nil {
+		t.Error("expected signature over a different user id to fail verification")
+	}
+}
+
+func TestSamePrimaryKey(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	armored := func(serialize func(io.Writer) error) string {
+		buf := new(bytes.Buffer)
+		w, err := armor.Encode(buf, PublicKeyType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		return buf.String()
+	}
+	full := armored(kring[0].Serialize)
+	minimal := armored(kring[0].PrimaryKey.Serialize)
+	other := armored(kring[1].Serialize)
+
+	for _, test := range []struct {
+		name string
+		a, b io.Reader
+		same bool
+	}{
+		{"full and minimal", strings.NewReader(full), strings.NewReader(minimal), true},
+		{"binary and minimal", readerFromHex(testKeys1And2Hex), strings.NewReader(minimal), true},
+		{"different keys", strings.NewReader(full), strings.NewReader(other), false},
+	} {
+		same, err := SamePrimaryKey(test.a, test.b)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if same != test.same {
+			t.Errorf("%s: got %v, want %v", test.name, same, test.same)
+		}
+	}
+
+	if _, err := SamePrimaryKey(strings.NewReader(full), strings.NewReader("")); err == nil {
+		t.Error("expected error for empty input")
+	}
+}
+
 // TestExternallyRevokableKey attempts to load and parse a key with a third party revocation permission.
 func TestExternallyRevocableKey(t *testing.T) {
 	kring, err := ReadKeyRing(readerFromHex(subkeyUsageHex))
@@ -217,6 +325,79 @@ func TestSubkeyRevocation(t *testing.T) {
 	}
 }
 
+func TestRevokedAt(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(revokedKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := kring[0]
+	revokedAt := e.Revocations[0].CreationTime
+	if !e.Revoked(revokedAt) || !e.Revoked(time.Now()) {
+		t.Error("revoked key not reported as revoked")
+	}
+	if e.Revoked(revokedAt.Add(-time.Second)) {
+		t.Error("key reported as revoked before its revocation")
+	}
+
+	kring, err = ReadKeyRing(readerFromHex(revokedSubkeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = kring[0]
+	if e.Revoked(time.Now()) {
+		t.Error("key with a revoked subkey reported as revoked")
+	}
+	for _, subkey := range e.Subkeys {
+		revoked := subkey.PublicKey.KeyId == 0x677815E371C2FD23
+		if subkey.Revoked(time.Now()) != revoked {
+			t.Errorf("subkey %X: got Revoked %v, want %v", subkey.PublicKey.KeyId, !revoked, revoked)
+		}
+		if revoked && subkey.Revoked(subkey.Revocation.CreationTime.Add(-time.Second)) {
+			t.Errorf("subkey %X reported as revoked before its revocation", subkey.PublicKey.KeyId)
+		}
+	}
+}
+
+func TestHardAndSoftRevocation(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := kring[0]
+	revokedAt := time.Now()
+	signedAt := revokedAt.Add(-time.Hour)
+
+	for _, test := range []struct {
+		reason uint8
+		hard   bool
+	}{
+		{1, false}, // superseded
+		{2, true},  // compromised
+	} {
+		reason := test.reason
+		revocation := &packet.Signature{
+			SigType:          packet.SigTypeKeyRevocation,
+			CreationTime:     revokedAt,
+			RevocationReason: &reason,
+		}
+		e.Revocations = []*packet.Signature{revocation}
+		e.Subkeys[0].Revocation = revocation
+
+		if !e.Revoked(revokedAt) || !e.Subkeys[0].Revoked(revokedAt) {
+			t.Errorf("reason %d: not revoked after the revocation", reason)
+		}
+		if e.Revoked(signedAt) || e.Subkeys[0].Revoked(signedAt) {
+			t.Errorf("reason %d: revoked before the revocation", reason)
+		}
+		if got := e.HardRevoked(); got != test.hard {
+			t.Errorf("reason %d: key hard revoked is %v, want %v", reason, got, test.hard)
+		}
+		if got := e.Subkeys[0].HardRevoked(); got != test.hard {
+			t.Errorf("reason %d: subkey hard revoked is %v, want %v", reason, got, test.hard)
+		}
+	}
+}
+
 func TestKeyWithSubKeyAndBadSelfSigOrder(t *testing.T) {
 	// This key was altered so that the self signatures following the
 	// subkey are in a sub-optimal order.
@@ -360,6 +541,47 @@ func TestIdVerification(t *testing.T) {
 	}
 }
 
+func TestValidCertificationsExpired(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kring[1].PrivateKey.Decrypt([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+	const identity = "Test Key 1 (RSA)"
+	created := time.Unix(1500000000, 0)
+	lifetime := uint32(24 * 60 * 60)
+	sig := &packet.Signature{
+		SigType:         packet.SigTypeGenericCert,
+		PubKeyAlgo:      kring[1].PrivateKey.PubKeyAlgo,
+		Hash:            crypto.SHA256,
+		CreationTime:    created,
+		SigLifetimeSecs: &lifetime,
+		IssuerKeyId:     &kring[1].PrivateKey.KeyId,
+	}
+	if err := sig.SignUserId(identity, kring[0].PrimaryKey, kring[1].PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	ident := kring[0].Identities[identity]
+	ident.Signatures = append(ident.Signatures, sig)
+
+	certifiers := EntityList{kring[1]}
+	if certs := kring[0].ValidCertifications(identity, certifiers, created.Add(time.Hour)); len(certs) != 1 || certs[0] != sig {
+		t.Errorf("got %d valid certifications before expiry, want the new one", len(certs))
+	}
+	if certs := kring[0].ValidCertifications(identity, certifiers, created.Add(48*time.Hour)); len(certs) != 0 {
+		t.Errorf("got %d valid certifications after expiry, want none", len(certs))
+	}
+	if certs := kring[0].ValidCertifications(identity, certifiers, created.Add(-time.Hour)); len(certs) != 0 {
+		t.Errorf("got %d valid certifications before creation, want none", len(certs))
+	}
+	if certs := kring[0].ValidCertifications(identity, EntityList{kring[0]}, created.Add(time.Hour)); len(certs) != 0 {
+		t.Errorf("got %d valid certifications without the certifier's key, want none", len(certs))
+	}
+}
+
 func testKey(t *testing.T, key string, which string) {
 	_, err := ReadArmoredKeyRing(strings.NewReader(key))
 	if err != nil {
@@ -606,119 +828,2032 @@ func TestNewEntityWithPreferredSymmetric(t *testing.T) {
 		}
 	}
 }
-func TestNewEntityWithoutPreferredSymmetric(t *testing.T) {
-	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", nil)
+
+func TestNewEntityDSAElGamal(t *testing.T) {
+	c := &packet.Config{Algorithm: packet.PubKeyAlgoDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", c)
 	if err != nil {
 		t.Fatal(err)
 	}
-	for _, identity := range entity.Identities {
-		if len(identity.SelfSignature.PreferredSymmetric) != 0 {
-			t.Fatalf("Expected preferred cipher to be empty but got length %d", len(identity.SelfSignature.PreferredSymmetric))
-		}
+
+	buf := new(bytes.Buffer)
+	if err := entity.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	kring, err := ReadKeyRing(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := kring[0]
+	if e.PrimaryKey.PubKeyAlgo != packet.PubKeyAlgoDSA {
+		t.Errorf("primary key algorithm is %d, want DSA", e.PrimaryKey.PubKeyAlgo)
+	}
+	if bits, _ := e.PrimaryKey.BitLength(); bits != 2048 {
+		t.Errorf("primary key is %d bits, want 2048", bits)
+	}
+	if len(e.Subkeys) != 1 || e.Subkeys[0].PublicKey.PubKeyAlgo != packet.PubKeyAlgoElGamal {
+		t.Fatalf("want a single ElGamal subkey, got %#v", e.Subkeys)
 	}
-}
 
-func TestKeyWithRevokedSubKey(t *testing.T) {
-	// This key contains a revoked sub key:
-	//  pub   rsa1024/0x4CBD826C39074E38 2018-06-14 [SC]
-	//        Key fingerprint = 3F95 169F 3FFA 7D3F 2B47  6F0C 4CBD 826C 3907 4E38
-	//  uid   Golang Gopher <no-reply@golang.com>
-	//  sub   rsa1024/0x945DB1AF61D85727 2018-06-14 [S] [revoked: 2018-06-14]
-	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(keyWithSubKey))
+	sig := new(bytes.Buffer)
+	if err := DetachSign(sig, e, strings.NewReader(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+	if signer, err := CheckDetachedSignature(kring, strings.NewReader(signedInput), sig); err != nil || signer != e {
+		t.Errorf("signature check failed: %v, %v", signer, err)
+	}
+
+	msg := new(bytes.Buffer)
+	w, err := Encrypt(msg, kring, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(keys) != 1 {
-		t.Fatal("Failed to read key with a sub key")
+	w.Write([]byte(signedInput))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
 	}
-	identity := keys[0].Identities["Golang Gopher <no-reply@golang.com>"]
-	// Test for an issue where Subkey Binding Signatures (RFC 4880 5.2.1) were added to the identity
-	// preceding the Subkey Packet if the Subkey Packet was followed by more than one signature.
-	// For example, the current key has the following layout:
-	//    PUBKEY UID SELFSIG SUBKEY REV SELFSIG
-	// The last SELFSIG would be added to the UID's signatures. This is wrong.
-	if numIdentitySigs, numExpected := len(identity.Signatures), 0; numIdentitySigs != numExpected {
-		t.Fatalf("got %d identity signatures, expected %d", numIdentitySigs, numExpected)
+	md, err := ReadMessage(msg, kring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if numSubKeys, numExpected := len(keys[0].Subkeys), 1; numSubKeys != numExpected {
-		t.Fatalf("got %d subkeys, expected %d", numSubKeys, numExpected)
+	if md.DecryptedWith.PublicKey.PubKeyAlgo != packet.PubKeyAlgoElGamal {
+		t.Errorf("decrypted with algorithm %d, want ElGamal", md.DecryptedWith.PublicKey.PubKeyAlgo)
 	}
-	subKey := keys[0].Subkeys[0]
-	if subKey.Sig == nil {
-		t.Fatalf("subkey signature is nil")
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != signedInput {
+		t.Errorf("got %q, want %q", contents, signedInput)
+	}
+
+	c = &packet.Config{Algorithm: packet.PubKeyAlgoDSA, DSABits: 1536}
+	if _, err := NewEntity("Golang Gopher", "", "", c); err == nil {
+		t.Error("made a DSA key of an unsupported size")
 	}
 }
 
-// Try decryption when private key is stubbed. Caveat is that when a key is
-// stubbed, privateKey will be non-nil, but privateKey.PrivateKey will be nil.
-// Consumers will often overlook this fact, so make sure exposed API fails
-// gracefully.
-func TestStubbedPrivateKeyDecryption(t *testing.T) {
-	makeECDH := func() *Entity {
-		t.Logf("Making ECDH key")
-		return generateEccKeysForTest(t, elliptic.P521(), elliptic.P521())
+func TestNewEntityWithPreferredAEAD(t *testing.T) {
+	c := &packet.Config{
+		RSABits:       1024,
+		PreferredAEAD: []packet.AEADMode{packet.AEADModeOCB, packet.AEADModeEAX},
 	}
-	makeRSA := func() *Entity {
-		t.Logf("Making RSA key")
-		cfg := &packet.Config{RSABits: 768}
-		entity, err := NewEntity("Go-Crypto PGP Test", "Test Only Do Not Use", "alice@example.com", cfg)
-		if err != nil {
-			t.Fatalf("makeRSA failed with %s", err)
-		}
-		return entity
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", c)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	funcs := []func() *Entity{makeECDH, makeRSA}
-	for _, f := range funcs {
-		entity := f()
-
-		buf := new(bytes.Buffer)
-		armored, err := armor.Encode(buf, "PGP MESSAGE", nil)
-		writer, err := Encrypt(armored, []*Entity{entity}, nil, nil, nil)
-		if err != nil {
-			t.Fatalf("Failed to Encrypt: %s", err)
-		}
-		msgstr := "Hello Test Encryption TestStubbedPrivateKeyOperations."
-		io.Copy(writer, bytes.NewBufferString(msgstr))
-		if err := writer.Close(); err != nil {
-			t.Fatalf("Failed to writer.Close: %s", err)
+	buf := new(bytes.Buffer)
+	if err := entity.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	kring, err := ReadKeyRing(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, identity := range kring[0].Identities {
+		got := identity.SelfSignature.PreferredAEAD
+		if len(got) != 2 || got[0] != packet.AEADModeOCB || got[1] != packet.AEADModeEAX {
+			t.Fatalf("Expected preferred AEAD modes %v, got %v", c.PreferredAEAD, got)
 		}
-		if err := armored.Close(); err != nil {
-			t.Fatalf("Failed to armored.Close: %s", err)
+	}
+}
+
+// readTestKeys returns the keys of testKeys1And2PrivateHex with all their
+// secret keys decrypted, for tests that need keys to sign with but don't
+// depend on how they were generated.
+func readTestKeys(t *testing.T) EntityList {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kring[1].PrivateKey.Decrypt([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	for _, subkey := range kring[1].Subkeys {
+		if err := subkey.PrivateKey.Decrypt([]byte("passphrase")); err != nil {
+			t.Fatal(err)
 		}
+	}
+	return kring
+}
 
-		// Stub the subkey
-		entity.Subkeys[0].PrivateKey.PrivateKey = nil
+// readDSATestKey returns the DSA key of dsaTestKeyPrivateHex, which can sign
+// and isn't one of the keys of testKeys1And2PrivateHex.
+func readDSATestKey(t *testing.T) *Entity {
+	kring, err := ReadKeyRing(readerFromHex(dsaTestKeyPrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kring[0]
+}
 
-		var entities EntityList
-		entities = append(entities, entity)
+// addIdentity adds an identity for uid to e that isn't the primary one. Its
+// self-signature is a copy of that of the primary identity, so it has to be
+// signed again, for example by SerializePrivate.
+func addIdentity(e *Entity, uid *packet.UserId) *Identity {
+	sig := *e.PrimaryIdentity().SelfSignature
+	sig.IsPrimaryId = nil
+	ident := &Identity{Name: uid.Id, UserId: uid, SelfSignature: &sig}
+	e.Identities[uid.Id] = ident
+	return ident
+}
 
-		decKeys := entities.DecryptionKeys()
-		if len(decKeys) != 0 {
-			t.Fatalf("Expecting DecryptionKeys() to return empty list")
+func TestReadEntityReorderedPackets(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	e := readTestKeys(t)[0]
+	addIdentity(e, packet.NewUserId("Second", "", "second@example.com"))
+
+	priv, err := rsa.GenerateKey(config.Random(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subkey := e.Subkeys[0]
+	subkey.PublicKey = packet.NewRSAPublicKey(config.Now(), &priv.PublicKey)
+	subkey.PrivateKey = packet.NewRSAPrivateKey(config.Now(), priv)
+	subkey.PublicKey.IsSubkey = true
+	subkey.PrivateKey.IsSubkey = true
+	bindingSig := *subkey.Sig
+	subkey.Sig = &bindingSig
+	e.Subkeys = append(e.Subkeys, subkey)
+
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Split the key into blocks that each start with a user id or subkey
+	// and hold the signatures that follow it.
+	var blocks [][]packet.Packet
+	packets := packet.NewReader(buf)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := p.(*packet.Signature); !ok {
+			blocks = append(blocks, nil)
 		}
+		blocks[len(blocks)-1] = append(blocks[len(blocks)-1], p)
+	}
+	if len(blocks) != 5 {
+		t.Fatalf("expected 5 blocks, got %d", len(blocks))
+	}
 
-		block, err := armor.Decode(bytes.NewBuffer(buf.Bytes()))
-		_, err = ReadMessage(block.Body, entities, nil, nil)
-		t.Logf("ReadMessage returned: %s", err)
-		if err == nil {
-			t.Fatalf("Expected a failure in ReadMessage")
+	// A user attribute with a certification that must not be attributed
+	// to the user id before it.
+	uat := packet.NewUserAttribute(&packet.OpaqueSubpacket{SubType: 100, Contents: []byte{1}})
+	uatSig := &packet.Signature{
+		SigType:      packet.SigTypePersonaCert,
+		PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: config.Now(),
+		IssuerKeyId:  &e.PrimaryKey.KeyId,
+	}
+	if err := uatSig.SignUserId("attribute", e.PrimaryKey, e.PrivateKey, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Primary key, subkey, user id, user attribute, subkey, user id.
+	reordered := new(bytes.Buffer)
+	for _, i := range []int{0, 3, 1, -1, 4, 2} {
+		block := []packet.Packet{uat, uatSig}
+		if i >= 0 {
+			block = blocks[i]
+		}
+		for _, p := range block {
+			var err error
+			switch p := p.(type) {
+			case *packet.PrivateKey:
+				err = p.Serialize(reordered)
+			case *packet.UserId:
+				err = p.Serialize(reordered)
+			case *packet.UserAttribute:
+				err = p.Serialize(reordered)
+			case *packet.Signature:
+				err = p.Serialize(reordered)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
 		}
+	}
 
-		if err != pgpErrors.ErrKeyIncorrect {
-			t.Fatalf("Expecting an error to be ErrKeyIncorrect")
+	read, err := ReadEntity(packet.NewReader(reordered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Identities) != 2 {
+		t.Fatalf("expected 2 identities, got %d", len(read.Identities))
+	}
+	for name, ident := range read.Identities {
+		if ident.SelfSignature == nil {
+			t.Errorf("identity %q has no self-signature", name)
+		}
+		if len(ident.Signatures) != 0 {
+			t.Errorf("identity %q picked up %d stray signatures", name, len(ident.Signatures))
+		}
+	}
+	if len(read.Subkeys) != 2 || len(read.BadSubkeys) != 0 {
+		t.Fatalf("expected 2 good subkeys, got %d good and %d bad", len(read.Subkeys), len(read.BadSubkeys))
+	}
+	for i, subkey := range read.Subkeys {
+		if subkey.PublicKey.KeyId != e.Subkeys[i].PublicKey.KeyId {
+			t.Errorf("subkey %d: got key id %x, want %x", i, subkey.PublicKey.KeyId, e.Subkeys[i].PublicKey.KeyId)
 		}
 	}
 }
 
-// See https://github.com/keybase/client/issues/18944; ReadKeyRing used to panic here
-func TestElGamalPrivateKeyFuzz(t *testing.T) {
-	d, err := base64.StdEncoding.DecodeString("xyIEOQTlQxQAAAAAAAAAADZlZ2VWZWU7wgAEfzdGaWxlIFOnxyIELgTlQwEAAAAAAA==")
+func TestStripSignatures(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = ReadKeyRing(bytes.NewBuffer(d))
-	if err == nil {
-		t.Fatal(errors.New("should have gotten an error parsing elgamal sign-or-encrypt private key"))
+	e := kring[0]
+	config := &packet.Config{}
+	signer := readTestKeys(t)[1]
+	ident := e.primaryIdentity()
+	if err := e.SignIdentity(ident.Name, signer, config); err != nil {
+		t.Fatal(err)
+	}
+	direct := &packet.Signature{
+		SigType:      packet.SigTypeDirectSignature,
+		PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: e.PrimaryKey.CreationTime,
+		IssuerKeyId:  &e.PrimaryKey.KeyId,
+	}
+	if err := direct.SignDirectKey(e.PrimaryKey, e.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	e.DirectSignature = direct
+	e.Revocations = []*packet.Signature{{SigType: packet.SigTypeKeyRevocation, CreationTime: time.Now()}}
+
+	stripped := e.StripSignatures()
+	if len(ident.Signatures) != 1 {
+		t.Error("StripSignatures modified the original entity")
+	}
+	if len(stripped.Revocations) != 1 {
+		t.Errorf("got %d revocations, want 1", len(stripped.Revocations))
+	}
+	if stripped.DirectSignature == nil || !stripped.DirectSignature.EqualTo(direct) {
+		t.Error("the direct-key signature wasn't kept")
+	}
+	if len(stripped.Identities) != len(e.Identities) || len(stripped.Subkeys) != len(e.Subkeys) {
+		t.Fatalf("got %d identities and %d subkeys, want %d and %d",
+			len(stripped.Identities), len(stripped.Subkeys), len(e.Identities), len(e.Subkeys))
+	}
+	for name, ident := range stripped.Identities {
+		if len(ident.Signatures) != 0 {
+			t.Errorf("identity %q kept %d certifications", name, len(ident.Signatures))
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := stripped.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.PrimaryKey.KeyId != e.PrimaryKey.KeyId {
+		t.Errorf("got primary key %x, want %x", read.PrimaryKey.KeyId, e.PrimaryKey.KeyId)
+	}
+	if read.DirectSignature == nil {
+		t.Error("re-signed key lost its direct-key signature")
+	}
+	if _, ok := read.Identities[ident.Name]; !ok {
+		t.Errorf("re-signed key lost identity %q", ident.Name)
+	}
+	if len(read.Subkeys) != len(e.Subkeys) {
+		t.Errorf("re-signed key has %d subkeys, want %d", len(read.Subkeys), len(e.Subkeys))
+	}
+	if _, ok := read.encryptionKey(time.Now()); !ok {
+		t.Error("re-signed key has no encryption key")
+	}
+	selfSig, readSig := ident.SelfSignature, read.Identities[ident.Name].SelfSignature
+	if !bytes.Equal(readSig.PreferredSymmetric, selfSig.PreferredSymmetric) ||
+		!bytes.Equal(readSig.PreferredHash, selfSig.PreferredHash) ||
+		!bytes.Equal(readSig.PreferredCompression, selfSig.PreferredCompression) {
+		t.Errorf("re-signed key has preferences %v, %v and %v, want %v, %v and %v",
+			readSig.PreferredSymmetric, readSig.PreferredHash, readSig.PreferredCompression,
+			selfSig.PreferredSymmetric, selfSig.PreferredHash, selfSig.PreferredCompression)
+	}
+
+	// The copy doesn't share keys with e.
+	if stripped.PrimaryKey == e.PrimaryKey || stripped.PrivateKey == e.PrivateKey ||
+		stripped.Subkeys[0].PrivateKey == e.Subkeys[0].PrivateKey {
+		t.Error("the stripped copy shares keys with the original")
+	}
+}
+
+func TestAttestCertifications(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := kring[0]
+	config := &packet.Config{}
+	var certs []*packet.Signature
+	ident := e.primaryIdentity()
+	for _, signer := range []*Entity{readTestKeys(t)[1], readDSATestKey(t)} {
+		if err := e.SignIdentity(ident.Name, signer, config); err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, ident.Signatures[len(ident.Signatures)-1])
+	}
+	if err := e.AttestCertifications(ident.Name, certs, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := e.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attestation *packet.Signature
+	for _, sig := range read.Identities[ident.Name].Signatures {
+		if sig.SigType == packet.SigTypeAttestation {
+			attestation = sig
+		}
+	}
+	if attestation == nil {
+		t.Fatal("attestation signature not found")
+	}
+	if err := read.PrimaryKey.VerifyUserIdSignature(ident.Name, read.PrimaryKey, attestation); err != nil {
+		t.Errorf("attestation signature doesn't verify: %s", err)
+	}
+	if len(attestation.AttestedCertifications) != len(certs) {
+		t.Fatalf("got %d attested certifications, want %d", len(attestation.AttestedCertifications), len(certs))
+	}
+	for i, cert := range certs {
+		digest, err := cert.AttestationDigest(attestation.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(attestation.AttestedCertifications[i], digest) {
+			t.Errorf("certification %d: got digest %x, want %x", i, attestation.AttestedCertifications[i], digest)
+		}
+	}
+}
+
+func TestAttestationDigestKnownAnswer(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The SHA-256 of 0x88, the four-octet body length and the body of the
+	// self-signature of the first key, with its ten octets of unhashed
+	// subpackets left out and their length set to zero, as computed
+	// independently of this package.
+	const want = "dd796442e75385117ad8b341e221bdc222a9c3a109978a740fccda1883aa2ace"
+	digest, err := kring[0].primaryIdentity().SelfSignature.AttestationDigest(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(digest); got != want {
+		t.Errorf("got digest %s, want %s", got, want)
+	}
+}
+
+func TestSerializePrivateDeterministic(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	config := &packet.Config{Time: func() time.Time { return now }}
+
+	var outputs [2][]byte
+	for i := range outputs {
+		buf := new(bytes.Buffer)
+		if err := kring[0].SerializePrivate(buf, config); err != nil {
+			t.Fatal(err)
+		}
+		outputs[i] = buf.Bytes()
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("re-signing the same key twice gave different bytes")
+	}
+}
+
+func TestAllUserIds(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	e, err := NewEntity("Good", "", "good@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := e.primaryIdentity()
+	bad := packet.NewUserId("Bad", "", "bad@example.com")
+
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, config); err != nil {
+		t.Fatal(err)
+	}
+	// Give the second user id the first one's self-signature, which
+	// won't verify over it.
+	if err := bad.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := good.SelfSignature.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Identities) != 1 {
+		t.Errorf("expected 1 verified identity, got %d", len(read.Identities))
+	}
+	infos := read.AllUserIds()
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 user ids, got %d", len(infos))
+	}
+	if infos[0].Name != good.Name || !infos[0].Verified {
+		t.Errorf("bad first user id: %+v", infos[0])
+	}
+	if infos[1].Name != bad.Id || infos[1].Verified {
+		t.Errorf("bad second user id: %+v", infos[1])
+	}
+
+	// Entities that weren't read from packets list their identities.
+	if infos := e.AllUserIds(); len(infos) != 1 || infos[0].Name != good.Name || !infos[0].Verified {
+		t.Errorf("bad user ids for new entity: %+v", infos)
+	}
+}
+
+func TestMinimalExport(t *testing.T) {
+	// subkeyUsageHex is what GnuPG produces for the key with
+	// --export-options export-minimal.
+	kring, err := ReadKeyRing(readerFromHex(subkeyUsageHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := kring[0]
+	if len(e.BadSubkeys) != 0 {
+		t.Errorf("unexpected bad subkeys: %v", e.BadSubkeys[0].Err)
+	}
+	if len(e.Subkeys) != 3 {
+		t.Fatalf("expected 3 subkeys, got %d", len(e.Subkeys))
+	}
+	for i, subkey := range e.Subkeys {
+		usage := subkey.Sig.GetKeyFlags().BitField
+		if keys := kring.KeysByIdUsage(subkey.PublicKey.KeyId, nil, usage); len(keys) != 1 {
+			t.Errorf("subkey %d is not usable for %x", i, usage)
+		}
+	}
+}
+
+// stripUnhashedSubpackets returns the serialized v4 signature packet sig with
+// its unhashed subpackets removed, as some minimal exports do.
+func stripUnhashedSubpackets(sig []byte) []byte {
+	body := sig[2:]
+	switch {
+	case sig[1] >= 255:
+		body = sig[6:]
+	case sig[1] >= 192:
+		body = sig[3:]
+	}
+	hashedEnd := 6 + (int(body[4])<<8 | int(body[5]))
+	unhashedEnd := hashedEnd + 2 + (int(body[hashedEnd])<<8 | int(body[hashedEnd+1]))
+
+	stripped := append([]byte{}, body[:hashedEnd]...)
+	stripped = append(stripped, 0, 0)
+	stripped = append(stripped, body[unhashedEnd:]...)
+	header := []byte{sig[0], 255, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[2:], uint32(len(stripped)))
+	return append(header, stripped...)
+}
+
+func TestMinimalExportWithoutUnhashedSubpackets(t *testing.T) {
+	config := &packet.Config{}
+	e := readTestKeys(t)[0]
+	// Sign the self-signatures.
+	if err := e.SerializePrivate(ioutil.Discard, config); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	writeSig := func(sig *packet.Signature) {
+		sigBuf := new(bytes.Buffer)
+		if err := sig.Serialize(sigBuf); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(stripUnhashedSubpackets(sigBuf.Bytes()))
+	}
+	e.PrimaryKey.Serialize(buf)
+	for _, ident := range e.Identities {
+		ident.UserId.Serialize(buf)
+		writeSig(ident.SelfSignature)
+	}
+	for _, subkey := range e.Subkeys {
+		subkey.PublicKey.Serialize(buf)
+		writeSig(subkey.Sig)
+	}
+
+	read, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Identities) != 1 {
+		t.Errorf("expected 1 identity, got %d", len(read.Identities))
+	}
+	if len(read.Subkeys) != 1 || len(read.BadSubkeys) != 0 {
+		t.Errorf("expected 1 good subkey, got %d good and %d bad", len(read.Subkeys), len(read.BadSubkeys))
+	}
+	if _, ok := read.encryptionKey(time.Now()); !ok {
+		t.Error("no usable encryption key")
+	}
+}
+
+func TestNewEntityWithoutPreferredSymmetric(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, identity := range entity.Identities {
+		if len(identity.SelfSignature.PreferredSymmetric) != 0 {
+			t.Fatalf("Expected preferred cipher to be empty but got length %d", len(identity.SelfSignature.PreferredSymmetric))
+		}
+	}
+}
+
+func TestSubkeyFingerprintString(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(expiringKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		fingerprint string
+		keyId       uint64
+	}{
+		{"015ED6A3A2A9438FE3800C18658541481ABB25A0", 0x658541481ABB25A0},
+		{"87B4F3672C4E4922989356A39AA585F496A672F5", 0x9AA585F496A672F5},
+	}
+	subkeys := kring[0].Subkeys
+	if len(subkeys) != len(expected) {
+		t.Fatalf("expected %d subkeys, got %d", len(expected), len(subkeys))
+	}
+	for i, subkey := range subkeys {
+		if fp := subkey.FingerprintString(); fp != expected[i].fingerprint {
+			t.Errorf("subkey %d: got fingerprint %s, want %s", i, fp, expected[i].fingerprint)
+		}
+		if subkey.PublicKey.KeyId != expected[i].keyId {
+			t.Errorf("subkey %d: got key id %X, want %X", i, subkey.PublicKey.KeyId, expected[i].keyId)
+		}
+	}
+}
+
+func TestKeyWithRevokedSubKey(t *testing.T) {
+	// This key contains a revoked sub key:
+	//  pub   rsa1024/0x4CBD826C39074E38 2018-06-14 [SC]
+	//        Key fingerprint = 3F95 169F 3FFA 7D3F 2B47  6F0C 4CBD 826C 3907 4E38
+	//  uid   Golang Gopher <no-reply@golang.com>
+	//  sub   rsa1024/0x945DB1AF61D85727 2018-06-14 [S] [revoked: 2018-06-14]
+	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(keyWithSubKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatal("Failed to read key with a sub key")
+	}
+	identity := keys[0].Identities["Golang Gopher <no-reply@golang.com>"]
+	// Test for an issue where Subkey Binding Signatures (RFC 4880 5.2.1) were added to the identity
+	// preceding the Subkey Packet if the Subkey Packet was followed by more than one signature.
+	// For example, the current key has the following layout:
+	//    PUBKEY UID SELFSIG SUBKEY REV SELFSIG
+	// The last SELFSIG would be added to the UID's signatures. This is wrong.
+	if numIdentitySigs, numExpected := len(identity.Signatures), 0; numIdentitySigs != numExpected {
+		t.Fatalf("got %d identity signatures, expected %d", numIdentitySigs, numExpected)
+	}
+	if numSubKeys, numExpected := len(keys[0].Subkeys), 1; numSubKeys != numExpected {
+		t.Fatalf("got %d subkeys, expected %d", numSubKeys, numExpected)
+	}
+	subKey := keys[0].Subkeys[0]
+	if subKey.Sig == nil {
+		t.Fatalf("subkey signature is nil")
+	}
+}
+
+// Try decryption when private key is stubbed. Caveat is that when a key is
+// stubbed, privateKey will be non-nil, but privateKey.PrivateKey will be nil.
+// Consumers will often overlook this fact, so make sure exposed API fails
+// gracefully.
+func TestStubbedPrivateKeyDecryption(t *testing.T) {
+	makeECDH := func() *Entity {
+		t.Logf("Making ECDH key")
+		return generateEccKeysForTest(t, elliptic.P521(), elliptic.P521())
+	}
+	makeRSA := func() *Entity {
+		t.Logf("Making RSA key")
+		cfg := &packet.Config{RSABits: 768}
+		entity, err := NewEntity("Go-Crypto PGP Test", "Test Only Do Not Use", "alice@example.com", cfg)
+		if err != nil {
+			t.Fatalf("makeRSA failed with %s", err)
+		}
+		return entity
+	}
+
+	funcs := []func() *Entity{makeECDH, makeRSA}
+	for _, f := range funcs {
+		entity := f()
+
+		buf := new(bytes.Buffer)
+		armored, err := armor.Encode(buf, "PGP MESSAGE", nil)
+		writer, err := Encrypt(armored, []*Entity{entity}, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to Encrypt: %s", err)
+		}
+		msgstr := "Hello Test Encryption TestStubbedPrivateKeyOperations."
+		io.Copy(writer, bytes.NewBufferString(msgstr))
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Failed to writer.Close: %s", err)
+		}
+		if err := armored.Close(); err != nil {
+			t.Fatalf("Failed to armored.Close: %s", err)
+		}
+
+		// Stub the subkey
+		entity.Subkeys[0].PrivateKey.PrivateKey = nil
+
+		var entities EntityList
+		entities = append(entities, entity)
+
+		decKeys := entities.DecryptionKeys()
+		if len(decKeys) != 0 {
+			t.Fatalf("Expecting DecryptionKeys() to return empty list")
+		}
+
+		block, err := armor.Decode(bytes.NewBuffer(buf.Bytes()))
+		_, err = ReadMessage(block.Body, entities, nil, nil)
+		t.Logf("ReadMessage returned: %s", err)
+		if err == nil {
+			t.Fatalf("Expected a failure in ReadMessage")
+		}
+
+		if !errors.Is(err, pgpErrors.ErrKeyIncorrect) {
+			t.Fatalf("Expecting an error to be ErrKeyIncorrect")
+		}
+	}
+}
+
+// See https://github.com/keybase/client/issues/18944; ReadKeyRing used to panic here
+func TestElGamalPrivateKeyFuzz(t *testing.T) {
+	d, err := base64.StdEncoding.DecodeString("xyIEOQTlQxQAAAAAAAAAADZlZ2VWZWU7wgAEfzdGaWxlIFOnxyIELgTlQwEAAAAAAA==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadKeyRing(bytes.NewBuffer(d))
+	if err == nil {
+		t.Fatal(errors.New("should have gotten an error parsing elgamal sign-or-encrypt private key"))
+	}
+}
+
+func TestEntityListSerializeArmored(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		hex       string
+		serialize func(EntityList, io.Writer) error
+	}{
+		{"public", testKeys1And2Hex, func(el EntityList, w io.Writer) error {
+			return el.SerializeArmored(w, nil)
+		}},
+		{"private", testKeys1And2PrivateHex, func(el EntityList, w io.Writer) error {
+			return el.SerializeArmoredPrivate(w, nil)
+		}},
+	} {
+		kring, err := ReadKeyRing(readerFromHex(test.hex))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := test.serialize(kring, buf); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if n := strings.Count(buf.String(), "-----BEGIN PGP "); n != 1 {
+			t.Errorf("%s: found %d armored blocks, want 1", test.name, n)
+		}
+
+		reread, err := ReadArmoredKeyRing(buf)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if len(reread) != len(kring) {
+			t.Fatalf("%s: got %d entities, want %d", test.name, len(reread), len(kring))
+		}
+		for i, e := range reread {
+			if e.PrimaryKey.Fingerprint != kring[i].PrimaryKey.Fingerprint {
+				t.Errorf("%s: entity %d: got %s, want %s", test.name, i, e.PrimaryKey.KeyIdString(), kring[i].PrimaryKey.KeyIdString())
+			}
+			if (e.PrivateKey != nil) != (test.name == "private") {
+				t.Errorf("%s: entity %d: unexpected private key %v", test.name, i, e.PrivateKey)
+			}
+		}
+	}
+}
+
+func TestSerializeArmoredChunked(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	e := readTestKeys(t)[0]
+	// Sign the binding of the first subkey.
+	if err := e.SerializePrivate(ioutil.Discard, config); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := e.RotateEncryptionSubkey(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	whole, err := armorPublicKey(serializeToBytes(t, e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxBytes := len(whole) / 2
+	chunks, err := SerializeArmoredChunked(e, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want several", len(chunks))
+	}
+
+	var el EntityList
+	for i, chunk := range chunks {
+		if len(chunk) > maxBytes {
+			t.Errorf("chunk %d is %d bytes, want at most %d", i, len(chunk), maxBytes)
+		}
+		kring, err := ReadArmoredKeyRing(strings.NewReader(chunk))
+		if err != nil {
+			t.Fatalf("chunk %d: %s", i, err)
+		}
+		if len(kring) != 1 || len(kring[0].Subkeys) == 0 {
+			t.Fatalf("chunk %d: got %d entities, want one with subkeys", i, len(kring))
+		}
+		el = append(el, kring...)
+	}
+	merged := el.Merge()
+	if len(merged) != 1 {
+		t.Fatalf("got %d entities after merging, want 1", len(merged))
+	}
+	if !bytes.Equal(serializeToBytes(t, merged[0]), serializeToBytes(t, e)) {
+		t.Error("merged chunks differ from the original key")
+	}
+
+	if _, err := SerializeArmoredChunked(e, 100); err == nil {
+		t.Error("chunking into blocks too small for the primary key succeeded")
+	}
+}
+
+func serializeToBytes(t *testing.T, e *Entity) []byte {
+	buf := new(bytes.Buffer)
+	if err := e.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPrimaryIdentityStableAcrossSerialization(t *testing.T) {
+	config := &packet.Config{}
+	e := readTestKeys(t)[0]
+	alice := e.PrimaryIdentity()
+	notPrimary := false
+	alice.SelfSignature.IsPrimaryId = &notPrimary
+
+	// Zoe sorts after the first user id, so the primary user id isn't
+	// the first one.
+	zoe := packet.NewUserId("Zoe", "", "zoe@example.com")
+	isPrimary := true
+	addIdentity(e, zoe).SelfSignature.IsPrimaryId = &isPrimary
+
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, config); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := imported.PrimaryIdentity().Name; name != zoe.Id {
+		t.Fatalf("imported primary identity is %q, want %q", name, zoe.Id)
+	}
+
+	reuse := &packet.Config{ReuseSignaturesOnSerialize: true}
+	for _, test := range []struct {
+		name      string
+		serialize func(*Entity, io.Writer) error
+	}{
+		{"Serialize", func(e *Entity, w io.Writer) error { return e.Serialize(w) }},
+		{"SerializePrivate", func(e *Entity, w io.Writer) error { return e.SerializePrivate(w, reuse) }},
+	} {
+		e := imported
+		for round := 0; round < 5; round++ {
+			buf := new(bytes.Buffer)
+			if err := test.serialize(e, buf); err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+			if e, err = ReadEntity(packet.NewReader(buf)); err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+			var names []string
+			for _, ident := range e.identities() {
+				names = append(names, ident.Name)
+			}
+			if want := []string{alice.Name, zoe.Id}; !reflect.DeepEqual(names, want) {
+				t.Errorf("%s: round %d: got user ids %q, want %q", test.name, round, names, want)
+			}
+			if name := e.PrimaryIdentity().Name; name != zoe.Id {
+				t.Errorf("%s: round %d: primary identity is %q, want %q", test.name, round, name, zoe.Id)
+			}
+		}
+	}
+}
+
+func TestUsableSubkeys(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	e, err := NewEntity("Test", "", "test@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a second encryption subkey, and a revoked and an expired one
+	// that must not be returned.
+	now := config.Now()
+	addSubkey := func() *Subkey {
+		priv, err := rsa.GenerateKey(config.Random(), 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := *e.Subkeys[0].Sig
+		subkey := Subkey{
+			PublicKey:  packet.NewRSAPublicKey(now, &priv.PublicKey),
+			PrivateKey: packet.NewRSAPrivateKey(now, priv),
+			Sig:        &sig,
+		}
+		e.Subkeys = append(e.Subkeys, subkey)
+		return &e.Subkeys[len(e.Subkeys)-1]
+	}
+	addSubkey()
+	addSubkey().Revocation = &packet.Signature{SigType: packet.SigTypeSubkeyRevocation}
+	lifetime := uint32(60)
+	addSubkey().Sig.KeyLifetimeSecs = &lifetime
+
+	subkeys := e.UsableSubkeys(packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage, now.Add(time.Hour))
+	if len(subkeys) != 2 {
+		t.Fatalf("got %d usable encryption subkeys, want 2", len(subkeys))
+	}
+	for i, subkey := range subkeys {
+		if subkey.PublicKey != e.Subkeys[i].PublicKey {
+			t.Errorf("usable subkey %d is %s, want %s", i, subkey.PublicKey.KeyIdString(), e.Subkeys[i].PublicKey.KeyIdString())
+		}
+	}
+
+	if subkeys := e.UsableSubkeys(packet.KeyFlagEncryptCommunications, now); len(subkeys) != 3 {
+		t.Errorf("got %d usable encryption subkeys before expiry, want 3", len(subkeys))
+	}
+	if subkeys := e.UsableSubkeys(packet.KeyFlagSign, now); len(subkeys) != 0 {
+		t.Errorf("got %d usable signing subkeys, want 0", len(subkeys))
+	}
+
+	// Like signingKey, an RSA subkey without key flags is used for
+	// signing but, unlike an ElGamal one, not for encryption.
+	addSubkey().Sig.FlagsValid = false
+	if subkeys := e.UsableSubkeys(packet.KeyFlagSign, now); len(subkeys) != 1 || subkeys[0].PublicKey != e.Subkeys[4].PublicKey {
+		t.Errorf("got %d usable signing subkeys, want the one without key flags", len(subkeys))
+	}
+	if subkeys := e.UsableSubkeys(packet.KeyFlagEncryptCommunications, now); len(subkeys) != 3 {
+		t.Errorf("got %d usable encryption subkeys with a subkey without key flags, want 3", len(subkeys))
+	}
+}
+
+func TestReadKeyRingLimits(t *testing.T) {
+	// Count the packets of the keyring, which has trust packets that
+	// aren't counted.
+	packets := packet.NewReader(readerFromHex(testKeys1And2Hex))
+	n := 0
+	for {
+		if _, err := packets.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+
+	for i, test := range []struct {
+		config *packet.Config
+		ok     bool
+	}{
+		{nil, true},
+		{&packet.Config{MaxEntities: 2}, true},
+		{&packet.Config{MaxEntities: 1}, false},
+		{&packet.Config{MaxPackets: n + 1}, true},
+		{&packet.Config{MaxPackets: n}, true},
+		{&packet.Config{MaxPackets: n - 1}, false},
+		{&packet.Config{MaxPackets: 5}, false},
+	} {
+		kring, err := ReadKeyRingWithConfig(readerFromHex(testKeys1And2Hex), test.config)
+		if test.ok {
+			if err != nil || len(kring) != 2 {
+				t.Errorf("%d: got %d entities, err %v", i, len(kring), err)
+			}
+			continue
+		}
+		if _, ok := err.(pgpErrors.StructuralError); !ok {
+			t.Errorf("%d: got err %v, want a StructuralError", i, err)
+		}
+		if kring != nil {
+			t.Errorf("%d: got %d entities, want none", i, len(kring))
+		}
+	}
+}
+
+func TestReadKeyRingUnknownPackets(t *testing.T) {
+	// Put a packet of the experimental type 60 after every user id and
+	// public subkey, between them and their self-signatures.
+	unknown := &packet.OpaquePacket{Tag: 60, Contents: []byte("from the future")}
+	buf := new(bytes.Buffer)
+	opaque := packet.NewOpaqueReader(readerFromHex(testKeys1And2Hex))
+	for {
+		op, err := opaque.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		if op.Tag == 13 || op.Tag == 14 {
+			if err := unknown.Serialize(buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	kring, err := ReadKeyRing(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kring) != len(want) {
+		t.Fatalf("got %d entities, want %d", len(kring), len(want))
+	}
+	for i, e := range kring {
+		if e.PrimaryKey.KeyId != want[i].PrimaryKey.KeyId {
+			t.Errorf("%d: got key %X, want %X", i, e.PrimaryKey.KeyId, want[i].PrimaryKey.KeyId)
+		}
+		if len(e.Identities) != len(want[i].Identities) || len(e.Subkeys) != len(want[i].Subkeys) {
+			t.Errorf("%d: got %d identities and %d subkeys, want %d and %d", i, len(e.Identities), len(e.Subkeys), len(want[i].Identities), len(want[i].Subkeys))
+		}
+		if len(e.BadSubkeys) != 0 || len(e.BadSelfSignatures) != 0 {
+			t.Errorf("%d: got %d bad subkeys and %d bad self-signatures", i, len(e.BadSubkeys), len(e.BadSelfSignatures))
+		}
+		if n := len(e.Identities) + len(e.Subkeys); len(e.UnknownPackets) != n {
+			t.Errorf("%d: got %d unknown packets recorded, want %d", i, len(e.UnknownPackets), n)
+		}
+		for _, warning := range e.UnknownPackets {
+			if warning != 60 {
+				t.Errorf("%d: recorded unknown packet type %d, want 60", i, warning)
+			}
+		}
+		if len(want[i].UnknownPackets) != 0 {
+			t.Errorf("%d: recorded unknown packets in a key without any", i)
+		}
+	}
+}
+
+func TestLocalCertificationNotExported(t *testing.T) {
+	// GnuPG marks the certification made with --lsign-key as not
+	// exportable.
+	block, err := armor.Decode(strings.NewReader(localCertKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var local *packet.Signature
+	packets := packet.NewReader(block.Body)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if sig, ok := p.(*packet.Signature); ok && sig.SigType == packet.SigTypeGenericCert {
+			local = sig
+		}
+	}
+	if local == nil {
+		t.Fatal("no certification found")
+	}
+	if local.IsExportable() {
+		t.Error("local certification parsed as exportable")
+	}
+
+	config := &packet.Config{}
+	e := readTestKeys(t)[0]
+	signer := readTestKeys(t)[1]
+	identity := e.PrimaryIdentity().Name
+	if err := e.SignIdentity(identity, signer, config); err != nil {
+		t.Fatal(err)
+	}
+	notExportable := false
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeGenericCert,
+		PubKeyAlgo:   signer.PrivateKey.PubKeyAlgo,
+		Hash:         config.Hash(),
+		CreationTime: config.Now(),
+		IssuerKeyId:  &signer.PrivateKey.KeyId,
+		Exportable:   &notExportable,
+	}
+	if err := sig.SignUserId(identity, e.PrimaryKey, signer.PrivateKey, config); err != nil {
+		t.Fatal(err)
+	}
+	ident := e.Identities[identity]
+	ident.Signatures = append(ident.Signatures, sig)
+
+	// SerializePrivate signs the self-signatures of a new entity, which
+	// Serialize needs.
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, config); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := e.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(ident.Signatures) != 2 {
+		t.Errorf("got %d certifications in memory, want 2", len(ident.Signatures))
+	}
+
+	var exported []*packet.Signature
+	packets = packet.NewReader(buf)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if sig, ok := p.(*packet.Signature); ok && sig.SigType == packet.SigTypeGenericCert {
+			exported = append(exported, sig)
+		}
+	}
+	if len(exported) != 1 || !exported[0].IsExportable() {
+		t.Errorf("exported %d certifications, want only the exportable one", len(exported))
+	}
+}
+
+// localCertKey is an Ed25519 key whose user id carries a local
+// certification (gpg --lsign-key), exported with export-local-sigs.
+const localCertKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEatF2pRYJKwYBBAHaRw8BAQdA/L8Eov8ZHwLJXYkYWvSIOWVf0VuFqKWA9fzr
+wk4Wsfq0HkFybW9yIFRlc3QgPGFybW9yQGV4YW1wbGUuY29tPoiQBBMWCAA4FiEE
+vyYpnWW5AQpXo01pz6HVqEEw6M0FAmrRdqUCGwMFCwkIBwIGFQoJCAsCBBYCAwEC
+HgECF4AACgkQz6HVqEEw6M2XDQD9G0A5AW0LwbIRdaQ0P7kkkLQ5t2dmXnPPb+4v
+obbEzhoBAIO2rlHEJozeI4gTqfHkB6827Y/hAMUikfgNx0yZDogLiHgEEBYIACAW
+IQQXz82ndTzLGz9MfXfIJ6vtnpJARQUCatF2xwIEAAAKCRDIJ6vtnpJARfdbAQDI
+ku1AcAZ04SkjtIfzZ74CC/rcIW3qYjkvStFtMrjxhQD/cWGqxIDlboCdwFlNvMQM
+efLpDv+Fj9iLGWFQd0Wxxg4=
+=PvYa
+-----END PGP PUBLIC KEY BLOCK-----`
+
+func TestCanCertify(t *testing.T) {
+	config := &packet.Config{}
+	e := readTestKeys(t)[0]
+	now := config.Now()
+	selfSig := e.PrimaryIdentity().SelfSignature
+
+	if !e.CanCertify(now) {
+		t.Error("new entity can't certify")
+	}
+
+	selfSig.FlagCertify = false
+	if e.CanCertify(now) {
+		t.Error("entity without the certify flag can certify")
+	}
+
+	selfSig.FlagsValid = false
+	if !e.CanCertify(now) {
+		t.Error("entity without key flags can't certify")
+	}
+
+	lifetime := uint32(60)
+	selfSig.KeyLifetimeSecs = &lifetime
+	if e.CanCertify(now.Add(time.Hour)) {
+		t.Error("expired entity can certify")
+	}
+}
+
+func TestEntityListMerge(t *testing.T) {
+	public, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := append(public, private...).Merge()
+	if len(merged) != len(public) {
+		t.Fatalf("got %d entities, want %d", len(merged), len(public))
+	}
+	e := merged[0]
+	if e != public[0] {
+		t.Error("merge didn't keep the first entity")
+	}
+	if e.PrivateKey == nil {
+		t.Fatal("merged entity has no private key")
+	}
+	for _, subkey := range e.Subkeys {
+		if subkey.PrivateKey == nil {
+			t.Errorf("subkey %s has no private key", subkey.PublicKey.KeyIdString())
+		}
+	}
+	if len(merged.DecryptionKeys()) == 0 {
+		t.Error("merged key ring has no decryption keys")
+	}
+
+	out := new(bytes.Buffer)
+	if err := DetachSign(out, e, strings.NewReader(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+	testDetachedSignature(t, public, out, signedInput, "merged", testKey1KeyId)
+
+	// Stubs, as exported by gpg --export-secret-subkeys, are replaced
+	// by the secret key material too.
+	stubbed, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := func(pub *packet.PublicKey) *packet.PrivateKey {
+		return &packet.PrivateKey{PublicKey: *pub}
+	}
+	stubbed[0].PrivateKey = stub(stubbed[0].PrimaryKey)
+	for i := range stubbed[0].Subkeys {
+		stubbed[0].Subkeys[i].PrivateKey = stub(stubbed[0].Subkeys[i].PublicKey)
+	}
+	merged = append(stubbed[:1], private[:1]...).Merge()
+	if !hasSecret(merged[0].PrivateKey) {
+		t.Error("stubbed primary key wasn't replaced")
+	}
+	for _, subkey := range merged[0].Subkeys {
+		if !hasSecret(subkey.PrivateKey) {
+			t.Errorf("stubbed subkey %s wasn't replaced", subkey.PublicKey.KeyIdString())
+		}
+	}
+}
+
+func TestEntityListMergeCertifications(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kring[1].PrivateKey.Decrypt([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	const identity = "Test Key 1 (RSA)"
+	if err := kring[0].SignIdentity(identity, kring[1], nil); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading a key drops certifications by other keys, so the copies
+	// of the certification are made in memory.
+	merged := EntityList{plain[0], kring[0].Clone(), kring[0].Clone()}.Merge()
+	if len(merged) != 1 {
+		t.Fatalf("got %d entities, want 1", len(merged))
+	}
+	if sigs := merged[0].Identities[identity].Signatures; len(sigs) != 1 {
+		t.Errorf("got %d certifications, want the one certification once", len(sigs))
+	}
+}
+
+func TestMergeIdentitiesAndRevocations(t *testing.T) {
+	config := &packet.Config{}
+	e := readTestKeys(t)[0]
+	if err := e.SerializePrivate(ioutil.Discard, config); err != nil {
+		t.Fatal(err)
+	}
+	alice := e.PrimaryIdentity()
+
+	// Identities made in memory have no user id packets read with them,
+	// so other must be merged by its identities.
+	other := e.Clone()
+	bob := packet.NewUserId("Bob", "", "bob@example.com")
+	addIdentity(other, bob)
+	now := config.Now()
+	other.Revocations = []*packet.Signature{{SigType: packet.SigTypeKeyRevocation, CreationTime: now}}
+	other.Identities[alice.Name].Revocation = &packet.Signature{SigType: packet.SigTypeIdentityRevocation, CreationTime: now}
+	other.Subkeys[0].Revocation = &packet.Signature{SigType: packet.SigTypeSubkeyRevocation, CreationTime: now}
+
+	merged := EntityList{e, other}.Merge()
+	if len(merged) != 1 || merged[0] != e {
+		t.Fatalf("got %d entities, want e", len(merged))
+	}
+	if _, ok := e.Identities[bob.Id]; !ok {
+		t.Error("identity of other wasn't merged")
+	}
+	if len(e.Revocations) != 1 {
+		t.Errorf("got %d key revocations, want 1", len(e.Revocations))
+	}
+	if e.Identities[alice.Name].Revocation == nil {
+		t.Error("identity revocation wasn't merged")
+	}
+	if e.Subkeys[0].Revocation == nil {
+		t.Error("subkey revocation wasn't merged")
+	}
+}
+
+func TestBadSelfSignatureReported(t *testing.T) {
+	config := &packet.Config{}
+	e := readTestKeys(t)[0]
+	alice := e.PrimaryIdentity()
+	bob := packet.NewUserId("Bob", "", "bob@example.com")
+	addIdentity(e, bob)
+	if err := e.SerializePrivate(ioutil.Discard, config); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	e.PrimaryKey.Serialize(buf)
+	alice.UserId.Serialize(buf)
+	alice.SelfSignature.Serialize(buf)
+	bob.Serialize(buf)
+	sigBuf := new(bytes.Buffer)
+	e.Identities[bob.Id].SelfSignature.Serialize(sigBuf)
+	// Corrupt the low byte of the signature MPI.
+	sigBytes := sigBuf.Bytes()
+	sigBytes[len(sigBytes)-1] ^= 1
+	buf.Write(sigBytes)
+
+	imported, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := imported.Identities[bob.Id]; ok {
+		t.Fatal("identity with a corrupted self-signature was accepted")
+	}
+	if len(imported.BadSelfSignatures) != 1 {
+		t.Fatalf("got %d bad self-signatures, want 1", len(imported.BadSelfSignatures))
+	}
+	bad := imported.BadSelfSignatures[0]
+	if bad.Name != bob.Id {
+		t.Errorf("bad self-signature is over %q, want %q", bad.Name, bob.Id)
+	}
+	if _, ok := bad.Err.(pgpErrors.SignatureError); !ok {
+		t.Errorf("got %#v, want a SignatureError", bad.Err)
+	}
+}
+
+func TestEmptyUserId(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	e, err := NewEntity("Alice", "", "alice@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := e.PrimaryIdentity()
+	emptySig := addIdentity(e, &packet.UserId{}).SelfSignature
+	if err := e.SerializePrivate(ioutil.Discard, config); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	e.PrimaryKey.Serialize(buf)
+	// A zero-length user id packet, in the old packet format.
+	buf.Write([]byte{0xb4, 0x00})
+	emptySig.Serialize(buf)
+	alice.UserId.Serialize(buf)
+	alice.SelfSignature.Serialize(buf)
+
+	imported, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, ok := imported.Identities[""]
+	if !ok {
+		t.Fatal("empty user id is missing")
+	}
+	if empty.SelfSignature == nil || empty.UserId == nil || len(empty.UserId.Raw()) != 0 {
+		t.Errorf("bad identity for the empty user id: %#v", empty)
+	}
+	if _, ok := imported.Identities[alice.Name]; !ok {
+		t.Errorf("identity %q is missing", alice.Name)
+	}
+	if ident := imported.PrimaryIdentity(); ident.Name != alice.Name {
+		t.Errorf("primary identity is %q, want %q", ident.Name, alice.Name)
+	}
+	infos := imported.AllUserIds()
+	if len(infos) != 2 || infos[0].Name != "" || !infos[0].Verified {
+		t.Errorf("bad user ids: %#v", infos)
+	}
+	if !strings.Contains(imported.ColonListing(time.Now()), "\nuid:-::::") {
+		t.Error("empty user id is missing from the colon listing")
+	}
+}
+
+func TestSignAndEncryptSubkeyCrossSignature(t *testing.T) {
+	config := &packet.Config{}
+	e := readTestKeys(t)[0]
+	subkey := &e.Subkeys[0]
+	subkey.Sig.FlagSign = true
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, config); err != nil {
+		t.Fatal(err)
+	}
+	if subkey.Sig.EmbeddedSignature == nil {
+		t.Fatal("sign+encrypt subkey wasn't cross-signed")
+	}
+
+	for _, test := range []struct {
+		name           string
+		crossSignedBy  *packet.PrivateKey
+		signingAllowed bool
+	}{
+		{"valid cross-signature", subkey.PrivateKey, true},
+		{"bad cross-signature", e.PrivateKey, false},
+	} {
+		sig := &packet.Signature{
+			CreationTime:              subkey.Sig.CreationTime,
+			SigType:                   packet.SigTypeSubkeyBinding,
+			PubKeyAlgo:                packet.PubKeyAlgoRSA,
+			Hash:                      subkey.Sig.Hash,
+			FlagsValid:                true,
+			FlagSign:                  true,
+			FlagEncryptStorage:        true,
+			FlagEncryptCommunications: true,
+			IssuerKeyId:               &e.PrimaryKey.KeyId,
+		}
+		if err := sig.CrossSignKey(e.PrimaryKey, test.crossSignedBy, config); err != nil {
+			t.Fatal(err)
+		}
+		if err := sig.SignKey(subkey.PublicKey, e.PrivateKey, config); err != nil {
+			t.Fatal(err)
+		}
+		subkey.Sig = sig
+
+		buf := new(bytes.Buffer)
+		if err := e.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		imported, err := ReadEntity(packet.NewReader(buf))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if len(imported.Subkeys) != 1 {
+			t.Fatalf("%s: got %d subkeys (%d bad), want 1", test.name, len(imported.Subkeys), len(imported.BadSubkeys))
+		}
+
+		now := time.Now()
+		if n := len(imported.UsableSubkeys(packet.KeyFlagEncryptCommunications, now)); n != 1 {
+			t.Errorf("%s: subkey isn't usable for encryption", test.name)
+		}
+		canSign := len(imported.UsableSubkeys(packet.KeyFlagSign, now)) == 1
+		if canSign != test.signingAllowed {
+			t.Errorf("%s: subkey usable for signing is %v, want %v", test.name, canSign, test.signingAllowed)
+		}
+		keys := EntityList{imported}.KeysByIdUsage(subkey.PublicKey.KeyId, nil, packet.KeyFlagSign)
+		if (len(keys) > 0) != test.signingAllowed {
+			t.Errorf("%s: got %d signing keys", test.name, len(keys))
+		}
+	}
+}
+
+func TestWeakBindingSignatures(t *testing.T) {
+	for _, test := range []struct {
+		hash crypto.Hash
+		weak bool
+	}{
+		{crypto.SHA1, true},
+		{crypto.SHA256, false},
+	} {
+		config := &packet.Config{RSABits: 1024, DefaultHash: test.hash}
+		e, err := NewEntity("Test", "", "test@example.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := e.SerializePrivate(buf, config); err != nil {
+			t.Fatal(err)
+		}
+		imported, err := ReadEntity(packet.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		weak := imported.WeakBindingSignatures()
+		if !test.weak {
+			if len(weak) != 0 {
+				t.Errorf("%s: %d subkeys flagged", test.hash, len(weak))
+			}
+			continue
+		}
+		if len(weak) != 1 || weak[0] != &imported.Subkeys[0] {
+			t.Errorf("%s: got %v, want the subkey", test.hash, weak)
+		}
+	}
+}
+
+func TestRebindSubkey(t *testing.T) {
+	// The subkey of the first test key is bound with SHA-1.
+	e := readTestKeys(t)[0]
+	if len(e.WeakBindingSignatures()) != 1 {
+		t.Fatal("expected a SHA-1 bound subkey")
+	}
+	lifetime := uint32(86400)
+	e.Subkeys[0].Sig.KeyLifetimeSecs = &lifetime
+
+	if err := e.RebindSubkey(&e.Subkeys[0], &packet.Config{DefaultHash: crypto.SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := e.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.Subkeys) != 1 {
+		t.Fatalf("got %d subkeys (%d bad), want 1", len(imported.Subkeys), len(imported.BadSubkeys))
+	}
+	sig := imported.Subkeys[0].Sig
+	if sig.Hash != crypto.SHA256 {
+		t.Errorf("binding uses %s, want SHA-256", sig.Hash)
+	}
+	if !sig.FlagEncryptCommunications || !sig.FlagEncryptStorage || sig.FlagSign {
+		t.Errorf("key flags changed: %+v", sig.GetKeyFlags())
+	}
+	if sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs != lifetime {
+		t.Errorf("key lifetime wasn't kept: %v", sig.KeyLifetimeSecs)
+	}
+	if len(imported.WeakBindingSignatures()) != 0 {
+		t.Error("rebound subkey is still flagged as weak")
+	}
+
+	if err := e.RebindSubkey(&Subkey{PublicKey: e.PrimaryKey}, nil); err == nil {
+		t.Error("rebinding a subkey of another entity succeeded")
+	}
+}
+
+func TestRebindSubkeyCopy(t *testing.T) {
+	// The subkey of the first test key is bound with SHA-1.
+	e := readTestKeys(t)[0]
+
+	// A copy of the subkey, as UsableSubkeys returns, rebinds the
+	// subkey held by e.
+	subkey := e.Subkeys[0]
+	if err := e.RebindSubkey(&subkey, &packet.Config{DefaultHash: crypto.SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	if e.Subkeys[0].Sig.Hash != crypto.SHA256 {
+		t.Errorf("binding of e's subkey uses %s, want SHA-256", e.Subkeys[0].Sig.Hash)
+	}
+}
+
+func TestRotateEncryptionSubkey(t *testing.T) {
+	created := time.Unix(1500000000, 0)
+	config := &packet.Config{RSABits: 1024, Time: func() time.Time { return created }}
+	e, err := NewEntity("Test", "", "test@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := e.Subkeys[0].PublicKey.KeyId
+
+	rotated := created.Add(24 * time.Hour)
+	config.Time = func() time.Time { return rotated }
+	sub, err := e.RotateEncryptionSubkey(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Subkeys) != 2 {
+		t.Fatalf("got %d subkeys, want 2", len(e.Subkeys))
+	}
+	if !sub.PublicKey.IsSubkey || sub.PublicKey.KeyId == old {
+		t.Fatal("rotation didn't return a fresh subkey")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, config); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.Subkeys) != 2 {
+		t.Fatalf("got %d subkeys after reading (%d bad), want 2", len(imported.Subkeys), len(imported.BadSubkeys))
+	}
+	key, ok := imported.encryptionKey(rotated)
+	if !ok {
+		t.Fatal("no encryption key after rotation")
+	}
+	if key.PublicKey.KeyId != sub.PublicKey.KeyId {
+		t.Errorf("encrypting to %X, want the rotated subkey %X", key.PublicKey.KeyId, sub.PublicKey.KeyId)
+	}
+
+	locked := &Entity{PrimaryKey: e.PrimaryKey, Identities: e.Identities}
+	if _, err := locked.RotateEncryptionSubkey(config); err == nil {
+		t.Error("rotating without a private key succeeded")
+	}
+}
+
+func TestPublicFromPrivate(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := new(bytes.Buffer)
+	if err := DetachSign(sig, kring[0], strings.NewReader(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	public := PublicFromPrivate(kring)
+	if kring[0].PrivateKey == nil {
+		t.Fatal("PublicFromPrivate modified its input")
+	}
+	for name := range public[0].Identities {
+		delete(public[0].Identities, name)
+	}
+	if len(kring[0].Identities) == 0 {
+		t.Fatal("the public copy shares its identities with the input")
+	}
+	public = PublicFromPrivate(kring)
+	armored := new(bytes.Buffer)
+	if err := public.SerializeArmored(armored, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(armored.String(), PrivateKeyType) {
+		t.Error("public keyring is armored as a private key block")
+	}
+
+	reread, err := ReadArmoredKeyRing(armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reread) != len(kring) {
+		t.Fatalf("got %d entities, want %d", len(reread), len(kring))
+	}
+	for _, el := range []EntityList{public, reread} {
+		for _, e := range el {
+			if e.PrivateKey != nil {
+				t.Errorf("%s: primary private key remains", e.PrimaryKey.KeyIdString())
+			}
+			for _, subkey := range e.Subkeys {
+				if subkey.PrivateKey != nil {
+					t.Errorf("%s: subkey private key remains", subkey.PublicKey.KeyIdString())
+				}
+			}
+		}
+	}
+	testDetachedSignature(t, reread, sig, signedInput, "public", testKey1KeyId)
+}
+
+func TestDecryptionFingerprints(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	// The primary keys may only sign, and the encryption subkey of the
+	// second key is still protected by its passphrase.
+	got := kring.DecryptionFingerprints(now)
+	want := [][]byte{kring[0].Subkeys[0].PublicKey.Fingerprint[:], kring[1].Subkeys[0].PublicKey.Fingerprint[:]}
+	if len(got) != len(want) {
+		t.Fatalf("got %d fingerprints, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("fingerprint %d: got %X, want %X", i, got[i], want[i])
+		}
+	}
+
+	if got := PublicFromPrivate(kring).DecryptionFingerprints(now); len(got) != 0 {
+		t.Errorf("got %d fingerprints for public keys, want none", len(got))
+	}
+
+	kring[1].Subkeys[0].Revocation = kring[1].Subkeys[0].Sig
+	if got := kring.DecryptionFingerprints(now); len(got) != 1 || !bytes.Equal(got[0], want[0]) {
+		t.Errorf("got %X with a revoked subkey, want only %X", got, want[0])
+	}
+}
+
+func TestSubkeyBindingAlgorithms(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, hash := kring[0].Subkeys[0].BindingAlgorithms()
+	if pub != packet.PubKeyAlgoRSA || hash != crypto.SHA1 {
+		t.Errorf("got %d/%s, want RSA/SHA-1", pub, hash)
+	}
+
+	e, err := NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024, DefaultHash: crypto.SHA512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, hash := e.Subkeys[0].BindingAlgorithms(); pub != packet.PubKeyAlgoRSA || hash != crypto.SHA512 {
+		t.Errorf("got %d/%s, want RSA/SHA-512", pub, hash)
+	}
+}
+
+func TestEntityClone(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := kring[0]
+	before := new(bytes.Buffer)
+	if err := e.Serialize(before); err != nil {
+		t.Fatal(err)
+	}
+
+	selfSig := e.primaryIdentity().SelfSignature
+	selfSig.ExtraSubpackets = []packet.Subpacket{{Type: 20, Contents: []byte{1, 2, 3}}}
+	c := e.Clone()
+	if c.PrimaryKey != &c.PrivateKey.PublicKey {
+		t.Error("the clone's primary key isn't the public part of its private key")
+	}
+
+	// Signatures are copied deeply, so changing them in place leaves the
+	// original alone.
+	clonedSig := c.primaryIdentity().SelfSignature
+	if len(clonedSig.PreferredSymmetric) == 0 || len(clonedSig.PreferredHash) == 0 {
+		t.Fatal("the test key has no preferences")
+	}
+	clonedSig.PreferredSymmetric[0] ^= 0xff
+	clonedSig.PreferredHash[0] ^= 0xff
+	clonedSig.ExtraSubpackets[0].Contents[0] = 0
+	if selfSig.PreferredSymmetric[0] == clonedSig.PreferredSymmetric[0] ||
+		selfSig.PreferredHash[0] == clonedSig.PreferredHash[0] ||
+		selfSig.ExtraSubpackets[0].Contents[0] != 1 {
+		t.Error("changing the clone's self-signature changed the original's")
+	}
+	selfSig.ExtraSubpackets = nil
+
+	config := &packet.Config{Time: func() time.Time { return time.Unix(1500000000, 0) }}
+	rev := &packet.Signature{
+		SigType:      packet.SigTypeSubkeyRevocation,
+		PubKeyAlgo:   c.PrivateKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: config.Now(),
+		IssuerKeyId:  &c.PrivateKey.KeyId,
+	}
+	if err := rev.SignKey(c.Subkeys[0].PublicKey, c.PrivateKey, config); err != nil {
+		t.Fatal(err)
+	}
+	c.Subkeys[0].Revocation = rev
+	for _, ident := range c.Identities {
+		ident.SelfSignature.KeyLifetimeSecs = nil
+		ident.Signatures = nil
+	}
+	if err := c.SerializePrivate(ioutil.Discard, config); err != nil {
+		t.Fatal(err)
+	}
+	cloned := new(bytes.Buffer)
+	if err := c.Serialize(cloned); err != nil {
+		t.Fatal(err)
+	}
+
+	after := new(bytes.Buffer)
+	if err := e.Serialize(after); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before.Bytes(), after.Bytes()) {
+		t.Error("changing the clone changed the original")
+	}
+	if e.Subkeys[0].Revocation != nil || e.Subkeys[0].Revoked(config.Now()) {
+		t.Error("revoking the clone's subkey revoked the original's")
+	}
+	if bytes.Equal(before.Bytes(), cloned.Bytes()) {
+		t.Error("the changed clone serialized like the original")
+	}
+
+	reread, err := ReadEntity(packet.NewReader(bytes.NewReader(cloned.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reread.Subkeys[0].Revocation == nil {
+		t.Error("the clone's subkey revocation wasn't serialized")
+	}
+}
+
+func TestEncryptionKeySubkeyOrder(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	config := &packet.Config{RSABits: 1024, Time: func() time.Time { return now }}
+	e, err := NewEntity("Test", "", "test@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEntity("Other", "", "other@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both encryption subkeys are created and bound at the same time.
+	e.Subkeys = append(e.Subkeys, other.Subkeys[0])
+	if err := e.RebindSubkey(&e.Subkeys[1], config); err != nil {
+		t.Fatal(err)
+	}
+
+	var chosen [][20]byte
+	for _, subkeys := range [][]Subkey{
+		{e.Subkeys[0], e.Subkeys[1]},
+		{e.Subkeys[1], e.Subkeys[0]},
+	} {
+		e.Subkeys = subkeys
+		buf := new(bytes.Buffer)
+		if err := e.SerializePrivate(buf, config); err != nil {
+			t.Fatal(err)
+		}
+		reread, err := ReadEntity(packet.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, ok := reread.encryptionKey(now)
+		if !ok {
+			t.Fatal("no encryption key")
+		}
+		chosen = append(chosen, key.PublicKey.Fingerprint)
+	}
+	if chosen[0] != chosen[1] {
+		t.Errorf("the chosen encryption subkey depends on the subkey order: %x, %x", chosen[0], chosen[1])
+	}
+}
+
+func TestDirectKeySignaturePreferences(t *testing.T) {
+	e := readTestKeys(t)[0]
+	selfSig := e.primaryIdentity().SelfSignature
+	selfSig.PreferredSymmetric = nil
+	selfSig.PreferredHash = nil
+	selfSig.PreferredCompression = nil
+	selfSig.KeyLifetimeSecs = nil
+
+	lifetime := uint32(3600)
+	direct := &packet.Signature{
+		SigType:            packet.SigTypeDirectSignature,
+		PubKeyAlgo:         e.PrimaryKey.PubKeyAlgo,
+		Hash:               crypto.SHA256,
+		CreationTime:       e.PrimaryKey.CreationTime,
+		IssuerKeyId:        &e.PrimaryKey.KeyId,
+		PreferredSymmetric: []uint8{uint8(packet.CipherAES256)},
+		PreferredHash:      []uint8{10}, // SHA-512
+		KeyLifetimeSecs:    &lifetime,
+	}
+	if err := direct.SignDirectKey(e.PrimaryKey, e.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	e.DirectSignature = direct
+
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.DirectSignature == nil {
+		t.Fatal("direct-key signature wasn't read")
+	}
+	if len(read.primaryIdentity().SelfSignature.PreferredHash) != 0 {
+		t.Fatal("self-signature has preferences of its own")
+	}
+
+	plan, err := PlanEncryption(EntityList{read}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Cipher != packet.CipherAES256 || plan.Hash != crypto.SHA512 {
+		t.Errorf("got cipher %d and hash %s, want preferences of the direct-key signature", plan.Cipher, plan.Hash)
+	}
+
+	created := read.PrimaryKey.CreationTime
+	if !read.CanCertify(created.Add(time.Minute)) {
+		t.Error("key can't certify before the direct-key signature's expiry")
+	}
+	if read.CanCertify(created.Add(2 * time.Hour)) {
+		t.Error("key can certify after the direct-key signature's expiry")
+	}
+}
+
+func TestDirectKeySignatureFlags(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := kring[0]
+	for _, ident := range e.Identities {
+		ident.SelfSignature.FlagsValid = false
+	}
+	lifetime := uint32(3600)
+	e.DirectSignature = &packet.Signature{
+		SigType:         packet.SigTypeDirectSignature,
+		CreationTime:    e.PrimaryKey.CreationTime,
+		FlagsValid:      true,
+		FlagSign:        true,
+		KeyLifetimeSecs: &lifetime,
+	}
+
+	keys := kring.KeysById(e.PrimaryKey.KeyId, nil)
+	if len(keys) != 1 {
+		t.Fatalf("got %d keys, want 1", len(keys))
+	}
+	if flags := keys[0].KeyFlags; !flags.Valid || flags.BitField != packet.KeyFlagSign {
+		t.Errorf("got key flags %+v, want the direct-key signature's", flags)
+	}
+	if keys := kring.KeysByIdUsage(e.PrimaryKey.KeyId, nil, packet.KeyFlagCertify); len(keys) != 0 {
+		t.Error("primary key can certify, although its direct-key signature only allows signing")
+	}
+
+	listing := e.ColonListing(e.PrimaryKey.CreationTime.Add(2 * time.Hour))
+	if !strings.HasPrefix(listing, "pub:e:") {
+		t.Errorf("key past its direct-key lifetime isn't listed as expired: %q", listing)
+	}
+}
+
+func TestDirectKeySignatureLifetimeAndHistory(t *testing.T) {
+	created := time.Unix(1500000000, 0)
+	config := &packet.Config{RSABits: 1024, Time: func() time.Time { return created }}
+	e, err := NewEntity("Direct", "", "direct@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Re-sign the identity well after the key was created.
+	ident := e.primaryIdentity()
+	ident.SelfSignature.KeyLifetimeSecs = nil
+	ident.SelfSignature.CreationTime = created.Add(10 * time.Hour)
+	if err := ident.SelfSignature.SignUserId(ident.Name, e.PrimaryKey, e.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lifetime := uint32(3600)
+	var directs []*packet.Signature
+	for i, lifetime := range []*uint32{nil, &lifetime} {
+		direct := &packet.Signature{
+			SigType:         packet.SigTypeDirectSignature,
+			PubKeyAlgo:      e.PrimaryKey.PubKeyAlgo,
+			Hash:            crypto.SHA256,
+			CreationTime:    created.Add(time.Duration(i) * time.Minute),
+			IssuerKeyId:     &e.PrimaryKey.KeyId,
+			KeyLifetimeSecs: lifetime,
+		}
+		if err := direct.SignDirectKey(e.PrimaryKey, e.PrivateKey, nil); err != nil {
+			t.Fatal(err)
+		}
+		directs = append(directs, direct)
+	}
+	e.setDirectSignatures(directs)
+
+	read := e
+	for i := 0; i < 2; i++ {
+		buf := new(bytes.Buffer)
+		if err := read.SerializePrivate(buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		if read, err = ReadEntity(packet.NewReader(buf)); err != nil {
+			t.Fatal(err)
+		}
+		if read.DirectSignature == nil || !read.DirectSignature.EqualTo(directs[1]) {
+			t.Fatalf("round %d: newest direct-key signature wasn't kept", i)
+		}
+		if len(read.OtherDirectSignatures) != 1 || !read.OtherDirectSignatures[0].EqualTo(directs[0]) {
+			t.Fatalf("round %d: got %d other direct-key signatures, want the older one", i, len(read.OtherDirectSignatures))
+		}
+	}
+
+	// The lifetime counts from the creation of the key, not from that of
+	// the identity's self-signature.
+	if !read.CanCertify(created.Add(30 * time.Minute)) {
+		t.Error("key can't certify before it expires")
+	}
+	if read.CanCertify(created.Add(2 * time.Hour)) {
+		t.Error("key can certify after it expires")
+	}
+}
+
+func TestPublicKeyMatchesCurve(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := packet.NewECDSAPublicKey(time.Now(), &priv.PublicKey)
+	if !publicKeyMatches(pk, &priv.PublicKey) {
+		t.Error("key doesn't match itself")
+	}
+	otherCurve := priv.PublicKey
+	otherCurve.Curve = elliptic.P384()
+	if publicKeyMatches(pk, &otherCurve) {
+		t.Error("key matches the same point on another curve")
+	}
+}
+
+func TestSerializePrivateOmitDummySubkeys(t *testing.T) {
+	e := readTestKeys(t)[0]
+	// Stub the subkey out, as when its secret lives on a smartcard.
+	e.Subkeys[0].PrivateKey.PrivateKey = nil
+
+	for _, omit := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		if err := e.SerializePrivate(buf, &packet.Config{OmitDummySubkeys: omit}); err != nil {
+			t.Fatal(err)
+		}
+		serialized := buf.Bytes()
+
+		var subkeyPackets int
+		packets := packet.NewReader(bytes.NewReader(serialized))
+		for {
+			p, err := packets.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch p := p.(type) {
+			case *packet.PrivateKey:
+				if p.IsSubkey {
+					subkeyPackets++
+					if omit {
+						t.Error("stubbed subkey written as a secret subkey")
+					}
+				}
+			case *packet.PublicKey:
+				if p.IsSubkey {
+					subkeyPackets++
+					if !omit {
+						t.Error("stubbed subkey written as a public subkey without OmitDummySubkeys")
+					}
+				}
+			}
+		}
+		if subkeyPackets != 1 {
+			t.Fatalf("got %d subkey packets, want 1", subkeyPackets)
+		}
+
+		read, err := ReadEntity(packet.NewReader(bytes.NewReader(serialized)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read.PrivateKey == nil || !read.PrivateKey.IsDecrypted() {
+			t.Error("primary secret key wasn't kept")
+		}
+		if len(read.Subkeys) != 1 || len(read.BadSubkeys) != 0 {
+			t.Fatalf("got %d subkeys and %d bad subkeys", len(read.Subkeys), len(read.BadSubkeys))
+		}
+		if omit && read.Subkeys[0].PrivateKey != nil {
+			t.Error("public-only subkey read with a private key")
+		}
+		if ok, errs := read.SelfConsistent(); !ok {
+			t.Errorf("serialized key isn't self-consistent: %v", errs)
+		}
+	}
+}
+
+func TestSelfConsistent(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, errs := kring[0].SelfConsistent(); !ok {
+		t.Errorf("good key isn't self-consistent: %v", errs)
+	}
+
+	// Bind the subkey of the first key with the binding signature of the
+	// second key's subkey.
+	broken := kring[0].Clone()
+	broken.Subkeys[0].Sig = kring[1].Subkeys[0].Sig
+	ok, errs := broken.SelfConsistent()
+	if ok || len(errs) != 1 {
+		t.Fatalf("got %v with reasons %v, want one reason", ok, errs)
+	}
+	if !strings.Contains(errs[0].Error(), "binding signature invalid") {
+		t.Errorf("unexpected reason: %s", errs[0])
+	}
+
+	// A key whose signing subkey lacks its cross-signature is read with
+	// the subkey dropped.
+	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(missingCrossSignatureKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, errs := keys[0].SelfConsistent(); ok || len(errs) == 0 {
+		t.Errorf("key with a dropped subkey is self-consistent")
 	}
 }
@@ -6,8 +6,11 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/keybase/go-crypto/openpgp/armor"
+	"github.com/keybase/go-crypto/openpgp/errors"
+	"github.com/keybase/go-crypto/openpgp/packet"
 )
 
 func TestMultisig(t *testing.T) {
@@ -94,6 +97,75 @@ func TestMultisig(t *testing.T) {
 	t.Logf("When trying with bad key, error was: %s", err)
 }
 
+func TestNestedOnePassSignatures(t *testing.T) {
+	keys := readTestKeys(t)
+
+	var signers []*packet.PrivateKey
+	for _, e := range keys {
+		signKey, ok := e.signingKey(time.Now())
+		if !ok {
+			t.Fatal("no signing key")
+		}
+		signers = append(signers, signKey.PrivateKey)
+	}
+
+	// The outer OnePassSignature packet is followed by the inner one, and
+	// the signatures come in the reverse order after the literal data.
+	m := &onePassSignedMessage{
+		signers:  signers,
+		sigType:  packet.SigTypeBinary,
+		contents: signedInput,
+	}
+	message := m.serialize(t)
+
+	md, err := ReadMessage(bytes.NewReader(message), keys, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.MultiSig {
+		t.Error("expected MultiSig to be true")
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != signedInput {
+		t.Errorf("bad contents: got %q", contents)
+	}
+	if md.SignatureError != nil || md.Signature == nil {
+		t.Errorf("bad top-level signature: %v", md.SignatureError)
+	}
+	if len(md.Signatures) != len(signers) {
+		t.Fatalf("expected %d signatures, got %d", len(signers), len(md.Signatures))
+	}
+	for i, sig := range md.Signatures {
+		if sig.SignedByKeyId != signers[i].KeyId {
+			t.Errorf("signature %d: got key id %x, want %x", i, sig.SignedByKeyId, signers[i].KeyId)
+		}
+		if sig.SignatureError != nil {
+			t.Errorf("signature %d: %v", i, sig.SignatureError)
+		}
+		if sig.Signature == nil || *sig.Signature.IssuerKeyId != signers[i].KeyId {
+			t.Errorf("signature %d was matched to the wrong signature packet", i)
+		}
+	}
+
+	// Without the inner signer's key only the outer layer verifies.
+	md, err = ReadMessage(bytes.NewReader(message), keys[:1], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError != nil {
+		t.Errorf("outer signature: %v", md.SignatureError)
+	}
+	if md.Signatures[1].SignatureError != errors.ErrUnknownIssuer {
+		t.Errorf("inner signature: got %v, want ErrUnknownIssuer", md.Signatures[1].SignatureError)
+	}
+}
+
 func TestMultisigMalformed(t *testing.T) {
 	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(testKey2))
 	if err != nil {
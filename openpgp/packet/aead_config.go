@@ -0,0 +1,69 @@
+package packet
+
+import (
+	"strconv"
+
+	"github.com/keybase/go-crypto/openpgp/errors"
+)
+
+// defaultAEADChunkSizeByte gives chunks of 2^16 bytes.
+const defaultAEADChunkSizeByte = 10
+
+// maxAEADChunkSizeByte is the largest chunk size octet allowed by
+// draft-ietf-openpgp-rfc4880bis, giving chunks of 4 MiB.
+const maxAEADChunkSizeByte = 16
+
+// AEADConfig collects the parameters of AEAD encrypted data packets. A nil
+// *AEADConfig is valid and results in all default values.
+type AEADConfig struct {
+	// ChunkSizeByte is the chunk size octet of the packet. Each chunk
+	// holds 2^(ChunkSizeByte+6) bytes of plaintext. It must be at
+	// most 16. If zero, chunks of 2^16 bytes are used.
+	ChunkSizeByte uint8
+	// Mode is the AEAD mode to use. If zero, EAX is used.
+	Mode AEADMode
+}
+
+// Validate returns an error if c holds values that can't be used.
+func (c *AEADConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.ChunkSizeByte > maxAEADChunkSizeByte {
+		return errors.InvalidArgumentError("AEAD chunk size byte too large: " + strconv.Itoa(int(c.ChunkSizeByte)))
+	}
+	switch c.Mode {
+	case 0, AEADModeEAX, AEADModeGCM:
+	case AEADModeOCB:
+		return errors.UnsupportedError("AEAD mode OCB")
+	default:
+		return errors.InvalidArgumentError("unknown AEAD mode: " + strconv.Itoa(int(c.Mode)))
+	}
+	return nil
+}
+
+// ChunkSize returns the number of plaintext bytes in each chunk.
+func (c *AEADConfig) ChunkSize() uint64 {
+	return uint64(1) << (c.chunkSizeByte() + 6)
+}
+
+func (c *AEADConfig) chunkSizeByte() uint8 {
+	if c == nil || c.ChunkSizeByte == 0 {
+		return defaultAEADChunkSizeByte
+	}
+	return c.ChunkSizeByte
+}
+
+func (c *AEADConfig) mode() AEADMode {
+	if c == nil || c.Mode == 0 {
+		return AEADModeEAX
+	}
+	return c.Mode
+}
+
+func (c *Config) aeadConfig() *AEADConfig {
+	if c == nil {
+		return nil
+	}
+	return c.AEADConfig
+}
@@ -0,0 +1,48 @@
+package packet
+
+import (
+	"testing"
+
+	"github.com/keybase/go-crypto/openpgp/errors"
+)
+
+func TestAEADConfigDefaults(t *testing.T) {
+	var config *Config
+	aead := config.aeadConfig()
+	if size := aead.ChunkSize(); size != 1<<16 {
+		t.Errorf("got default chunk size %d, want %d", size, 1<<16)
+	}
+	if mode := aead.mode(); mode != AEADModeEAX {
+		t.Errorf("got default mode %d, want EAX", mode)
+	}
+
+	config = &Config{AEADConfig: &AEADConfig{ChunkSizeByte: 1, Mode: AEADModeOCB}}
+	aead = config.aeadConfig()
+	if size := aead.ChunkSize(); size != 128 {
+		t.Errorf("got chunk size %d, want 128", size)
+	}
+	if mode := aead.mode(); mode != AEADModeOCB {
+		t.Errorf("got mode %d, want OCB", mode)
+	}
+}
+
+func TestAEADConfigValidate(t *testing.T) {
+	for _, test := range []struct {
+		config *AEADConfig
+		ok     bool
+	}{
+		{nil, true},
+		{&AEADConfig{}, true},
+		{&AEADConfig{ChunkSizeByte: maxAEADChunkSizeByte, Mode: AEADModeGCM}, true},
+		{&AEADConfig{ChunkSizeByte: maxAEADChunkSizeByte + 1}, false},
+		{&AEADConfig{Mode: 4}, false},
+	} {
+		err := test.config.Validate()
+		if test.ok && err != nil {
+			t.Errorf("%+v: unexpected error: %s", test.config, err)
+		}
+		if _, ok := err.(errors.InvalidArgumentError); !test.ok && !ok {
+			t.Errorf("%+v: got %v, want InvalidArgumentError", test.config, err)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package packet
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"strconv"
+
+	"github.com/keybase/go-crypto/openpgp/eax"
+	"github.com/keybase/go-crypto/openpgp/errors"
+)
+
+// AEADEncrypted represents an AEAD encrypted data packet. The encrypted
+// contents will consist of more OpenPGP packets. The plaintext is split into
+// chunks that are each encrypted and authenticated, followed by a final tag
+// that authenticates the length of the whole. See
+// draft-ietf-openpgp-rfc4880bis, section 5.16.
+type AEADEncrypted struct {
+	Cipher        CipherFunction
+	Mode          AEADMode
+	ChunkSizeByte uint8 // chunks hold 2^(ChunkSizeByte+6) bytes of plaintext.
+	iv            []byte
+	contents      io.Reader
+
+	// first holds the start of the contents, kept so that Decrypt can be
+	// tried with several keys. firstEOF is set if it is all of them.
+	first    []byte
+	firstEOF bool
+}
+
+const aeadEncryptedVersion = 1
+
+// errAEADChunk is returned if a chunk fails to authenticate.
+var errAEADChunk = errors.SignatureError("AEAD chunk authentication failed")
+
+// aeadTagSize is the size of the authentication tag of every supported
+// AEAD mode.
+const aeadTagSize = 16
+
+func (ae *AEADEncrypted) parse(r io.Reader) error {
+	var buf [4]byte
+	if _, err := readFull(r, buf[:]); err != nil {
+		return err
+	}
+	if buf[0] != aeadEncryptedVersion {
+		return errors.UnsupportedError("unknown AEADEncrypted version " + strconv.Itoa(int(buf[0])))
+	}
+	ae.Cipher = CipherFunction(buf[1])
+	ae.Mode = AEADMode(buf[2])
+	ae.ChunkSizeByte = buf[3]
+	if ae.ChunkSizeByte > maxAEADChunkSizeByte {
+		return errors.UnsupportedError("AEAD chunk size byte too large: " + strconv.Itoa(int(ae.ChunkSizeByte)))
+	}
+	nonceSize := ae.Mode.nonceSize()
+	if nonceSize == 0 {
+		return errors.UnsupportedError("unknown AEAD mode: " + strconv.Itoa(int(ae.Mode)))
+	}
+	ae.iv = make([]byte, nonceSize)
+	if _, err := readFull(r, ae.iv); err != nil {
+		return err
+	}
+	ae.contents = r
+	return nil
+}
+
+// Decrypt returns a ReadCloser, from which the decrypted contents of the
+// packet can be read. The first chunk is decrypted straight away, so that an
+// incorrect key is detected and results in a KeyIncorrect error. Each chunk
+// is authenticated before its plaintext is returned, and a failure is
+// reported as a SignatureError error when reading. The cipher is created
+// with config.CipherFactory, if it is set. If config is nil, sensible
+// defaults will be used.
+func (ae *AEADEncrypted) Decrypt(key []byte, config *Config) (io.ReadCloser, error) {
+	keySize := ae.Cipher.KeySize()
+	if keySize == 0 {
+		return nil, errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(ae.Cipher)))
+	}
+	if len(key) != keySize {
+		return nil, errors.InvalidArgumentError("AEADEncrypted: incorrect key length")
+	}
+	aead, err := newAEAD(ae.Mode, ae.Cipher, key, config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newAEADCrypter(aead, ae.Cipher, ae.Mode, ae.ChunkSizeByte, ae.iv)
+	if ae.first == nil {
+		ae.first = make([]byte, c.chunkSize+2*aeadTagSize)
+		n, err := readFull(ae.contents, ae.first)
+		if err == io.ErrUnexpectedEOF {
+			ae.firstEOF = true
+		} else if err != nil {
+			return nil, err
+		}
+		ae.first = ae.first[:n]
+	}
+
+	r := &aeadDecrypter{
+		aeadCrypter: c,
+		in:          ae.contents,
+		peeked:      append([]byte(nil), ae.first...),
+		inEOF:       ae.firstEOF,
+	}
+	if err := r.readChunk(); err != nil {
+		if err == errAEADChunk {
+			return nil, errors.ErrKeyIncorrect
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// nonceSize returns the size of the nonces of mode, or zero if it isn't
+// known.
+func (mode AEADMode) nonceSize() int {
+	switch mode {
+	case AEADModeEAX:
+		return 16
+	case AEADModeOCB:
+		return 15
+	case AEADModeGCM:
+		return 12
+	}
+	return 0
+}
+
+// newAEAD returns cipherFunc, keyed with key, in the given AEAD mode.
+func newAEAD(mode AEADMode, cipherFunc CipherFunction, key []byte, config *Config) (cipher.AEAD, error) {
+	block, err := config.newCipher(cipherFunc, key)
+	if err != nil {
+		return nil, err
+	}
+	if block.BlockSize() != 16 {
+		return nil, errors.UnsupportedError("AEAD with a " + strconv.Itoa(8*block.BlockSize()) + "-bit block cipher")
+	}
+	switch mode {
+	case AEADModeEAX:
+		return eax.NewEAX(block)
+	case AEADModeGCM:
+		return cipher.NewGCM(block)
+	case AEADModeOCB:
+		return nil, errors.UnsupportedError("AEAD mode OCB")
+	}
+	return nil, errors.UnsupportedError("unknown AEAD mode: " + strconv.Itoa(int(mode)))
+}
+
+// aeadCrypter holds the state shared by the encryption and decryption of
+// the chunks of an AEAD encrypted data packet.
+type aeadCrypter struct {
+	aead       cipher.AEAD
+	chunkSize  int
+	iv         []byte
+	header     [5]byte // the packet tag and the fields that precede the IV.
+	chunkIndex uint64
+	processed  uint64 // the number of plaintext bytes so far.
+}
+
+func newAEADCrypter(aead cipher.AEAD, cipherFunc CipherFunction, mode AEADMode, chunkSizeByte uint8, iv []byte) aeadCrypter {
+	return aeadCrypter{
+		aead:      aead,
+		chunkSize: 1 << (chunkSizeByte + 6),
+		iv:        iv,
+		header: [5]byte{
+			0x80 | 0x40 | byte(packetTypeAEADEncrypted),
+			aeadEncryptedVersion,
+			byte(cipherFunc),
+			byte(mode),
+			chunkSizeByte,
+		},
+	}
+}
+
+// nonce returns the nonce of the current chunk, which is the IV xored with
+// the chunk index.
+func (c *aeadCrypter) nonce() []byte {
+	nonce := append([]byte(nil), c.iv...)
+	var index [8]byte
+	binary.BigEndian.PutUint64(index[:], c.chunkIndex)
+	for i := range index {
+		nonce[len(nonce)-8+i] ^= index[i]
+	}
+	return nonce
+}
+
+// additionalData returns the associated data of the current chunk or, if
+// final is set, of the final tag, which also covers the total length of the
+// plaintext.
+func (c *aeadCrypter) additionalData(final bool) []byte {
+	ad := make([]byte, len(c.header), len(c.header)+16)
+	copy(ad, c.header[:])
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], c.chunkIndex)
+	ad = append(ad, buf[:]...)
+	if final {
+		binary.BigEndian.PutUint64(buf[:], c.processed)
+		ad = append(ad, buf[:]...)
+	}
+	return ad
+}
+
+// aeadDecrypter reads the plaintext of the chunks of an AEAD encrypted data
+// packet. It reads ahead far enough to tell the last chunk, and the final tag
+// after it, from the others.
+type aeadDecrypter struct {
+	aeadCrypter
+	in        io.Reader
+	peeked    []byte // ciphertext read from in but not yet decrypted.
+	inEOF     bool   // set once in is exhausted.
+	plaintext []byte // decrypted but not yet returned.
+	eof       bool   // set once the final tag has been checked.
+	err       error
+}
+
+func (r *aeadDecrypter) Read(buf []byte) (n int, err error) {
+	for len(r.plaintext) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.eof {
+			return 0, io.EOF
+		}
+		r.err = r.readChunk()
+	}
+	n = copy(buf, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return
+}
+
+// readChunk decrypts the next chunk and, if it is the last one, checks the
+// final tag.
+func (r *aeadDecrypter) readChunk() error {
+	want := r.chunkSize + 2*aeadTagSize
+	if !r.inEOF && len(r.peeked) < want {
+		n := len(r.peeked)
+		r.peeked = append(r.peeked, make([]byte, want-n)...)
+		m, err := readFull(r.in, r.peeked[n:])
+		if err == io.ErrUnexpectedEOF {
+			r.inEOF = true
+		} else if err != nil {
+			return err
+		}
+		r.peeked = r.peeked[:n+m]
+	}
+
+	if r.inEOF && len(r.peeked) < aeadTagSize {
+		return errors.StructuralError("AEAD encrypted data truncated")
+	}
+	chunk := r.peeked
+	if r.inEOF {
+		chunk = chunk[:len(chunk)-aeadTagSize]
+	} else {
+		chunk = chunk[:r.chunkSize+aeadTagSize]
+	}
+	if len(chunk) > 0 && len(chunk) < aeadTagSize {
+		return errors.StructuralError("AEAD encrypted data truncated")
+	}
+	if len(chunk) > 0 {
+		plaintext, err := r.aead.Open(nil, r.nonce(), chunk, r.additionalData(false))
+		if err != nil {
+			return errAEADChunk
+		}
+		r.plaintext = plaintext
+		r.chunkIndex++
+		r.processed += uint64(len(plaintext))
+	}
+	r.peeked = r.peeked[len(chunk):]
+
+	if r.inEOF {
+		if _, err := r.aead.Open(nil, r.nonce(), r.peeked, r.additionalData(true)); err != nil {
+			return errors.SignatureError("AEAD final tag authentication failed")
+		}
+		r.peeked = nil
+		r.eof = true
+	}
+	return nil
+}
+
+// Close checks that the contents were read to the end and authenticated.
+func (r *aeadDecrypter) Close() error {
+	var buf [1024]byte
+	for {
+		_, err := r.Read(buf[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// aeadEncrypter splits the plaintext written to it into chunks, which it
+// encrypts and writes to w.
+type aeadEncrypter struct {
+	aeadCrypter
+	w   io.WriteCloser
+	buf []byte // plaintext that doesn't yet fill a chunk.
+}
+
+func (w *aeadEncrypter) Write(p []byte) (n int, err error) {
+	n = len(p)
+	for len(w.buf)+len(p) >= w.chunkSize {
+		m := w.chunkSize - len(w.buf)
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+		if err = w.writeChunk(); err != nil {
+			return 0, err
+		}
+	}
+	w.buf = append(w.buf, p...)
+	return
+}
+
+func (w *aeadEncrypter) writeChunk() error {
+	ciphertext := w.aead.Seal(nil, w.nonce(), w.buf, w.additionalData(false))
+	if _, err := w.w.Write(ciphertext); err != nil {
+		return err
+	}
+	w.chunkIndex++
+	w.processed += uint64(len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes the last, partial chunk, if any, and the final tag.
+func (w *aeadEncrypter) Close() error {
+	if len(w.buf) > 0 {
+		if err := w.writeChunk(); err != nil {
+			return err
+		}
+	}
+	tag := w.aead.Seal(nil, w.nonce(), nil, w.additionalData(true))
+	if _, err := w.w.Write(tag); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
+
+// SerializeAEADEncrypted serializes an AEAD encrypted data packet to w and
+// returns a WriteCloser to which the to-be-encrypted packets can be written.
+// The chunk size and AEAD mode are taken from config.AEADConfig. If config
+// is nil, sensible defaults will be used.
+func SerializeAEADEncrypted(w io.Writer, c CipherFunction, key []byte, config *Config) (contents io.WriteCloser, err error) {
+	aeadConfig := config.aeadConfig()
+	if err = aeadConfig.Validate(); err != nil {
+		return
+	}
+	if c.KeySize() != len(key) {
+		return nil, errors.InvalidArgumentError("AEADEncrypted.Serialize: bad key length")
+	}
+	mode, chunkSizeByte := aeadConfig.mode(), aeadConfig.chunkSizeByte()
+	aead, err := newAEAD(mode, c, key, config)
+	if err != nil {
+		return
+	}
+	iv := make([]byte, mode.nonceSize())
+	if _, err = io.ReadFull(config.Random(), iv); err != nil {
+		return
+	}
+
+	ciphertext, err := serializeStreamHeader(noOpCloser{w}, packetTypeAEADEncrypted, config)
+	if err != nil {
+		return
+	}
+	header := []byte{aeadEncryptedVersion, byte(c), byte(mode), chunkSizeByte}
+	if _, err = ciphertext.Write(append(header, iv...)); err != nil {
+		return
+	}
+	return &aeadEncrypter{
+		aeadCrypter: newAEADCrypter(aead, c, mode, chunkSizeByte, iv),
+		w:           ciphertext,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package packet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/keybase/go-crypto/openpgp/errors"
+)
+
+func TestAEADEncryptedRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, CipherAES128.KeySize())
+	message := make([]byte, 1000)
+	for i := range message {
+		message[i] = byte(i)
+	}
+
+	for _, test := range []struct {
+		mode      AEADMode
+		length    int
+		numChunks uint64
+	}{
+		{AEADModeEAX, 1000, 8},
+		{AEADModeGCM, 1000, 8},
+		{AEADModeEAX, 512, 4},
+		{AEADModeEAX, 1, 1},
+		{AEADModeGCM, 0, 0},
+	} {
+		config := &Config{AEADConfig: &AEADConfig{ChunkSizeByte: 1, Mode: test.mode}}
+		plaintext := message[:test.length]
+
+		buf := new(bytes.Buffer)
+		w, err := SerializeAEADEncrypted(buf, CipherAES128, key, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(plaintext)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := Read(buf)
+		if err != nil {
+			t.Fatalf("mode %d, length %d: %s", test.mode, test.length, err)
+		}
+		ae, ok := p.(*AEADEncrypted)
+		if !ok {
+			t.Fatalf("mode %d, length %d: got %T, want *AEADEncrypted", test.mode, test.length, p)
+		}
+		if ae.Mode != test.mode || ae.ChunkSizeByte != 1 || ae.Cipher != CipherAES128 {
+			t.Errorf("mode %d, length %d: got header %d %d %d", test.mode, test.length, ae.Mode, ae.ChunkSizeByte, ae.Cipher)
+		}
+
+		if _, err := ae.Decrypt(bytes.Repeat([]byte{0x43}, len(key)), nil); err != errors.ErrKeyIncorrect && test.length > 0 {
+			t.Errorf("mode %d, length %d: wrong key gave %v, want ErrKeyIncorrect", test.mode, test.length, err)
+		}
+		r, err := ae.Decrypt(key, nil)
+		if err != nil {
+			t.Fatalf("mode %d, length %d: %s", test.mode, test.length, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("mode %d, length %d: %s", test.mode, test.length, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("mode %d, length %d: wrong plaintext", test.mode, test.length)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("mode %d, length %d: Close: %s", test.mode, test.length, err)
+		}
+		if n := r.(*aeadDecrypter).chunkIndex; n != test.numChunks {
+			t.Errorf("mode %d, length %d: got %d chunks, want %d", test.mode, test.length, n, test.numChunks)
+		}
+	}
+}
+
+func TestAEADEncryptedModified(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, CipherAES128.KeySize())
+	config := &Config{AEADConfig: &AEADConfig{ChunkSizeByte: 1}}
+
+	buf := new(bytes.Buffer)
+	w, err := SerializeAEADEncrypted(buf, CipherAES128, key, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(make([]byte, 300))
+	w.Close()
+	encrypted := buf.Bytes()
+
+	for _, test := range []struct {
+		name   string
+		offset int // from the end of the packet.
+	}{
+		{"modified last chunk", 50},
+		{"modified final tag", 1},
+	} {
+		modified := append([]byte(nil), encrypted...)
+		modified[len(modified)-test.offset] ^= 1
+		p, err := Read(bytes.NewReader(modified))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		r, err := p.(*AEADEncrypted).Decrypt(key, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if _, err = ioutil.ReadAll(r); err == nil {
+			t.Errorf("%s: no error", test.name)
+		} else if _, ok := err.(errors.SignatureError); !ok {
+			t.Errorf("%s: got %v, want SignatureError", test.name, err)
+		}
+	}
+}
+
+func TestSerializeAEADEncryptedInvalidConfig(t *testing.T) {
+	key := make([]byte, CipherAES128.KeySize())
+	for _, aeadConfig := range []*AEADConfig{
+		{ChunkSizeByte: maxAEADChunkSizeByte + 1},
+		{Mode: AEADModeOCB},
+	} {
+		buf := new(bytes.Buffer)
+		_, err := SerializeAEADEncrypted(buf, CipherAES128, key, &Config{AEADConfig: aeadConfig})
+		if err == nil {
+			t.Errorf("%+v: no error", aeadConfig)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%+v: %d bytes written before failing", aeadConfig, buf.Len())
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 // will contain more OpenPGP packets. See RFC 4880, section 5.6.
 type Compressed struct {
 	Body io.Reader
+	Algo CompressionAlgo // the algorithm that Body was compressed with.
 }
 
 const (
@@ -55,12 +56,35 @@ func (c *Compressed) parse(r io.Reader) error {
 	case 3:
 		c.Body = bzip2.NewReader(r)
 	default:
-		err = errors.UnsupportedError("unknown compression algorithm: " + strconv.Itoa(int(buf[0])))
+		err = errors.UnsupportedError("compression algorithm " + strconv.Itoa(int(buf[0])) + " can't be decompressed")
+	}
+	if err == nil {
+		c.Algo = CompressionAlgo(buf[0])
+		c.Body = compressedReader{c.Body, r}
 	}
 
 	return err
 }
 
+// compressedReader wraps a decompressor and, once it reports EOF, consumes
+// whatever is left of the packet contents, such as a trailing empty partial
+// length chunk. Otherwise any packets following the Compressed packet would
+// be read starting from those leftover bytes.
+type compressedReader struct {
+	body     io.Reader
+	contents io.Reader
+}
+
+func (cr compressedReader) Read(buf []byte) (n int, err error) {
+	n, err = cr.body.Read(buf)
+	if err == io.EOF {
+		if _, cerr := consumeAll(cr.contents); cerr != nil {
+			err = cerr
+		}
+	}
+	return
+}
+
 // compressedWriterCloser represents the serialized compression stream
 // header and the compressor. Its Close() method ensures that both the
 // compressor and serialized stream header are closed. Its Write()
@@ -89,7 +113,22 @@ func (cwc compressedWriteCloser) Close() (err error) {
 // nil, sensible defaults will be used to configure the compression
 // algorithm.
 func SerializeCompressed(w io.WriteCloser, algo CompressionAlgo, cc *CompressionConfig) (literaldata io.WriteCloser, err error) {
-	compressed, err := serializeStreamHeader(w, packetTypeCompressed)
+	return serializeCompressed(w, algo, cc, nil)
+}
+
+// SerializeCompressedWithConfig is like SerializeCompressed, but takes the
+// compression settings from config.CompressionConfig and writes the packet
+// with a definite length if config.ForceDefiniteLength is set.
+func SerializeCompressedWithConfig(w io.WriteCloser, algo CompressionAlgo, config *Config) (literaldata io.WriteCloser, err error) {
+	var cc *CompressionConfig
+	if config != nil {
+		cc = config.CompressionConfig
+	}
+	return serializeCompressed(w, algo, cc, config)
+}
+
+func serializeCompressed(w io.WriteCloser, algo CompressionAlgo, cc *CompressionConfig, config *Config) (literaldata io.WriteCloser, err error) {
+	compressed, err := serializeStreamHeader(w, packetTypeCompressed, config)
 	if err != nil {
 		return
 	}
@@ -6,9 +6,13 @@ package packet
 
 import (
 	"crypto"
+	"crypto/cipher"
 	"crypto/rand"
 	"io"
+	"strconv"
 	"time"
+
+	"github.com/keybase/go-crypto/openpgp/errors"
 )
 
 // Config collects a number of parameters along with sensible defaults.
@@ -27,9 +31,15 @@ type Config struct {
 	// epoch. If Time is nil, time.Now is used.
 	Time func() time.Time
 	// DefaultCompressionAlgo is the compression algorithm to be
-	// applied to the plaintext before encryption. If zero, no
-	// compression is done.
+	// applied to the plaintext before encryption. Messages without
+	// recipients, such as those written by SymmetricallyEncrypt, are
+	// compressed with it, and aren't compressed if it is zero.
+	// Encrypt uses it if all of the recipients accept it, and the
+	// algorithm they prefer otherwise, including when it is zero.
 	DefaultCompressionAlgo CompressionAlgo
+	// DisableCompression stops messages from being compressed at all,
+	// overriding DefaultCompressionAlgo and any recipient preferences.
+	DisableCompression bool
 	// CompressionConfig configures the compression settings.
 	CompressionConfig *CompressionConfig
 	// S2KCount is only used for symmetric encryption. It
@@ -46,9 +56,108 @@ type Config struct {
 	// RSABits is the number of bits in new RSA keys made with NewEntity.
 	// If zero, then 2048 bit keys are created.
 	RSABits int
+	// Algorithm is the public key algorithm of the primary key of new
+	// entities made with NewEntity. If zero, PubKeyAlgoRSA is used.
+	// PubKeyAlgoDSA makes a DSA primary key with an ElGamal encryption
+	// subkey, for interoperating with legacy implementations.
+	Algorithm PublicKeyAlgorithm
+	// DSABits is the size of new DSA keys made with NewEntity: 1024,
+	// 2048 or 3072. If zero, then 2048 bit keys are created. Their
+	// ElGamal subkeys are 2048 bits, or 3072 bits with 3072 bit DSA
+	// keys.
+	DSABits int
 	// ReuseSignatures tells us to reuse existing Signatures
 	// on serialized output.
 	ReuseSignaturesOnSerialize bool
+	// PreferredAEAD lists the AEAD modes, most preferred first, to
+	// advertise in the self-signature of keys made with NewEntity.
+	// If empty, no AEAD preferences are advertised.
+	PreferredAEAD []AEADMode
+	// AEADConfig configures the chunk size and mode of AEAD encrypted
+	// data packets written by SerializeAEADEncrypted. If nil, sensible
+	// defaults are used. Encrypt only writes AEAD encrypted data if it
+	// is set and all of the recipients support it.
+	AEADConfig *AEADConfig
+	// ExternalSigner, if non-nil, performs the private key operation
+	// when signing a message, in place of the private key material of
+	// the signing key. The signature packet is still built and hashed
+	// by this package. It isn't used for self-signatures or
+	// certifications. The caller must ensure that ExternalSigner
+	// corresponds to the key being signed with.
+	ExternalSigner ExternalSigner
+	// VerificationCache, if non-nil, is consulted before verifying
+	// certification signatures and is told about the ones that
+	// verify, so repeated verifications can be skipped.
+	VerificationCache VerificationCache
+	// RequireSignature makes ReadMessage fail with
+	// errors.ErrUnsignedMessage when the message isn't signed,
+	// instead of returning the plaintext.
+	RequireSignature bool
+	// ClockSkew is how far the signer's clock may be ahead of, or the
+	// verifier's clock behind, the current time when checking the
+	// creation and expiration times of message signatures. If zero,
+	// signatures created in the future or already expired are
+	// rejected. These times are only checked when verifying with a
+	// non-nil Config.
+	ClockSkew time.Duration
+	// CipherFactory, if non-nil, creates the block ciphers used to
+	// encrypt and decrypt symmetrically encrypted data and the session
+	// keys of symmetric key encrypted packets, in place of the
+	// implementations built into this package. This allows, for
+	// instance, substituting a certified AES implementation.
+	CipherFactory func(cipherFunc CipherFunction, key []byte) (cipher.Block, error)
+	// MaxPackets limits how many packets a Reader made with
+	// NewReaderWithConfig reads: reading a packet past the limit fails
+	// with a StructuralError, to bound the work done on malicious
+	// input. Trust packets aren't counted. If zero, there is no limit.
+	MaxPackets int
+	// MaxEntities limits how many entities ReadKeyRingWithConfig reads
+	// before failing with a StructuralError. If zero, there is no
+	// limit.
+	MaxEntities int
+	// RejectUnprotected makes ReadMessage fail with
+	// errors.ErrUnprotectedMessage when the message is encrypted
+	// without a modification detection code, as with the plain
+	// Symmetrically Encrypted Data packets of RFC 2440, instead of
+	// decrypting it.
+	RejectUnprotected bool
+	// SignerUserId, if non-empty, names the identity of the signing
+	// entity that a message signature is made on behalf of. It must be
+	// one of the signer's user ids and is recorded in the signature's
+	// signer's user id subpacket.
+	SignerUserId string
+	// SessionKey, if non-nil, is used as the session key of encrypted
+	// messages instead of a randomly generated one. Its length must
+	// match the key size of the cipher that is picked. It is only meant
+	// for tests that need reproducible output: reusing a session key
+	// for different messages is insecure.
+	SessionKey []byte
+	// ForceDefiniteLength makes the writers of literal, compressed and
+	// encrypted data buffer each packet in memory and write it with a
+	// definite length, instead of streaming it with partial lengths,
+	// for the benefit of parsers that reject partial lengths.
+	ForceDefiniteLength bool
+	// RequireIssuerFingerprint makes signature verification fail with
+	// errors.ErrMissingIssuerFingerprint when a signature names its
+	// issuer only by the easily spoofed key id, without an issuer
+	// fingerprint subpacket.
+	RequireIssuerFingerprint bool
+	// SubpacketConfig, if non-nil, is called before a detached signature
+	// is made and may append application-specific subpackets, such as
+	// notations, to the hashed area. The creation time and issuer
+	// subpackets are always added by the package and must not be
+	// appended here.
+	SubpacketConfig func(subpackets *[]Subpacket)
+	// OmitDummySubkeys makes Entity.SerializePrivate write subkeys
+	// whose secret is a GNU-dummy stub, such as those moved to a
+	// smartcard, as public subkey packets instead of with the GNU
+	// dummy S2K that some tools don't understand.
+	OmitDummySubkeys bool
+	// MinRSABits is the smallest size of RSA keys whose message and
+	// detached signatures are accepted. Signatures made by smaller RSA
+	// keys fail with an errors.PolicyError, even though they verify. If
+	// zero, there is no minimum.
+	MinRSABits int
 }
 
 func (c *Config) Random() io.Reader {
@@ -79,8 +188,32 @@ func (c *Config) Now() time.Time {
 	return c.Time()
 }
 
-func (c *Config) Compression() CompressionAlgo {
+// newCipher returns a block cipher of the given kind keyed with key, made by
+// c.CipherFactory if it is set.
+func (c *Config) newCipher(cipherFunc CipherFunction, key []byte) (cipher.Block, error) {
+	if c != nil && c.CipherFactory != nil {
+		return c.CipherFactory(cipherFunc, key)
+	}
+	block := cipherFunc.new(key)
+	if block == nil {
+		return nil, errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(cipherFunc)))
+	}
+	return block, nil
+}
+
+func (c *Config) forceDefiniteLength() bool {
+	return c != nil && c.ForceDefiniteLength
+}
+
+func (c *Config) maxPackets() int {
 	if c == nil {
+		return 0
+	}
+	return c.MaxPackets
+}
+
+func (c *Config) Compression() CompressionAlgo {
+	if c == nil || c.DisableCompression {
 		return CompressionNone
 	}
 	return c.DefaultCompressionAlgo
@@ -2,6 +2,7 @@ package packet
 
 import (
 	"bytes"
+	"crypto"
 	"io"
 	"math/big"
 
@@ -24,26 +25,55 @@ func ECDHKdfParams(pub *PublicKey) []byte {
 	return buf.Bytes()
 }
 
+// ECDHKDFParams returns the hash function and key wrapping cipher that pk
+// advertises for ECDH key derivation. ok is false if pk is not an ECDH key,
+// or if the advertised parameters are unknown or unsupported.
+func (pk *PublicKey) ECDHKDFParams() (hash crypto.Hash, wrapCipher CipherFunction, ok bool) {
+	if pk.PubKeyAlgo != PubKeyAlgoECDH || pk.ecdh == nil {
+		return 0, 0, false
+	}
+	hash, ok = s2k.HashIdToHash(byte(pk.ecdh.KdfHash))
+	if !ok || !hash.Available() {
+		return 0, 0, false
+	}
+	wrapCipher = CipherFunction(pk.ecdh.KdfAlgo)
+	switch wrapCipher {
+	case CipherAES128, CipherAES192, CipherAES256:
+	default:
+		// RFC 6637 section 8 requires AES key wrapping.
+		return 0, 0, false
+	}
+	return hash, wrapCipher, true
+}
+
 func decryptKeyECDH(priv *PrivateKey, X, Y *big.Int, C []byte) (out []byte, err error) {
 	ecdhpriv, ok := priv.PrivateKey.(*ecdh.PrivateKey)
 	if !ok {
 		return nil, errors.InvalidArgumentError("bad internal ECDH key")
 	}
 
-	Sx := ecdhpriv.DecryptShared(X, Y)
-
-	kdfParams := ECDHKdfParams(&priv.PublicKey)
-	hash, ok := s2k.HashIdToHash(byte(priv.ecdh.KdfHash))
+	hash, wrapCipher, ok := priv.ECDHKDFParams()
 	if !ok {
-		return nil, errors.InvalidArgumentError("invalid hash id in private key")
+		return nil, errors.UnsupportedError("ECDH KDF parameters in private key")
 	}
+	if len(C) < 16 || len(C)%8 != 0 {
+		return nil, errors.StructuralError("ECDH wrapped key has invalid length")
+	}
+
+	Sx := ecdhpriv.DecryptShared(X, Y)
 
+	kdfParams := ECDHKdfParams(&priv.PublicKey)
 	key := ecdhpriv.KDF(Sx, kdfParams, hash)
-	keySize := CipherFunction(priv.ecdh.KdfAlgo).KeySize()
 
-	decrypted, err := ecdh.AESKeyUnwrap(key[:keySize], C)
+	decrypted, err := ecdh.AESKeyUnwrap(key[:wrapCipher.KeySize()], C)
 	if err != nil {
-		return nil, err
+		// The ciphertext is well-formed, so the integrity check in
+		// the key unwrap failed: we derived a different KEK than
+		// the sender did.
+		if ecdhKDFMismatch(priv, ecdhpriv, Sx, C) {
+			return nil, errors.ErrECDHKDFMismatch
+		}
+		return nil, errors.ErrKeyIncorrect
 	}
 
 	// We have to "read ahead" to discover real length of the
@@ -57,17 +87,42 @@ func decryptKeyECDH(priv *PrivateKey, X, Y *big.Int, C []byte) (out []byte, err
 	return out, nil
 }
 
+// ecdhKDFMismatch reports whether C, which failed to unwrap with the KDF
+// parameters of priv, unwraps with other parameters allowed by RFC 6637,
+// section 8, meaning that the sender used different KDF parameters for the
+// key.
+func ecdhKDFMismatch(priv *PrivateKey, ecdhpriv *ecdh.PrivateKey, Sx, C []byte) bool {
+	pub := priv.PublicKey
+	for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		hashId, ok := s2k.HashToHashId(hash)
+		if !ok || !hash.Available() {
+			continue
+		}
+		for _, wrapCipher := range []CipherFunction{CipherAES128, CipherAES192, CipherAES256} {
+			kdf := ecdhKdf{KdfHash: kdfHashFunction(hashId), KdfAlgo: kdfAlgorithm(wrapCipher)}
+			if kdf == *priv.ecdh {
+				continue
+			}
+			pub.ecdh = &kdf
+			key := ecdhpriv.KDF(Sx, ECDHKdfParams(&pub), hash)
+			if _, err := ecdh.AESKeyUnwrap(key[:wrapCipher.KeySize()], C); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func serializeEncryptedKeyECDH(w io.Writer, rand io.Reader, header [10]byte, pub *PublicKey, keyBlock []byte) error {
 	ecdhpub := pub.PublicKey.(*ecdh.PublicKey)
 	kdfParams := ECDHKdfParams(pub)
 
-	hash, ok := s2k.HashIdToHash(byte(pub.ecdh.KdfHash))
+	hash, wrapCipher, ok := pub.ECDHKDFParams()
 	if !ok {
-		return errors.InvalidArgumentError("invalid hash id in private key")
+		return errors.UnsupportedError("ECDH KDF parameters in public key")
 	}
 
-	kdfKeySize := CipherFunction(pub.ecdh.KdfAlgo).KeySize()
-	Vx, Vy, C, err := ecdhpub.Encrypt(rand, kdfParams, keyBlock, hash, kdfKeySize)
+	Vx, Vy, C, err := ecdhpub.Encrypt(rand, kdfParams, keyBlock, hash, wrapCipher.KeySize())
 	if err != nil {
 		return err
 	}
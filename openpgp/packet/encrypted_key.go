@@ -126,6 +126,34 @@ func (e *EncryptedKey) Decrypt(priv *PrivateKey, config *Config) error {
 	return nil
 }
 
+// EncryptedMPIs returns copies of the MPIs that hold the encrypted session
+// key: one for RSA, two for ElGamal and the ephemeral point for ECDH. It
+// returns nil for unknown algorithms.
+func (e *EncryptedKey) EncryptedMPIs() [][]byte {
+	switch e.Algo {
+	case PubKeyAlgoRSA, PubKeyAlgoRSAEncryptOnly, PubKeyAlgoECDH:
+		return [][]byte{copyBytes(e.encryptedMPI1.bytes)}
+	case PubKeyAlgoElGamal:
+		return [][]byte{copyBytes(e.encryptedMPI1.bytes), copyBytes(e.encryptedMPI2.bytes)}
+	}
+	return nil
+}
+
+// WrappedKey returns a copy of the AES key-wrapped session key of an ECDH
+// encrypted key, or nil for other algorithms.
+func (e *EncryptedKey) WrappedKey() []byte {
+	if e.Algo != PubKeyAlgoECDH {
+		return nil
+	}
+	return copyBytes(e.ecdh_C)
+}
+
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
 // Serialize writes the encrypted key packet, e, to w.
 func (e *EncryptedKey) Serialize(w io.Writer) error {
 	var mpiLen int
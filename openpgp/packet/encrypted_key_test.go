@@ -6,11 +6,18 @@ package packet
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"math/big"
 	"testing"
+	"time"
 
+	"github.com/keybase/go-crypto/openpgp/ecdh"
+	"github.com/keybase/go-crypto/openpgp/errors"
+	"github.com/keybase/go-crypto/openpgp/s2k"
 	"github.com/keybase/go-crypto/rsa"
 )
 
@@ -150,3 +157,38 @@ func TestSerializingEncryptedKey(t *testing.T) {
 		t.Fatalf("serialization of encrypted key differed from original. Original was %s, but reserialized as %s", encryptedKeyHex, bufHex)
 	}
 }
+
+func TestECDHKDFMismatch(t *testing.T) {
+	ecdhPriv, err := ecdh.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := NewECDHPrivateKey(time.Now(), ecdhPriv)
+
+	// The sender has the same key, with other KDF parameters.
+	sender := priv.PublicKey
+	hashId, _ := s2k.HashToHashId(crypto.SHA256)
+	sender.ecdh = &ecdhKdf{KdfHash: kdfHashFunction(hashId), KdfAlgo: kdfAlgorithm(CipherAES128)}
+
+	key := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	for _, test := range []struct {
+		pub  *PublicKey
+		want error
+	}{
+		{&priv.PublicKey, nil},
+		{&sender, errors.ErrECDHKDFMismatch},
+	} {
+		buf := new(bytes.Buffer)
+		if err := SerializeEncryptedKey(buf, test.pub, CipherAES128, key, nil); err != nil {
+			t.Fatal(err)
+		}
+		p, err := Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ek := p.(*EncryptedKey)
+		if err := ek.Decrypt(priv, nil); err != test.want {
+			t.Errorf("got %v, want %v", err, test.want)
+		}
+	}
+}
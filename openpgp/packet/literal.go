@@ -55,6 +55,12 @@ func (l *LiteralData) parse(r io.Reader) (err error) {
 // WriteCloser to which the data itself can be written and which MUST be closed
 // on completion. The fileName is truncated to 255 bytes.
 func SerializeLiteral(w io.WriteCloser, isBinary bool, fileName string, time uint32) (plaintext io.WriteCloser, err error) {
+	return SerializeLiteralWithConfig(w, isBinary, fileName, time, nil)
+}
+
+// SerializeLiteralWithConfig is like SerializeLiteral, but writes the packet
+// with a definite length if config.ForceDefiniteLength is set.
+func SerializeLiteralWithConfig(w io.WriteCloser, isBinary bool, fileName string, time uint32, config *Config) (plaintext io.WriteCloser, err error) {
 	var buf [4]byte
 	buf[0] = 't'
 	if isBinary {
@@ -65,7 +71,7 @@ func SerializeLiteral(w io.WriteCloser, isBinary bool, fileName string, time uin
 	}
 	buf[1] = byte(len(fileName))
 
-	inner, err := serializeStreamHeader(w, packetTypeLiteralData)
+	inner, err := serializeStreamHeader(w, packetTypeLiteralData, config)
 	if err != nil {
 		return
 	}
@@ -13,6 +13,7 @@ import (
 	"crypto/des"
 	"crypto/elliptic"
 	"io"
+	"math"
 	"math/big"
 
 	"github.com/keybase/go-crypto/cast5"
@@ -97,28 +98,47 @@ func (r *partialLengthReader) Read(p []byte) (n int, err error) {
 }
 
 // partialLengthWriter writes a stream of data using OpenPGP partial lengths.
-// See RFC 4880, section 4.2.2.4.
+// See RFC 4880, section 4.2.2.4. Apart from the first chunk, data is passed
+// on as it is written, so memory use doesn't grow with the size of the
+// stream.
 type partialLengthWriter struct {
 	w          io.WriteCloser
 	lengthByte [1]byte
+	// first buffers the start of the stream, since the first partial
+	// length must be at least minFirstPartialLength bytes. Streams
+	// shorter than that are written with a regular length on Close.
+	first     []byte
+	sentFirst bool
+	// definite makes first buffer the whole stream, so that it is
+	// always written with a regular length.
+	definite bool
 }
 
+const minFirstPartialLength = 512
+
 func (w *partialLengthWriter) Write(p []byte) (n int, err error) {
+	if !w.sentFirst {
+		if w.definite || len(w.first)+len(p) < minFirstPartialLength {
+			w.first = append(w.first, p...)
+			return len(p), nil
+		}
+		n = minFirstPartialLength - len(w.first)
+		w.first = append(w.first, p[:n]...)
+		p = p[n:]
+		if err = w.writeChunk(w.first, 9); err != nil {
+			return 0, err
+		}
+		w.sentFirst = true
+		w.first = nil
+	}
 	for len(p) > 0 {
 		for power := uint(14); power < 32; power-- {
 			l := 1 << power
 			if len(p) >= l {
-				w.lengthByte[0] = 224 + uint8(power)
-				_, err = w.w.Write(w.lengthByte[:])
-				if err != nil {
-					return
-				}
-				var m int
-				m, err = w.w.Write(p[:l])
-				n += m
-				if err != nil {
+				if err = w.writeChunk(p[:l], power); err != nil {
 					return
 				}
+				n += l
 				p = p[l:]
 				break
 			}
@@ -127,7 +147,27 @@ func (w *partialLengthWriter) Write(p []byte) (n int, err error) {
 	return
 }
 
+// writeChunk writes data, which must be 2^power bytes long, with a partial
+// length.
+func (w *partialLengthWriter) writeChunk(data []byte, power uint) (err error) {
+	w.lengthByte[0] = 224 + uint8(power)
+	if _, err = w.w.Write(w.lengthByte[:]); err != nil {
+		return
+	}
+	_, err = w.w.Write(data)
+	return
+}
+
 func (w *partialLengthWriter) Close() error {
+	if !w.sentFirst {
+		if err := serializeLength(w.w, len(w.first)); err != nil {
+			return err
+		}
+		if _, err := w.w.Write(w.first); err != nil {
+			return err
+		}
+		return w.w.Close()
+	}
 	w.lengthByte[0] = 0
 	_, err := w.w.Write(w.lengthByte[:])
 	if err != nil {
@@ -161,6 +201,20 @@ func (l *spanReader) Read(p []byte) (n int, err error) {
 // readHeader parses a packet header and returns an io.Reader which will return
 // the contents of the packet. See RFC 4880, section 4.2.
 func readHeader(r io.Reader) (tag packetType, length int64, contents io.Reader, err error) {
+	tag, length, contents, _, err = readPacketHeader(r, nil)
+	return
+}
+
+// readHeaderBytes is like readHeader, but also returns the header as it was
+// read.
+func readHeaderBytes(r io.Reader) (tag packetType, length int64, contents io.Reader, header []byte, err error) {
+	return readPacketHeader(r, func(packetType) bool { return true })
+}
+
+// readPacketHeader is like readHeader, but also returns the header as it was
+// read if record, when non-nil, returns true for the tag of the packet, for
+// packets that are written back exactly as they came.
+func readPacketHeader(r io.Reader, record func(packetType) bool) (tag packetType, length int64, contents io.Reader, header []byte, err error) {
 	var buf [4]byte
 	_, err = io.ReadFull(r, buf[:1])
 	if err != nil {
@@ -170,9 +224,22 @@ func readHeader(r io.Reader) (tag packetType, length int64, contents io.Reader,
 		err = errors.StructuralError("tag byte does not have MSB set")
 		return
 	}
-	if buf[0]&0x40 == 0 {
-		// Old format packet
+	oldFormat := buf[0]&0x40 == 0
+	if oldFormat {
 		tag = packetType((buf[0] & 0x3f) >> 2)
+	} else {
+		tag = packetType(buf[0] & 0x3f)
+	}
+
+	// The length, which follows, is read through hr.
+	hr := r
+	if record != nil && record(tag) {
+		rec := &recordingReader{r: r, recorded: []byte{buf[0]}}
+		defer func() { header = rec.recorded }()
+		hr = rec
+	}
+
+	if oldFormat {
 		lengthType := buf[0] & 3
 		if lengthType == 3 {
 			length = -1
@@ -180,7 +247,7 @@ func readHeader(r io.Reader) (tag packetType, length int64, contents io.Reader,
 			return
 		}
 		lengthBytes := 1 << lengthType
-		_, err = readFull(r, buf[0:lengthBytes])
+		_, err = readFull(hr, buf[0:lengthBytes])
 		if err != nil {
 			return
 		}
@@ -193,8 +260,7 @@ func readHeader(r io.Reader) (tag packetType, length int64, contents io.Reader,
 	}
 
 	// New format packet
-	tag = packetType(buf[0] & 0x3f)
-	length, isPartial, err := readLength(r)
+	length, isPartial, err := readLength(hr)
 	if err != nil {
 		return
 	}
@@ -211,45 +277,70 @@ func readHeader(r io.Reader) (tag packetType, length int64, contents io.Reader,
 	return
 }
 
+// recordingReader keeps a copy of everything read through it.
+type recordingReader struct {
+	r        io.Reader
+	recorded []byte
+}
+
+func (rr *recordingReader) Read(p []byte) (n int, err error) {
+	n, err = rr.r.Read(p)
+	rr.recorded = append(rr.recorded, p[:n]...)
+	return
+}
+
 // serializeHeader writes an OpenPGP packet header to w. See RFC 4880, section
 // 4.2.
 func serializeHeader(w io.Writer, ptype packetType, length int) (err error) {
 	var buf [6]byte
-	var n int
-
 	buf[0] = 0x80 | 0x40 | byte(ptype)
-	if length < 192 {
-		buf[1] = byte(length)
-		n = 2
-	} else if length < 8384 {
-		length -= 192
-		buf[1] = 192 + byte(length>>8)
-		buf[2] = byte(length)
-		n = 3
-	} else {
-		buf[1] = 255
-		buf[2] = byte(length >> 24)
-		buf[3] = byte(length >> 16)
-		buf[4] = byte(length >> 8)
-		buf[5] = byte(length)
-		n = 6
-	}
+	n := 1 + putLength(buf[1:], length)
+	_, err = w.Write(buf[:n])
+	return
+}
 
+// serializeLength writes a new format packet length to w. See RFC 4880,
+// section 4.2.2.
+func serializeLength(w io.Writer, length int) (err error) {
+	var buf [5]byte
+	n := putLength(buf[:], length)
 	_, err = w.Write(buf[:n])
 	return
 }
 
+// putLength encodes a new format packet length into buf, which must be at
+// least five bytes long, and returns the number of bytes used.
+func putLength(buf []byte, length int) int {
+	if length < 192 {
+		buf[0] = byte(length)
+		return 1
+	} else if length < 8384 {
+		length -= 192
+		buf[0] = 192 + byte(length>>8)
+		buf[1] = byte(length)
+		return 2
+	}
+	buf[0] = 255
+	buf[1] = byte(length >> 24)
+	buf[2] = byte(length >> 16)
+	buf[3] = byte(length >> 8)
+	buf[4] = byte(length)
+	return 5
+}
+
 // serializeStreamHeader writes an OpenPGP packet header to w where the
 // length of the packet is unknown. It returns a io.WriteCloser which can be
 // used to write the contents of the packet. See RFC 4880, section 4.2.
-func serializeStreamHeader(w io.WriteCloser, ptype packetType) (out io.WriteCloser, err error) {
+// If config.ForceDefiniteLength is set, the contents are buffered until the
+// WriteCloser is closed and written with a definite length.
+func serializeStreamHeader(w io.WriteCloser, ptype packetType, config *Config) (out io.WriteCloser, err error) {
 	var buf [1]byte
 	buf[0] = 0x80 | 0x40 | byte(ptype)
 	_, err = w.Write(buf[:])
 	if err != nil {
 		return
 	}
-	out = &partialLengthWriter{w: w}
+	out = &partialLengthWriter{w: w, definite: config.forceDefiniteLength()}
 	return
 }
 
@@ -295,10 +386,12 @@ const (
 	packetTypeCompressed                packetType = 8
 	packetTypeSymmetricallyEncrypted    packetType = 9
 	packetTypeLiteralData               packetType = 11
+	packetTypeTrust                     packetType = 12
 	packetTypeUserId                    packetType = 13
 	packetTypePublicSubkey              packetType = 14
 	packetTypeUserAttribute             packetType = 17
 	packetTypeSymmetricallyEncryptedMDC packetType = 18
+	packetTypeAEADEncrypted             packetType = 20
 )
 
 // peekVersion detects the version of a public key packet about to
@@ -317,7 +410,10 @@ func peekVersion(r io.Reader) (bufr *bufio.Reader, ver byte, err error) {
 // Read reads a single OpenPGP packet from the given io.Reader. If there is an
 // error parsing a packet, the whole packet is consumed from the input.
 func Read(r io.Reader) (p Packet, err error) {
-	tag, _, contents, err := readHeader(r)
+	// Only the headers of signatures are kept, for V3 signatures.
+	tag, _, contents, header, err := readPacketHeader(r, func(tag packetType) bool {
+		return tag == packetTypeSignature
+	})
 	if err != nil {
 		return
 	}
@@ -332,7 +428,7 @@ func Read(r io.Reader) (p Packet, err error) {
 			return
 		}
 		if version < 4 {
-			p = new(SignatureV3)
+			p = &SignatureV3{header: header}
 		} else {
 			p = new(Signature)
 		}
@@ -371,6 +467,8 @@ func Read(r io.Reader) (p Packet, err error) {
 		se := new(SymmetricallyEncrypted)
 		se.MDC = true
 		p = se
+	case packetTypeAEADEncrypted:
+		p = new(AEADEncrypted)
 	default:
 		err = errors.UnknownPacketTypeError(tag)
 	}
@@ -383,6 +481,37 @@ func Read(r io.Reader) (p Packet, err error) {
 	return
 }
 
+// ReadAt reads a single packet that starts at offset in r, for random access
+// into a stream of packets, and returns it along with the offset of the
+// packet that follows. The next offset is also returned when the packet
+// itself can't be parsed, such as one of an unknown type, so that it can be
+// skipped. The bodies of streamed packets, such as literal data, are read
+// from r as they are consumed.
+func ReadAt(r io.ReaderAt, offset int64) (p Packet, next int64, err error) {
+	if offset < 0 {
+		return nil, 0, errors.InvalidArgumentError("negative offset")
+	}
+	section := io.NewSectionReader(r, offset, math.MaxInt64-offset)
+	_, length, contents, header, err := readHeaderBytes(section)
+	if err != nil {
+		return nil, 0, err
+	}
+	if length >= 0 {
+		next = offset + int64(len(header)) + length
+	} else {
+		// The length of a packet with partial or indeterminate lengths
+		// is only known once its body has been read.
+		if _, err = consumeAll(contents); err != nil {
+			return nil, 0, err
+		}
+		pos, _ := section.Seek(0, io.SeekCurrent)
+		next = offset + pos
+	}
+
+	p, err = Read(io.NewSectionReader(r, offset, next-offset))
+	return p, next, err
+}
+
 // SignatureType represents the different semantic meanings of an OpenPGP
 // signature. See RFC 4880, section 5.2.1.
 type SignatureType uint8
@@ -394,6 +523,7 @@ const (
 	SigTypePersonaCert                      = 0x11
 	SigTypeCasualCert                       = 0x12
 	SigTypePositiveCert                     = 0x13
+	SigTypeAttestation                      = 0x16
 	SigTypeSubkeyBinding                    = 0x18
 	SigTypePrimaryKeyBinding                = 0x19
 	SigTypeDirectSignature                  = 0x1F
@@ -564,6 +694,17 @@ func padToKeySize(pub *rsa.PublicKey, b []byte) []byte {
 	return bb
 }
 
+// AEADMode represents the different Authenticated Encryption with Associated
+// Data modes specified for OpenPGP. See draft-ietf-openpgp-rfc4880bis,
+// section 9.6.
+type AEADMode uint8
+
+const (
+	AEADModeEAX AEADMode = 1
+	AEADModeOCB AEADMode = 2
+	AEADModeGCM AEADMode = 3
+)
+
 // CompressionAlgo Represents the different compression algorithms
 // supported by OpenPGP (except for BZIP2, which is not currently
 // supported). See Section 9.3 of RFC 4880.
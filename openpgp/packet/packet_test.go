@@ -191,6 +191,55 @@ func TestReadHeader(t *testing.T) {
 	}
 }
 
+func TestReadAt(t *testing.T) {
+	keyring, _ := hex.DecodeString(ecc384PubHex)
+	r := bytes.NewReader(keyring)
+
+	// Walk the keyring to find where its second packet starts.
+	_, second, err := ReadAt(r, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, next, err := ReadAt(r, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, ok := p.(*UserId)
+	if !ok {
+		t.Fatalf("got %T at offset %d, want *UserId", p, second)
+	}
+	if uid.Id != "ec_dsa_dh_384 <openpgp@brainhub.org>" {
+		t.Errorf("got user id %q", uid.Id)
+	}
+	if next <= second || next >= int64(len(keyring)) {
+		t.Errorf("got next offset %d after a packet at %d", next, second)
+	}
+
+	var offset int64
+	for offset < int64(len(keyring)) {
+		if _, offset, err = ReadAt(r, offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if offset != int64(len(keyring)) {
+		t.Errorf("walked to offset %d, want %d", offset, len(keyring))
+	}
+	if _, _, err := ReadAt(r, offset); err != io.EOF {
+		t.Errorf("got %v at the end of the keyring, want io.EOF", err)
+	}
+
+	// The length of an old format packet of indeterminate length runs
+	// to the end of the data.
+	compressed, _ := hex.DecodeString(compressedHex)
+	p, next, err = ReadAt(bytes.NewReader(compressed), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*Compressed); !ok || next != int64(len(compressed)) {
+		t.Errorf("got %T ending at %d, want *Compressed ending at %d", p, next, len(compressed))
+	}
+}
+
 func TestSerializeHeader(t *testing.T) {
 	tag := packetTypePublicKey
 	lengths := []int{0, 1, 2, 64, 192, 193, 8000, 8384, 8385, 10000}
@@ -254,3 +303,101 @@ func TestPartialLengths(t *testing.T) {
 		}
 	}
 }
+
+func TestPartialLengthsFirstChunk(t *testing.T) {
+	for _, length := range []int{0, 10, 511, 512, 513, 4000} {
+		buf := bytes.NewBuffer(nil)
+		w, err := serializeStreamHeader(noOpCloser{buf}, packetTypeLiteralData, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Write a byte at a time so nothing but the writer decides
+		// how the stream is split.
+		for i := 0; i < length; i++ {
+			w.Write([]byte{byte(i)})
+		}
+		w.Close()
+
+		if length >= minFirstPartialLength && buf.Bytes()[1] != 224+9 {
+			t.Errorf("length %d: first partial length byte is %d, want %d", length, buf.Bytes()[1], 224+9)
+		}
+		tag, _, contents, err := readHeader(buf)
+		if err != nil {
+			t.Fatalf("length %d: %s", length, err)
+		}
+		if tag != packetTypeLiteralData {
+			t.Errorf("length %d: got tag %d", length, tag)
+		}
+		data, err := ioutil.ReadAll(contents)
+		if err != nil {
+			t.Fatalf("length %d: %s", length, err)
+		}
+		if len(data) != length {
+			t.Errorf("length %d: read back %d bytes", length, len(data))
+		}
+	}
+}
+
+func TestForceDefiniteLength(t *testing.T) {
+	config := &Config{ForceDefiniteLength: true}
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	buf := new(bytes.Buffer)
+	compressed, err := SerializeCompressedWithConfig(noOpCloser{buf}, CompressionZLIB, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal, err := SerializeLiteralWithConfig(compressed, true, "", 0, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal.Write(data)
+	if err := literal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A first length octet from 224 to 254 is a partial length.
+	isPartial := func(header []byte) bool {
+		return header[1] >= 224 && header[1] < 255
+	}
+	if isPartial(buf.Bytes()) {
+		t.Error("compressed packet has a partial length")
+	}
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := ioutil.ReadAll(p.(*Compressed).Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isPartial(inner) {
+		t.Error("literal data packet has a partial length")
+	}
+	p, err = Read(bytes.NewReader(inner))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(p.(*LiteralData).Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, data) {
+		t.Error("literal data didn't survive the round trip")
+	}
+
+	// Without the flag, the same data is streamed.
+	buf.Reset()
+	literal, err = SerializeLiteralWithConfig(noOpCloser{buf}, true, "", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal.Write(data)
+	literal.Close()
+	if !isPartial(buf.Bytes()) {
+		t.Error("streamed literal data packet doesn't have a partial length")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/cipher"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/sha1"
 	"fmt"
 	"io"
@@ -232,6 +233,85 @@ func (pk *PrivateKey) Encrypt(passphrase []byte, config *Config) (err error) {
 	return nil
 }
 
+// IsDecrypted reports whether pk holds usable private key material, that is,
+// it was never encrypted or has been decrypted and not locked since.
+func (pk *PrivateKey) IsDecrypted() bool {
+	return !pk.Encrypted && pk.PrivateKey != nil
+}
+
+// Lock is the inverse of Decrypt: it encrypts the private key with
+// passphrase, as Encrypt does, and then drops the decrypted key material so
+// that pk cannot be used for signing or decryption until Decrypt is called
+// again. The dropped material is left to the garbage collector and is not
+// wiped from memory.
+func (pk *PrivateKey) Lock(passphrase []byte, config *Config) error {
+	if err := pk.Encrypt(passphrase, config); err != nil {
+		return err
+	}
+	pk.PrivateKey = nil
+	return nil
+}
+
+// Validate checks that the secret key material of pk belongs to its public
+// key, to catch corrupted keys before they are used. It returns
+// errors.ErrPrivateKeyMismatch if it doesn't. pk must be decrypted.
+func (pk *PrivateKey) Validate() error {
+	if !pk.IsDecrypted() {
+		return errors.InvalidArgumentError("cannot validate an encrypted private key")
+	}
+
+	var ok bool
+	switch priv := pk.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		pub := pk.PublicKey.PublicKey.(*rsa.PublicKey)
+		ok = priv.N.Cmp(pub.N) == 0 && priv.E == pub.E && priv.Validate() == nil
+	case *dsa.PrivateKey:
+		pub := pk.PublicKey.PublicKey.(*dsa.PublicKey)
+		ok = priv.X.Sign() > 0 && priv.X.Cmp(pub.Q) < 0 &&
+			new(big.Int).Exp(pub.G, priv.X, pub.P).Cmp(pub.Y) == 0
+	case *elgamal.PrivateKey:
+		pub := pk.PublicKey.PublicKey.(*elgamal.PublicKey)
+		ok = priv.X.Sign() > 0 && priv.X.Cmp(pub.P) < 0 &&
+			new(big.Int).Exp(pub.G, priv.X, pub.P).Cmp(pub.Y) == 0
+	case *ecdsa.PrivateKey:
+		pub := pk.PublicKey.PublicKey.(*ecdsa.PublicKey)
+		if scalar, fits := curveScalar(pub.Curve, priv.D); fits {
+			x, y := pub.Curve.ScalarBaseMult(scalar)
+			ok = x.Cmp(pub.X) == 0 && y.Cmp(pub.Y) == 0
+		}
+	case *ecdh.PrivateKey:
+		pub := pk.PublicKey.PublicKey.(*ecdh.PublicKey)
+		if scalar, fits := curveScalar(pub.Curve, priv.X); fits {
+			x, y := pub.Curve.ScalarBaseMult(scalar)
+			got, _ := ecdh.Marshal(pub.Curve, x, y)
+			want, _ := ecdh.Marshal(pub.Curve, pub.X, pub.Y)
+			ok = bytes.Equal(got, want)
+		}
+	case *EdDSAPrivateKey:
+		pub, _, err := ed25519.GenerateKey(bytes.NewReader(priv.seed.bytes))
+		ok = err == nil && bytes.Equal(pub, pk.PublicKey.edk.p.bytes[1:])
+	default:
+		return errors.UnsupportedError("cannot validate this private key type")
+	}
+
+	if !ok {
+		return errors.ErrPrivateKeyMismatch
+	}
+	return nil
+}
+
+// curveScalar returns the big-endian bytes of k, padded to the size of the
+// order of curve, and whether k fits in them.
+func curveScalar(curve elliptic.Curve, k *big.Int) ([]byte, bool) {
+	size := (curve.Params().N.BitLen() + 7) / 8
+	if k.Sign() <= 0 || k.BitLen() > 8*size {
+		return nil, false
+	}
+	scalar := make([]byte, size)
+	k.FillBytes(scalar)
+	return scalar, true
+}
+
 func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 	buf := bytes.NewBuffer(nil)
 	err = pk.PublicKey.serializeWithoutHeaders(buf)
@@ -6,8 +6,21 @@ package packet
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
 	"testing"
 	"time"
+
+	"github.com/keybase/go-crypto/curve25519"
+	"github.com/keybase/go-crypto/ed25519"
+	"github.com/keybase/go-crypto/openpgp/ecdh"
+	"github.com/keybase/go-crypto/openpgp/elgamal"
+	"github.com/keybase/go-crypto/openpgp/errors"
+	"github.com/keybase/go-crypto/rsa"
 )
 
 var privateKeyTests = []struct {
@@ -113,6 +126,62 @@ func TestPrivateKeyEncrypt(t *testing.T) {
 	}
 }
 
+func TestPrivateKeyLock(t *testing.T) {
+	p, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := p.(*PrivateKey)
+	if privKey.IsDecrypted() {
+		t.Fatal("freshly read key should not be decrypted")
+	}
+
+	sign := func() error {
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   PubKeyAlgoRSA,
+			Hash:         crypto.SHA256,
+			CreationTime: time.Now(),
+		}
+		h := crypto.SHA256.New()
+		h.Write(message)
+		return sig.Sign(h, privKey, nil)
+	}
+
+	if err := privKey.Decrypt(oldPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if !privKey.IsDecrypted() {
+		t.Error("key should be decrypted after Decrypt")
+	}
+	if err := sign(); err != nil {
+		t.Fatalf("failed to sign with decrypted key: %s", err)
+	}
+
+	if err := privKey.Lock(newPassphrase, nil); err != nil {
+		t.Fatal(err)
+	}
+	if privKey.IsDecrypted() {
+		t.Error("key should not be decrypted after Lock")
+	}
+	if err := sign(); err == nil {
+		t.Error("signing with a locked key should fail")
+	}
+
+	if err := privKey.Decrypt(oldPassphrase); err == nil {
+		t.Error("locked key decrypted with the old passphrase")
+	}
+	if err := privKey.Decrypt(newPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if !privKey.IsDecrypted() {
+		t.Error("key should be decrypted after Decrypt")
+	}
+	if err := sign(); err != nil {
+		t.Errorf("failed to sign after unlocking: %s", err)
+	}
+}
+
 func TestPrivateKeyReadAndSerailze(t *testing.T) {
 	for i, test := range privateKeyTests {
 		packet, err := Read(readerFromHex(test.privateKeyHex))
@@ -172,6 +241,107 @@ func TestPrivateKeyEncryptThenDecrypt(t *testing.T) {
 	}
 }
 
+func TestPrivateKeyValidate(t *testing.T) {
+	p, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := p.(*PrivateKey)
+	if err := rsaKey.Validate(); err == nil {
+		t.Error("validated an encrypted private key")
+	}
+	if err := rsaKey.Decrypt(oldPassphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = Read(readerFromHex(privKeyElGamalHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elGamalKey := p.(*PrivateKey)
+	if err := elGamalKey.Decrypt(oldPassphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	dsaKey := newDSATestKey(t, dsa.L1024N160)
+	dsaPriv := dsaKey.PrivateKey.(*dsa.PrivateKey)
+	ecdsaPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdhPriv, err := ecdh.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cv25519Priv, err := ecdh.GenerateKey(curve25519.Cv25519(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eddsaKey := newEdDSAPrivateKeyForTest(t)
+
+	// Adding 8 to a scalar changes the key even on Curve25519, which
+	// clears the low three bits of the secret.
+	eight := big.NewInt(8)
+	for _, test := range []struct {
+		name   string
+		key    *PrivateKey
+		tamper func()
+	}{
+		{"RSA", rsaKey, func() {
+			priv := rsaKey.PrivateKey.(*rsa.PrivateKey)
+			priv.D.Add(priv.D, eight)
+		}},
+		{"ElGamal", elGamalKey, func() {
+			priv := elGamalKey.PrivateKey.(*elgamal.PrivateKey)
+			priv.X.Add(priv.X, eight)
+		}},
+		{"DSA", dsaKey, func() { dsaPriv.X.Add(dsaPriv.X, eight) }},
+		{"ECDSA", NewECDSAPrivateKey(time.Now(), ecdsaPriv), func() { ecdsaPriv.D.Add(ecdsaPriv.D, eight) }},
+		{"ECDH", NewECDHPrivateKey(time.Now(), ecdhPriv), func() { ecdhPriv.X.Add(ecdhPriv.X, eight) }},
+		{"Curve25519", NewECDHPrivateKey(time.Now(), cv25519Priv), func() { cv25519Priv.X.Add(cv25519Priv.X, eight) }},
+		{"EdDSA", eddsaKey, func() { eddsaKey.PrivateKey.(*EdDSAPrivateKey).seed.bytes[0] ^= 1 }},
+	} {
+		if err := test.key.Validate(); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+		test.tamper()
+		if err := test.key.Validate(); err != errors.ErrPrivateKeyMismatch {
+			t.Errorf("%s: got %v for a tampered key, want ErrPrivateKeyMismatch", test.name, err)
+		}
+	}
+}
+
+// newEdDSAPrivateKeyForTest returns an unencrypted Ed25519 private key,
+// parsed from a packet since there is no constructor for one.
+func newEdDSAPrivateKeyForTest(t *testing.T) *PrivateKey {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := priv[:32]
+	seed[0] |= 0x80 // so that the MPI is exactly 32 bytes
+	pub, _, _ = ed25519.GenerateKey(bytes.NewReader(seed))
+
+	body := []byte{4, 0x5a, 0, 0, 0, byte(PubKeyAlgoEdDSA)}
+	body = append(body, 9, 0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01)
+	body = append(body, 0x01, 0x07, 0x40)
+	body = append(body, pub...)
+	body = append(body, 0)
+	secret := append([]byte{0x01, 0x00}, seed...)
+	var checksum uint16
+	for _, b := range secret {
+		checksum += uint16(b)
+	}
+	body = append(body, secret...)
+	body = append(body, byte(checksum>>8), byte(checksum))
+
+	p, err := Read(bytes.NewReader(append([]byte{0xc5, byte(len(body))}, body...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*PrivateKey)
+}
+
 func TestIssue11505(t *testing.T) {
 	// parsing a rsa private key with p or q == 1 used to panic due to a divide by zero
 	_, _ = Read(readerFromHex("9c3004303030300100000011303030000000000000010130303030303030303030303030303030303030303030303030303030303030303030303030303030303030"))
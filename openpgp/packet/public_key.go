@@ -664,6 +664,13 @@ func (pk *PublicKey) CanSign() bool {
 // VerifySignature returns nil iff sig is a valid signature, made by this
 // public key, of the data hashed into signed. signed is mutated by this call.
 func (pk *PublicKey) VerifySignature(signed hash.Hash, sig *Signature) (err error) {
+	return pk.verifySignature(signed, sig, nil)
+}
+
+// verifySignature is like VerifySignature, but skips the public key
+// operation if cache has already seen sig succeed, and records it if it
+// succeeds now. cache may be nil.
+func (pk *PublicKey) verifySignature(signed hash.Hash, sig *Signature, cache VerificationCache) (err error) {
 	if !pk.CanSign() {
 		return errors.InvalidArgumentError("public key cannot generate signatures")
 	}
@@ -688,20 +695,33 @@ func (pk *PublicKey) VerifySignature(signed hash.Hash, sig *Signature) (err erro
 		return errors.InvalidArgumentError("public key and signature use different algorithms")
 	}
 
+	if cache == nil {
+		return pk.verifySignatureHash(hashBytes, sig)
+	}
+	key := verificationCacheKey(pk, hashBytes, sig)
+	if cache.Get(key) {
+		return nil
+	}
+	if err = pk.verifySignatureHash(hashBytes, sig); err != nil {
+		return err
+	}
+	cache.Set(key)
+	return nil
+}
+
+// verifySignatureHash checks sig against the final hash of the signed data.
+func (pk *PublicKey) verifySignatureHash(hashBytes []byte, sig *Signature) (err error) {
 	switch pk.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
 		rsaPublicKey, _ := pk.PublicKey.(*rsa.PublicKey)
-		err = rsa.VerifyPKCS1v15(rsaPublicKey, sig.Hash, hashBytes, padToKeySize(rsaPublicKey, sig.RSASignature.bytes))
-		if err != nil {
-			return errors.SignatureError("RSA verification failure")
-		}
-		return nil
+		return verifyRSASignature(rsaPublicKey, sig.rsaPadding, sig.Hash, hashBytes, padToKeySize(rsaPublicKey, sig.RSASignature.bytes))
 	case PubKeyAlgoDSA:
+		// r and s are converted with SetBytes, which ignores leading
+		// zero bytes, so MPIs that aren't minimally encoded still
+		// verify.
 		dsaPublicKey, _ := pk.PublicKey.(*dsa.PublicKey)
-		// Need to truncate hashBytes to match FIPS 186-3 section 4.6.
-		subgroupSize := (dsaPublicKey.Q.BitLen() + 7) / 8
-		if len(hashBytes) > subgroupSize {
-			hashBytes = hashBytes[:subgroupSize]
+		if hashBytes, err = dsaTruncateHash(dsaPublicKey, hashBytes); err != nil {
+			return err
 		}
 		if !dsa.Verify(dsaPublicKey, hashBytes, new(big.Int).SetBytes(sig.DSASigR.bytes), new(big.Int).SetBytes(sig.DSASigS.bytes)) {
 			return errors.SignatureError("DSA verification failure")
@@ -724,6 +744,30 @@ func (pk *PublicKey) VerifySignature(signed hash.Hash, sig *Signature) (err erro
 	panic("unreachable")
 }
 
+// rsaPadding identifies the padding scheme of an RSA signature. OpenPGP
+// only defines PKCS #1 v1.5; a scheme that a future format adds, such as
+// PSS, gets its own value and case in verifyRSASignature.
+type rsaPadding uint8
+
+const (
+	rsaPaddingPKCS1v15 rsaPadding = iota
+)
+
+// verifyRSASignature checks the RSA signature sig of hashBytes using the
+// given padding scheme.
+func verifyRSASignature(pub *rsa.PublicKey, padding rsaPadding, hash crypto.Hash, hashBytes, sig []byte) (err error) {
+	switch padding {
+	case rsaPaddingPKCS1v15:
+		err = rsa.VerifyPKCS1v15(pub, hash, hashBytes, sig)
+	default:
+		return errors.UnsupportedError("RSA padding scheme " + strconv.Itoa(int(padding)))
+	}
+	if err != nil {
+		return errors.SignatureError("RSA verification failure")
+	}
+	return nil
+}
+
 // VerifySignatureV3 returns nil iff sig is a valid signature, made by this
 // public key, of the data hashed into signed. signed is mutated by this call.
 func (pk *PublicKey) VerifySignatureV3(signed hash.Hash, sig *SignatureV3) (err error) {
@@ -754,10 +798,8 @@ func (pk *PublicKey) VerifySignatureV3(signed hash.Hash, sig *SignatureV3) (err
 		return
 	case PubKeyAlgoDSA:
 		dsaPublicKey := pk.PublicKey.(*dsa.PublicKey)
-		// Need to truncate hashBytes to match FIPS 186-3 section 4.6.
-		subgroupSize := (dsaPublicKey.Q.BitLen() + 7) / 8
-		if len(hashBytes) > subgroupSize {
-			hashBytes = hashBytes[:subgroupSize]
+		if hashBytes, err = dsaTruncateHash(dsaPublicKey, hashBytes); err != nil {
+			return err
 		}
 		if !dsa.Verify(dsaPublicKey, hashBytes, new(big.Int).SetBytes(sig.DSASigR.bytes), new(big.Int).SetBytes(sig.DSASigS.bytes)) {
 			return errors.SignatureError("DSA verification failure")
@@ -769,6 +811,19 @@ func (pk *PublicKey) VerifySignatureV3(signed hash.Hash, sig *SignatureV3) (err
 	panic("unreachable")
 }
 
+// dsaTruncateHash truncates hashBytes to the size of the subgroup of pub,
+// as required by FIPS 186-3 section 4.6. DSA2 keys with a 224 or 256 bit q
+// need a hash at least as long as q, so a shorter hash (e.g. SHA-1 with a
+// 256 bit q) is rejected rather than silently used.
+func dsaTruncateHash(pub *dsa.PublicKey, hashBytes []byte) ([]byte, error) {
+	subgroupSize := (pub.Q.BitLen() + 7) / 8
+	if len(hashBytes) < subgroupSize {
+		return nil, errors.SignatureError("DSA hash of " + strconv.Itoa(8*len(hashBytes)) +
+			" bits is too short for " + strconv.Itoa(pub.Q.BitLen()) + " bit subgroup")
+	}
+	return hashBytes[:subgroupSize], nil
+}
+
 // keySignatureHash returns a Hash of the message that needs to be signed for
 // pk to assert a subkey relationship to signed.
 func keySignatureHash(pk, signed signingKey, hashFunc crypto.Hash) (h hash.Hash, err error) {
@@ -794,11 +849,18 @@ func updateKeySignatureHash(pk, signed signingKey, h hash.Hash) {
 // VerifyKeySignature returns nil iff sig is a valid signature, made by this
 // public key, of signed.
 func (pk *PublicKey) VerifyKeySignature(signed *PublicKey, sig *Signature) error {
+	return pk.VerifyKeySignatureWithConfig(signed, sig, nil)
+}
+
+// VerifyKeySignatureWithConfig is like VerifyKeySignature, but consults and
+// populates config's VerificationCache, if any.
+func (pk *PublicKey) VerifyKeySignatureWithConfig(signed *PublicKey, sig *Signature, config *Config) error {
+	cache := config.verificationCache()
 	h, err := keySignatureHash(pk, signed, sig.Hash)
 	if err != nil {
 		return err
 	}
-	if err = pk.VerifySignature(h, sig); err != nil {
+	if err = pk.verifySignature(h, sig, cache); err != nil {
 		return err
 	}
 
@@ -827,7 +889,7 @@ func (pk *PublicKey) VerifyKeySignature(signed *PublicKey, sig *Signature) error
 		if h, err = keySignatureHash(pk, signed, sig.EmbeddedSignature.Hash); err != nil {
 			return errors.StructuralError("error while hashing for cross-signature: " + err.Error())
 		}
-		if err := signed.VerifySignature(h, sig.EmbeddedSignature); err != nil {
+		if err := signed.verifySignature(h, sig.EmbeddedSignature, cache); err != nil {
 			return errors.StructuralError("error while verifying cross-signature: " + err.Error())
 		}
 	}
@@ -906,11 +968,17 @@ func updateUserIdSignatureHash(id string, pk *PublicKey, h hash.Hash) {
 // VerifyUserIdSignature returns nil iff sig is a valid signature, made by this
 // public key, that id is the identity of pub.
 func (pk *PublicKey) VerifyUserIdSignature(id string, pub *PublicKey, sig *Signature) (err error) {
+	return pk.VerifyUserIdSignatureWithConfig(id, pub, sig, nil)
+}
+
+// VerifyUserIdSignatureWithConfig is like VerifyUserIdSignature, but
+// consults and populates config's VerificationCache, if any.
+func (pk *PublicKey) VerifyUserIdSignatureWithConfig(id string, pub *PublicKey, sig *Signature, config *Config) (err error) {
 	h, err := userIdSignatureHash(id, pub, sig.Hash)
 	if err != nil {
 		return err
 	}
-	return pk.VerifySignature(h, sig)
+	return pk.verifySignature(h, sig, config.verificationCache())
 }
 
 // VerifyUserIdSignatureV3 returns nil iff sig is a valid signature, made by this
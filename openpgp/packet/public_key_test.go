@@ -9,11 +9,13 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/hex"
 	"math/big"
 	"testing"
 	"time"
 
+	"github.com/keybase/go-crypto/openpgp/errors"
 	"github.com/keybase/go-crypto/rsa"
 )
 
@@ -254,3 +256,42 @@ const ecdsaPkDataHex = "9893045071c29413052b8104002304230401f4867769cedfa52c3250
 
 // Source: https://sites.google.com/site/brainhub/pgpecckeys#TOC-ECC-NIST-P-384-key
 const ecc384PubHex = `99006f044d53059213052b81040022030304f6b8c5aced5b84ef9f4a209db2e4a9dfb70d28cb8c10ecd57674a9fa5a67389942b62d5e51367df4c7bfd3f8e500feecf07ed265a621a8ebbbe53e947ec78c677eba143bd1533c2b350e1c29f82313e1e1108eba063be1e64b10e6950e799c2db42465635f6473615f64685f333834203c6f70656e70677040627261696e6875622e6f72673e8900cb04101309005305024d530592301480000000002000077072656665727265642d656d61696c2d656e636f64696e67407067702e636f6d7067706d696d65040b090807021901051b03000000021602051e010000000415090a08000a0910098033880f54719fca2b0180aa37350968bd5f115afd8ce7bc7b103822152dbff06d0afcda835329510905b98cb469ba208faab87c7412b799e7b633017f58364ea480e8a1a3f253a0c5f22c446e8be9a9fce6210136ee30811abbd49139de28b5bdf8dc36d06ae748579e9ff503b90073044d53059212052b810400220303042faa84024a20b6735c4897efa5bfb41bf85b7eefeab5ca0cb9ffc8ea04a46acb25534a577694f9e25340a4ab5223a9dd1eda530c8aa2e6718db10d7e672558c7736fe09369ea5739a2a3554bf16d41faa50562f11c6d39bbd5dffb6b9a9ec9180301090989008404181309000c05024d530592051b0c000000000a0910098033880f54719f80970180eee7a6d8fcee41ee4f9289df17f9bcf9d955dca25c583b94336f3a2b2d4986dc5cf417b8d2dc86f741a9e1a6d236c0e3017d1c76575458a0cfb93ae8a2b274fcc65ceecd7a91eec83656ba13219969f06945b48c56bd04152c3a0553c5f2f4bd1267`
+
+func TestVerifyRSASignaturePadding(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := NewRSAPrivateKey(time.Now(), rsaPriv)
+
+	// Signatures made by this package use PKCS #1 v1.5 and must keep
+	// verifying through that path.
+	sig := &Signature{
+		SigType:      SigTypeBinary,
+		PubKeyAlgo:   PubKeyAlgoRSA,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &priv.KeyId,
+	}
+	h := crypto.SHA256.New()
+	h.Write([]byte("hello"))
+	if err := sig.Sign(h, priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sig.rsaPadding != rsaPaddingPKCS1v15 {
+		t.Errorf("got padding %d, want PKCS #1 v1.5", sig.rsaPadding)
+	}
+	h = crypto.SHA256.New()
+	h.Write([]byte("hello"))
+	if err := priv.VerifySignature(h, sig); err != nil {
+		t.Errorf("PKCS #1 v1.5 signature didn't verify: %s", err)
+	}
+
+	digest := crypto.SHA256.New()
+	digest.Write([]byte("hello"))
+	hashed := digest.Sum(nil)
+	rsaSig := padToKeySize(&rsaPriv.PublicKey, sig.RSASignature.bytes)
+	if _, ok := verifyRSASignature(&rsaPriv.PublicKey, rsaPaddingPKCS1v15+1, crypto.SHA256, hashed, rsaSig).(errors.UnsupportedError); !ok {
+		t.Error("expected UnsupportedError for an unknown padding scheme")
+	}
+}
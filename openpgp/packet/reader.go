@@ -15,6 +15,12 @@ import (
 type Reader struct {
 	q       []Packet
 	readers []io.Reader
+	// maxPackets, if non-zero, is how many packets may be read from
+	// readers. read counts them, including skipped unknown packets but
+	// not trust packets.
+	maxPackets, read int
+	// unknown records the packets of unknown type that Next skipped.
+	unknown []errors.UnknownPacketTypeError
 }
 
 // New io.Readers are pushed when a compressed or encrypted packet is processed
@@ -25,8 +31,14 @@ type Reader struct {
 // This constant limits the number of recursive packets that may be pushed.
 const maxReaders = 32
 
+// maxSkippedUnknown limits how many skipped packets of unknown type a Reader
+// records for SkippedUnknown, so that a stream of them that nobody asks
+// about, such as in a long message, doesn't hold on to memory.
+const maxSkippedUnknown = 64
+
 // Next returns the most recently unread Packet, or reads another packet from
-// the top-most io.Reader. Unknown packet types are skipped.
+// the top-most io.Reader. Unknown packet types are skipped, and recorded for
+// SkippedUnknown unless they are trust packets.
 func (r *Reader) Next() (p Packet, err error) {
 	if len(r.q) > 0 {
 		p = r.q[len(r.q)-1]
@@ -34,22 +46,50 @@ func (r *Reader) Next() (p Packet, err error) {
 		return
 	}
 
+	// Once the limit is exceeded, it stays exceeded.
+	if r.maxPackets > 0 && r.read > r.maxPackets {
+		return nil, errors.StructuralError("too many packets")
+	}
 	for len(r.readers) > 0 {
 		p, err = Read(r.readers[len(r.readers)-1])
-		if err == nil {
-			return
-		}
 		if err == io.EOF {
 			r.readers = r.readers[:len(r.readers)-1]
 			continue
 		}
-		if _, ok := err.(errors.UnknownPacketTypeError); !ok {
+		// Trust packets are local to GnuPG's keyrings, and RFC 4880
+		// says to ignore them, so they neither count towards the
+		// limit nor are worth a warning.
+		if err == errors.UnknownPacketTypeError(packetTypeTrust) {
+			continue
+		}
+		r.read++
+		if r.maxPackets > 0 && r.read > r.maxPackets {
+			return nil, errors.StructuralError("too many packets")
+		}
+		if err == nil {
+			return
+		}
+		unknown, ok := err.(errors.UnknownPacketTypeError)
+		if !ok {
 			return nil, err
 		}
+		if len(r.unknown) < maxSkippedUnknown {
+			r.unknown = append(r.unknown, unknown)
+		}
 	}
 	return nil, io.EOF
 }
 
+// SkippedUnknown returns an UnknownPacketTypeError for each packet of unknown
+// type that Next has skipped since the last call, in order, such as packets
+// defined by newer versions of OpenPGP. Skipped trust packets aren't
+// included, and only the first maxSkippedUnknown packets are.
+func (r *Reader) SkippedUnknown() []errors.UnknownPacketTypeError {
+	unknown := r.unknown
+	r.unknown = nil
+	return unknown
+}
+
 // Push causes the Reader to start reading from a new io.Reader. When an EOF
 // error is seen from the new io.Reader, it is popped and the Reader continues
 // to read from the next most recent io.Reader. Push returns a StructuralError
@@ -74,3 +114,12 @@ func NewReader(r io.Reader) *Reader {
 		readers: []io.Reader{r},
 	}
 }
+
+// NewReaderWithConfig is like NewReader, but the Reader fails with a
+// StructuralError once it has read config.MaxPackets packets.
+// If config is nil, sensible defaults will be used.
+func NewReaderWithConfig(r io.Reader, config *Config) *Reader {
+	reader := NewReader(r)
+	reader.maxPackets = config.maxPackets()
+	return reader
+}
@@ -0,0 +1,34 @@
+package packet
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReaderSkippedUnknownLimit(t *testing.T) {
+	buf := new(bytes.Buffer)
+	unknown := &OpaquePacket{Tag: 60, Contents: []byte("from the future")}
+	for i := 0; i < 2*maxSkippedUnknown; i++ {
+		if err := unknown.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewReader(buf)
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+	skipped := r.SkippedUnknown()
+	if len(skipped) != maxSkippedUnknown {
+		t.Errorf("got %d skipped packets recorded, want %d", len(skipped), maxSkippedUnknown)
+	}
+	for _, err := range skipped {
+		if err != 60 {
+			t.Errorf("recorded unknown packet type %d, want 60", err)
+		}
+	}
+	if skipped := r.SkippedUnknown(); len(skipped) != 0 {
+		t.Errorf("got %d skipped packets after they were returned", len(skipped))
+	}
+}
@@ -9,10 +9,12 @@ import (
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"encoding/asn1"
 	"encoding/binary"
 	"fmt"
 	"hash"
 	"io"
+	"math/big"
 	"strconv"
 	"time"
 
@@ -37,6 +39,16 @@ type Signer interface {
 	PublicKeyAlgo() PublicKeyAlgorithm
 }
 
+// ExternalSigner performs the raw private key operation of a signature on
+// behalf of a key whose private half is held elsewhere, such as in a
+// hardware token. It has the same method set as crypto.Signer: RSA signers
+// must return a PKCS #1 v1.5 signature, ECDSA signers an ASN.1 encoded
+// (r, s) pair and EdDSA signers the 64 byte concatenation of R and S.
+type ExternalSigner interface {
+	Public() crypto.PublicKey
+	Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
 // RevocationKey represents designated revoker packet. See RFC 4880
 // section 5.2.3.15 for details.
 type RevocationKey struct {
@@ -62,7 +74,10 @@ type Signature struct {
 	HashSuffix []byte
 	// HashTag contains the first two bytes of the hash for fast rejection
 	// of bad signed data.
-	HashTag      [2]byte
+	HashTag [2]byte
+	// CreationTime is when the signature was made, from its hashed
+	// signature creation time subpacket, so it is covered by the
+	// signature and can be trusted once the signature verifies.
 	CreationTime time.Time
 
 	RSASignature         parsedMPI
@@ -73,16 +88,35 @@ type Signature struct {
 	// rawSubpackets contains the unparsed subpackets, in order.
 	rawSubpackets []outputSubpacket
 
+	// rsaPadding is the padding scheme of RSASignature. Every RSA
+	// signature that can currently be parsed uses PKCS #1 v1.5.
+	rsaPadding rsaPadding
+
 	// The following are optional so are nil when not included in the
 	// signature.
 
 	SigLifetimeSecs, KeyLifetimeSecs                        *uint32
 	PreferredSymmetric, PreferredHash, PreferredCompression []uint8
+	PreferredAEAD                                           []AEADMode
 	PreferredKeyServer                                      string
 	IssuerKeyId                                             *uint64
 	IsPrimaryId                                             *bool
 	IssuerFingerprint                                       []byte
 
+	// Exportable is false for a local certification, which must not be
+	// exported with the key. A nil Exportable means the signature is
+	// exportable. See RFC 4880, section 5.2.3.11.
+	Exportable *bool
+
+	// SignerUserId names the user id of the signer that the signature
+	// was made on behalf of. See RFC 4880, section 5.2.3.22.
+	SignerUserId *string
+
+	// AttestedCertifications holds the digests of the third-party
+	// certifications that an attestation signature approves. See
+	// draft-ietf-openpgp-rfc4880bis, section 5.2.3.30.
+	AttestedCertifications [][]byte
+
 	// FlagsValid is set if any flags were given. See RFC 4880, section
 	// 5.2.3.21 for details.
 	FlagsValid                                                           bool
@@ -99,10 +133,22 @@ type Signature struct {
 	// Regex is a regex that can match a PGP UID. See RFC 4880, 5.2.3.14 for details
 	Regex string
 
+	// TrustLevel and TrustAmount are set by a trust signature subpacket,
+	// which makes a certification also delegate trust to the certified
+	// key. A level of one makes it a trusted introducer, and higher
+	// levels let it delegate in turn. An amount of 120 is complete
+	// trust and 60 partial trust. See RFC 4880, section 5.2.3.13.
+	TrustLevel, TrustAmount uint8
+
 	// MDC is set if this signature has a feature packet that indicates
 	// support for MDC subpackets.
 	MDC bool
 
+	// AEAD is set if this signature has a features subpacket that
+	// indicates support for AEAD encrypted data. See
+	// draft-ietf-openpgp-rfc4880bis, section 5.2.3.25.
+	AEAD bool
+
 	// EmbeddedSignature, if non-nil, is a signature of the parent key, by
 	// this key. This prevents an attacker from claiming another's signing
 	// subkey as their own.
@@ -118,9 +164,28 @@ type Signature struct {
 	// revocation for this key).
 	DesignatedRevoker *RevocationKey
 
+	// ExtraSubpackets holds hashed subpackets, such as notations, that
+	// this package has no field for. When a signature is made, they are
+	// added to the hashed area after the subpackets built from the fields
+	// above. It isn't set when a signature is parsed.
+	ExtraSubpackets []Subpacket
+
+	// UnknownSubpackets holds the hashed subpackets of a parsed signature
+	// that weren't recognized, in order. They aren't written out when the
+	// signature is serialized again.
+	UnknownSubpackets []Subpacket
+
 	outSubpackets []outputSubpacket
 }
 
+// Subpacket is a signature subpacket in its raw form. See RFC 4880,
+// section 5.2.3.1.
+type Subpacket struct {
+	Type       uint8
+	IsCritical bool
+	Contents   []byte
+}
+
 func (sig *Signature) parse(r io.Reader) (err error) {
 	// RFC 4880, section 5.2.3
 	var buf [5]byte
@@ -191,6 +256,14 @@ func (sig *Signature) parse(r io.Reader) (err error) {
 		return
 	}
 
+	// The issuer key id is implied by a v4 issuer fingerprint, and
+	// minimal exports may drop the unhashed issuer subpacket that
+	// usually accompanies it.
+	if sig.IssuerKeyId == nil && len(sig.IssuerFingerprint) == 20 {
+		keyId := binary.BigEndian.Uint64(sig.IssuerFingerprint[12:])
+		sig.IssuerKeyId = &keyId
+	}
+
 	_, err = readFull(r, sig.HashTag[:2])
 	if err != nil {
 		return
@@ -242,6 +315,8 @@ type signatureSubpacketType uint8
 const (
 	creationTimeSubpacket        signatureSubpacketType = 2
 	signatureExpirationSubpacket signatureSubpacketType = 3
+	exportableCertSubpacket      signatureSubpacketType = 4
+	trustSubpacket               signatureSubpacketType = 5
 	regularExpressionSubpacket   signatureSubpacketType = 6
 	keyExpirationSubpacket       signatureSubpacketType = 9
 	prefSymmetricAlgosSubpacket  signatureSubpacketType = 11
@@ -253,10 +328,13 @@ const (
 	primaryUserIdSubpacket       signatureSubpacketType = 25
 	policyURISubpacket           signatureSubpacketType = 26
 	keyFlagsSubpacket            signatureSubpacketType = 27
+	signerUserIdSubpacket        signatureSubpacketType = 28
 	reasonForRevocationSubpacket signatureSubpacketType = 29
 	featuresSubpacket            signatureSubpacketType = 30
 	embeddedSignatureSubpacket   signatureSubpacketType = 32
 	issuerFingerprint            signatureSubpacketType = 33
+	prefAEADAlgosSubpacket       signatureSubpacketType = 34
+	attestedCertsSubpacket       signatureSubpacketType = 37
 )
 
 // parseSignatureSubpacket parses a single subpacket. len(subpacket) is >= 1.
@@ -323,6 +401,27 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		}
 		sig.SigLifetimeSecs = new(uint32)
 		*sig.SigLifetimeSecs = binary.BigEndian.Uint32(subpacket)
+	case exportableCertSubpacket:
+		// Exportable certification, section 5.2.3.11
+		if !isHashed {
+			return
+		}
+		if len(subpacket) != 1 {
+			err = errors.StructuralError("exportable certification subpacket with bad length")
+			return
+		}
+		sig.Exportable = new(bool)
+		*sig.Exportable = subpacket[0] != 0
+	case trustSubpacket:
+		// Trust signature, section 5.2.3.13
+		if !isHashed {
+			return
+		}
+		if len(subpacket) != 2 {
+			err = errors.StructuralError("trust signature subpacket with bad length")
+			return
+		}
+		sig.TrustLevel, sig.TrustAmount = subpacket[0], subpacket[1]
 	case keyExpirationSubpacket:
 		// Key expiration time, section 5.2.3.6
 		if !isHashed {
@@ -363,6 +462,32 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		}
 		sig.PreferredCompression = make([]byte, len(subpacket))
 		copy(sig.PreferredCompression, subpacket)
+	case prefAEADAlgosSubpacket:
+		// Preferred AEAD algorithms, draft-ietf-openpgp-rfc4880bis
+		// section 5.2.3.8
+		if !isHashed {
+			return
+		}
+		sig.PreferredAEAD = make([]AEADMode, len(subpacket))
+		for i, mode := range subpacket {
+			sig.PreferredAEAD[i] = AEADMode(mode)
+		}
+	case attestedCertsSubpacket:
+		// Attested Certifications, draft-ietf-openpgp-rfc4880bis
+		// section 5.2.3.30
+		if !isHashed {
+			return
+		}
+		size := sig.Hash.Size()
+		if len(subpacket)%size != 0 {
+			err = errors.StructuralError("attested certifications subpacket with bad length")
+			return
+		}
+		sig.AttestedCertifications = nil
+		for len(subpacket) > 0 {
+			sig.AttestedCertifications = append(sig.AttestedCertifications, subpacket[:size])
+			subpacket = subpacket[size:]
+		}
 	case primaryUserIdSubpacket:
 		// Primary User ID, section 5.2.3.19
 		if !isHashed {
@@ -400,6 +525,13 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 				sig.FlagEncryptStorage = true
 			}
 		}
+	case signerUserIdSubpacket:
+		// Signer's User ID, section 5.2.3.22
+		if !isHashed {
+			return
+		}
+		sig.SignerUserId = new(string)
+		*sig.SignerUserId = string(subpacket)
 	case reasonForRevocationSubpacket:
 		// Reason For Revocation, section 5.2.3.23
 		if !isHashed {
@@ -415,9 +547,10 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 	case featuresSubpacket:
 		// Features subpacket, section 5.2.3.24 specifies a very general
 		// mechanism for OpenPGP implementations to signal support for new
-		// features. In practice, the subpacket is used exclusively to
-		// indicate support for MDC-protected encryption.
+		// features. In practice, the subpacket is used to indicate support
+		// for MDC-protected and, more recently, AEAD encryption.
 		sig.MDC = len(subpacket) >= 1 && subpacket[0]&1 == 1
+		sig.AEAD = len(subpacket) >= 1 && subpacket[0]&2 == 2
 	case embeddedSignatureSubpacket:
 		// Only usage is in signatures that cross-certify
 		// signing subkeys. section 5.2.3.26 describes the
@@ -467,6 +600,9 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 			err = errors.UnsupportedError("unknown critical signature subpacket type " + strconv.Itoa(int(packetType)))
 			return
 		}
+		if isHashed {
+			sig.UnknownSubpackets = append(sig.UnknownSubpackets, Subpacket{uint8(packetType), isCritical, append([]byte{}, subpacket...)})
+		}
 	}
 	return
 
@@ -544,6 +680,71 @@ func (sig *Signature) KeyExpired(currentTime time.Time) bool {
 	return currentTime.After(expiry)
 }
 
+// IsHardRevocation returns whether sig, a revocation signature, is a hard
+// revocation: one that gives no reason, or a reason other than the key
+// being superseded or retired or the user id no longer being valid. A hard
+// revocation means that the key may have been compromised, so even
+// signatures made before it are suspect. See RFC 4880, section 5.2.3.23.
+func (sig *Signature) IsHardRevocation() bool {
+	if sig.RevocationReason == nil {
+		return true
+	}
+	switch *sig.RevocationReason {
+	case 1, 3, 32: // superseded, retired, user id no longer valid
+		return false
+	}
+	return true
+}
+
+// IsExportable returns whether sig may be exported along with the key it
+// certifies, which is the case unless it is marked as a local certification.
+func (sig *Signature) IsExportable() bool {
+	return sig.Exportable == nil || *sig.Exportable
+}
+
+// SigExpired returns whether sig has an expiration time that is before
+// currentTime.
+func (sig *Signature) SigExpired(currentTime time.Time) bool {
+	if sig.SigLifetimeSecs == nil || *sig.SigLifetimeSecs == 0 {
+		return false
+	}
+	expiry := sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second)
+	return currentTime.After(expiry)
+}
+
+// EqualTo reports whether sig and other are the same signature, even if
+// they were serialized differently, for example with their unhashed
+// subpackets in a different order. They are the same if they have the same
+// issuer, type, algorithms and creation time, cover the same hashed data and
+// have the same signature values. No signature is equal to nil.
+func (sig *Signature) EqualTo(other *Signature) bool {
+	if other == nil {
+		return false
+	}
+	if sig.SigType != other.SigType || sig.PubKeyAlgo != other.PubKeyAlgo ||
+		sig.Hash != other.Hash || !sig.CreationTime.Equal(other.CreationTime) ||
+		sig.HashTag != other.HashTag || !bytes.Equal(sig.HashSuffix, other.HashSuffix) {
+		return false
+	}
+	if (sig.IssuerKeyId == nil) != (other.IssuerKeyId == nil) ||
+		sig.IssuerKeyId != nil && *sig.IssuerKeyId != *other.IssuerKeyId {
+		return false
+	}
+	return mpiEqual(sig.RSASignature, other.RSASignature) &&
+		mpiEqual(sig.DSASigR, other.DSASigR) &&
+		mpiEqual(sig.DSASigS, other.DSASigS) &&
+		mpiEqual(sig.ECDSASigR, other.ECDSASigR) &&
+		mpiEqual(sig.ECDSASigS, other.ECDSASigS) &&
+		mpiEqual(sig.EdDSASigR, other.EdDSASigR) &&
+		mpiEqual(sig.EdDSASigS, other.EdDSASigS)
+}
+
+// mpiEqual reports whether a and b hold the same number, ignoring any
+// non-minimal leading zero bytes.
+func mpiEqual(a, b parsedMPI) bool {
+	return bytes.Equal(bytes.TrimLeft(a.bytes, "\x00"), bytes.TrimLeft(b.bytes, "\x00"))
+}
+
 // ExpiresBeforeOther checks if other signature has expiration at
 // later date than sig.
 func (sig *Signature) ExpiresBeforeOther(other *Signature) bool {
@@ -564,6 +765,17 @@ func (sig *Signature) ExpiresBeforeOther(other *Signature) bool {
 	return getExpiryDate(other).After(getExpiryDate(sig))
 }
 
+// HashTrailer returns the final trailer of HashSuffix: the version, 0xff and
+// the length of the hashed portion of the signature packet, as hashed after
+// the signed data. See RFC 4880, section 5.2.4. It returns nil if
+// HashSuffix hasn't been populated by parsing or signing.
+func (sig *Signature) HashTrailer() []byte {
+	if len(sig.HashSuffix) < 6 {
+		return nil
+	}
+	return sig.HashSuffix[len(sig.HashSuffix)-6:]
+}
+
 // buildHashSuffix constructs the HashSuffix member of sig in preparation for signing.
 func (sig *Signature) buildHashSuffix() (err error) {
 	hashedSubpacketsLen := subpacketsLength(sig.outSubpackets, true)
@@ -611,10 +823,25 @@ func (sig *Signature) signPrepareHash(h hash.Hash) (digest []byte, err error) {
 func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err error) {
 	signer, hashIsSigner := h.(Signer)
 
-	if !hashIsSigner && (priv == nil || priv.PrivateKey == nil) {
+	// The external signer only makes signatures of messages, so that
+	// self-signatures made with the same config still use priv.
+	var external ExternalSigner
+	if config != nil && (sig.SigType == SigTypeBinary || sig.SigType == SigTypeText) {
+		external = config.ExternalSigner
+	}
+
+	if !hashIsSigner && priv == nil {
 		err = errors.InvalidArgumentError("attempting to sign with nil PrivateKey")
 		return
 	}
+	if !hashIsSigner && external == nil && priv.PrivateKey == nil {
+		err = errors.InvalidArgumentError("attempting to sign with nil PrivateKey")
+		return
+	}
+
+	if priv != nil && sig.IssuerFingerprint == nil {
+		sig.IssuerFingerprint = append([]byte{}, priv.Fingerprint[:]...)
+	}
 
 	sig.outSubpackets = sig.buildSubpackets()
 	digest, err := sig.signPrepareHash(h)
@@ -634,6 +861,10 @@ func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err e
 		return
 	}
 
+	if external != nil {
+		return sig.signExternal(external, digest, config)
+	}
+
 	switch priv.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
 		sig.RSASignature.bytes, err = rsa.SignPKCS1v15(config.Random(), priv.PrivateKey.(*rsa.PrivateKey), sig.Hash, digest)
@@ -641,10 +872,8 @@ func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err e
 	case PubKeyAlgoDSA:
 		dsaPriv := priv.PrivateKey.(*dsa.PrivateKey)
 
-		// Need to truncate hashBytes to match FIPS 186-3 section 4.6.
-		subgroupSize := (dsaPriv.Q.BitLen() + 7) / 8
-		if len(digest) > subgroupSize {
-			digest = digest[:subgroupSize]
+		if digest, err = dsaTruncateHash(&dsaPriv.PublicKey, digest); err != nil {
+			return errors.InvalidArgumentError(sig.Hash.String() + " hash is too short for DSA key")
 		}
 		r, s, err := dsa.Sign(config.Random(), dsaPriv, digest)
 		if err != nil {
@@ -675,6 +904,43 @@ func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err e
 	return
 }
 
+// signExternal has es perform the private key operation over digest and
+// stores the result in sig.
+func (sig *Signature) signExternal(es ExternalSigner, digest []byte, config *Config) error {
+	switch sig.PubKeyAlgo {
+	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
+		b, err := es.Sign(config.Random(), digest, sig.Hash)
+		if err != nil {
+			return err
+		}
+		sig.RSASignature = FromBytes(b)
+	case PubKeyAlgoECDSA:
+		b, err := es.Sign(config.Random(), digest, sig.Hash)
+		if err != nil {
+			return err
+		}
+		var ecdsaSig struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(b, &ecdsaSig); err != nil || len(rest) != 0 {
+			return errors.InvalidArgumentError("external signer returned malformed ECDSA signature")
+		}
+		sig.ECDSASigR = FromBig(ecdsaSig.R)
+		sig.ECDSASigS = FromBig(ecdsaSig.S)
+	case PubKeyAlgoEdDSA:
+		b, err := es.Sign(config.Random(), digest, crypto.Hash(0))
+		if err != nil {
+			return err
+		}
+		if len(b) != 64 {
+			return errors.InvalidArgumentError("external signer returned malformed EdDSA signature")
+		}
+		sig.EdDSASigR = FromBytes(b[:32])
+		sig.EdDSASigS = FromBytes(b[32:])
+	default:
+		return errors.UnsupportedError("public key algorithm for external signing: " + strconv.Itoa(int(sig.PubKeyAlgo)))
+	}
+	return nil
+}
+
 // SignUserId computes a signature from priv, asserting that pub is a valid
 // key for the identity id.  On success, the signature is stored in sig. Call
 // Serialize to write it out.
@@ -699,8 +965,15 @@ func (sig *Signature) SignUserIdWithSigner(id string, pub *PublicKey, s Signer,
 
 // SignKey computes a signature from priv, asserting that pub is a subkey. On
 // success, the signature is stored in sig. Call Serialize to write it out.
+// The same hash, over the primary key followed by the subkey, is used for
+// subkey binding and subkey revocation signatures, so sig.SigType may be
+// either. A binding signature for a signing subkey must already carry the
+// subkey's cross-signature; see CrossSignKey.
 // If config is nil, sensible defaults will be used.
 func (sig *Signature) SignKey(pub *PublicKey, priv *PrivateKey, config *Config) error {
+	if sig.SigType == SigTypeSubkeyBinding && sig.FlagSign && sig.EmbeddedSignature == nil {
+		return errors.InvalidArgumentError("binding signature for a signing subkey needs a cross-signature")
+	}
 	h, err := keySignatureHash(&priv.PublicKey, pub, sig.Hash)
 	if err != nil {
 		return err
@@ -708,6 +981,18 @@ func (sig *Signature) SignKey(pub *PublicKey, priv *PrivateKey, config *Config)
 	return sig.Sign(h, priv, config)
 }
 
+// SignDirectKey computes a signature from priv over the key pub alone, as
+// made by direct-key and key revocation signatures, so sig.SigType may be
+// either. On success, the signature is stored in sig. Call Serialize to
+// write it out. If config is nil, sensible defaults will be used.
+func (sig *Signature) SignDirectKey(pub *PublicKey, priv *PrivateKey, config *Config) error {
+	h, err := keyRevocationHash(pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
 // SignKeyWithSigner computes a signature using s, asserting that
 // signeePubKey is a subkey. On success, the signature is stored in sig. Call
 // Serialize to write it out. If config is nil, sensible defaults will be used.
@@ -796,7 +1081,11 @@ func (sig *Signature) Serialize(w io.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	return sig.serializeSignatureValues(w)
+}
 
+// serializeSignatureValues writes the algorithm specific signature MPIs.
+func (sig *Signature) serializeSignatureValues(w io.Writer) (err error) {
 	switch sig.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
 		err = writeMPIs(w, sig.RSASignature)
@@ -812,6 +1101,42 @@ func (sig *Signature) Serialize(w io.Writer) (err error) {
 	return
 }
 
+// AttestationDigest returns the digest of sig, made with h, that an
+// attestation signature lists to approve sig. It is computed as for a
+// signature over a signature packet: the hashed data is the octet 0x88, the
+// four-octet length of the body of sig and then that body, in which the
+// unhashed subpacket data is left out and its length is set to zero. See
+// draft-ietf-openpgp-rfc4880bis, section 5.2.3.30, and RFC 4880, section
+// 5.2.4.
+func (sig *Signature) AttestationDigest(h crypto.Hash) ([]byte, error) {
+	if !h.Available() {
+		return nil, errors.UnsupportedError("hash function " + strconv.Itoa(int(h)))
+	}
+	if len(sig.HashSuffix) < 6 {
+		return nil, errors.InvalidArgumentError("Signature: need to call Sign, SignUserId or SignKey before AttestationDigest")
+	}
+	// The body holds the version, type, algorithms and hashed subpackets,
+	// which are the hash suffix without its trailer, an empty unhashed
+	// area, the hash tag and the signature values.
+	body := bytes.NewBuffer(nil)
+	body.Write(sig.HashSuffix[:len(sig.HashSuffix)-6])
+	body.Write([]byte{0, 0})
+	body.Write(sig.HashTag[:])
+	if err := sig.serializeSignatureValues(body); err != nil {
+		return nil, err
+	}
+
+	// 0x88 is an old format signature packet header with a four-octet
+	// length.
+	d := h.New()
+	var header [5]byte
+	header[0] = 0x88
+	binary.BigEndian.PutUint32(header[1:], uint32(body.Len()))
+	d.Write(header[:])
+	d.Write(body.Bytes())
+	return d.Sum(nil), nil
+}
+
 // outputSubpacket represents a subpacket to be marshaled.
 type outputSubpacket struct {
 	hashed        bool // true if this subpacket is in the hashed area.
@@ -820,23 +1145,43 @@ type outputSubpacket struct {
 	contents      []byte
 }
 
+// buildSubpackets returns the subpackets to serialize for sig. So that
+// re-signing the same data gives the same bytes, they are always emitted in
+// the order that GnuPG uses:
+//
+//	hashed:   issuer fingerprint, creation time, signature expiration,
+//	          exportable, trust, key flags, key expiration, primary user
+//	          id, preferred symmetric, preferred AEAD, preferred hash,
+//	          preferred compression, features, signer's user id,
+//	          attested certifications, then ExtraSubpackets
+//	unhashed: issuer key id, embedded signature
 func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
+	// Like GnuPG, put the full issuer fingerprint in the hashed area
+	// and the issuer key id, which is implied by it, in the unhashed
+	// area for older verifiers.
+	if len(sig.IssuerFingerprint) > 0 {
+		contents := append([]byte{4}, sig.IssuerFingerprint...)
+		subpackets = append(subpackets, outputSubpacket{true, issuerFingerprint, false, contents})
+	}
+
 	creationTime := make([]byte, 4)
 	binary.BigEndian.PutUint32(creationTime, uint32(sig.CreationTime.Unix()))
 	subpackets = append(subpackets, outputSubpacket{true, creationTimeSubpacket, false, creationTime})
 
-	if sig.IssuerKeyId != nil {
-		keyId := make([]byte, 8)
-		binary.BigEndian.PutUint64(keyId, *sig.IssuerKeyId)
-		subpackets = append(subpackets, outputSubpacket{true, issuerSubpacket, false, keyId})
-	}
-
 	if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
 		sigLifetime := make([]byte, 4)
 		binary.BigEndian.PutUint32(sigLifetime, *sig.SigLifetimeSecs)
 		subpackets = append(subpackets, outputSubpacket{true, signatureExpirationSubpacket, true, sigLifetime})
 	}
 
+	if !sig.IsExportable() {
+		subpackets = append(subpackets, outputSubpacket{true, exportableCertSubpacket, false, []byte{0}})
+	}
+
+	if sig.TrustLevel != 0 || sig.TrustAmount != 0 {
+		subpackets = append(subpackets, outputSubpacket{true, trustSubpacket, false, []byte{sig.TrustLevel, sig.TrustAmount}})
+	}
+
 	// Key flags may only appear in self-signatures or certification signatures.
 
 	if sig.FlagsValid {
@@ -859,6 +1204,14 @@ func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
 		subpackets = append(subpackets, outputSubpacket{true, prefSymmetricAlgosSubpacket, false, sig.PreferredSymmetric})
 	}
 
+	if len(sig.PreferredAEAD) > 0 {
+		modes := make([]byte, len(sig.PreferredAEAD))
+		for i, mode := range sig.PreferredAEAD {
+			modes[i] = byte(mode)
+		}
+		subpackets = append(subpackets, outputSubpacket{true, prefAEADAlgosSubpacket, false, modes})
+	}
+
 	if len(sig.PreferredHash) > 0 {
 		subpackets = append(subpackets, outputSubpacket{true, prefHashAlgosSubpacket, false, sig.PreferredHash})
 	}
@@ -867,6 +1220,39 @@ func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
 		subpackets = append(subpackets, outputSubpacket{true, prefCompressionSubpacket, false, sig.PreferredCompression})
 	}
 
+	if sig.MDC || sig.AEAD {
+		var features byte
+		if sig.MDC {
+			features |= 1
+		}
+		if sig.AEAD {
+			features |= 2
+		}
+		subpackets = append(subpackets, outputSubpacket{true, featuresSubpacket, false, []byte{features}})
+	}
+
+	if sig.SignerUserId != nil {
+		subpackets = append(subpackets, outputSubpacket{true, signerUserIdSubpacket, false, []byte(*sig.SignerUserId)})
+	}
+
+	if len(sig.AttestedCertifications) > 0 {
+		digests := make([]byte, 0, len(sig.AttestedCertifications)*sig.Hash.Size())
+		for _, digest := range sig.AttestedCertifications {
+			digests = append(digests, digest...)
+		}
+		subpackets = append(subpackets, outputSubpacket{true, attestedCertsSubpacket, false, digests})
+	}
+
+	for _, extra := range sig.ExtraSubpackets {
+		subpackets = append(subpackets, outputSubpacket{true, signatureSubpacketType(extra.Type), extra.IsCritical, extra.Contents})
+	}
+
+	if sig.IssuerKeyId != nil {
+		keyId := make([]byte, 8)
+		binary.BigEndian.PutUint64(keyId, *sig.IssuerKeyId)
+		subpackets = append(subpackets, outputSubpacket{false, issuerSubpacket, false, keyId})
+	}
+
 	if sig.EmbeddedSignature != nil {
 		buf := bytes.NewBuffer(nil)
 		if err := sig.EmbeddedSignature.Serialize(buf); err == nil {
@@ -7,10 +7,18 @@ package packet
 import (
 	"bytes"
 	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	_ "crypto/sha1"
 	"encoding/hex"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/keybase/go-crypto/openpgp/errors"
+	"github.com/keybase/go-crypto/rsa"
 )
 
 func TestSignatureRead(t *testing.T) {
@@ -25,6 +33,22 @@ func TestSignatureRead(t *testing.T) {
 	}
 }
 
+func TestSignatureHashTrailer(t *testing.T) {
+	packet, err := Read(readerFromHex(signatureDataHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := packet.(*Signature)
+	// Six bytes of fixed fields plus six bytes of hashed subpackets.
+	expected := []byte{4, 0xff, 0, 0, 0, 12}
+	if trailer := sig.HashTrailer(); !bytes.Equal(trailer, expected) {
+		t.Errorf("got trailer %x, want %x", trailer, expected)
+	}
+	if new(Signature).HashTrailer() != nil {
+		t.Error("expected nil trailer for an empty signature")
+	}
+}
+
 func TestSignatureReserialize(t *testing.T) {
 	packet, _ := Read(readerFromHex(signatureDataHex))
 	sig := packet.(*Signature)
@@ -71,4 +95,437 @@ func TestSignWithNilPrivateKey(t *testing.T) {
 	}
 }
 
+// dsaTestParameters holds fixed domain parameters, generated once with
+// dsa.GenerateParameters, so that tests don't spend seconds searching for
+// primes.
+var dsaTestParameters = map[dsa.ParameterSizes]dsa.Parameters{
+	dsa.L1024N160: {
+		P: fromHex("edc34188bd3b2e65d2bc96158ed12e3af3aee4d8972875bbeadd6b03072f245758a8f83325130d3711cbc3f6a546b5a137e00f20b8c503a0b92469e9a413337c0c46f524d63da88aa346266dae833d0b9ea86913af7ef62acc4b057834099618de7043a3fb7a0c79b74ec9adcecba2c0c02b45ab7945d48a7c9f8a81ab84612b"),
+		Q: fromHex("fc2152d4fd3f8b6c6ecec5844031bd05f11846e9"),
+		G: fromHex("c3339dedf4ec4d50843d11866bb3794c0583d619d25150fc2068072fc9faea53e86ae1494fd970c66c2c98cb0711cb7ff838d6c0b7d8f0997fbfbeeb3f41c2858dae9bc9d734c45c9e500ba3b7448292299ca8e09170bb182c7898688ee49064d0218233feab4e5c9c31f04f6a80a3a8039009df9a3eeb70073266222539c2a"),
+	},
+	dsa.L2048N256: {
+		P: fromHex("d887f0cf9a3772b002c8cd96320ba077abbf4fea06516cbd3dea947ce93cdc443722819be6227c6a31504f077c3c5ac95ef15cfd14f8eb60c8543c039b4b9a6080b5fc90f55200e9845d21a1f8438f6289985c8d15f5b4c8f85acf1651b7e737fd7a2babeac153bad3572d0c34377cea6b1b0692b66d13c9bef0930123e99cbee4f40c0854c87ae33167d8c2cd84498b539575d4c24179e140345bb5b708349bbdb41ac8c4a024efb4513055f69278aa2213527ce1c3775a53b435780d0d91c42fb54e21304e4e9ffa3e466c1a1cb369f16526ea0496049a9dd411d43440b3dac8f5a0bf27b6eeaf26b0a65be4211fb6ebe59f8f1ae1f0b31a16d8f5c1592959"),
+		Q: fromHex("b0d2b3904b951636c987704444c11ab4fb91370ff040287b8cc12c2a61ec088d"),
+		G: fromHex("444f7909a85704df6abe6543e17aad999d30733db5c405b7dd1ac6a48a6ac4e6a94407e22635b69af930111cecace556718b17b6a5c8dcaeee95b0ed054c6f58ece632a5f906634991939e9da8973777d988c5f9682bb510f88aead456bd06bcc2511f5325d7498e9c40de27232fe7956a2feb5b984f4abae31cdb7444dd1f5fdb899fbea61091f12418e0b4259f14e45053f3b87a9c75e08064a317b1a460e74b8b60e09abfb6e6baf56d71d942e5f578a1bd52aeb8ae843fce5d521463c5a15021ec027c43f42d214ad28b0906aa3128f01db92c12314f4bffdb6770040a38091cf1bb9f9f9fefab9b0d98ff62743eb9251ad3ec97510b9ec22cbff22e212"),
+	},
+}
+
+func newDSATestKey(t *testing.T, sizes dsa.ParameterSizes) *PrivateKey {
+	dsaPriv := &dsa.PrivateKey{PublicKey: dsa.PublicKey{Parameters: dsaTestParameters[sizes]}}
+	if err := dsa.GenerateKey(dsaPriv, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	return NewDSAPrivateKey(time.Now(), dsaPriv)
+}
+
+func TestDSASignatureHashSizes(t *testing.T) {
+	for _, test := range []struct {
+		sizes dsa.ParameterSizes
+		hash  crypto.Hash
+	}{
+		{dsa.L1024N160, crypto.SHA1},
+		{dsa.L1024N160, crypto.SHA256},
+		{dsa.L2048N256, crypto.SHA256},
+		{dsa.L2048N256, crypto.SHA512},
+	} {
+		priv := newDSATestKey(t, test.sizes)
+
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   PubKeyAlgoDSA,
+			Hash:         test.hash,
+			CreationTime: time.Now(),
+		}
+		h := test.hash.New()
+		h.Write([]byte("hello"))
+		if err := sig.Sign(h, priv, nil); err != nil {
+			t.Fatalf("%d-bit q, %s: %s", dsaTestParameters[test.sizes].Q.BitLen(), test.hash, err)
+		}
+
+		h = test.hash.New()
+		h.Write([]byte("hello"))
+		if err := priv.PublicKey.VerifySignature(h, sig); err != nil {
+			t.Errorf("%d-bit q, %s: failed to verify: %s", dsaTestParameters[test.sizes].Q.BitLen(), test.hash, err)
+		}
+	}
+}
+
+func TestDSA2SignatureWithShortHash(t *testing.T) {
+	priv := newDSATestKey(t, dsa.L2048N256)
+
+	sig := &Signature{
+		SigType:      SigTypeBinary,
+		PubKeyAlgo:   PubKeyAlgoDSA,
+		Hash:         crypto.SHA1,
+		CreationTime: time.Now(),
+	}
+	h := crypto.SHA1.New()
+	h.Write([]byte("hello"))
+	err := sig.Sign(h, priv, nil)
+	if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Fatalf("expected InvalidArgumentError when signing with SHA-1, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "SHA-1") {
+		t.Errorf("error %q doesn't name the hash", err)
+	}
+
+	// Forge a signature over the 160-bit digest directly, as a lax
+	// implementation would, and make sure verification rejects it.
+	sig.outSubpackets = sig.buildSubpackets()
+	h = crypto.SHA1.New()
+	h.Write([]byte("hello"))
+	digest, err := sig.signPrepareHash(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := dsa.Sign(rand.Reader, priv.PrivateKey.(*dsa.PrivateKey), digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.DSASigR = FromBig(r)
+	sig.DSASigS = FromBig(s)
+
+	h = crypto.SHA1.New()
+	h.Write([]byte("hello"))
+	err = priv.PublicKey.VerifySignature(h, sig)
+	if _, ok := err.(errors.SignatureError); !ok {
+		t.Errorf("expected SignatureError for short hash, got %v", err)
+	}
+}
+
+func TestSignatureEqualTo(t *testing.T) {
+	p1, _ := Read(readerFromHex(signatureDataHex))
+	p2, _ := Read(readerFromHex(signatureDataHex))
+	if !p1.(*Signature).EqualTo(p2.(*Signature)) {
+		t.Error("two parses of the same signature aren't equal")
+	}
+
+	priv := newDSATestKey(t, dsa.L1024N160)
+	now := time.Now()
+	sign := func() *Signature {
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   priv.PubKeyAlgo,
+			Hash:         crypto.SHA256,
+			CreationTime: now,
+			IssuerKeyId:  &priv.KeyId,
+		}
+		h := crypto.SHA256.New()
+		h.Write([]byte("hello"))
+		if err := sig.Sign(h, priv, nil); err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	sig := sign()
+
+	nonMinimal := *sig
+	nonMinimal.DSASigS.bytes = append([]byte{0}, sig.DSASigS.bytes...)
+	if !sig.EqualTo(&nonMinimal) {
+		t.Error("a non-minimal encoding of the same signature isn't equal")
+	}
+	if sig.EqualTo(sign()) {
+		t.Error("signatures with different DSA nonces are equal")
+	}
+	if sig.EqualTo(p1.(*Signature)) {
+		t.Error("signatures by different keys are equal")
+	}
+	if sig.EqualTo(nil) {
+		t.Error("a signature is equal to nil")
+	}
+}
+
+func TestSignatureFeatures(t *testing.T) {
+	priv := newDSATestKey(t, dsa.L1024N160)
+	for _, features := range []struct{ mdc, aead bool }{
+		{true, false},
+		{false, true},
+		{true, true},
+	} {
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   priv.PubKeyAlgo,
+			Hash:         crypto.SHA256,
+			CreationTime: time.Now(),
+			IssuerKeyId:  &priv.KeyId,
+			MDC:          features.mdc,
+			AEAD:         features.aead,
+		}
+		if err := sig.Sign(crypto.SHA256.New(), priv, nil); err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := sig.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		p, err := Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.(*Signature); got.MDC != features.mdc || got.AEAD != features.aead {
+			t.Errorf("got MDC %v and AEAD %v, want %v and %v", got.MDC, got.AEAD, features.mdc, features.aead)
+		}
+	}
+}
+
+func TestSignatureTrust(t *testing.T) {
+	priv := newDSATestKey(t, dsa.L1024N160)
+	sig := &Signature{
+		SigType:      SigTypeGenericCert,
+		PubKeyAlgo:   priv.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &priv.KeyId,
+		TrustLevel:   2,
+		TrustAmount:  120,
+	}
+	if err := sig.SignUserId("Trusted <trusted@example.com>", &priv.PublicKey, priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := sig.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.(*Signature); got.TrustLevel != 2 || got.TrustAmount != 120 {
+		t.Errorf("got trust level %d and amount %d, want 2 and 120", got.TrustLevel, got.TrustAmount)
+	}
+}
+
+func TestSignatureNonMinimalMPIs(t *testing.T) {
+	ecdsaPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, priv := range []*PrivateKey{
+		newDSATestKey(t, dsa.L1024N160),
+		NewECDSAPrivateKey(time.Now(), ecdsaPriv),
+	} {
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   priv.PubKeyAlgo,
+			Hash:         crypto.SHA256,
+			CreationTime: time.Now(),
+			IssuerKeyId:  &priv.KeyId,
+		}
+		h := crypto.SHA256.New()
+		h.Write([]byte("hello"))
+		if err := sig.Sign(h, priv, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// Give s a spurious leading zero byte, counted in its bit
+		// length, as some implementations do.
+		s := &sig.DSASigS
+		if priv.PubKeyAlgo == PubKeyAlgoECDSA {
+			s = &sig.ECDSASigS
+		}
+		s.bytes = append([]byte{0}, s.bytes...)
+		s.bitLength = uint16(8 * len(s.bytes))
+
+		buf := new(bytes.Buffer)
+		if err := sig.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		p, err := Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h = crypto.SHA256.New()
+		h.Write([]byte("hello"))
+		if err := priv.PublicKey.VerifySignature(h, p.(*Signature)); err != nil {
+			t.Errorf("%d: failed to verify signature with a non-minimal s: %s", priv.PubKeyAlgo, err)
+		}
+	}
+}
+
+func TestSignatureIssuerSubpackets(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := NewRSAPrivateKey(time.Now(), rsaPriv)
+
+	sig := &Signature{
+		SigType:      SigTypeBinary,
+		PubKeyAlgo:   PubKeyAlgoRSA,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &priv.KeyId,
+	}
+	h := crypto.SHA256.New()
+	h.Write([]byte("hello"))
+	if err := sig.Sign(h, priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := sig.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := p.(*Signature)
+	if !bytes.Equal(parsed.IssuerFingerprint, priv.Fingerprint[:]) {
+		t.Errorf("bad issuer fingerprint: got %x, want %x", parsed.IssuerFingerprint, priv.Fingerprint)
+	}
+	if parsed.IssuerKeyId == nil || *parsed.IssuerKeyId != priv.KeyId {
+		t.Errorf("bad issuer key id: %v", parsed.IssuerKeyId)
+	}
+
+	var sawFingerprint, sawKeyId bool
+	for _, sp := range parsed.rawSubpackets {
+		switch sp.subpacketType {
+		case issuerFingerprint:
+			sawFingerprint = true
+			if !sp.hashed {
+				t.Error("issuer fingerprint subpacket should be hashed")
+			}
+		case issuerSubpacket:
+			sawKeyId = true
+			if sp.hashed {
+				t.Error("issuer key id subpacket should not be hashed")
+			}
+		}
+	}
+	if !sawFingerprint || !sawKeyId {
+		t.Errorf("missing issuer subpackets: fingerprint %v, key id %v", sawFingerprint, sawKeyId)
+	}
+}
+
+func TestSignatureSubpacketOrder(t *testing.T) {
+	keyLifetime := uint32(3600)
+	isPrimaryId := true
+	keyId := uint64(0x0123456789abcdef)
+	sig := &Signature{
+		CreationTime:         time.Unix(1500000000, 0),
+		IssuerKeyId:          &keyId,
+		IssuerFingerprint:    make([]byte, 20),
+		FlagsValid:           true,
+		FlagSign:             true,
+		KeyLifetimeSecs:      &keyLifetime,
+		IsPrimaryId:          &isPrimaryId,
+		PreferredSymmetric:   []uint8{9},
+		PreferredAEAD:        []AEADMode{AEADModeEAX},
+		PreferredHash:        []uint8{8},
+		PreferredCompression: []uint8{2},
+		MDC:                  true,
+	}
+	expected := []signatureSubpacketType{
+		issuerFingerprint, creationTimeSubpacket, keyFlagsSubpacket,
+		keyExpirationSubpacket, primaryUserIdSubpacket,
+		prefSymmetricAlgosSubpacket, prefAEADAlgosSubpacket,
+		prefHashAlgosSubpacket, prefCompressionSubpacket,
+		featuresSubpacket, issuerSubpacket,
+	}
+	subpackets := sig.buildSubpackets()
+	if len(subpackets) != len(expected) {
+		t.Fatalf("got %d subpackets, want %d", len(subpackets), len(expected))
+	}
+	for i, sp := range subpackets {
+		if sp.subpacketType != expected[i] {
+			t.Errorf("subpacket %d: got type %d, want %d", i, sp.subpacketType, expected[i])
+		}
+	}
+}
+
+func TestSubkeyBindingAndRevocation(t *testing.T) {
+	newKey := func() *PrivateKey {
+		rsaPriv, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewRSAPrivateKey(time.Now(), rsaPriv)
+	}
+	primary, subkey := newKey(), newKey()
+	subkey.IsSubkey = true
+	subkey.PublicKey.IsSubkey = true
+
+	// reparse round-trips sig so that verification only sees what a
+	// reader of the key, such as GnuPG, would.
+	reparse := func(sig *Signature) *Signature {
+		buf := new(bytes.Buffer)
+		if err := sig.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		p, err := Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.(*Signature)
+	}
+
+	binding := &Signature{
+		SigType:      SigTypeSubkeyBinding,
+		PubKeyAlgo:   primary.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &primary.KeyId,
+		FlagsValid:   true,
+		FlagSign:     true,
+	}
+	if _, ok := binding.SignKey(&subkey.PublicKey, primary, nil).(errors.InvalidArgumentError); !ok {
+		t.Error("expected an error signing a signing subkey binding without a cross-signature")
+	}
+	if err := binding.CrossSignKey(&primary.PublicKey, subkey, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := binding.SignKey(&subkey.PublicKey, primary, nil); err != nil {
+		t.Fatal(err)
+	}
+	parsed := reparse(binding)
+	if parsed.EmbeddedSignature == nil {
+		t.Fatal("binding signature lost its cross-signature")
+	}
+	if err := primary.VerifyKeySignature(&subkey.PublicKey, parsed); err != nil {
+		t.Errorf("binding signature didn't verify: %s", err)
+	}
+	// The binding must not verify over the keys in the other order.
+	if err := primary.VerifyKeySignature(&primary.PublicKey, parsed); err == nil {
+		t.Error("binding signature verified over the wrong subkey")
+	}
+
+	revocation := &Signature{
+		SigType:      SigTypeSubkeyRevocation,
+		PubKeyAlgo:   primary.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &primary.KeyId,
+	}
+	if err := revocation.SignKey(&subkey.PublicKey, primary, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.VerifyKeySignature(&subkey.PublicKey, reparse(revocation)); err != nil {
+		t.Errorf("subkey revocation didn't verify: %s", err)
+	}
+}
+
 const signatureDataHex = "c2c05c04000102000605024cb45112000a0910ab105c91af38fb158f8d07ff5596ea368c5efe015bed6e78348c0f033c931d5f2ce5db54ce7f2a7e4b4ad64db758d65a7a71773edeab7ba2a9e0908e6a94a1175edd86c1d843279f045b021a6971a72702fcbd650efc393c5474d5b59a15f96d2eaad4c4c426797e0dcca2803ef41c6ff234d403eec38f31d610c344c06f2401c262f0993b2e66cad8a81ebc4322c723e0d4ba09fe917e8777658307ad8329adacba821420741009dfe87f007759f0982275d028a392c6ed983a0d846f890b36148c7358bdb8a516007fac760261ecd06076813831a36d0459075d1befa245ae7f7fb103d92ca759e9498fe60ef8078a39a3beda510deea251ea9f0a7f0df6ef42060f20780360686f3e400e"
+
+func TestIsHardRevocation(t *testing.T) {
+	reason := func(r uint8) *uint8 { return &r }
+	for _, test := range []struct {
+		reason *uint8
+		hard   bool
+	}{
+		{nil, true},
+		{reason(0), true},  // no reason specified
+		{reason(1), false}, // superseded
+		{reason(2), true},  // compromised
+		{reason(3), false}, // retired
+		{reason(32), false},
+		{reason(100), true},
+	} {
+		sig := &Signature{SigType: SigTypeKeyRevocation, RevocationReason: test.reason}
+		if got := sig.IsHardRevocation(); got != test.hard {
+			t.Errorf("reason %v: got %v, want %v", test.reason, got, test.hard)
+		}
+	}
+}
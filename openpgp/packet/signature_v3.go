@@ -5,6 +5,7 @@
 package packet
 
 import (
+	"bytes"
 	"crypto"
 	"encoding/binary"
 	"fmt"
@@ -21,6 +22,9 @@ import (
 // here for backwards compatibility to read and validate with older key material.
 // See RFC 4880, section 5.2.2.
 type SignatureV3 struct {
+	// Version is 3, or 2 for the otherwise identical signatures of
+	// older PGP versions. Zero is taken to be 3 when serializing.
+	Version      byte
 	SigType      SignatureType
 	CreationTime time.Time
 	IssuerKeyId  uint64
@@ -30,6 +34,9 @@ type SignatureV3 struct {
 
 	RSASignature     parsedMPI
 	DSASigR, DSASigS parsedMPI
+
+	// header is the packet header the signature was read with, if any.
+	header []byte
 }
 
 func (sig *SignatureV3) parse(r io.Reader) (err error) {
@@ -42,6 +49,7 @@ func (sig *SignatureV3) parse(r io.Reader) (err error) {
 		err = errors.UnsupportedError("signature packet version " + strconv.Itoa(int(buf[0])))
 		return
 	}
+	sig.Version = buf[0]
 	if _, err = readFull(r, buf[:1]); err != nil {
 		return
 	}
@@ -100,11 +108,42 @@ func (sig *SignatureV3) parse(r io.Reader) (err error) {
 	return
 }
 
-// Serialize marshals sig to w. Sign, SignUserId or SignKey must have been
-// called first.
+// Serialize marshals sig to w, including the packet header, in the wire
+// format of its version. Sign, SignUserId or SignKey must have been called
+// first.
 func (sig *SignatureV3) Serialize(w io.Writer) (err error) {
+	if sig.RSASignature.bytes == nil && sig.DSASigR.bytes == nil {
+		return errors.InvalidArgumentError("Signature: need to call Sign, SignUserId or SignKey before Serialize")
+	}
+
+	var sigLength int
+	switch sig.PubKeyAlgo {
+	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
+		sigLength = 2 + len(sig.RSASignature.bytes)
+	case PubKeyAlgoDSA:
+		sigLength = 2 + len(sig.DSASigR.bytes) + 2 + len(sig.DSASigS.bytes)
+	default:
+		panic("impossible")
+	}
+	// Version, hashed length, type, creation time, key id, algorithms
+	// and hash tag.
+	const headerLength = 1 + 1 + 5 + 8 + 2 + 2
+	if err = sig.serializeHeader(w, headerLength+sigLength); err != nil {
+		return
+	}
+
 	buf := make([]byte, 8)
 
+	version := sig.Version
+	if version == 0 {
+		version = 3
+	}
+	buf[0] = version
+	buf[1] = 5
+	if _, err = w.Write(buf[:2]); err != nil {
+		return
+	}
+
 	// Write the sig type and creation time
 	buf[0] = byte(sig.SigType)
 	binary.BigEndian.PutUint32(buf[1:5], uint32(sig.CreationTime.Unix()))
@@ -130,10 +169,6 @@ func (sig *SignatureV3) Serialize(w io.Writer) (err error) {
 		return
 	}
 
-	if sig.RSASignature.bytes == nil && sig.DSASigR.bytes == nil {
-		return errors.InvalidArgumentError("Signature: need to call Sign, SignUserId or SignKey before Serialize")
-	}
-
 	switch sig.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
 		err = writeMPIs(w, sig.RSASignature)
@@ -144,3 +179,34 @@ func (sig *SignatureV3) Serialize(w io.Writer) (err error) {
 	}
 	return
 }
+
+// serializeHeader writes the packet header of sig to w. A signature that was
+// read is written with the header it came with, as long as its length still
+// holds. Otherwise an old format header is used, as PGP versions that made
+// V3 signatures knew no other.
+func (sig *SignatureV3) serializeHeader(w io.Writer, length int) (err error) {
+	if len(sig.header) > 0 {
+		if _, oldLength, _, err := readHeader(bytes.NewReader(sig.header)); err == nil && oldLength == int64(length) {
+			_, err = w.Write(sig.header)
+			return err
+		}
+	}
+
+	var buf [5]byte
+	buf[0] = 0x80 | byte(packetTypeSignature)<<2
+	n := 2
+	switch {
+	case length < 1<<8:
+		buf[1] = byte(length)
+	case length < 1<<16:
+		buf[0] |= 1
+		binary.BigEndian.PutUint16(buf[1:3], uint16(length))
+		n = 3
+	default:
+		buf[0] |= 2
+		binary.BigEndian.PutUint32(buf[1:5], uint32(length))
+		n = 5
+	}
+	_, err = w.Write(buf[:n])
+	return
+}
@@ -50,12 +50,52 @@ func TestSignatureV3Reserialize(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	expected = expected[4+141+4+39:] // See pgpdump offsets below, this is where the sig starts
+	expected = expected[2+141+2+39:] // See pgpdump offsets below, this is where the sig starts
 	if !bytes.Equal(expected, out.Bytes()) {
 		t.Errorf("output doesn't match input (got vs expected):\n%s\n%s", hex.Dump(out.Bytes()), hex.Dump(expected))
 	}
 }
 
+func TestSignatureV3DetachedReserialize(t *testing.T) {
+	// The same signature as version 3 and as version 2.
+	v2Hex := detachedSignatureV3Hex[:6] + "02" + detachedSignatureV3Hex[8:]
+	for _, sigHex := range []string{detachedSignatureV3Hex, v2Hex} {
+		expected, _ := hex.DecodeString(sigHex)
+		packet, err := Read(bytes.NewReader(expected))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := packet.(*SignatureV3)
+		if sig.Version != expected[3] {
+			t.Errorf("got version %d, want %d", sig.Version, expected[3])
+		}
+		out := new(bytes.Buffer)
+		if err = sig.Serialize(out); err != nil {
+			t.Fatalf("error reserializing: %s", err)
+		}
+		if !bytes.Equal(expected, out.Bytes()) {
+			t.Errorf("output doesn't match input (got vs expected):\n%s\n%s", hex.Dump(out.Bytes()), hex.Dump(expected))
+		}
+
+		// Without the original header, an old format one is made up.
+		sig.header = nil
+		out.Reset()
+		if err = sig.Serialize(out); err != nil {
+			t.Fatalf("error reserializing: %s", err)
+		}
+		if want := append([]byte{0x88, 0x95}, expected[3:]...); !bytes.Equal(want, out.Bytes()) {
+			t.Errorf("output doesn't match input (got vs expected):\n%s\n%s", hex.Dump(out.Bytes()), hex.Dump(want))
+		}
+		packet, err = Read(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.(*SignatureV3).Version != sig.Version {
+			t.Errorf("version %d was not preserved", sig.Version)
+		}
+	}
+}
+
 func v3KeyReader(t *testing.T) io.Reader {
 	armorBlock, err := armor.Decode(bytes.NewBufferString(keySigV3Armor))
 	if err != nil {
@@ -90,3 +130,7 @@ gSkWZCDAjNdph7zexvAb0CcUWahcwiBIgg3U5ErCx9I5CNVA9U+s8bNrDZwgSIeBzp3KhWUx
 YFCbq4EjXRoOrYM=
 =LPjs
 -----END PGP PUBLIC KEY BLOCK-----`
+
+// detachedSignatureV3Hex is a V3 detached signature made by gpg, which
+// uses an old format header with a two octet length.
+const detachedSignatureV3Hex = "8900950305005255c25ca34d7e18c20c31bb0102bb3f04009f6589ef8a028d6e54f6eaf25432e590d31c3a41f4710897585e10c31e5e332c7f9f409af8512adceaff24d0da1474ab07aa7bce4f674610b010fccc5b579ae5eb00a127f272fb799f988ab8e4574c141da6dbfecfef7e6b2c478d9a3d2551ba741f260ee22bec762812f0053e05380bfdd55ad0f22d8cdf71b233fe51ae8a24"
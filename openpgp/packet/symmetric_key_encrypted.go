@@ -74,6 +74,13 @@ func (ske *SymmetricKeyEncrypted) parse(r io.Reader) error {
 // the cipher to use when decrypting a subsequent Symmetrically Encrypted Data
 // packet.
 func (ske *SymmetricKeyEncrypted) Decrypt(passphrase []byte) ([]byte, CipherFunction, error) {
+	return ske.DecryptWithConfig(passphrase, nil)
+}
+
+// DecryptWithConfig is like Decrypt but creates the cipher with
+// config.CipherFactory, if it is set.
+// If config is nil, sensible defaults will be used.
+func (ske *SymmetricKeyEncrypted) DecryptWithConfig(passphrase []byte, config *Config) ([]byte, CipherFunction, error) {
 	key := make([]byte, ske.CipherFunc.KeySize())
 	ske.s2k(key, passphrase)
 
@@ -83,7 +90,11 @@ func (ske *SymmetricKeyEncrypted) Decrypt(passphrase []byte) ([]byte, CipherFunc
 
 	// the IV is all zeros
 	iv := make([]byte, ske.CipherFunc.blockSize())
-	c := cipher.NewCFBDecrypter(ske.CipherFunc.new(key), iv)
+	block, err := config.newCipher(ske.CipherFunc, key)
+	if err != nil {
+		return nil, ske.CipherFunc, err
+	}
+	c := cipher.NewCFBDecrypter(block, iv)
 	plaintextKey := make([]byte, len(ske.encryptedKey))
 	c.XORKeyStream(plaintextKey, ske.encryptedKey)
 	cipherFunc := CipherFunction(plaintextKey[0])
@@ -110,6 +121,35 @@ func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Conf
 		return nil, errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(cipherFunc)))
 	}
 
+	sessionKey := make([]byte, keySize)
+	_, err = io.ReadFull(config.Random(), sessionKey)
+	if err != nil {
+		return
+	}
+
+	err = SerializeSymmetricKeyEncryptedReuseKey(w, sessionKey, cipherFunc, passphrase, config)
+	if err != nil {
+		return
+	}
+
+	key = sessionKey
+	return
+}
+
+// SerializeSymmetricKeyEncryptedReuseKey serializes a symmetric key packet to
+// w that holds sessionKey, a key for cipherFunc, encrypted by a key derived
+// from the given passphrase. This allows a message that is also encrypted to
+// public keys to be decrypted with a passphrase as well.
+// If config is nil, sensible defaults will be used.
+func SerializeSymmetricKeyEncryptedReuseKey(w io.Writer, sessionKey []byte, cipherFunc CipherFunction, passphrase []byte, config *Config) (err error) {
+	keySize := cipherFunc.KeySize()
+	if keySize == 0 {
+		return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(cipherFunc)))
+	}
+	if len(sessionKey) != keySize {
+		return errors.InvalidArgumentError("SymmetricKeyEncrypted: bad session key length")
+	}
+
 	s2kBuf := new(bytes.Buffer)
 	keyEncryptingKey := make([]byte, keySize)
 	// s2k.Serialize salts and stretches the passphrase, and writes the
@@ -120,6 +160,18 @@ func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Conf
 	}
 	s2kBytes := s2kBuf.Bytes()
 
+	// Encrypt the session key before writing anything, so that a failing
+	// cipher factory doesn't leave a partial packet behind.
+	block, err := config.newCipher(cipherFunc, keyEncryptingKey)
+	if err != nil {
+		return
+	}
+	iv := make([]byte, cipherFunc.blockSize())
+	c := cipher.NewCFBEncrypter(block, iv)
+	encryptedCipherAndKey := make([]byte, keySize+1)
+	c.XORKeyStream(encryptedCipherAndKey, []byte{byte(cipherFunc)})
+	c.XORKeyStream(encryptedCipherAndKey[1:], sessionKey)
+
 	packetLength := 2 /* header */ + len(s2kBytes) + 1 /* cipher type */ + keySize
 	err = serializeHeader(w, packetTypeSymmetricKeyEncrypted, packetLength)
 	if err != nil {
@@ -137,22 +189,6 @@ func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Conf
 	if err != nil {
 		return
 	}
-
-	sessionKey := make([]byte, keySize)
-	_, err = io.ReadFull(config.Random(), sessionKey)
-	if err != nil {
-		return
-	}
-	iv := make([]byte, cipherFunc.blockSize())
-	c := cipher.NewCFBEncrypter(cipherFunc.new(keyEncryptingKey), iv)
-	encryptedCipherAndKey := make([]byte, keySize+1)
-	c.XORKeyStream(encryptedCipherAndKey, buf[1:])
-	c.XORKeyStream(encryptedCipherAndKey[1:], sessionKey)
 	_, err = w.Write(encryptedCipherAndKey)
-	if err != nil {
-		return
-	}
-
-	key = sessionKey
 	return
 }
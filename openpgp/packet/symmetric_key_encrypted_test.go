@@ -6,7 +6,9 @@ package packet
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"encoding/hex"
+	"errors"
 	"io"
 	"io/ioutil"
 	"testing"
@@ -115,3 +117,26 @@ func TestSerializeSymmetricKeyEncryptedCiphers(t *testing.T) {
 		}
 	}
 }
+
+func TestSerializeCipherFactoryFailure(t *testing.T) {
+	errFactory := errors.New("no cipher")
+	config := &Config{CipherFactory: func(CipherFunction, []byte) (cipher.Block, error) {
+		return nil, errFactory
+	}}
+	key := make([]byte, CipherAES128.KeySize())
+
+	buf := new(bytes.Buffer)
+	if err := SerializeSymmetricKeyEncryptedReuseKey(buf, key, CipherAES128, []byte("password"), config); err != errFactory {
+		t.Errorf("SerializeSymmetricKeyEncryptedReuseKey: got %v, want the factory's error", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("SerializeSymmetricKeyEncryptedReuseKey: wrote %d bytes before failing", buf.Len())
+	}
+
+	if _, err := SerializeSymmetricallyEncrypted(buf, CipherAES128, key, config); err != errFactory {
+		t.Errorf("SerializeSymmetricallyEncrypted: got %v, want the factory's error", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("SerializeSymmetricallyEncrypted: wrote %d bytes before failing", buf.Len())
+	}
+}
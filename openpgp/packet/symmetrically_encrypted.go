@@ -46,6 +46,13 @@ func (se *SymmetricallyEncrypted) parse(r io.Reader) error {
 // packet can be read. An incorrect key can, with high probability, be detected
 // immediately and this will result in a KeyIncorrect error being returned.
 func (se *SymmetricallyEncrypted) Decrypt(c CipherFunction, key []byte) (io.ReadCloser, error) {
+	return se.DecryptWithConfig(c, key, nil)
+}
+
+// DecryptWithConfig is like Decrypt but creates the cipher with
+// config.CipherFactory, if it is set.
+// If config is nil, sensible defaults will be used.
+func (se *SymmetricallyEncrypted) DecryptWithConfig(c CipherFunction, key []byte, config *Config) (io.ReadCloser, error) {
 	keySize := c.KeySize()
 	if keySize == 0 {
 		return nil, errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(c)))
@@ -70,7 +77,11 @@ func (se *SymmetricallyEncrypted) Decrypt(c CipherFunction, key []byte) (io.Read
 		ocfbResync = OCFBNoResync
 	}
 
-	s := NewOCFBDecrypter(c.new(key), se.prefix, ocfbResync)
+	block, err := config.newCipher(c, key)
+	if err != nil {
+		return nil, err
+	}
+	s := NewOCFBDecrypter(block, se.prefix, ocfbResync)
 	if s == nil {
 		return nil, errors.ErrKeyIncorrect
 	}
@@ -258,8 +269,13 @@ func SerializeSymmetricallyEncrypted(w io.Writer, c CipherFunction, key []byte,
 	if c.KeySize() != len(key) {
 		return nil, errors.InvalidArgumentError("SymmetricallyEncrypted.Serialize: bad key length")
 	}
+	block, err := config.newCipher(c, key)
+	if err != nil {
+		return
+	}
+
 	writeCloser := noOpCloser{w}
-	ciphertext, err := serializeStreamHeader(writeCloser, packetTypeSymmetricallyEncryptedMDC)
+	ciphertext, err := serializeStreamHeader(writeCloser, packetTypeSymmetricallyEncryptedMDC, config)
 	if err != nil {
 		return
 	}
@@ -269,7 +285,6 @@ func SerializeSymmetricallyEncrypted(w io.Writer, c CipherFunction, key []byte,
 		return
 	}
 
-	block := c.new(key)
 	blockSize := block.BlockSize()
 	iv := make([]byte, blockSize)
 	_, err = config.Random().Read(iv)
@@ -14,6 +14,32 @@ import (
 
 const UserAttrImageSubpacket = 1
 
+// UserAttrImageJPEG is the image encoding of a version 1 image header that
+// holds a JPEG image. See RFC 4880, section 5.12.1.
+const UserAttrImageJPEG = 1
+
+// UserAttributeImage is an image from a user attribute packet.
+type UserAttributeImage struct {
+	// Version is the version of the image header. Only version 1 is
+	// defined.
+	Version byte
+	// Encoding is the image encoding given by a version 1 header, such as
+	// UserAttrImageJPEG. It is zero for other header versions.
+	Encoding byte
+	// Data holds the image itself, without its header. Images in
+	// encodings that aren't known are kept as they are.
+	Data []byte
+}
+
+// MIMEType returns the media type of the image, or
+// "application/octet-stream" if its encoding isn't known.
+func (img *UserAttributeImage) MIMEType() string {
+	if img.Version == 1 && img.Encoding == UserAttrImageJPEG {
+		return "image/jpeg"
+	}
+	return "application/octet-stream"
+}
+
 // UserAttribute is capable of storing other types of data about a user
 // beyond name, email and a text comment. In practice, user attributes are typically used
 // to store a signed thumbnail photo JPEG image of the user.
@@ -89,3 +115,28 @@ func (uat *UserAttribute) ImageData() (imageData [][]byte) {
 	}
 	return
 }
+
+// Images returns the images in the user attribute packet, whatever their
+// encoding. Image subpackets whose header is truncated are skipped.
+func (uat *UserAttribute) Images() (images []UserAttributeImage) {
+	for _, sp := range uat.Contents {
+		if sp.SubType != UserAttrImageSubpacket || len(sp.Contents) < 3 {
+			continue
+		}
+		// RFC 4880, section 5.12.1: a little-endian header length,
+		// which includes the length itself, and a header version.
+		headerLen := int(sp.Contents[0]) | int(sp.Contents[1])<<8
+		if headerLen < 3 || headerLen > len(sp.Contents) {
+			continue
+		}
+		img := UserAttributeImage{
+			Version: sp.Contents[2],
+			Data:    sp.Contents[headerLen:],
+		}
+		if img.Version == 1 && headerLen >= 4 {
+			img.Encoding = sp.Contents[3]
+		}
+		images = append(images, img)
+	}
+	return
+}
@@ -107,3 +107,38 @@ EG8VQHsInbuVcgflRXnt5fIs2FYHgcgUVi8LG+xusdW/mN7U2KgEVkTzPt60UVfQ9eHxGHrV1MGi
 iD4V25x1qvdgLAMd6KK0pbHm4x++dp8FtUubLxJ5EIjMc+A4Za+qfD8pe1JZVOBmiinW3RyRPMfi
 R8QPE638+k2l6LK0Hylbddhb6nOa80mlkcmWR2kcnlnOSaKK7qCXKcNdu5narcSrAoBxvODWJIga
 VckjDdqKKwq/EaQ0gUdbjQ6mr7QGBUcd6tPBC6gtGpOOuKKKie5qn7qIpEXd0HSiiimSf//Z`
+
+func TestUserAttributeImages(t *testing.T) {
+	header := func(encoding byte) []byte {
+		return append([]byte{0x10, 0x00, 0x01, encoding}, make([]byte, 12)...)
+	}
+	jpegData := []byte{0xff, 0xd8, 0xff, 0xe0}
+	otherData := []byte("not a jpeg")
+	uat := NewUserAttribute(
+		&OpaqueSubpacket{SubType: UserAttrImageSubpacket, Contents: append(header(UserAttrImageJPEG), jpegData...)},
+		&OpaqueSubpacket{SubType: UserAttrImageSubpacket, Contents: append(header(0x6e), otherData...)},
+	)
+
+	buf := new(bytes.Buffer)
+	if err := uat.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := p.(*UserAttribute).Images()
+	if len(images) != 2 {
+		t.Fatalf("got %d images, want 2", len(images))
+	}
+	if images[0].MIMEType() != "image/jpeg" || !bytes.Equal(images[0].Data, jpegData) {
+		t.Errorf("JPEG image: got %s %x", images[0].MIMEType(), images[0].Data)
+	}
+	if images[1].Encoding != 0x6e || images[1].MIMEType() != "application/octet-stream" || !bytes.Equal(images[1].Data, otherData) {
+		t.Errorf("unknown image: got encoding %d, %s %q", images[1].Encoding, images[1].MIMEType(), images[1].Data)
+	}
+	// ImageData still returns every image subpacket past a 16-byte header.
+	if imgs := p.(*UserAttribute).ImageData(); len(imgs) != 2 || !bytes.Equal(imgs[0], jpegData) || !bytes.Equal(imgs[1], otherData) {
+		t.Errorf("ImageData: got %x, want both images", imgs)
+	}
+}
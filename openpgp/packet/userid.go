@@ -13,6 +13,10 @@ import (
 // UserId contains text that is intended to represent the name and email
 // address of the key holder. See RFC 4880, section 5.11. By convention, this
 // takes the form "Full Name (Comment) <email@example.com>"
+//
+// The text is kept byte for byte as it appears in the packet, even when it
+// isn't valid UTF-8, as with some legacy keys that use Latin-1, so that
+// re-serializing a UserId doesn't invalidate its self-signatures.
 type UserId struct {
 	Id string // By convention, this takes the form "Full Name (Comment) <email@example.com>" which is split out in the fields below.
 
@@ -71,10 +75,16 @@ func (uid *UserId) parse(r io.Reader) (err error) {
 		return
 	}
 	uid.Id = string(b)
-	uid.Name, uid.Comment, uid.Email = parseUserId(uid.Id)
+	uid.Name, uid.Comment, uid.Email = ParseUserId(uid.Id)
 	return
 }
 
+// Raw returns the contents of the user id packet, exactly as they were read
+// or will be serialized.
+func (uid *UserId) Raw() []byte {
+	return []byte(uid.Id)
+}
+
 // Serialize marshals uid to w in the form of an OpenPGP packet, including
 // header.
 func (uid *UserId) Serialize(w io.Writer) error {
@@ -86,9 +96,11 @@ func (uid *UserId) Serialize(w io.Writer) error {
 	return err
 }
 
-// parseUserId extracts the name, comment and email from a user id string that
-// is formatted as "Full Name (Comment) <email@example.com>".
-func parseUserId(id string) (name, comment, email string) {
+// ParseUserId extracts the name, comment and email from a user id string that
+// is formatted as "Full Name (Comment) <email@example.com>", the same way the
+// fields of a parsed UserId are filled in. Any of the components may be
+// missing, in which case it is returned as the empty string.
+func ParseUserId(id string) (name, comment, email string) {
 	var n, c, e struct {
 		start, end int
 	}
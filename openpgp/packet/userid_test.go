@@ -5,6 +5,7 @@
 package packet
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -24,11 +25,15 @@ var userIdTests = []struct {
 	{"  John Smith  < email > lksdfj", "John Smith", "", "email"},
 	{"(<foo", "", "<foo", ""},
 	{"René Descartes (العربي)", "René Descartes", "العربي", ""},
+	{"<john@example.com>", "", "", "john@example.com"},
+	{"(work) <john@example.com>", "", "work", "john@example.com"},
+	{"John Smith <john@example.com>", "John Smith", "", "john@example.com"},
+	{"John Smith (work) <john@example.com>", "John Smith", "work", "john@example.com"},
 }
 
 func TestParseUserId(t *testing.T) {
 	for i, test := range userIdTests {
-		name, comment, email := parseUserId(test.id)
+		name, comment, email := ParseUserId(test.id)
 		if name != test.name {
 			t.Errorf("%d: name mismatch got:%s want:%s", i, name, test.name)
 		}
@@ -85,3 +90,35 @@ func TestNewUserIdWithInvalidInput(t *testing.T) {
 		}
 	}
 }
+
+func TestUserIdRawBytes(t *testing.T) {
+	// A Latin-1 user id, which isn't valid UTF-8.
+	raw := []byte("J\xfcrgen M\xfcller <jm@example.com>")
+	serialized := append([]byte{0xcd, byte(len(raw))}, raw...)
+
+	p, err := Read(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, ok := p.(*UserId)
+	if !ok {
+		t.Fatalf("got %T, want *UserId", p)
+	}
+	if !bytes.Equal(uid.Raw(), raw) {
+		t.Errorf("Raw() = %q, want %q", uid.Raw(), raw)
+	}
+	if uid.Name != "J\xfcrgen M\xfcller" {
+		t.Errorf("Name = %q", uid.Name)
+	}
+	if uid.Email != "jm@example.com" {
+		t.Errorf("Email = %q", uid.Email)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := uid.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), serialized) {
+		t.Errorf("re-serialized as %x, want %x", buf.Bytes(), serialized)
+	}
+}
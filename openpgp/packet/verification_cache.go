@@ -0,0 +1,44 @@
+package packet
+
+import (
+	"crypto/sha256"
+)
+
+// VerificationCacheKey identifies a single signature verification. Digest
+// covers both the hash of the signed data and the signature values, so two
+// keys are only equal if the same signature was checked over the same data.
+type VerificationCacheKey struct {
+	Digest            [sha256.Size]byte
+	SignerFingerprint [20]byte
+}
+
+// VerificationCache remembers signatures that were previously found to be
+// valid, so that re-verifying a key with many certifications can skip the
+// public key operations. Implementations must be safe for concurrent use if
+// the Config they are attached to is shared between goroutines.
+type VerificationCache interface {
+	// Get reports whether the verification identified by key has
+	// previously succeeded.
+	Get(key VerificationCacheKey) bool
+	// Set records that the verification identified by key succeeded.
+	Set(key VerificationCacheKey)
+}
+
+func (c *Config) verificationCache() VerificationCache {
+	if c == nil {
+		return nil
+	}
+	return c.VerificationCache
+}
+
+// verificationCacheKey returns the key under which a verification of sig by
+// pk over hashBytes is cached.
+func verificationCacheKey(pk *PublicKey, hashBytes []byte, sig *Signature) (key VerificationCacheKey) {
+	h := sha256.New()
+	h.Write(hashBytes)
+	writeMPIs(h, sig.RSASignature, sig.DSASigR, sig.DSASigS,
+		sig.ECDSASigR, sig.ECDSASigS, sig.EdDSASigR, sig.EdDSASigS)
+	h.Sum(key.Digest[:0])
+	key.SignerFingerprint = pk.Fingerprint
+	return
+}
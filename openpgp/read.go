@@ -6,12 +6,16 @@
 package openpgp // import "github.com/keybase/go-crypto/openpgp"
 
 import (
+	"bufio"
 	"crypto"
 	"crypto/hmac"
 	_ "crypto/sha256"
+	"encoding"
 	"hash"
 	"io"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/keybase/go-crypto/openpgp/armor"
 	"github.com/keybase/go-crypto/openpgp/errors"
@@ -41,6 +45,8 @@ type MessageDetails struct {
 	IsEncrypted              bool                // true if the message was encrypted.
 	EncryptedToKeyIds        []uint64            // the list of recipient key ids.
 	IsSymmetricallyEncrypted bool                // true if a passphrase could have decrypted the message.
+	UsedMDC                  bool                // true if the encrypted data is protected by a modification detection code.
+	UsedAEAD                 bool                // true if the encrypted data is an AEAD encrypted data packet.
 	DecryptedWith            Key                 // the private key used to decrypt the message, if any.
 	IsSigned                 bool                // true if the message is signed.
 	SignedByKeyId            uint64              // the key id of the signer, if any.
@@ -57,16 +63,47 @@ type MessageDetails struct {
 	// been consumed. Once EOF has been seen, the following fields are
 	// valid. (An authentication code failure is reported as a
 	// SignatureError error when reading from UnverifiedBody.)
+	//
+	// When SignatureError is nil, the CreationTime of Signature or
+	// SignatureV3 is the verified time the message was signed, which is
+	// the time to keep for trust-on-first-use tracking of SignedBy.
 	SignatureError error               // nil if the signature is good.
 	Signature      *packet.Signature   // the signature packet itself, if v4 (default)
 	SignatureV3    *packet.SignatureV3 // the signature packet if it is a v2 or v3 signature
 
+	// DecryptedCipher is the cipher that the encrypted data was
+	// decrypted with, as given by the session key packet.
+	DecryptedCipher packet.CipherFunction
+
+	// CompressionAlgo is the algorithm of the outermost compressed data
+	// packet of the message, or CompressionNone if it isn't compressed.
+	CompressionAlgo packet.CompressionAlgo
+
 	// Does the Message include multiple signatures? Also called "nested signatures".
 	MultiSig bool
 
+	// Signatures describes each one-pass signature in the message, in
+	// the order that their OnePassSignature packets appear. The
+	// verification results are only valid once UnverifiedBody has been
+	// read to EOF.
+	Signatures []*SignatureDetails
+
 	decrypted io.ReadCloser
 }
 
+// SignatureDetails describes one layer of a signed message.
+type SignatureDetails struct {
+	SignedByKeyId  uint64              // the key id of the signer.
+	SignedBy       *Key                // the key of the signer, if available.
+	SignatureError error               // nil if the signature is good.
+	Signature      *packet.Signature   // the signature packet itself, if v4 (default)
+	SignatureV3    *packet.SignatureV3 // the signature packet if it is a v2 or v3 signature
+
+	h, wrappedHash hash.Hash
+	hashFunc       crypto.Hash // the hash announced by the OnePassSignature.
+	matched        bool
+}
+
 // A PromptFunction is used as a callback by functions that may need to decrypt
 // a private key, or prompt for a passphrase. It is called with a list of
 // acceptable, encrypted private keys and a boolean that indicates whether a
@@ -86,15 +123,17 @@ type keyEnvelopePair struct {
 // ReadMessage parses an OpenPGP message that may be signed and/or encrypted.
 // The given KeyRing should contain both public keys (for signature
 // verification) and, possibly encrypted, private keys for decrypting.
+// If none of the private keys can decrypt the message, the error is an
+// *errors.NoMatchingKeyError, which unwraps to errors.ErrKeyIncorrect.
 // If config is nil, sensible defaults will be used.
 func ReadMessage(r io.Reader, keyring KeyRing, prompt PromptFunction, config *packet.Config) (md *MessageDetails, err error) {
 	var p packet.Packet
 
 	var symKeys []*packet.SymmetricKeyEncrypted
 	var pubKeys []keyEnvelopePair
-	var se *packet.SymmetricallyEncrypted
+	var se encryptedData
 
-	packets := packet.NewReader(r)
+	packets := packet.NewReaderWithConfig(r, config)
 	md = new(MessageDetails)
 	md.IsEncrypted = true
 
@@ -132,20 +171,31 @@ ParsePackets:
 				pubKeys = append(pubKeys, keyEnvelopePair{k, p})
 			}
 		case *packet.SymmetricallyEncrypted:
+			// Without an MDC the ciphertext can be modified
+			// undetectably.
+			if !p.MDC && config != nil && config.RejectUnprotected {
+				return nil, errors.ErrUnprotectedMessage
+			}
 			se = p
+			md.UsedMDC = p.MDC
+			break ParsePackets
+		case *packet.AEADEncrypted:
+			se = aeadEncryptedData{p}
+			md.UsedAEAD = true
 			break ParsePackets
-		case *packet.Compressed, *packet.LiteralData, *packet.OnePassSignature:
+		case *packet.Compressed, *packet.LiteralData, *packet.OnePassSignature, *packet.Signature:
 			// This message isn't encrypted.
 			if len(symKeys) != 0 || len(pubKeys) != 0 {
 				return nil, errors.StructuralError("key material not followed by encrypted message")
 			}
 			packets.Unread(p)
-			return readSignedMessage(packets, nil, keyring)
+			return readSignedMessage(packets, nil, keyring, config)
 		}
 	}
 
 	var candidates []Key
 	var decrypted io.ReadCloser
+	attemptErrs := make(map[uint64]error)
 
 	// Now that we have the list of encrypted keys we need to decrypt at
 	// least one of them or, if we cannot, we need to call the prompt
@@ -163,26 +213,31 @@ FindKey:
 			if !pk.key.PrivateKey.Encrypted {
 				if pk.key.PrivateKey.PrivateKey == nil {
 					// Key is stubbed
+					attemptErrs[pk.key.PublicKey.KeyId] = errors.InvalidArgumentError("private key is stubbed")
 					continue
 				}
 				if len(pk.encryptedKey.Key) == 0 {
 					err := pk.encryptedKey.Decrypt(pk.key.PrivateKey, config)
 					if err != nil {
+						attemptErrs[pk.key.PublicKey.KeyId] = err
 						continue
 					}
 				}
 				if len(pk.encryptedKey.Key) == 0 {
 					continue
 				}
-				decrypted, err = se.Decrypt(pk.encryptedKey.CipherFunc, pk.encryptedKey.Key)
+				decrypted, err = se.DecryptWithConfig(pk.encryptedKey.CipherFunc, pk.encryptedKey.Key, config)
 				if err != nil && err != errors.ErrKeyIncorrect {
 					return nil, err
 				}
 				if decrypted != nil {
 					md.DecryptedWith = pk.key
+					md.DecryptedCipher = pk.encryptedKey.CipherFunc
 					break FindKey
 				}
+				attemptErrs[pk.key.PublicKey.KeyId] = errors.ErrKeyIncorrect
 			} else {
+				attemptErrs[pk.key.PublicKey.KeyId] = errors.InvalidArgumentError("private key is encrypted")
 				fpr := string(pk.key.PublicKey.Fingerprint[:])
 				if v := candidateFingerprints[fpr]; v {
 					continue
@@ -193,11 +248,11 @@ FindKey:
 		}
 
 		if len(candidates) == 0 && len(symKeys) == 0 {
-			return nil, errors.ErrKeyIncorrect
+			return nil, noMatchingKeyError(md, keyring, attemptErrs)
 		}
 
 		if prompt == nil {
-			return nil, errors.ErrKeyIncorrect
+			return nil, noMatchingKeyError(md, keyring, attemptErrs)
 		}
 
 		passphrase, err := prompt(candidates, len(symKeys) != 0)
@@ -208,13 +263,14 @@ FindKey:
 		// Try the symmetric passphrase first
 		if len(symKeys) != 0 && passphrase != nil {
 			for _, s := range symKeys {
-				key, cipherFunc, err := s.Decrypt(passphrase)
+				key, cipherFunc, err := s.DecryptWithConfig(passphrase, config)
 				if err == nil {
-					decrypted, err = se.Decrypt(cipherFunc, key)
+					decrypted, err = se.DecryptWithConfig(cipherFunc, key, config)
 					if err != nil && err != errors.ErrKeyIncorrect {
 						return nil, err
 					}
 					if decrypted != nil {
+						md.DecryptedCipher = cipherFunc
 						break FindKey
 					}
 				}
@@ -227,13 +283,108 @@ FindKey:
 	if err := packets.Push(decrypted); err != nil {
 		return nil, err
 	}
-	return readSignedMessage(packets, md, keyring)
+	return readSignedMessage(packets, md, keyring, config)
+}
+
+// encryptedData is the packet that holds the encrypted contents of a message,
+// which is either a *packet.SymmetricallyEncrypted or an AEAD encrypted data
+// packet.
+type encryptedData interface {
+	DecryptWithConfig(c packet.CipherFunction, key []byte, config *packet.Config) (io.ReadCloser, error)
+}
+
+// aeadEncryptedData adapts a *packet.AEADEncrypted to encryptedData. The
+// packet names its own cipher, so the one given by the session key packet is
+// ignored.
+type aeadEncryptedData struct {
+	*packet.AEADEncrypted
+}
+
+func (ae aeadEncryptedData) DecryptWithConfig(_ packet.CipherFunction, key []byte, config *packet.Config) (io.ReadCloser, error) {
+	return ae.Decrypt(key, config)
+}
+
+// ReadMessageWithSessionKey parses an OpenPGP encrypted message, possibly
+// signed, that is decrypted with the given session key instead of a private
+// key. The session key is typically recovered elsewhere from one of the
+// values returned by ExtractPKESKs. The keyring is only used to verify
+// signatures and may be nil, in which case signatures aren't verified. If
+// config is nil, sensible defaults will be used.
+func ReadMessageWithSessionKey(r io.Reader, cipherFunc packet.CipherFunction, key []byte, keyring KeyRing, config *packet.Config) (md *MessageDetails, err error) {
+	if keyring == nil {
+		keyring = EntityList{}
+	}
+	packets := packet.NewReaderWithConfig(r, config)
+	md = new(MessageDetails)
+	md.IsEncrypted = true
+
+	var se encryptedData
+ParsePackets:
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			return nil, err
+		}
+		switch p := p.(type) {
+		case *packet.SymmetricKeyEncrypted:
+			md.IsSymmetricallyEncrypted = true
+		case *packet.EncryptedKey:
+			md.EncryptedToKeyIds = append(md.EncryptedToKeyIds, p.KeyId)
+		case *packet.SymmetricallyEncrypted:
+			if !p.MDC && config != nil && config.RejectUnprotected {
+				return nil, errors.ErrUnprotectedMessage
+			}
+			se = p
+			md.UsedMDC = p.MDC
+			break ParsePackets
+		case *packet.AEADEncrypted:
+			se = aeadEncryptedData{p}
+			md.UsedAEAD = true
+			break ParsePackets
+		case *packet.Compressed, *packet.LiteralData, *packet.OnePassSignature, *packet.Signature:
+			return nil, errors.InvalidArgumentError("message is not encrypted")
+		}
+	}
+
+	decrypted, err := se.DecryptWithConfig(cipherFunc, key, config)
+	if err != nil {
+		return nil, err
+	}
+	md.DecryptedCipher = cipherFunc
+	md.decrypted = decrypted
+	if err := packets.Push(decrypted); err != nil {
+		return nil, err
+	}
+	return readSignedMessage(packets, md, keyring, config)
+}
+
+// noMatchingKeyError describes why none of the keys in keyring could decrypt
+// the message described by md. attemptErrs holds the error hit with each
+// private key that was tried, by key id. The decryption keys of keyring that
+// aren't recipients of the message are reported as tried too.
+func noMatchingKeyError(md *MessageDetails, keyring KeyRing, attemptErrs map[uint64]error) error {
+	for _, k := range keyring.DecryptionKeys() {
+		if _, ok := attemptErrs[k.PublicKey.KeyId]; !ok {
+			attemptErrs[k.PublicKey.KeyId] = errors.InvalidArgumentError("key is not a recipient of the message")
+		}
+	}
+	tried := make([]uint64, 0, len(attemptErrs))
+	for id := range attemptErrs {
+		tried = append(tried, id)
+	}
+	sort.Slice(tried, func(i, j int) bool { return tried[i] < tried[j] })
+	return &errors.NoMatchingKeyError{
+		EncryptedToKeyIds: md.EncryptedToKeyIds,
+		TriedKeyIds:       tried,
+		Errors:            attemptErrs,
+	}
 }
 
 // readSignedMessage reads a possibly signed message if mdin is non-zero then
 // that structure is updated and returned. Otherwise a fresh MessageDetails is
-// used.
-func readSignedMessage(packets *packet.Reader, mdin *MessageDetails, keyring KeyRing) (md *MessageDetails, err error) {
+// used. If config requires a signature, unsigned messages are rejected with
+// errors.ErrUnsignedMessage.
+func readSignedMessage(packets *packet.Reader, mdin *MessageDetails, keyring KeyRing, config *packet.Config) (md *MessageDetails, err error) {
 	if mdin == nil {
 		mdin = new(MessageDetails)
 	}
@@ -242,6 +393,8 @@ func readSignedMessage(packets *packet.Reader, mdin *MessageDetails, keyring Key
 	var p packet.Packet
 	var h hash.Hash
 	var wrappedHash hash.Hash
+	var prefixSig *packet.Signature
+	var primary *SignatureDetails
 FindLiteralData:
 	for {
 		p, err = packets.Next()
@@ -250,15 +403,42 @@ FindLiteralData:
 		}
 		switch p := p.(type) {
 		case *packet.Compressed:
+			if md.CompressionAlgo == packet.CompressionNone {
+				md.CompressionAlgo = p.Algo
+			}
 			if err := packets.Push(p.Body); err != nil {
 				return nil, err
 			}
 		case *packet.OnePassSignature:
+			layer := &SignatureDetails{SignedByKeyId: p.KeyId, hashFunc: p.Hash}
+			keys, keyErr := signingKeysById(keyring, p.KeyId, nil)
+			if len(keys) > 0 {
+				layer.SignedBy = &keys[0]
+			} else {
+				layer.SignatureError = keyErr
+			}
+			md.Signatures = append(md.Signatures, layer)
+
+			// Only the layer reported in SignedBy must have a usable
+			// hash; the others are checked on a best effort basis.
+			isPrimary := !md.IsSigned || md.SignedBy == nil
+			if isPrimary || layer.SignedBy != nil {
+				layer.h, layer.wrappedHash, err = hashForSignature(p.Hash, p.SigType)
+				if err != nil {
+					if isPrimary {
+						md = nil
+						return
+					}
+					layer.SignatureError = err
+					err = nil
+				}
+			}
+
 			if md.IsSigned {
 				// If IsSigned is set, it means we have multiple
 				// OnePassSignature packets.
 				md.MultiSig = true
-				if md.SignedBy != nil {
+				if !isPrimary {
 					// We've already found the signature we were looking
 					// for, made by key that we had in keyring and can
 					// check signature against. Continue with that instead
@@ -267,6 +447,21 @@ FindLiteralData:
 				}
 			}
 
+			h, wrappedHash = layer.h, layer.wrappedHash
+			md.IsSigned = true
+			prefixSig = nil
+			primary = layer
+			md.SignedByKeyId = p.KeyId
+			md.SignedBy = layer.SignedBy
+		case *packet.Signature:
+			// A signature that precedes the data it covers instead
+			// of being announced by a OnePassSignature packet. See
+			// RFC 4880, section 11.3. It is checked once the literal
+			// data has been read.
+			if md.IsSigned {
+				continue FindLiteralData
+			}
+
 			h, wrappedHash, err = hashForSignature(p.Hash, p.SigType)
 			if err != nil {
 				md = nil
@@ -274,10 +469,16 @@ FindLiteralData:
 			}
 
 			md.IsSigned = true
-			md.SignedByKeyId = p.KeyId
-			keys := keyring.KeysByIdUsage(p.KeyId, nil, packet.KeyFlagSign)
-			if len(keys) > 0 {
-				md.SignedBy = &keys[0]
+			prefixSig = p
+			primary = nil
+			if p.IssuerKeyId != nil {
+				md.SignedByKeyId = *p.IssuerKeyId
+				keys, keyErr := signingKeysById(keyring, *p.IssuerKeyId, p.IssuerFingerprint)
+				if len(keys) > 0 {
+					md.SignedBy = &keys[0]
+				} else if keyErr == errors.ErrKeyCannotSign || keyErr == errors.ErrKeyRevoked {
+					md.SignatureError = keyErr
+				}
 			}
 		case *packet.LiteralData:
 			md.LiteralData = p
@@ -285,8 +486,24 @@ FindLiteralData:
 		}
 	}
 
+	if !md.IsSigned && config != nil && config.RequireSignature {
+		return nil, errors.ErrUnsignedMessage
+	}
+
+	if md.SignedBy == nil && md.SignatureError == nil {
+		// Nothing will verify the signature, but a signer whose key
+		// isn't allowed to sign or is revoked is worth reporting up
+		// front.
+		for _, layer := range md.Signatures {
+			if layer.SignatureError == errors.ErrKeyCannotSign || layer.SignatureError == errors.ErrKeyRevoked {
+				md.SignatureError = layer.SignatureError
+				break
+			}
+		}
+	}
+
 	if md.SignedBy != nil {
-		md.UnverifiedBody = &signatureCheckReader{packets, h, wrappedHash, md}
+		md.UnverifiedBody = &signatureCheckReader{packets, h, wrappedHash, md, prefixSig, primary, config}
 	} else if md.decrypted != nil {
 		md.UnverifiedBody = checkReader{md}
 	} else {
@@ -337,65 +554,56 @@ func (cr checkReader) Read(buf []byte) (n int, err error) {
 
 // signatureCheckReader wraps an io.Reader from a LiteralData packet and hashes
 // the data as it is read. When it sees an EOF from the underlying io.Reader
-// it parses and checks a trailing Signature packet and triggers any MDC checks.
+// it parses and checks the trailing Signature packets and triggers any MDC
+// checks.
 type signatureCheckReader struct {
 	packets        *packet.Reader
 	h, wrappedHash hash.Hash
 	md             *MessageDetails
+	// prefixSig, if not nil, is a signature that was read before the
+	// literal data, so no trailing Signature packet is expected.
+	prefixSig *packet.Signature
+	// primary is the entry of md.Signatures that is reported in the
+	// top-level fields of md.
+	primary *SignatureDetails
+	config  *packet.Config
 }
 
 func (scr *signatureCheckReader) Read(buf []byte) (n int, err error) {
 	n, err = scr.md.LiteralData.Body.Read(buf)
-	scr.wrappedHash.Write(buf[:n])
-	if err == io.EOF {
-		for {
-			var p packet.Packet
-			p, scr.md.SignatureError = scr.packets.Next()
-			if scr.md.SignatureError != nil {
-				if scr.md.MultiSig {
-					// If we are in MultiSig, we might have found other
-					// signature that cannot be verified using our key.
-					// Clear Signature field so it's clear for consumers
-					// that this message failed to verify.
-					scr.md.Signature = nil
-				}
-				return
-			}
-
-			var ok bool
-			if scr.md.Signature, ok = p.(*packet.Signature); ok {
-				var err error
-				if keyID := scr.md.Signature.IssuerKeyId; keyID != nil {
-					if *keyID != scr.md.SignedBy.PublicKey.KeyId {
-						if scr.md.MultiSig {
-							continue // try again to find a sig we can verify
-						}
-						err = errors.StructuralError("bad key id")
-					}
-				}
-				if fingerprint := scr.md.Signature.IssuerFingerprint; fingerprint != nil {
-					if !hmac.Equal(fingerprint, scr.md.SignedBy.PublicKey.Fingerprint[:]) {
-						if scr.md.MultiSig {
-							continue // try again to find a sig we can verify
-						}
-						err = errors.StructuralError("bad key fingerprint")
-					}
-				}
-				if err == nil {
-					err = scr.md.SignedBy.PublicKey.VerifySignature(scr.h, scr.md.Signature)
-				}
-				scr.md.SignatureError = err
-			} else if scr.md.SignatureV3, ok = p.(*packet.SignatureV3); ok {
-				scr.md.SignatureError = scr.md.SignedBy.PublicKey.VerifySignatureV3(scr.h, scr.md.SignatureV3)
-			} else {
-				scr.md.SignatureError = errors.StructuralError("LiteralData not followed by Signature")
-				return
+	if scr.prefixSig != nil {
+		scr.wrappedHash.Write(buf[:n])
+	}
+	for _, layer := range scr.md.Signatures {
+		if layer.wrappedHash != nil {
+			layer.wrappedHash.Write(buf[:n])
+		}
+	}
+	if err == io.EOF && scr.prefixSig != nil {
+		scr.md.Signature = scr.prefixSig
+		scr.md.SignatureError = scr.md.SignedBy.PublicKey.VerifySignature(scr.h, scr.prefixSig)
+		if scr.md.SignatureError == nil {
+			scr.md.SignatureError = checkSignatureTime(scr.prefixSig, scr.config)
+		}
+		if scr.md.SignatureError == nil {
+			scr.md.SignatureError = checkIssuerFingerprint(scr.prefixSig, scr.config)
+		}
+		if scr.md.SignatureError == nil {
+			scr.md.SignatureError = checkKeySize(scr.md.SignedBy.PublicKey, scr.config)
+		}
+		if scr.md.SignatureError == nil {
+			scr.md.SignatureError = checkRevocation(*scr.md.SignedBy, scr.prefixSig)
+		}
+		if scr.md.decrypted != nil {
+			if mdcErr := scr.md.decrypted.Close(); mdcErr != nil {
+				err = mdcErr
 			}
-
-			// Parse only one packet by default, unless message is MultiSig. Then
-			// we ask for more packets after discovering non-matching signature,
-			// until we find one that we can verify.
-			break
+		}
+		return
+	}
+	if err == io.EOF {
+		if !scr.checkTrailingSignatures() {
+			return
 		}
 
 		// The SymmetricallyEncrypted packet, if any, might have an
@@ -411,97 +619,734 @@ func (scr *signatureCheckReader) Read(buf []byte) (n int, err error) {
 	return
 }
 
+// checkTrailingSignatures reads the Signature packets that follow the
+// literal data and verifies each against the layer of md.Signatures it
+// belongs to. Signatures are matched to the innermost layer made by the same
+// key, since nested signatures appear in the reverse order of their
+// OnePassSignature packets. It returns false if the message is malformed.
+func (scr *signatureCheckReader) checkTrailingSignatures() bool {
+	md := scr.md
+	pending := len(md.Signatures)
+	for pending > 0 {
+		p, err := scr.packets.Next()
+		if err != nil {
+			scr.finishUnmatched(err)
+			return false
+		}
+
+		var issuer *uint64
+		switch sig := p.(type) {
+		case *packet.Signature:
+			issuer = sig.IssuerKeyId
+		case *packet.SignatureV3:
+			issuer = &sig.IssuerKeyId
+		default:
+			scr.finishUnmatched(errors.StructuralError("LiteralData not followed by Signature"))
+			return false
+		}
+
+		layer := scr.matchLayer(issuer)
+		if layer == nil {
+			continue
+		}
+		layer.matched = true
+		pending--
+		layer.verify(p, scr.config)
+		if layer == scr.primary {
+			md.Signature, md.SignatureV3 = layer.Signature, layer.SignatureV3
+			md.SignatureError = layer.SignatureError
+		}
+	}
+	return true
+}
+
+// matchLayer returns the innermost unmatched layer of the message that was
+// signed by issuer. If the signature doesn't name its issuer, or the message
+// has a single layer, the innermost unmatched layer is returned instead.
+func (scr *signatureCheckReader) matchLayer(issuer *uint64) *SignatureDetails {
+	var fallback *SignatureDetails
+	for i := len(scr.md.Signatures) - 1; i >= 0; i-- {
+		layer := scr.md.Signatures[i]
+		if layer.matched {
+			continue
+		}
+		if issuer != nil && *issuer == layer.SignedByKeyId {
+			return layer
+		}
+		if fallback == nil {
+			fallback = layer
+		}
+	}
+	if issuer == nil || len(scr.md.Signatures) == 1 {
+		return fallback
+	}
+	return nil
+}
+
+// finishUnmatched records err against every layer that didn't get a
+// signature.
+func (scr *signatureCheckReader) finishUnmatched(err error) {
+	for _, layer := range scr.md.Signatures {
+		if !layer.matched {
+			layer.SignatureError = err
+		}
+	}
+	if scr.primary != nil && !scr.primary.matched {
+		scr.md.Signature = nil
+		scr.md.SignatureError = err
+	}
+}
+
+// verify checks the signature packet p against the signer and hash of the
+// layer, and its creation and expiration times against config, and records
+// the result.
+func (layer *SignatureDetails) verify(p packet.Packet, config *packet.Config) {
+	switch sig := p.(type) {
+	case *packet.Signature:
+		layer.Signature = sig
+	case *packet.SignatureV3:
+		layer.SignatureV3 = sig
+	}
+	if layer.SignedBy == nil || layer.h == nil {
+		// SignatureError already says why this layer can't be checked.
+		return
+	}
+
+	// The literal data was hashed as the OnePassSignature announced, so
+	// a signature over a different hash can't be checked against it.
+	var sigHash crypto.Hash
+	if layer.Signature != nil {
+		sigHash = layer.Signature.Hash
+	} else {
+		sigHash = layer.SignatureV3.Hash
+	}
+	if sigHash != layer.hashFunc {
+		layer.SignatureError = errors.ErrOnePassSignatureHashMismatch
+		return
+	}
+
+	pk := layer.SignedBy.PublicKey
+	if sig := layer.Signature; sig != nil {
+		if keyID := sig.IssuerKeyId; keyID != nil && *keyID != pk.KeyId {
+			layer.SignatureError = errors.StructuralError("bad key id")
+		} else if fingerprint := sig.IssuerFingerprint; fingerprint != nil && !hmac.Equal(fingerprint, pk.Fingerprint[:]) {
+			layer.SignatureError = errors.StructuralError("bad key fingerprint")
+		} else {
+			layer.SignatureError = pk.VerifySignature(layer.h, sig)
+		}
+	} else {
+		layer.SignatureError = pk.VerifySignatureV3(layer.h, layer.SignatureV3)
+	}
+	if layer.SignatureError == nil {
+		layer.SignatureError = checkSignatureTime(p, config)
+	}
+	if layer.SignatureError == nil {
+		layer.SignatureError = checkIssuerFingerprint(p, config)
+	}
+	if layer.SignatureError == nil {
+		layer.SignatureError = checkKeySize(pk, config)
+	}
+	if layer.SignatureError == nil {
+		layer.SignatureError = checkRevocation(*layer.SignedBy, p)
+	}
+}
+
+// checkSignatureTime returns an error if the signature packet p was created
+// after the current time or has expired, allowing for config.ClockSkew.
+// Without a config the times aren't checked, so that callers that don't opt
+// in keep accepting such signatures.
+func checkSignatureTime(p packet.Packet, config *packet.Config) error {
+	if config == nil {
+		return nil
+	}
+	skew := config.ClockSkew
+	now := config.Now()
+
+	var created time.Time
+	switch sig := p.(type) {
+	case *packet.Signature:
+		if sig.SigExpired(now.Add(-skew)) {
+			return errors.ErrSignatureExpired
+		}
+		created = sig.CreationTime
+	case *packet.SignatureV3:
+		created = sig.CreationTime
+	}
+	if created.After(now.Add(skew)) {
+		return errors.SignatureError("signature created in the future")
+	}
+	return nil
+}
+
+// checkIssuerFingerprint returns errors.ErrMissingIssuerFingerprint if
+// config.RequireIssuerFingerprint is set and the signature packet p names
+// its issuer only by key id. V3 signatures can't carry a fingerprint.
+func checkIssuerFingerprint(p packet.Packet, config *packet.Config) error {
+	if config == nil || !config.RequireIssuerFingerprint {
+		return nil
+	}
+	if sig, ok := p.(*packet.Signature); ok && len(sig.IssuerFingerprint) > 0 {
+		return nil
+	}
+	return errors.ErrMissingIssuerFingerprint
+}
+
+// checkRevocation returns errors.ErrKeyRevoked if key was revoked when it
+// made the signature packet p, see Key.revokedAt.
+func checkRevocation(key Key, p packet.Packet) error {
+	var created time.Time
+	switch sig := p.(type) {
+	case *packet.Signature:
+		created = sig.CreationTime
+	case *packet.SignatureV3:
+		created = sig.CreationTime
+	}
+	if key.revokedAt(created) {
+		return errors.ErrKeyRevoked
+	}
+	return nil
+}
+
+// checkKeySize returns an errors.PolicyError if pk is an RSA key smaller than
+// config.MinRSABits.
+func checkKeySize(pk *packet.PublicKey, config *packet.Config) error {
+	if config == nil || config.MinRSABits == 0 {
+		return nil
+	}
+	switch pk.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+	default:
+		return nil
+	}
+	bits, err := pk.BitLength()
+	if err != nil {
+		return err
+	}
+	if int(bits) < config.MinRSABits {
+		return errors.PolicyError("RSA key " + pk.KeyIdString() + " has " + strconv.Itoa(int(bits)) + " bits, fewer than " + strconv.Itoa(config.MinRSABits))
+	}
+	return nil
+}
+
+// signingKeysById returns the keys in keyring that match the given issuer
+// and are allowed to make signatures. Unlike KeysByIdUsage, it keeps keys
+// with a soft revocation, as the signatures they made before they were
+// revoked stay valid; checkRevocation rejects the later ones. If none are
+// found, the error says whether the issuer is unknown, hard-revoked or
+// merely lacks the signing capability.
+func signingKeysById(keyring KeyRing, id uint64, fp []byte) ([]Key, error) {
+	var keys []Key
+	err := errors.ErrUnknownIssuer
+	for _, key := range keyring.KeysById(id, fp) {
+		switch {
+		case key.hardRevoked():
+			if err == errors.ErrUnknownIssuer {
+				err = errors.ErrKeyRevoked
+			}
+		case keyHasUsage(key, id, fp, packet.KeyFlagSign):
+			keys = append(keys, key)
+		default:
+			err = errors.ErrKeyCannotSign
+		}
+	}
+	if len(keys) > 0 {
+		return keys, nil
+	}
+	return nil, err
+}
+
 // CheckDetachedSignature takes a signed file and a detached signature and
-// returns the signer if the signature is valid. If the signer isn't known,
-// ErrUnknownIssuer is returned.
+// returns the signer if the signature is valid. If the detached signature
+// holds several signatures, each of them is tried and the signer of the
+// first one that verifies is returned. If none of the signers are known,
+// ErrUnknownIssuer is returned. If a signer is known but its key isn't
+// allowed to sign, ErrKeyCannotSign is returned, and if its key was revoked
+// when the signature was made, ErrKeyRevoked. A key revoked as superseded
+// or retired still verifies the signatures it made before its revocation.
 func CheckDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signer *Entity, err error) {
-	signer, _, err = checkDetachedSignature(keyring, signed, signature)
+	return CheckDetachedSignatureWithConfig(keyring, signed, signature, nil)
+}
+
+// CheckDetachedSignatureWithConfig is like CheckDetachedSignature, but
+// checks the signatures against the policy in config. If config is nil,
+// sensible defaults will be used.
+func CheckDetachedSignatureWithConfig(keyring KeyRing, signed, signature io.Reader, config *packet.Config) (signer *Entity, err error) {
+	signer, _, err = checkDetachedSignature(keyring, signed, signature, config)
 	return signer, err
 }
 
-func checkDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signer *Entity, issuer *uint64, err error) {
-	var issuerKeyId uint64
+// CheckDetachedSignatures is like CheckDetachedSignature, but returns the
+// signers of every signature in the detached signature that verifies, in
+// the order they appear. Signatures by keys that aren't in keyring are
+// skipped. If no signature verifies, the error is that of the first one
+// that failed.
+func CheckDetachedSignatures(keyring KeyRing, signed, signature io.Reader) (signers []*Entity, err error) {
+	verified, err := checkDetachedSignatures(keyring, signed, signature, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range verified {
+		signers = append(signers, v.signer)
+	}
+	return signers, nil
+}
+
+func checkDetachedSignature(keyring KeyRing, signed, signature io.Reader, config *packet.Config) (signer *Entity, issuer *uint64, err error) {
+	verified, err := checkDetachedSignatures(keyring, signed, signature, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return verified[0].signer, &verified[0].issuerKeyId, nil
+}
+
+// detachedSignature is a signature read from a detached signature, along
+// with the keys that may have made it and the hash of the signed data.
+type detachedSignature struct {
+	p           packet.Packet
+	issuerKeyId uint64
+	keys        []Key
+	hashFunc    crypto.Hash
+	sigType     packet.SignatureType
+	h           hash.Hash
+}
+
+// verifiedSignature is a detached signature that verified.
+type verifiedSignature struct {
+	signer      *Entity
+	issuerKeyId uint64
+}
+
+// newDetachedSignature looks up the keys in keyring that may have made the
+// signature packet p. It returns ErrUnknownIssuer, ErrKeyRevoked or
+// ErrKeyCannotSign if there are none.
+func newDetachedSignature(keyring KeyRing, p packet.Packet) (*detachedSignature, error) {
+	sig := &detachedSignature{p: p}
 	var issuerFingerprint []byte
-	var hashFunc crypto.Hash
-	var sigType packet.SignatureType
-	var keys []Key
-	var p packet.Packet
+	switch p := p.(type) {
+	case *packet.Signature:
+		if p.IssuerKeyId == nil {
+			return nil, errors.StructuralError("signature doesn't have an issuer")
+		}
+		sig.issuerKeyId = *p.IssuerKeyId
+		sig.hashFunc = p.Hash
+		sig.sigType = p.SigType
+		issuerFingerprint = p.IssuerFingerprint
+	case *packet.SignatureV3:
+		sig.issuerKeyId = p.IssuerKeyId
+		sig.hashFunc = p.Hash
+		sig.sigType = p.SigType
+	default:
+		return nil, errors.StructuralError("non signature packet found")
+	}
+
+	keys, err := signingKeysById(keyring, sig.issuerKeyId, issuerFingerprint)
+	if len(keys) == 0 {
+		return nil, err
+	}
+	sig.keys = keys
+	return sig, nil
+}
+
+// verify checks sig against the hash of the signed data, which must have
+// been written in full, and returns the entity that made it.
+func (sig *detachedSignature) verify(config *packet.Config) (signer *Entity, err error) {
+	for _, key := range sig.keys {
+		switch p := sig.p.(type) {
+		case *packet.Signature:
+			err = key.PublicKey.VerifySignature(sig.h, p)
+		case *packet.SignatureV3:
+			err = key.PublicKey.VerifySignatureV3(sig.h, p)
+		default:
+			panic("unreachable")
+		}
+		if err == nil {
+			err = checkSignatureTime(sig.p, config)
+			if err == nil {
+				err = checkIssuerFingerprint(sig.p, config)
+			}
+			if err == nil {
+				err = checkKeySize(key.PublicKey, config)
+			}
+			if err == nil {
+				err = checkRevocation(key, sig.p)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return key.Entity, nil
+		}
+	}
+	return nil, err
+}
+
+// checkDetachedSignatures verifies every signature in signature whose
+// issuer is in keyring against signed, which is only read once.
+func checkDetachedSignatures(keyring KeyRing, signed, signature io.Reader, config *packet.Config) ([]verifiedSignature, error) {
+	var sigs []*detachedSignature
+	var hashes []io.Writer
+
+	// The error to return if no signature can be checked at all.
+	noSignatureErr := errors.ErrUnknownIssuer
 
 	packets := packet.NewReader(signature)
 	for {
-		p, err = packets.Next()
+		p, err := packets.Next()
 		if err == io.EOF {
-			return nil, nil, errors.ErrUnknownIssuer
+			break
 		}
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
-		switch sig := p.(type) {
-		case *packet.Signature:
-			if sig.IssuerKeyId == nil {
-				return nil, nil, errors.StructuralError("signature doesn't have an issuer")
+		sig, err := newDetachedSignature(keyring, p)
+		if err == errors.ErrUnknownIssuer || err == errors.ErrKeyCannotSign || err == errors.ErrKeyRevoked {
+			if err != errors.ErrUnknownIssuer && noSignatureErr == errors.ErrUnknownIssuer {
+				noSignatureErr = err
 			}
-			issuerKeyId = *sig.IssuerKeyId
-			hashFunc = sig.Hash
-			sigType = sig.SigType
-			issuerFingerprint = sig.IssuerFingerprint
-		case *packet.SignatureV3:
-			issuerKeyId = sig.IssuerKeyId
-			hashFunc = sig.Hash
-			sigType = sig.SigType
-		default:
-			return nil, nil, errors.StructuralError("non signature packet found")
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
 
-		keys = keyring.KeysByIdUsage(issuerKeyId, issuerFingerprint, packet.KeyFlagSign)
-		if len(keys) > 0 {
-			break
+		h, wrappedHash, err := hashForSignature(sig.hashFunc, sig.sigType)
+		if err != nil {
+			noSignatureErr = err
+			continue
 		}
+		sig.h = h
+		sigs = append(sigs, sig)
+		hashes = append(hashes, wrappedHash)
 	}
 
-	if len(keys) == 0 {
-		panic("unreachable")
+	if len(sigs) == 0 {
+		return nil, noSignatureErr
 	}
 
-	h, wrappedHash, err := hashForSignature(hashFunc, sigType)
-	if err != nil {
-		return nil, nil, err
+	if _, err := io.Copy(io.MultiWriter(hashes...), signed); err != nil && err != io.EOF {
+		return nil, err
 	}
 
-	if _, err := io.Copy(wrappedHash, signed); err != nil && err != io.EOF {
-		return nil, nil, err
+	var verified []verifiedSignature
+	var firstErr error
+	for _, sig := range sigs {
+		signer, err := sig.verify(config)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		verified = append(verified, verifiedSignature{signer, sig.issuerKeyId})
 	}
 
-	for _, key := range keys {
-		switch sig := p.(type) {
-		case *packet.Signature:
-			err = key.PublicKey.VerifySignature(h, sig)
-		case *packet.SignatureV3:
-			err = key.PublicKey.VerifySignatureV3(h, sig)
-		default:
-			panic("unreachable")
+	if len(verified) == 0 {
+		return nil, firstErr
+	}
+	return verified, nil
+}
+
+// CheckDetachedSignatureHash is like CheckDetachedSignatureWithConfig, but
+// the signed data has already been hashed with hash, for example by the
+// store that holds it. A signature covers the signed data followed by a
+// trailer of its own, so a finished digest can't be verified: digest must
+// be the state of the unfinished hash, as returned by its MarshalBinary
+// method. For text signatures, the data must have been hashed with
+// canonical line endings. Signatures made with a hash other than hash are
+// rejected. If config is nil, sensible defaults will be used.
+func CheckDetachedSignatureHash(kr KeyRing, digest []byte, hash crypto.Hash, sig io.Reader, config *packet.Config) (*Entity, error) {
+	if !hash.Available() {
+		return nil, errors.UnsupportedError("hash function " + strconv.Itoa(int(hash)))
+	}
+	if _, ok := hash.New().(encoding.BinaryUnmarshaler); !ok {
+		return nil, errors.UnsupportedError("hash function " + strconv.Itoa(int(hash)) + " can't restore a digest")
+	}
+
+	// The error to return if no signature can be checked at all.
+	noSignatureErr := errors.ErrUnknownIssuer
+	var firstErr error
+
+	packets := packet.NewReader(sig)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
 		}
 
+		ds, err := newDetachedSignature(kr, p)
+		if err == errors.ErrUnknownIssuer || err == errors.ErrKeyCannotSign || err == errors.ErrKeyRevoked {
+			if err != errors.ErrUnknownIssuer && noSignatureErr == errors.ErrUnknownIssuer {
+				noSignatureErr = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if ds.hashFunc != hash {
+			err = errors.InvalidArgumentError("signature uses hash function " + strconv.Itoa(int(ds.hashFunc)) + ", not " + strconv.Itoa(int(hash)))
+		} else {
+			ds.h = hash.New()
+			err = ds.h.(encoding.BinaryUnmarshaler).UnmarshalBinary(digest)
+			if err != nil {
+				err = errors.InvalidArgumentError("bad digest: " + err.Error())
+			}
+		}
 		if err == nil {
-			return key.Entity, &issuerKeyId, nil
+			var signer *Entity
+			if signer, err = ds.verify(config); err == nil {
+				return signer, nil
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
 		}
 	}
 
-	return nil, nil, err
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, noSignatureErr
+}
+
+// CheckDetachedSignaturesBatch checks many detached signatures, each read
+// from one of sigs, over the same signed data. It returns, for each
+// signature, either its signer or the error that it failed with, as
+// CheckDetachedSignatureWithConfig would. signed is read only once, and it
+// is hashed only once for all of the signatures that use the same hash
+// function and signature type.
+// If config is nil, sensible defaults will be used.
+func CheckDetachedSignaturesBatch(kr KeyRing, signed io.Reader, sigs []io.Reader, config *packet.Config) ([]*Entity, []error) {
+	signers := make([]*Entity, len(sigs))
+	errs := make([]error, len(sigs))
+
+	type digestKey struct {
+		hashFunc crypto.Hash
+		sigType  packet.SignatureType
+	}
+	shared := make(map[digestKey]*sharedDigest)
+	digests := make([]*sharedDigest, len(sigs))
+	var hashes []io.Writer
+
+	for i, r := range sigs {
+		p, err := packet.NewReader(r).Next()
+		if err == io.EOF {
+			err = errors.StructuralError("no signature found")
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		sig, err := newDetachedSignature(kr, p)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		key := digestKey{sig.hashFunc, sig.sigType}
+		d := shared[key]
+		if d == nil {
+			h, wrappedHash, err := hashForSignature(sig.hashFunc, sig.sigType)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			d = &sharedDigest{hashFunc: sig.hashFunc, h: h}
+			hashes = append(hashes, wrappedHash)
+			// A digest whose state can't be copied can't be shared,
+			// so the next signature gets a digest of its own.
+			if _, ok := h.(encoding.BinaryMarshaler); ok {
+				shared[key] = d
+			}
+		}
+		d.users = append(d.users, sig)
+		digests[i] = d
+	}
+
+	if len(hashes) > 0 {
+		if _, err := io.Copy(io.MultiWriter(hashes...), signed); err != nil && err != io.EOF {
+			for i := range digests {
+				if digests[i] != nil {
+					errs[i] = err
+				}
+			}
+			return signers, errs
+		}
+	}
+
+	for i, d := range digests {
+		if d == nil {
+			continue
+		}
+		sig, err := d.take()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		signers[i], errs[i] = sig.verify(config)
+	}
+	return signers, errs
+}
+
+// sharedDigest is the hash of the signed data shared by the detached
+// signatures in users. Checking a signature consumes the hash, so each
+// user but the last is given a copy of it.
+type sharedDigest struct {
+	hashFunc crypto.Hash
+	h        hash.Hash
+	users    []*detachedSignature
+	taken    int
+}
+
+// take returns the next user of d, with its own hash of the signed data.
+// Users must be taken in order.
+func (d *sharedDigest) take() (*detachedSignature, error) {
+	sig := d.users[d.taken]
+	d.taken++
+	if d.taken == len(d.users) {
+		sig.h = d.h
+		return sig, nil
+	}
+	state, err := d.h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	h := d.hashFunc.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	sig.h = h
+	return sig, nil
 }
 
 // CheckArmoredDetachedSignature performs the same actions as
 // CheckDetachedSignature but expects the signature to be armored.
 func CheckArmoredDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signer *Entity, err error) {
-	signer, _, err = checkArmoredDetachedSignature(keyring, signed, signature)
+	signer, _, err = checkArmoredDetachedSignature(keyring, signed, signature, nil)
 	return signer, err
 }
 
-func checkArmoredDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signer *Entity, issuer *uint64, err error) {
+func checkArmoredDetachedSignature(keyring KeyRing, signed, signature io.Reader, config *packet.Config) (signer *Entity, issuer *uint64, err error) {
 	body, err := readArmored(signature, SignatureType)
 	if err != nil {
 		return
 	}
-	return checkDetachedSignature(keyring, signed, body)
+	return checkDetachedSignature(keyring, signed, body, config)
+}
+
+// CheckDetachedSignatureAuto performs the same actions as
+// CheckDetachedSignature, but accepts the signature either armored or in
+// binary form. OpenPGP packets always start with a byte that has its most
+// significant bit set, which never happens for armored text.
+// If config is nil, sensible defaults will be used.
+func CheckDetachedSignatureAuto(keyring KeyRing, signed, signature io.Reader, config *packet.Config) (signer *Entity, err error) {
+	br := bufio.NewReader(signature)
+	armored, err := peekArmored(br)
+	if err != nil {
+		return nil, err
+	}
+	if armored {
+		signer, _, err = checkArmoredDetachedSignature(keyring, signed, br, config)
+	} else {
+		signer, _, err = checkDetachedSignature(keyring, signed, br, config)
+	}
+	return signer, err
+}
+
+// RecipientKeyIds returns the key ids of the recipients of the message in r,
+// which may be armored or binary, and whether the message can also be
+// decrypted with a passphrase. Only the packets that precede the encrypted
+// data are read, and nothing is decrypted. A hidden recipient is reported
+// as key id zero.
+func RecipientKeyIds(armoredOrBinary io.Reader) (keyIds []uint64, symmetric bool, err error) {
+	infos, symmetric, err := readSessionKeyPackets(armoredOrBinary)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, info := range infos {
+		keyIds = append(keyIds, info.KeyId)
+	}
+	return keyIds, symmetric, nil
+}
+
+// PKESKInfo describes a public-key encrypted session key packet. It holds
+// everything needed to recover the session key with the recipient's private
+// key, for example on another machine. See RFC 4880, section 5.1.
+type PKESKInfo struct {
+	KeyId uint64 // the recipient key id, zero for a hidden recipient.
+	Algo  packet.PublicKeyAlgorithm
+
+	// MPIs holds the raw encrypted session key values: one for RSA,
+	// two for ElGamal and the ephemeral point for ECDH.
+	MPIs [][]byte
+	// WrappedKey holds the AES key-wrapped session key for ECDH.
+	WrappedKey []byte
+}
+
+// ExtractPKESKs returns the public-key encrypted session keys of the
+// message in r, which may be armored or binary. Only the packets that
+// precede the encrypted data are read. Once decrypted, a session key can be
+// passed to ReadMessageWithSessionKey.
+func ExtractPKESKs(r io.Reader) ([]PKESKInfo, error) {
+	infos, _, err := readSessionKeyPackets(r)
+	return infos, err
+}
+
+// readSessionKeyPackets reads the packets that precede the encrypted data of
+// the message in r, which may be armored or binary. It returns the
+// public-key encrypted session keys and whether there is a symmetric-key
+// encrypted one too.
+func readSessionKeyPackets(r io.Reader) (infos []PKESKInfo, symmetric bool, err error) {
+	br := bufio.NewReader(r)
+	armored, err := peekArmored(br)
+	if err != nil {
+		return nil, false, err
+	}
+	var body io.Reader = br
+	if armored {
+		if body, err = readArmored(br, "PGP MESSAGE"); err != nil {
+			return nil, false, err
+		}
+	}
+
+	packets := packet.NewReader(body)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			return infos, symmetric, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		switch p := p.(type) {
+		case *packet.EncryptedKey:
+			infos = append(infos, PKESKInfo{
+				KeyId:      p.KeyId,
+				Algo:       p.Algo,
+				MPIs:       p.EncryptedMPIs(),
+				WrappedKey: p.WrappedKey(),
+			})
+		case *packet.SymmetricKeyEncrypted:
+			symmetric = true
+		default:
+			return infos, symmetric, nil
+		}
+	}
+}
+
+// peekArmored reports whether br holds armored rather than binary data,
+// without consuming any of it.
+func peekArmored(br *bufio.Reader) (bool, error) {
+	first, err := br.Peek(1)
+	if err == io.EOF {
+		return false, errors.InvalidArgumentError("no data found")
+	}
+	if err != nil {
+		return false, err
+	}
+	return first[0]&0x80 == 0, nil
 }
@@ -6,8 +6,12 @@ package openpgp
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/sha256"
 	_ "crypto/sha512"
+	"encoding"
 	"encoding/hex"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,6 +22,7 @@ import (
 	"github.com/keybase/go-crypto/openpgp/armor"
 	"github.com/keybase/go-crypto/openpgp/errors"
 	"github.com/keybase/go-crypto/openpgp/packet"
+	"github.com/keybase/go-crypto/rsa"
 )
 
 func readerFromHex(s string) io.Reader {
@@ -132,14 +137,240 @@ func checkSignedMessage(t *testing.T, signedHex, expected string) {
 	}
 }
 
+// onePassSignedMessage builds a message the way a one-pass signer writes
+// it: a one-pass signature packet for every signer, in order, the literal
+// data and then the signatures in the reverse order.
+type onePassSignedMessage struct {
+	signers  []*packet.PrivateKey
+	sigType  packet.SignatureType
+	contents string
+	// signed is the data the signatures are made over, contents if empty.
+	signed string
+	// opsHash is the hash that the one-pass signature packets name and
+	// sigHash the one the signatures use. Both default to SHA-256.
+	opsHash, sigHash crypto.Hash
+}
+
+func (m *onePassSignedMessage) hashes() (opsHash, sigHash crypto.Hash) {
+	opsHash, sigHash = m.opsHash, m.sigHash
+	if opsHash == 0 {
+		opsHash = crypto.SHA256
+	}
+	if sigHash == 0 {
+		sigHash = crypto.SHA256
+	}
+	return
+}
+
+func (m *onePassSignedMessage) writeOnePassSignatures(t *testing.T, w io.Writer) {
+	opsHash, _ := m.hashes()
+	for i, priv := range m.signers {
+		ops := &packet.OnePassSignature{
+			SigType:    m.sigType,
+			Hash:       opsHash,
+			PubKeyAlgo: priv.PubKeyAlgo,
+			KeyId:      priv.KeyId,
+			IsLast:     i == len(m.signers)-1,
+		}
+		if err := ops.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (m *onePassSignedMessage) writeLiteral(t *testing.T, w io.Writer) {
+	lit, err := packet.SerializeLiteral(noOpCloser{w}, m.sigType != packet.SigTypeText, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lit.Write([]byte(m.contents))
+	lit.Close()
+}
+
+func (m *onePassSignedMessage) writeSignatures(t *testing.T, w io.Writer) {
+	_, sigHash := m.hashes()
+	signed := m.signed
+	if signed == "" {
+		signed = m.contents
+	}
+	for i := len(m.signers) - 1; i >= 0; i-- {
+		priv := m.signers[i]
+		sig := &packet.Signature{
+			SigType:      m.sigType,
+			PubKeyAlgo:   priv.PubKeyAlgo,
+			Hash:         sigHash,
+			CreationTime: time.Now(),
+			IssuerKeyId:  &priv.KeyId,
+		}
+		h := sigHash.New()
+		h.Write([]byte(signed))
+		if err := sig.Sign(h, priv, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := sig.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (m *onePassSignedMessage) serialize(t *testing.T) []byte {
+	buf := new(bytes.Buffer)
+	m.writeOnePassSignatures(t, buf)
+	m.writeLiteral(t, buf)
+	m.writeSignatures(t, buf)
+	return buf.Bytes()
+}
+
 func TestSignedMessage(t *testing.T) {
 	checkSignedMessage(t, signedMessageHex, signedInput)
 }
 
+func TestSignatureCreationTime(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	md, err := ReadMessage(readerFromHex(signedMessageHex), kring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError != nil {
+		t.Fatalf("signature error: %s", md.SignatureError)
+	}
+	if want := time.Unix(1295811833, 0); !md.Signature.CreationTime.Equal(want) {
+		t.Errorf("got creation time %s, want %s", md.Signature.CreationTime, want)
+	}
+}
+
 func TestTextSignedMessage(t *testing.T) {
 	checkSignedMessage(t, signedTextMessageHex, signedTextInput)
 }
 
+func TestTextSignedMessageMixedLineEndings(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	signKey, ok := kring[0].signingKey(time.Now())
+	if !ok {
+		t.Fatal("no signing key")
+	}
+	priv := signKey.PrivateKey
+
+	const input = "first line\nsecond line\r\nthird line\n\nlast line"
+	const canonical = "first line\r\nsecond line\r\nthird line\r\n\r\nlast line"
+
+	m := &onePassSignedMessage{
+		signers:  []*packet.PrivateKey{priv},
+		sigType:  packet.SigTypeText,
+		contents: input,
+		signed:   canonical,
+	}
+
+	md, err := ReadMessage(bytes.NewReader(m.serialize(t)), kring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != input {
+		t.Errorf("got %q, want %q: line endings of the literal data should be kept", contents, input)
+	}
+	if md.SignatureError != nil {
+		t.Errorf("signature over the canonical text didn't verify: %s", md.SignatureError)
+	}
+}
+
+func TestCompressedSignedMessageLayouts(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	signKey, ok := kring[0].signingKey(time.Now())
+	if !ok {
+		t.Fatal("no signing key")
+	}
+	priv := signKey.PrivateKey
+
+	m := &onePassSignedMessage{
+		signers:  []*packet.PrivateKey{priv},
+		sigType:  packet.SigTypeBinary,
+		contents: signedInput,
+	}
+	writeOnePass := func(w io.Writer) { m.writeOnePassSignatures(t, w) }
+	writeLiteral := func(w io.Writer) { m.writeLiteral(t, w) }
+	writeSignature := func(w io.Writer) { m.writeSignatures(t, w) }
+	compressed := func(layers ...func(io.Writer)) func(io.Writer) {
+		return func(w io.Writer) {
+			c, err := packet.SerializeCompressed(noOpCloser{w}, packet.CompressionZLIB, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, layer := range layers {
+				layer(c)
+			}
+			c.Close()
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		layers []func(io.Writer)
+	}{
+		{"compressed one-pass", []func(io.Writer){compressed(writeOnePass, writeLiteral, writeSignature)}},
+		{"compressed literal", []func(io.Writer){writeOnePass, compressed(writeLiteral), writeSignature}},
+		{"nested compression", []func(io.Writer){compressed(writeOnePass, compressed(writeLiteral), writeSignature)}},
+		{"compressed prefix signature", []func(io.Writer){compressed(writeSignature, writeLiteral)}},
+		{"prefix signature", []func(io.Writer){writeSignature, compressed(writeLiteral)}},
+	} {
+		buf := new(bytes.Buffer)
+		for _, layer := range test.layers {
+			layer(buf)
+		}
+		t.Logf("checking %s", test.name)
+		checkSignedMessage(t, hex.EncodeToString(buf.Bytes()), signedInput)
+	}
+}
+
+func TestOnePassSignatureHashMismatch(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	signKey, ok := kring[0].signingKey(time.Now())
+	if !ok {
+		t.Fatal("no signing key")
+	}
+	priv := signKey.PrivateKey
+
+	for _, test := range []struct {
+		opsHash, sigHash crypto.Hash
+		wantErr          error
+	}{
+		{crypto.SHA256, crypto.SHA256, nil},
+		{crypto.SHA256, crypto.SHA512, errors.ErrOnePassSignatureHashMismatch},
+		{crypto.SHA512, crypto.SHA256, errors.ErrOnePassSignatureHashMismatch},
+	} {
+		m := &onePassSignedMessage{
+			signers:  []*packet.PrivateKey{priv},
+			sigType:  packet.SigTypeBinary,
+			contents: signedInput,
+			opsHash:  test.opsHash,
+			sigHash:  test.sigHash,
+		}
+		md, err := ReadMessage(bytes.NewReader(m.serialize(t)), kring, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != signedInput {
+			t.Errorf("got %q, want %q", contents, signedInput)
+		}
+		if md.SignatureError != test.wantErr {
+			t.Errorf("one-pass hash %v, signature hash %v: got error %v, want %v", test.opsHash, test.sigHash, md.SignatureError, test.wantErr)
+		}
+		if md.Signature == nil || md.Signature.Hash != test.sigHash {
+			t.Errorf("one-pass hash %v, signature hash %v: trailing signature not reported", test.opsHash, test.sigHash)
+		}
+	}
+}
+
 // The reader should detect "compressed quines", which are compressed
 // packets that expand into themselves and cause an infinite recursive
 // parsing loop.
@@ -212,6 +443,9 @@ func TestSignedEncryptedMessage(t *testing.T) {
 		if !md.IsSigned || md.SignedByKeyId != test.signedByKeyId || md.SignedBy == nil || !md.IsEncrypted || md.IsSymmetricallyEncrypted || len(md.EncryptedToKeyIds) == 0 || md.EncryptedToKeyIds[0] != test.encryptedToKeyId || md.MultiSig {
 			t.Errorf("#%d: bad MessageDetails: %#v", i, md)
 		}
+		if md.DecryptedCipher == 0 {
+			t.Errorf("#%d: the cipher used wasn't reported", i)
+		}
 
 		contents, err := ioutil.ReadAll(md.UnverifiedBody)
 		if err != nil {
@@ -246,6 +480,287 @@ func TestUnspecifiedRecipient(t *testing.T) {
 	}
 }
 
+func TestNoMatchingKeyError(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	for _, subkey := range kring[1].Subkeys {
+		if subkey.PrivateKey.Encrypted {
+			if err := subkey.PrivateKey.Decrypt([]byte("passphrase")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, kring[:1], nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("testing"))
+	w.Close()
+
+	_, err = ReadMessage(bytes.NewReader(buf.Bytes()), kring[1:], nil, nil)
+	noKeyErr, ok := err.(*errors.NoMatchingKeyError)
+	if !ok {
+		t.Fatalf("expected NoMatchingKeyError, got %v", err)
+	}
+
+	wantRecipient, _ := kring[0].encryptionKey(time.Now())
+	if len(noKeyErr.EncryptedToKeyIds) != 1 || noKeyErr.EncryptedToKeyIds[0] != wantRecipient.PublicKey.KeyId {
+		t.Errorf("bad EncryptedToKeyIds: %X", noKeyErr.EncryptedToKeyIds)
+	}
+	// None of the keys in kring[1:] is a recipient, so its decryption
+	// key is reported as tried.
+	decryptionKeys := kring[1:].DecryptionKeys()
+	if len(decryptionKeys) != 1 {
+		t.Fatalf("got %d decryption keys, want 1", len(decryptionKeys))
+	}
+	triedId := decryptionKeys[0].PublicKey.KeyId
+	if len(noKeyErr.TriedKeyIds) != 1 || noKeyErr.TriedKeyIds[0] != triedId || noKeyErr.Errors[triedId] == nil {
+		t.Errorf("bad TriedKeyIds: got %X and %v, want %X", noKeyErr.TriedKeyIds, noKeyErr.Errors, triedId)
+	}
+	if !strings.Contains(noKeyErr.Error(), fmt.Sprintf("tried %X", triedId)) {
+		t.Errorf("error %q doesn't name the tried key", noKeyErr)
+	}
+	if !stderrors.Is(err, errors.ErrKeyIncorrect) {
+		t.Error("NoMatchingKeyError doesn't match ErrKeyIncorrect")
+	}
+
+	// A recipient key whose secret is stubbed out is tried and fails.
+	stubbed := kring[0].Clone()
+	for i := range stubbed.Subkeys {
+		stubbed.Subkeys[i].PrivateKey.PrivateKey = nil
+	}
+	_, err = ReadMessage(bytes.NewReader(buf.Bytes()), EntityList{stubbed}, nil, nil)
+	if noKeyErr, ok = err.(*errors.NoMatchingKeyError); !ok {
+		t.Fatalf("expected NoMatchingKeyError, got %v", err)
+	}
+	if len(noKeyErr.TriedKeyIds) != 1 || noKeyErr.TriedKeyIds[0] != wantRecipient.PublicKey.KeyId {
+		t.Errorf("bad TriedKeyIds: got %X, want %X", noKeyErr.TriedKeyIds, wantRecipient.PublicKey.KeyId)
+	}
+	if noKeyErr.Errors[wantRecipient.PublicKey.KeyId] == nil {
+		t.Errorf("no error recorded for the stubbed key: %v", noKeyErr.Errors)
+	}
+}
+
+func TestRequireSignature(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+
+	for _, signed := range []bool{false, true} {
+		var signer *Entity
+		if signed {
+			signer = kring[0]
+		}
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, kring[:1], signer, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("testing"))
+		w.Close()
+		message := buf.Bytes()
+
+		if _, err := ReadMessage(bytes.NewReader(message), kring, nil, nil); err != nil {
+			t.Errorf("signed=%v: without RequireSignature: %s", signed, err)
+		}
+
+		config := &packet.Config{RequireSignature: true}
+		_, err = ReadMessage(bytes.NewReader(message), kring, nil, config)
+		if signed && err != nil {
+			t.Errorf("signed=%v: with RequireSignature: %s", signed, err)
+		}
+		if !signed && err != errors.ErrUnsignedMessage {
+			t.Errorf("signed=%v: with RequireSignature: got %v, want ErrUnsignedMessage", signed, err)
+		}
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	now := time.Now()
+
+	// The signer's clock is 30 seconds ahead of the verifier's.
+	signConfig := &packet.Config{Time: func() time.Time { return now.Add(30 * time.Second) }}
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, kring[:1], kring[0], nil, signConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("testing"))
+	w.Close()
+	message := buf.Bytes()
+
+	for _, test := range []struct {
+		skew time.Duration
+		ok   bool
+	}{
+		{0, false},
+		{time.Minute, true},
+	} {
+		config := &packet.Config{
+			Time:      func() time.Time { return now },
+			ClockSkew: test.skew,
+		}
+		md, err := ReadMessage(bytes.NewReader(message), kring, nil, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+			t.Fatal(err)
+		}
+		if test.ok && md.SignatureError != nil {
+			t.Errorf("skew %s: unexpected signature error: %s", test.skew, md.SignatureError)
+		}
+		if !test.ok && md.SignatureError == nil {
+			t.Errorf("skew %s: signature from the future was accepted", test.skew)
+		}
+	}
+
+	// Without a config, signature times aren't checked.
+	md, err := ReadMessage(bytes.NewReader(message), kring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError != nil {
+		t.Errorf("no config: unexpected signature error: %s", md.SignatureError)
+	}
+}
+
+func TestUnprotectedMessage(t *testing.T) {
+	prompt := func(keys []Key, symmetric bool) ([]byte, error) {
+		return []byte("testing"), nil
+	}
+
+	md, err := ReadMessage(readerFromHex(rfc2440MessageHex), nil, prompt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "legacy message" {
+		t.Errorf("got %q, want %q", contents, "legacy message")
+	}
+	if md.UsedMDC {
+		t.Error("message without an MDC reported as using one")
+	}
+	if md.DecryptedCipher != packet.CipherCAST5 {
+		t.Errorf("got cipher %d, want CAST5", md.DecryptedCipher)
+	}
+
+	config := &packet.Config{RejectUnprotected: true}
+	if _, err := ReadMessage(readerFromHex(rfc2440MessageHex), nil, prompt, config); err != errors.ErrUnprotectedMessage {
+		t.Errorf("got %v, want ErrUnprotectedMessage", err)
+	}
+}
+
+func TestReadAEADMessage(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encKey, ok := kring[0].encryptionKey(time.Now())
+	if !ok {
+		t.Fatal("no encryption key")
+	}
+	config := &packet.Config{AEADConfig: &packet.AEADConfig{ChunkSizeByte: 1}}
+	sessionKey := make([]byte, packet.CipherAES128.KeySize())
+
+	buf := new(bytes.Buffer)
+	if err := packet.SerializeEncryptedKey(buf, encKey.PublicKey, packet.CipherAES128, sessionKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := packet.SerializeAEADEncrypted(buf, packet.CipherAES128, sessionKey, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal, err := packet.SerializeLiteral(encrypted, true, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := strings.Repeat("AEAD message ", 50)
+	io.WriteString(literal, message)
+	literal.Close()
+
+	md, err := ReadMessage(bytes.NewReader(buf.Bytes()), kring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != message {
+		t.Errorf("got %q, want %q", contents, message)
+	}
+	if !md.UsedAEAD || md.UsedMDC {
+		t.Errorf("got UsedAEAD %v and UsedMDC %v, want true and false", md.UsedAEAD, md.UsedMDC)
+	}
+
+	md, err = ReadMessageWithSessionKey(bytes.NewReader(buf.Bytes()), packet.CipherAES128, sessionKey, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents, err = ioutil.ReadAll(md.UnverifiedBody); err != nil || string(contents) != message {
+		t.Errorf("with the session key: got %q, %v", contents, err)
+	}
+}
+
+func TestSignatureByEncryptionOnlySubkey(t *testing.T) {
+	e := readTestKeys(t)[0]
+	subkey := e.Subkeys[0]
+	if subkey.Sig.FlagSign {
+		t.Fatal("expected an encryption-only subkey")
+	}
+	kring := EntityList{e}
+	message := []byte("signed by the wrong key")
+
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeBinary,
+		PubKeyAlgo:   subkey.PrivateKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &subkey.PrivateKey.KeyId,
+	}
+	h := sig.Hash.New()
+	h.Write(message)
+	if err := sig.Sign(h, subkey.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	sigBuf := new(bytes.Buffer)
+	if err := sig.Serialize(sigBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := CheckDetachedSignature(kring, bytes.NewReader(message), bytes.NewReader(sigBuf.Bytes()))
+	if err != errors.ErrKeyCannotSign {
+		t.Errorf("CheckDetachedSignature: got %v, want ErrKeyCannotSign", err)
+	}
+
+	m := &onePassSignedMessage{
+		signers:  []*packet.PrivateKey{subkey.PrivateKey},
+		sigType:  packet.SigTypeBinary,
+		contents: string(message),
+	}
+
+	md, err := ReadMessage(bytes.NewReader(m.serialize(t)), kring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if md.SignedBy != nil {
+		t.Error("message was attributed to an encryption-only subkey")
+	}
+	if md.SignatureError != errors.ErrKeyCannotSign {
+		t.Errorf("ReadMessage: got %v, want ErrKeyCannotSign", md.SignatureError)
+	}
+}
+
 func TestSymmetricallyEncrypted(t *testing.T) {
 	firstTimeCalled := true
 
@@ -277,6 +792,10 @@ func TestSymmetricallyEncrypted(t *testing.T) {
 		t.Errorf("ReadAll: %s", err)
 	}
 
+	if md.CompressionAlgo != packet.CompressionZIP {
+		t.Errorf("CompressionAlgo is %d, want %d", md.CompressionAlgo, packet.CompressionZIP)
+	}
+
 	expectedCreationTime := uint32(1295992998)
 	if md.LiteralData.Time != expectedCreationTime {
 		t.Errorf("LiteralData.Time is %d, want %d", md.LiteralData.Time, expectedCreationTime)
@@ -320,6 +839,44 @@ func TestDetachedSignature(t *testing.T) {
 	}
 }
 
+func TestCheckDetachedSignatureAuto(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	sigBytes, _ := hex.DecodeString(detachedSignatureHex)
+
+	signer, err := CheckDetachedSignatureAuto(kring, bytes.NewBufferString(signedInput), bytes.NewReader(sigBytes), nil)
+	if err != nil {
+		t.Fatalf("binary signature: %s", err)
+	}
+	if signer == nil || signer.PrimaryKey.KeyId != testKey1KeyId {
+		t.Errorf("binary signature: wrong signer: %#v", signer)
+	}
+
+	armored := new(bytes.Buffer)
+	w, err := armor.Encode(armored, SignatureType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(sigBytes)
+	w.Close()
+
+	signer, err = CheckDetachedSignatureAuto(kring, bytes.NewBufferString(signedInput), bytes.NewReader(armored.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("armored signature: %s", err)
+	}
+	if signer == nil || signer.PrimaryKey.KeyId != testKey1KeyId {
+		t.Errorf("armored signature: wrong signer: %#v", signer)
+	}
+
+	_, err = CheckDetachedSignatureAuto(kring, bytes.NewBufferString(signedInput+"X"), bytes.NewReader(armored.Bytes()), nil)
+	if err == nil {
+		t.Error("armored signature over wrong input verified")
+	}
+	_, err = CheckDetachedSignatureAuto(kring, bytes.NewBufferString(signedInput), strings.NewReader(""), nil)
+	if err == nil {
+		t.Error("empty signature verified")
+	}
+}
+
 func TestDetachedSignatureDSA(t *testing.T) {
 	kring, _ := ReadKeyRing(readerFromHex(dsaTestKeyHex))
 	testDetachedSignature(t, kring, readerFromHex(detachedSignatureDSAHex), signedInput, "binary", testKey3KeyId)
@@ -330,6 +887,128 @@ func TestMultipleSignaturePacketsDSA(t *testing.T) {
 	testDetachedSignature(t, kring, readerFromHex(missingHashFunctionHex+detachedSignatureDSAHex), signedInput, "binary", testKey3KeyId)
 }
 
+func TestStackedDetachedSignatures(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	other := readDSATestKey(t)
+
+	// The first signature is by a key that isn't in kring.
+	sigs := new(bytes.Buffer)
+	for _, signer := range []*Entity{other, kring[0]} {
+		if err := DetachSign(sigs, signer, strings.NewReader(signedInput), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testDetachedSignature(t, kring, bytes.NewReader(sigs.Bytes()), signedInput, "stacked", testKey1KeyId)
+
+	signers, err := CheckDetachedSignatures(kring, strings.NewReader(signedInput), bytes.NewReader(sigs.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signers) != 1 || signers[0] != kring[0] {
+		t.Errorf("got %d signers, want only the key in the keyring", len(signers))
+	}
+
+	both := append(EntityList{other}, kring...)
+	signers, err = CheckDetachedSignatures(both, strings.NewReader(signedInput), bytes.NewReader(sigs.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signers) != 2 || signers[0] != other || signers[1] != kring[0] {
+		t.Errorf("got %d signers, want both, in order", len(signers))
+	}
+
+	_, err = CheckDetachedSignatures(kring, strings.NewReader(signedInput+"X"), bytes.NewReader(sigs.Bytes()))
+	if err == nil || err == errors.ErrUnknownIssuer {
+		t.Errorf("got %v for a bad signature by a known key", err)
+	}
+}
+
+func TestSignatureByRevokedKey(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := kring[0]
+	signedAt := time.Unix(1500000000, 0)
+	config := &packet.Config{Time: func() time.Time { return signedAt }}
+
+	sig := new(bytes.Buffer)
+	if err := DetachSign(sig, signer, bytes.NewBufferString(signedInput), config); err != nil {
+		t.Fatal(err)
+	}
+	msg := new(bytes.Buffer)
+	w, err := Encrypt(msg, kring[:1], signer, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, signedInput)
+	w.Close()
+
+	superseded, compromised := uint8(1), uint8(2)
+	for _, test := range []struct {
+		name      string
+		reason    *uint8
+		revokedAt time.Time
+		wantErr   error
+	}{
+		{"soft revocation after signing", &superseded, signedAt.Add(time.Hour), nil},
+		{"soft revocation before signing", &superseded, signedAt.Add(-time.Hour), errors.ErrKeyRevoked},
+		{"hard revocation after signing", &compromised, signedAt.Add(time.Hour), errors.ErrKeyRevoked},
+		{"revocation without a reason", nil, signedAt.Add(time.Hour), errors.ErrKeyRevoked},
+	} {
+		signer.Revocations = []*packet.Signature{{
+			SigType:          packet.SigTypeKeyRevocation,
+			CreationTime:     test.revokedAt,
+			RevocationReason: test.reason,
+		}}
+
+		_, err := CheckDetachedSignature(kring, bytes.NewBufferString(signedInput), bytes.NewReader(sig.Bytes()))
+		if err != test.wantErr {
+			t.Errorf("%s: CheckDetachedSignature returned %v, want %v", test.name, err, test.wantErr)
+		}
+
+		md, err := ReadMessage(bytes.NewReader(msg.Bytes()), kring, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if md.SignatureError != test.wantErr {
+			t.Errorf("%s: ReadMessage signature error is %v, want %v", test.name, md.SignatureError, test.wantErr)
+		}
+	}
+}
+
+func TestCheckDetachedSignaturesBatch(t *testing.T) {
+	kring := readTestKeys(t)
+	other := readDSATestKey(t)
+
+	var sigs []io.Reader
+	for _, signer := range []*Entity{kring[0], other, kring[1]} {
+		sig := new(bytes.Buffer)
+		if err := DetachSign(sig, signer, strings.NewReader(signedInput), nil); err != nil {
+			t.Fatal(err)
+		}
+		sigs = append(sigs, sig)
+	}
+
+	signers, errs := CheckDetachedSignaturesBatch(kring, strings.NewReader(signedInput), sigs, nil)
+	if len(signers) != 3 || len(errs) != 3 {
+		t.Fatalf("got %d signers and %d errors, want 3 of each", len(signers), len(errs))
+	}
+	if signers[0] != kring[0] || errs[0] != nil {
+		t.Errorf("first signature: got signer %v, error %v", signers[0], errs[0])
+	}
+	if signers[1] != nil || errs[1] != errors.ErrUnknownIssuer {
+		t.Errorf("unknown signer: got signer %v, error %v", signers[1], errs[1])
+	}
+	if signers[2] != kring[1] || errs[2] != nil {
+		t.Errorf("third signature: got signer %v, error %v", signers[2], errs[2])
+	}
+}
+
 func testHashFunctionError(t *testing.T, signatureHex string) {
 	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
 	_, err := CheckDetachedSignature(kring, nil, readerFromHex(signatureHex))
@@ -418,6 +1097,40 @@ func TestSigningSubkey(t *testing.T) {
 	}
 }
 
+func TestEntityTestPassphrase(t *testing.T) {
+	el, err := ReadArmoredKeyRing(bytes.NewBufferString(signingSubkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := el[0]
+	if e.TestPassphrase([]byte(signingSubkeyPassphrase + "X")) {
+		t.Error("wrong passphrase accepted")
+	}
+	if !e.TestPassphrase([]byte(signingSubkeyPassphrase)) {
+		t.Error("correct passphrase rejected")
+	}
+	if !e.PrivateKey.Encrypted || e.PrivateKey.PrivateKey != nil {
+		t.Error("testing the passphrase decrypted the primary key")
+	}
+	for i, subkey := range e.Subkeys {
+		if !subkey.PrivateKey.Encrypted || subkey.PrivateKey.PrivateKey != nil {
+			t.Errorf("testing the passphrase decrypted subkey %d", i)
+		}
+	}
+
+	// With an offline primary key, the subkeys hold the passphrase.
+	dummy, err := ReadArmoredKeyRing(bytes.NewBufferString(gnuDummyS2KPrivateKeyWithSigningSubkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dummy[0].TestPassphrase([]byte(gnuDummyS2KPrivateKeyWithSigningSubkeyPassphrase)) {
+		t.Error("correct passphrase rejected for a key with a GNU dummy primary")
+	}
+	if dummy[0].TestPassphrase([]byte("wrong")) {
+		t.Error("wrong passphrase accepted for a key with a GNU dummy primary")
+	}
+}
+
 func openPrivateKey(t *testing.T, armoredKey string, passphrase string, protected bool, nSubkeys int) *Entity {
 	el, err := ReadArmoredKeyRing(bytes.NewBufferString(armoredKey))
 	if err != nil {
@@ -723,7 +1436,7 @@ func testSignWithRevokedSubkey(t *testing.T, privArmored, pubArmored, passphrase
 	}
 	var ring EntityList
 	ring = append(ring, priv)
-	signer, issuer, err := checkArmoredDetachedSignature(ring, strings.NewReader(detachedMsg), strings.NewReader(sig))
+	signer, issuer, err := checkArmoredDetachedSignature(ring, strings.NewReader(detachedMsg), strings.NewReader(sig), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -756,7 +1469,7 @@ func testSignWithRevokedSubkey(t *testing.T, privArmored, pubArmored, passphrase
 	}
 	var ring2 EntityList
 	ring2 = append(ring2, priv2)
-	signer, issuer, err = checkArmoredDetachedSignature(ring2, strings.NewReader(detachedMsg), strings.NewReader(sig))
+	signer, issuer, err = checkArmoredDetachedSignature(ring2, strings.NewReader(detachedMsg), strings.NewReader(sig), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -922,6 +1635,282 @@ func TestSignedTextMessageNoSignature(t *testing.T) {
 	t.Logf("SignatureError is: %s", md.SignatureError)
 }
 
+func TestRecipientKeyIds(t *testing.T) {
+	binary, _ := hex.DecodeString(signedEncryptedMessageHex)
+	var armored bytes.Buffer
+	w, _ := armor.Encode(&armored, "PGP MESSAGE", nil)
+	w.Write(binary)
+	w.Close()
+
+	for _, r := range []io.Reader{bytes.NewReader(binary), &armored} {
+		keyIds, symmetric, err := RecipientKeyIds(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keyIds) != 1 || keyIds[0] != 0x2a67d68660df41c7 || symmetric {
+			t.Errorf("got key ids %x, symmetric %t", keyIds, symmetric)
+		}
+	}
+
+	keyIds, _, err := RecipientKeyIds(readerFromHex(recipientUnspecifiedHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyIds) != 1 || keyIds[0] != 0 {
+		t.Errorf("got key ids %x for a hidden recipient, want [0]", keyIds)
+	}
+
+	var buf bytes.Buffer
+	plaintext, err := SymmetricallyEncrypt(&buf, []byte("password"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext.Write([]byte("hello"))
+	plaintext.Close()
+	keyIds, symmetric, err := RecipientKeyIds(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyIds) != 0 || !symmetric {
+		t.Errorf("got key ids %x, symmetric %t for a passphrase-encrypted message", keyIds, symmetric)
+	}
+}
+
+func TestReadMessageUnsupportedCompression(t *testing.T) {
+	// A compressed data packet of indeterminate length using the
+	// private/experimental compression algorithm 110.
+	message := []byte{0xa3, 110, 0x01, 0x02, 0x03}
+	_, err := ReadMessage(bytes.NewReader(message), EntityList{}, nil, nil)
+	if _, ok := err.(errors.UnsupportedError); !ok {
+		t.Fatalf("got %v, want UnsupportedError", err)
+	}
+	if !strings.Contains(err.Error(), "compression algorithm 110") {
+		t.Errorf("error %q doesn't name the compression algorithm", err)
+	}
+}
+
+func TestReadMessageWithExtractedSessionKey(t *testing.T) {
+	e := readTestKeys(t)[0]
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, EntityList{e}, e, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const message = "decrypted on another machine"
+	w.Write([]byte(message))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := buf.Bytes()
+
+	infos, err := ExtractPKESKs(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subkey := e.Subkeys[0].PrivateKey
+	if len(infos) != 1 || infos[0].KeyId != subkey.KeyId || infos[0].Algo != packet.PubKeyAlgoRSA || len(infos[0].MPIs) != 1 {
+		t.Fatalf("got %+v", infos)
+	}
+
+	// What the offline machine does with the extracted MPI.
+	priv := subkey.PrivateKey.(*rsa.PrivateKey)
+	c := make([]byte, (priv.N.BitLen()+7)/8)
+	copy(c[len(c)-len(infos[0].MPIs[0]):], infos[0].MPIs[0])
+	b, err := rsa.DecryptPKCS1v15(nil, priv, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipherFunc, key := packet.CipherFunction(b[0]), b[1:len(b)-2]
+
+	md, err := ReadMessageWithSessionKey(bytes.NewReader(ciphertext), cipherFunc, key, EntityList{e}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != message {
+		t.Errorf("got %q, want %q", contents, message)
+	}
+	if !md.IsSigned || md.SignatureError != nil || md.DecryptedCipher != cipherFunc {
+		t.Errorf("IsSigned %t, SignatureError %v, DecryptedCipher %d", md.IsSigned, md.SignatureError, md.DecryptedCipher)
+	}
+
+	// Without a keyring, the signature can't be checked.
+	md, err = ReadMessageWithSessionKey(bytes.NewReader(ciphertext), cipherFunc, key, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsSigned || md.SignedBy != nil || md.SignedByKeyId != e.PrimaryKey.KeyId {
+		t.Errorf("without a keyring: IsSigned %t, SignedBy %v, SignedByKeyId %x", md.IsSigned, md.SignedBy, md.SignedByKeyId)
+	}
+
+	key[0] ^= 1
+	if _, err := ReadMessageWithSessionKey(bytes.NewReader(ciphertext), cipherFunc, key, nil, nil); err != errors.ErrKeyIncorrect {
+		t.Errorf("got %v with a wrong session key, want ErrKeyIncorrect", err)
+	}
+}
+
+func TestCheckDetachedSignatureHash(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	out := new(bytes.Buffer)
+	if err := DetachSign(out, kring[0], strings.NewReader(signedInput), &packet.Config{DefaultHash: crypto.SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	signature := out.Bytes()
+
+	h := sha256.New()
+	h.Write([]byte(signedInput))
+	digest, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := CheckDetachedSignatureHash(kring, digest, crypto.SHA256, bytes.NewReader(signature), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.PrimaryKey.KeyId != testKey1KeyId {
+		t.Errorf("got signer %x, want %x", signer.PrimaryKey.KeyId, uint64(testKey1KeyId))
+	}
+
+	if _, err := CheckDetachedSignatureHash(kring, digest, crypto.SHA512, bytes.NewReader(signature), nil); err == nil {
+		t.Error("signature verified against a digest made with another hash")
+	}
+
+	h.Write([]byte("tampered"))
+	digest, _ = h.(encoding.BinaryMarshaler).MarshalBinary()
+	if _, err := CheckDetachedSignatureHash(kring, digest, crypto.SHA256, bytes.NewReader(signature), nil); err == nil {
+		t.Error("signature verified against the digest of other data")
+	}
+}
+
+func TestDetachedSignatureHashIndependentOfSelfSignature(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if h := kring[0].PrimaryIdentity().SelfSignature.Hash; h != crypto.SHA1 {
+		t.Fatalf("self-signature uses %s, want SHA-1", h)
+	}
+
+	for _, h := range []crypto.Hash{crypto.SHA256, crypto.SHA512} {
+		out := new(bytes.Buffer)
+		if err := DetachSign(out, kring[0], strings.NewReader(signedInput), &packet.Config{DefaultHash: h}); err != nil {
+			t.Fatal(err)
+		}
+		p, err := packet.Read(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig := p.(*packet.Signature); sig.Hash != h {
+			t.Errorf("signature uses %s, want %s", sig.Hash, h)
+		}
+		testDetachedSignature(t, kring, out, signedInput, h.String(), testKey1KeyId)
+	}
+}
+
+func TestRequireIssuerFingerprint(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	config := &packet.Config{RequireIssuerFingerprint: true}
+
+	// Signatures made by this package carry the issuer fingerprint.
+	sig := new(bytes.Buffer)
+	if err := DetachSign(sig, kring[0], strings.NewReader(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := CheckDetachedSignatureWithConfig(kring, strings.NewReader(signedInput), sig, config)
+	if err != nil || signer == nil || signer.PrimaryKey.KeyId != testKey1KeyId {
+		t.Errorf("signature with a fingerprint: got %v, %v", signer, err)
+	}
+
+	// The older fixtures only carry the key id.
+	_, err = CheckDetachedSignatureWithConfig(kring, strings.NewReader(signedInput), readerFromHex(detachedSignatureHex), config)
+	if err != errors.ErrMissingIssuerFingerprint {
+		t.Errorf("detached signature without a fingerprint: got %v, want ErrMissingIssuerFingerprint", err)
+	}
+	if _, err := CheckDetachedSignature(kring, strings.NewReader(signedInput), readerFromHex(detachedSignatureHex)); err != nil {
+		t.Errorf("detached signature without a fingerprint and no policy: %s", err)
+	}
+
+	md, err := ReadMessage(readerFromHex(signedMessageHex), kring, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError != errors.ErrMissingIssuerFingerprint {
+		t.Errorf("message without a fingerprint: got %v, want ErrMissingIssuerFingerprint", md.SignatureError)
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, kring[:1], kring[0], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(signedInput))
+	w.Close()
+	md, err = ReadMessage(buf, kring, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError != nil {
+		t.Errorf("message with a fingerprint: %s", md.SignatureError)
+	}
+}
+
+func TestMinRSABits(t *testing.T) {
+	e := readTestKeys(t)[0]
+	kring := EntityList{e}
+	policy := &packet.Config{MinRSABits: 2048}
+
+	sig := new(bytes.Buffer)
+	if err := DetachSign(sig, e, strings.NewReader(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := CheckDetachedSignatureWithConfig(kring, strings.NewReader(signedInput), bytes.NewReader(sig.Bytes()), policy)
+	if _, ok := err.(errors.PolicyError); !ok {
+		t.Errorf("detached signature by a 1024 bit key: got %v, want a PolicyError", err)
+	}
+	for _, config := range []*packet.Config{nil, {MinRSABits: 1024}} {
+		if _, err := CheckDetachedSignatureWithConfig(kring, strings.NewReader(signedInput), bytes.NewReader(sig.Bytes()), config); err != nil {
+			t.Errorf("detached signature with config %+v: %s", config, err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, kring, e, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(signedInput))
+	w.Close()
+	for _, test := range []struct {
+		config *packet.Config
+		ok     bool
+	}{
+		{nil, true},
+		{policy, false},
+	} {
+		md, err := ReadMessage(bytes.NewReader(buf.Bytes()), kring, nil, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+			t.Fatal(err)
+		}
+		_, rejected := md.SignatureError.(errors.PolicyError)
+		if test.ok && md.SignatureError != nil || !test.ok && !rejected {
+			t.Errorf("signed message with config %+v: got %v", test.config, md.SignatureError)
+		}
+	}
+}
+
 const testKey1KeyId = 0xA34D7E18C20C31BB
 const testKey3KeyId = 0x338934250CCC0360
 
@@ -938,6 +1927,11 @@ const detachedSignatureV3TextHex = "8900950305005255c25ca34d7e18c20c31bb0102bb3f
 
 const detachedSignatureDSAHex = "884604001102000605024d6c4eac000a0910338934250ccc0360f18d00a087d743d6405ed7b87755476629600b8b694a39e900a0abff8126f46faf1547c1743c37b21b4ea15b8f83"
 
+// rfc2440MessageHex is "legacy message" encrypted with the passphrase
+// "testing" by gpg --rfc2440 --cipher-algo CAST5 -c, so it uses a plain
+// Symmetrically Encrypted Data packet without an MDC.
+const rfc2440MessageHex = "8c0d04030302d89625eec6160bbcffa42ad3c19dff9b32d8b173b3c6407e311328b3191f32f863aca93a1ca55f0bd53c4cf5ed852539a6e94d785d"
+
 const testKeys1And2Hex = "988d044d3c5c10010400b1d13382944bd5aba23a4312968b5095d14f947f600eb478e14a6fcb16b0e0cac764884909c020bc495cfcc39a935387c661507bdb236a0612fb582cac3af9b29cc2c8c70090616c41b662f4da4c1201e195472eb7f4ae1ccbcbf9940fe21d985e379a5563dde5b9a23d35f1cfaa5790da3b79db26f23695107bfaca8e7b5bcd0011010001b41054657374204b6579203120285253412988b804130102002205024d3c5c10021b03060b090807030206150802090a0b0416020301021e01021780000a0910a34d7e18c20c31bbb5b304009cc45fe610b641a2c146331be94dade0a396e73ca725e1b25c21708d9cab46ecca5ccebc23055879df8f99eea39b377962a400f2ebdc36a7c99c333d74aeba346315137c3ff9d0a09b0273299090343048afb8107cf94cbd1400e3026f0ccac7ecebbc4d78588eb3e478fe2754d3ca664bcf3eac96ca4a6b0c8d7df5102f60f6b0020003b88d044d3c5c10010400b201df61d67487301f11879d514f4248ade90c8f68c7af1284c161098de4c28c2850f1ec7b8e30f959793e571542ffc6532189409cb51c3d30dad78c4ad5165eda18b20d9826d8707d0f742e2ab492103a85bbd9ddf4f5720f6de7064feb0d39ee002219765bb07bcfb8b877f47abe270ddeda4f676108cecb6b9bb2ad484a4f0011010001889f04180102000905024d3c5c10021b0c000a0910a34d7e18c20c31bb1a03040085c8d62e16d05dc4e9dad64953c8a2eed8b6c12f92b1575eeaa6dcf7be9473dd5b24b37b6dffbb4e7c99ed1bd3cb11634be19b3e6e207bed7505c7ca111ccf47cb323bf1f8851eb6360e8034cbff8dd149993c959de89f8f77f38e7e98b8e3076323aa719328e2b408db5ec0d03936efd57422ba04f925cdc7b4c1af7590e40ab0020003988d044d3c5c33010400b488c3e5f83f4d561f317817538d9d0397981e9aef1321ca68ebfae1cf8b7d388e19f4b5a24a82e2fbbf1c6c26557a6c5845307a03d815756f564ac7325b02bc83e87d5480a8fae848f07cb891f2d51ce7df83dcafdc12324517c86d472cc0ee10d47a68fd1d9ae49a6c19bbd36d82af597a0d88cc9c49de9df4e696fc1f0b5d0011010001b42754657374204b6579203220285253412c20656e637279707465642070726976617465206b65792988b804130102002205024d3c5c33021b03060b090807030206150802090a0b0416020301021e01021780000a0910d4984f961e35246b98940400908a73b6a6169f700434f076c6c79015a49bee37130eaf23aaa3cfa9ce60bfe4acaa7bc95f1146ada5867e0079babb38804891f4f0b8ebca57a86b249dee786161a755b7a342e68ccf3f78ed6440a93a6626beb9a37aa66afcd4f888790cb4bb46d94a4ae3eb3d7d3e6b00f6bfec940303e89ec5b32a1eaaacce66497d539328b0020003b88d044d3c5c33010400a4e913f9442abcc7f1804ccab27d2f787ffa592077ca935a8bb23165bd8d57576acac647cc596b2c3f814518cc8c82953c7a4478f32e0cf645630a5ba38d9618ef2bc3add69d459ae3dece5cab778938d988239f8c5ae437807075e06c828019959c644ff05ef6a5a1dab72227c98e3a040b0cf219026640698d7a13d8538a570011010001889f04180102000905024d3c5c33021b0c000a0910d4984f961e35246b26c703ff7ee29ef53bc1ae1ead533c408fa136db508434e233d6e62be621e031e5940bbd4c08142aed0f82217e7c3e1ec8de574bc06ccf3c36633be41ad78a9eacd209f861cae7b064100758545cc9dd83db71806dc1cfd5fb9ae5c7474bba0c19c44034ae61bae5eca379383339dece94ff56ff7aa44a582f3e5c38f45763af577c0934b0020003"
 
 const testKeys1And2PrivateHex = "9501d8044d3c5c10010400b1d13382944bd5aba23a4312968b5095d14f947f600eb478e14a6fcb16b0e0cac764884909c020bc495cfcc39a935387c661507bdb236a0612fb582cac3af9b29cc2c8c70090616c41b662f4da4c1201e195472eb7f4ae1ccbcbf9940fe21d985e379a5563dde5b9a23d35f1cfaa5790da3b79db26f23695107bfaca8e7b5bcd00110100010003ff4d91393b9a8e3430b14d6209df42f98dc927425b881f1209f319220841273a802a97c7bdb8b3a7740b3ab5866c4d1d308ad0d3a79bd1e883aacf1ac92dfe720285d10d08752a7efe3c609b1d00f17f2805b217be53999a7da7e493bfc3e9618fd17018991b8128aea70a05dbce30e4fbe626aa45775fa255dd9177aabf4df7cf0200c1ded12566e4bc2bb590455e5becfb2e2c9796482270a943343a7835de41080582c2be3caf5981aa838140e97afa40ad652a0b544f83eb1833b0957dce26e47b0200eacd6046741e9ce2ec5beb6fb5e6335457844fb09477f83b050a96be7da043e17f3a9523567ed40e7a521f818813a8b8a72209f1442844843ccc7eb9805442570200bdafe0438d97ac36e773c7162028d65844c4d463e2420aa2228c6e50dc2743c3d6c72d0d782a5173fe7be2169c8a9f4ef8a7cf3e37165e8c61b89c346cdc6c1799d2b41054657374204b6579203120285253412988b804130102002205024d3c5c10021b03060b090807030206150802090a0b0416020301021e01021780000a0910a34d7e18c20c31bbb5b304009cc45fe610b641a2c146331be94dade0a396e73ca725e1b25c21708d9cab46ecca5ccebc23055879df8f99eea39b377962a400f2ebdc36a7c99c333d74aeba346315137c3ff9d0a09b0273299090343048afb8107cf94cbd1400e3026f0ccac7ecebbc4d78588eb3e478fe2754d3ca664bcf3eac96ca4a6b0c8d7df5102f60f6b00200009d01d8044d3c5c10010400b201df61d67487301f11879d514f4248ade90c8f68c7af1284c161098de4c28c2850f1ec7b8e30f959793e571542ffc6532189409cb51c3d30dad78c4ad5165eda18b20d9826d8707d0f742e2ab492103a85bbd9ddf4f5720f6de7064feb0d39ee002219765bb07bcfb8b877f47abe270ddeda4f676108cecb6b9bb2ad484a4f00110100010003fd17a7490c22a79c59281fb7b20f5e6553ec0c1637ae382e8adaea295f50241037f8997cf42c1ce26417e015091451b15424b2c59eb8d4161b0975630408e394d3b00f88d4b4e18e2cc85e8251d4753a27c639c83f5ad4a571c4f19d7cd460b9b73c25ade730c99df09637bd173d8e3e981ac64432078263bb6dc30d3e974150dd0200d0ee05be3d4604d2146fb0457f31ba17c057560785aa804e8ca5530a7cd81d3440d0f4ba6851efcfd3954b7e68908fc0ba47f7ac37bf559c6c168b70d3a7c8cd0200da1c677c4bce06a068070f2b3733b0a714e88d62aa3f9a26c6f5216d48d5c2b5624144f3807c0df30be66b3268eeeca4df1fbded58faf49fc95dc3c35f134f8b01fd1396b6c0fc1b6c4f0eb8f5e44b8eace1e6073e20d0b8bc5385f86f1cf3f050f66af789f3ef1fc107b7f4421e19e0349c730c68f0a226981f4e889054fdb4dc149e8e889f04180102000905024d3c5c10021b0c000a0910a34d7e18c20c31bb1a03040085c8d62e16d05dc4e9dad64953c8a2eed8b6c12f92b1575eeaa6dcf7be9473dd5b24b37b6dffbb4e7c99ed1bd3cb11634be19b3e6e207bed7505c7ca111ccf47cb323bf1f8851eb6360e8034cbff8dd149993c959de89f8f77f38e7e98b8e3076323aa719328e2b408db5ec0d03936efd57422ba04f925cdc7b4c1af7590e40ab00200009501fe044d3c5c33010400b488c3e5f83f4d561f317817538d9d0397981e9aef1321ca68ebfae1cf8b7d388e19f4b5a24a82e2fbbf1c6c26557a6c5845307a03d815756f564ac7325b02bc83e87d5480a8fae848f07cb891f2d51ce7df83dcafdc12324517c86d472cc0ee10d47a68fd1d9ae49a6c19bbd36d82af597a0d88cc9c49de9df4e696fc1f0b5d0011010001fe030302e9030f3c783e14856063f16938530e148bc57a7aa3f3e4f90df9dceccdc779bc0835e1ad3d006e4a8d7b36d08b8e0de5a0d947254ecfbd22037e6572b426bcfdc517796b224b0036ff90bc574b5509bede85512f2eefb520fb4b02aa523ba739bff424a6fe81c5041f253f8d757e69a503d3563a104d0d49e9e890b9d0c26f96b55b743883b472caa7050c4acfd4a21f875bdf1258d88bd61224d303dc9df77f743137d51e6d5246b88c406780528fd9a3e15bab5452e5b93970d9dcc79f48b38651b9f15bfbcf6da452837e9cc70683d1bdca94507870f743e4ad902005812488dd342f836e72869afd00ce1850eea4cfa53ce10e3608e13d3c149394ee3cbd0e23d018fcbcb6e2ec5a1a22972d1d462ca05355d0d290dd2751e550d5efb38c6c89686344df64852bf4ff86638708f644e8ec6bd4af9b50d8541cb91891a431326ab2e332faa7ae86cfb6e0540aa63160c1e5cdd5a4add518b303fff0a20117c6bc77f7cfbaf36b04c865c6c2b42754657374204b6579203220285253412c20656e637279707465642070726976617465206b65792988b804130102002205024d3c5c33021b03060b090807030206150802090a0b0416020301021e01021780000a0910d4984f961e35246b98940400908a73b6a6169f700434f076c6c79015a49bee37130eaf23aaa3cfa9ce60bfe4acaa7bc95f1146ada5867e0079babb38804891f4f0b8ebca57a86b249dee786161a755b7a342e68ccf3f78ed6440a93a6626beb9a37aa66afcd4f888790cb4bb46d94a4ae3eb3d7d3e6b00f6bfec940303e89ec5b32a1eaaacce66497d539328b00200009d01fe044d3c5c33010400a4e913f9442abcc7f1804ccab27d2f787ffa592077ca935a8bb23165bd8d57576acac647cc596b2c3f814518cc8c82953c7a4478f32e0cf645630a5ba38d9618ef2bc3add69d459ae3dece5cab778938d988239f8c5ae437807075e06c828019959c644ff05ef6a5a1dab72227c98e3a040b0cf219026640698d7a13d8538a570011010001fe030302e9030f3c783e148560f936097339ae381d63116efcf802ff8b1c9360767db5219cc987375702a4123fd8657d3e22700f23f95020d1b261eda5257e9a72f9a918e8ef22dd5b3323ae03bbc1923dd224db988cadc16acc04b120a9f8b7e84da9716c53e0334d7b66586ddb9014df604b41be1e960dcfcbc96f4ed150a1a0dd070b9eb14276b9b6be413a769a75b519a53d3ecc0c220e85cd91ca354d57e7344517e64b43b6e29823cbd87eae26e2b2e78e6dedfbb76e3e9f77bcb844f9a8932eb3db2c3f9e44316e6f5d60e9e2a56e46b72abe6b06dc9a31cc63f10023d1f5e12d2a3ee93b675c96f504af0001220991c88db759e231b3320dcedf814dcf723fd9857e3d72d66a0f2af26950b915abdf56c1596f46a325bf17ad4810d3535fb02a259b247ac3dbd4cc3ecf9c51b6c07cebb009c1506fba0a89321ec8683e3fd009a6e551d50243e2d5092fefb3321083a4bad91320dc624bd6b5dddf93553e3d53924c05bfebec1fb4bd47e89a1a889f04180102000905024d3c5c33021b0c000a0910d4984f961e35246b26c703ff7ee29ef53bc1ae1ead533c408fa136db508434e233d6e62be621e031e5940bbd4c08142aed0f82217e7c3e1ec8de574bc06ccf3c36633be41ad78a9eacd209f861cae7b064100758545cc9dd83db71806dc1cfd5fb9ae5c7474bba0c19c44034ae61bae5eca379383339dece94ff56ff7aa44a582f3e5c38f45763af577c0934b0020000"
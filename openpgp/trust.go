@@ -0,0 +1,198 @@
+package openpgp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/keybase/go-crypto/openpgp/packet"
+)
+
+// Validity is how sure a web of trust calculation is that a key belongs to
+// the owner named in its user ids.
+type Validity int
+
+const (
+	ValidityUnknown  Validity = iota // no certifications by trusted introducers.
+	ValidityMarginal                 // some, but not enough, such certifications.
+	ValidityFull                     // enough such certifications.
+	ValidityUltimate                 // one of the trust anchors.
+)
+
+// The thresholds of the web of trust model, as GnuPG sets them by default.
+const (
+	completesNeeded = 1
+	marginalsNeeded = 3
+
+	// Trust amounts of at least these make an introducer fully or
+	// partially trusted. See RFC 4880, section 5.2.3.13.
+	completeTrustAmount = 120
+	partialTrustAmount  = 60
+)
+
+// introducer describes how far a key is trusted to certify other keys.
+type introducer struct {
+	amount uint8 // the trust amount, 255 for a trust anchor.
+	depth  int   // the levels of keys it can introduce, -1 for no limit.
+}
+
+// better reports whether i is a more trusted introducer than other.
+func (i introducer) better(other introducer) bool {
+	if i.amount != other.amount {
+		return i.amount > other.amount
+	}
+	return other.depth != -1 && (i.depth == -1 || i.depth > other.depth)
+}
+
+// certification is a valid certification of an identity of a key.
+type certification struct {
+	certifier string // the fingerprint of the certifying key.
+	sig       *packet.Signature
+}
+
+// ComputeValidity computes the validity of the keys in el with the classic
+// web of trust model, starting from the trust anchors, which are given by
+// the fingerprints of their primary keys. Anchors are ultimately valid and
+// fully trusted to introduce other keys. A key certified by one fully
+// trusted introducer, or by three partially trusted ones, is fully valid,
+// and one certified by fewer is marginally valid.
+//
+// A certification that is also a trust signature (see
+// packet.Signature.TrustLevel) makes the certified key an introducer once
+// it is fully valid: fully trusted with a trust amount of 120 or more, and
+// partially trusted with 60 or more. The trust level bounds how many levels
+// of keys it can introduce in turn, and it never gets more trust or levels
+// than the introducer that signed it. A trust signature that is limited to
+// user ids matching a regular expression only counts as a certification, as
+// this package doesn't support regular expressions.
+//
+// Certifications are taken from the Signatures of each identity, such as
+// those added by SignIdentity, and must be in effect and verify against a
+// key in el. Revoked identities and revoked or expired keys don't take part.
+// The result maps the upper-case hex fingerprint of each primary key in el
+// to its validity.
+func (el EntityList) ComputeValidity(anchors [][]byte) map[string]Validity {
+	now := time.Now()
+	validity := make(map[string]Validity, len(el))
+	introducers := make(map[string]introducer)
+	certifications := make(map[string][]certification)
+
+	isAnchor := make(map[string]bool, len(anchors))
+	for _, anchor := range anchors {
+		isAnchor[fingerprintString(anchor)] = true
+	}
+
+	var usable []*Entity
+	for _, e := range el {
+		fpr := fingerprintString(e.PrimaryKey.Fingerprint[:])
+		validity[fpr] = ValidityUnknown
+		if e.Revoked(now) || e.primaryIdentity() == nil || e.primaryKeyExpired(now) {
+			continue
+		}
+		if isAnchor[fpr] {
+			validity[fpr] = ValidityUltimate
+			introducers[fpr] = introducer{amount: 255, depth: -1}
+			continue
+		}
+		usable = append(usable, e)
+		certifications[fpr] = el.certificationsOf(e, now)
+	}
+
+	// Each pass can only raise the validity of keys and the trust in
+	// introducers, both of which are bounded, so this terminates.
+	for changed := true; changed; {
+		changed = false
+		for _, e := range usable {
+			fpr := fingerprintString(e.PrimaryKey.Fingerprint[:])
+
+			var full, marginal int
+			var delegated introducer
+			counted := make(map[string]bool)
+			for _, cert := range certifications[fpr] {
+				signer, ok := introducers[cert.certifier]
+				if !ok || signer.depth == 0 {
+					continue
+				}
+				// Count each introducer once, however many of
+				// the identities of e it certified.
+				if !counted[cert.certifier] {
+					counted[cert.certifier] = true
+					if signer.amount >= completeTrustAmount {
+						full++
+					} else {
+						marginal++
+					}
+				}
+				// Trust signatures scoped to the user ids
+				// matching a regular expression aren't
+				// honoured, as regular expressions aren't
+				// supported.
+				if cert.sig.TrustLevel == 0 || cert.sig.Regex != "" || signer.depth == 1 {
+					continue
+				}
+				trust := introducer{amount: cert.sig.TrustAmount, depth: int(cert.sig.TrustLevel)}
+				if trust.amount > signer.amount {
+					trust.amount = signer.amount
+				}
+				if signer.depth > 0 && trust.depth > signer.depth-1 {
+					trust.depth = signer.depth - 1
+				}
+				if trust.better(delegated) {
+					delegated = trust
+				}
+			}
+
+			v := ValidityUnknown
+			switch {
+			case full >= completesNeeded || marginal >= marginalsNeeded:
+				v = ValidityFull
+			case full > 0 || marginal > 0:
+				v = ValidityMarginal
+			}
+			if v > validity[fpr] {
+				validity[fpr] = v
+				changed = true
+			}
+
+			if validity[fpr] == ValidityFull && delegated.amount >= partialTrustAmount {
+				if current, ok := introducers[fpr]; !ok || delegated.better(current) {
+					introducers[fpr] = delegated
+					changed = true
+				}
+			}
+		}
+	}
+	return validity
+}
+
+// certificationsOf returns the third-party certifications of the identities
+// of e that aren't revoked, are in effect at now and verify against a key in
+// el, as ValidCertifications does, along with the key that made each.
+func (el EntityList) certificationsOf(e *Entity, now time.Time) (certs []certification) {
+	for name, ident := range e.Identities {
+		if ident.Revocation != nil {
+			continue
+		}
+		for _, sig := range ident.Signatures {
+			if sig.SigType < packet.SigTypeGenericCert || sig.SigType > packet.SigTypePositiveCert {
+				continue
+			}
+			if sig.IssuerKeyId == nil || sig.CreationTime.After(now) || sig.SigExpired(now) {
+				continue
+			}
+			for _, key := range el.KeysByIdUsage(*sig.IssuerKeyId, sig.IssuerFingerprint, packet.KeyFlagCertify) {
+				if key.Entity == e {
+					continue
+				}
+				if key.PublicKey.VerifyUserIdSignature(name, e.PrimaryKey, sig) == nil {
+					certs = append(certs, certification{fingerprintString(key.Entity.PrimaryKey.Fingerprint[:]), sig})
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+func fingerprintString(fingerprint []byte) string {
+	return fmt.Sprintf("%X", fingerprint)
+}
@@ -0,0 +1,97 @@
+package openpgp
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/keybase/go-crypto/openpgp/packet"
+)
+
+// certifyWithTrust adds a certification of the identity of e by signer,
+// which is a trust signature if level is non-zero.
+func certifyWithTrust(t *testing.T, e, signer *Entity, level, amount uint8) {
+	certifyWithScopedTrust(t, e, signer, level, amount, "")
+}
+
+// certifyWithScopedTrust is like certifyWithTrust, but limits the trust to
+// the user ids matching regex, if it is non-empty.
+func certifyWithScopedTrust(t *testing.T, e, signer *Entity, level, amount uint8, regex string) {
+	ident := e.primaryIdentity()
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeGenericCert,
+		PubKeyAlgo:   signer.PrivateKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now().Add(-time.Minute),
+		IssuerKeyId:  &signer.PrivateKey.KeyId,
+		TrustLevel:   level,
+		TrustAmount:  amount,
+		Regex:        regex,
+	}
+	if err := sig.SignUserId(ident.Name, e.PrimaryKey, signer.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	ident.Signatures = append(ident.Signatures, sig)
+}
+
+func TestComputeValidity(t *testing.T) {
+	names := []string{"anchor", "full", "introduced", "unreached", "m1", "m2", "m3", "two-marginals", "three-marginals", "scoped", "scoped-introduced"}
+	keys := make(map[string]*Entity)
+	var el EntityList
+	for _, name := range names {
+		e, err := NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = e
+		el = append(el, e)
+	}
+
+	// The anchor fully trusts "full" to introduce keys, but not to
+	// delegate that trust, so "introduced" is valid but the keys it
+	// certifies aren't.
+	certifyWithTrust(t, keys["full"], keys["anchor"], 1, 120)
+	certifyWithTrust(t, keys["introduced"], keys["full"], 1, 120)
+	certifyWithTrust(t, keys["unreached"], keys["introduced"], 0, 0)
+
+	// Three partially trusted introducers are needed for full validity.
+	for _, m := range []string{"m1", "m2", "m3"} {
+		certifyWithTrust(t, keys[m], keys["anchor"], 1, 60)
+		certifyWithTrust(t, keys["three-marginals"], keys[m], 0, 0)
+	}
+	certifyWithTrust(t, keys["two-marginals"], keys["m1"], 0, 0)
+	certifyWithTrust(t, keys["two-marginals"], keys["m2"], 0, 0)
+
+	// Trust limited by a regular expression isn't delegated, so the
+	// scoped introducer can't introduce any key.
+	certifyWithScopedTrust(t, keys["scoped"], keys["anchor"], 1, 120, `<[^>]+[@.]example\.org>$`)
+	certifyWithTrust(t, keys["scoped-introduced"], keys["scoped"], 0, 0)
+
+	validity := el.ComputeValidity([][]byte{keys["anchor"].PrimaryKey.Fingerprint[:]})
+	for name, want := range map[string]Validity{
+		"anchor":            ValidityUltimate,
+		"full":              ValidityFull,
+		"introduced":        ValidityFull,
+		"unreached":         ValidityUnknown,
+		"m1":                ValidityFull,
+		"two-marginals":     ValidityMarginal,
+		"three-marginals":   ValidityFull,
+		"scoped":            ValidityFull,
+		"scoped-introduced": ValidityUnknown,
+	} {
+		fpr := fingerprintString(keys[name].PrimaryKey.Fingerprint[:])
+		if got := validity[fpr]; got != want {
+			t.Errorf("%s: got validity %d, want %d", name, got, want)
+		}
+	}
+	if len(validity) != len(names) {
+		t.Errorf("got %d keys, want %d", len(validity), len(names))
+	}
+
+	// Without an anchor, nothing is valid.
+	for fpr, v := range el.ComputeValidity(nil) {
+		if v != ValidityUnknown {
+			t.Errorf("%s: got validity %d without anchors", fpr, v)
+		}
+	}
+}
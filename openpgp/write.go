@@ -6,6 +6,8 @@ package openpgp
 
 import (
 	"crypto"
+	"crypto/dsa"
+	"encoding"
 	"hash"
 	"io"
 	"strconv"
@@ -92,32 +94,19 @@ func SignWithSigner(s packet.Signer, w io.Writer, message io.Reader, sigType pac
 }
 
 func detachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (err error) {
-	signerSubkey, ok := signer.signingKey(config.Now())
-	if !ok {
-		err = errors.InvalidArgumentError("no valid signing keys")
+	signerKey, err := signer.signingPrivateKey(config)
+	if err != nil {
 		return
 	}
-	if signerSubkey.PrivateKey == nil {
-		return errors.InvalidArgumentError("signing key doesn't have a private key")
-	}
-	if signerSubkey.PrivateKey.Encrypted {
-		return errors.InvalidArgumentError("signing key is encrypted")
-	}
-
-	sig := new(packet.Signature)
-	sig.SigType = sigType
-	sig.PubKeyAlgo = signerSubkey.PrivateKey.PubKeyAlgo
-	sig.Hash = config.Hash()
-	sig.CreationTime = config.Now()
-	sig.IssuerKeyId = &signerSubkey.PrivateKey.KeyId
 
+	sig := newSignaturePacket(signerKey, sigType, config.Hash(), config)
 	h, wrappedHash, err := hashForSignature(sig.Hash, sig.SigType)
 	if err != nil {
 		return
 	}
 	io.Copy(wrappedHash, message)
 
-	err = sig.Sign(h, signerSubkey.PrivateKey, config)
+	err = sig.Sign(h, signerKey, config)
 	if err != nil {
 		return
 	}
@@ -125,6 +114,134 @@ func detachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.S
 	return sig.Serialize(w)
 }
 
+// SignHash makes a detached binary signature by e over data that has
+// already been hashed with hash, for example by the store that holds it. A
+// signature covers the data followed by a trailer of its own, so a finished
+// digest can't be signed: digest must be the state of the unfinished hash,
+// as returned by its MarshalBinary method. Such signatures can be checked
+// the same way with CheckDetachedSignatureHash. If config is nil, sensible
+// defaults will be used.
+func (e *Entity) SignHash(digest []byte, hashFunc crypto.Hash, config *packet.Config) (*packet.Signature, error) {
+	if !hashFunc.Available() {
+		return nil, errors.UnsupportedError("hash function " + strconv.Itoa(int(hashFunc)))
+	}
+	h, ok := hashFunc.New().(interface {
+		hash.Hash
+		encoding.BinaryUnmarshaler
+	})
+	if !ok {
+		return nil, errors.UnsupportedError("hash function " + strconv.Itoa(int(hashFunc)) + " can't restore a digest")
+	}
+	if err := h.UnmarshalBinary(digest); err != nil {
+		return nil, errors.InvalidArgumentError("bad digest: " + err.Error())
+	}
+
+	signerKey, err := e.signingPrivateKey(config)
+	if err != nil {
+		return nil, err
+	}
+	sig := newSignaturePacket(signerKey, packet.SigTypeBinary, hashFunc, config)
+	if err := sig.Sign(h, signerKey, config); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// newSignaturePacket returns an unsigned detached signature of the given
+// type by signerKey, with the subpackets that config asks for.
+func newSignaturePacket(signerKey *packet.PrivateKey, sigType packet.SignatureType, hashFunc crypto.Hash, config *packet.Config) *packet.Signature {
+	sig := new(packet.Signature)
+	sig.SigType = sigType
+	sig.PubKeyAlgo = signerKey.PubKeyAlgo
+	sig.Hash = hashFunc
+	sig.CreationTime = config.Now()
+	sig.IssuerKeyId = &signerKey.KeyId
+	sig.SignerUserId = signerUserId(config)
+	if config != nil && config.SubpacketConfig != nil {
+		config.SubpacketConfig(&sig.ExtraSubpackets)
+	}
+	return sig
+}
+
+// signingPrivateKey returns the private key that e signs with. If config
+// supplies an ExternalSigner, the key matching it is used and need not
+// hold private key material.
+func (e *Entity) signingPrivateKey(config *packet.Config) (*packet.PrivateKey, error) {
+	if config != nil && config.SignerUserId != "" {
+		if _, ok := e.Identities[config.SignerUserId]; !ok {
+			return nil, errors.InvalidArgumentError("signer user id not found in signing entity")
+		}
+	}
+
+	if config != nil && config.ExternalSigner != nil {
+		priv, ok := e.externalSigningKey(config.Now(), config.ExternalSigner)
+		if !ok {
+			return nil, errors.InvalidArgumentError("no signing key matches external signer")
+		}
+		return priv, nil
+	}
+
+	signKey, ok := e.signingKey(config.Now())
+	if !ok {
+		return nil, errors.InvalidArgumentError("no valid signing keys")
+	}
+	if signKey.PrivateKey == nil {
+		return nil, errors.InvalidArgumentError("signing key doesn't have a private key")
+	}
+	if signKey.PrivateKey.Encrypted {
+		return nil, errors.InvalidArgumentError("signing key is encrypted")
+	}
+	return signKey.PrivateKey, nil
+}
+
+// signerUserId returns the value of the signer's user id subpacket
+// requested by config, or nil if there is none.
+func signerUserId(config *packet.Config) *string {
+	if config == nil || config.SignerUserId == "" {
+		return nil
+	}
+	uid := config.SignerUserId
+	return &uid
+}
+
+// PreferredSigningHash returns the hash to sign a message for recipient
+// with: the first hash in the recipient's preferences that this package
+// implements, that isn't the weak SHA-1 or MD5, and that the signing key of
+// signer can sign with. If there is none, or the recipient states no
+// preferences, SHA-256 is used, as it is by default when signing.
+func (signer *Entity) PreferredSigningHash(recipient *Entity) crypto.Hash {
+	var pub *packet.PublicKey
+	if key, ok := signer.signingKey(time.Now()); ok {
+		pub = key.PublicKey
+	} else {
+		pub = signer.PrimaryKey
+	}
+
+	if recipient != nil {
+		if sig := recipient.primarySelfSignature(); sig != nil {
+			for _, id := range sig.PreferredHash {
+				h, ok := s2k.HashIdToHash(id)
+				if !ok || h == crypto.SHA1 || h == crypto.MD5 {
+					continue
+				}
+				if h.Available() && canSignWithHash(pub, h) {
+					return h
+				}
+			}
+		}
+	}
+	return crypto.SHA256
+}
+
+// canSignWithHash reports whether pub can sign digests made with h. DSA
+// signatures need a digest at least as long as the key's subgroup order.
+func canSignWithHash(pub *packet.PublicKey, h crypto.Hash) bool {
+	if k, ok := pub.PublicKey.(*dsa.PublicKey); ok {
+		return h.Size() >= (k.Q.BitLen()+7)/8
+	}
+	return true
+}
+
 // FileHints contains metadata about encrypted files. This metadata is, itself,
 // encrypted.
 type FileHints struct {
@@ -159,11 +276,7 @@ func SymmetricallyEncrypt(ciphertext io.Writer, passphrase []byte, hints *FileHi
 
 	literaldata := w
 	if algo := config.Compression(); algo != packet.CompressionNone {
-		var compConfig *packet.CompressionConfig
-		if config != nil {
-			compConfig = config.CompressionConfig
-		}
-		literaldata, err = packet.SerializeCompressed(w, algo, compConfig)
+		literaldata, err = packet.SerializeCompressedWithConfig(w, algo, config)
 		if err != nil {
 			return
 		}
@@ -173,7 +286,7 @@ func SymmetricallyEncrypt(ciphertext io.Writer, passphrase []byte, hints *FileHi
 	if !hints.ModTime.IsZero() {
 		epochSeconds = uint32(hints.ModTime.Unix())
 	}
-	return packet.SerializeLiteral(literaldata, hints.IsBinary, hints.FileName, epochSeconds)
+	return packet.SerializeLiteralWithConfig(literaldata, hints.IsBinary, hints.FileName, epochSeconds, config)
 }
 
 // intersectPreferences mutates and returns a prefix of a that contains only
@@ -204,24 +317,63 @@ func hashToHashId(h crypto.Hash) uint8 {
 // Encrypt encrypts a message to a number of recipients and, optionally, signs
 // it. hints contains optional information, that is also encrypted, that aids
 // the recipients in processing the message. The resulting WriteCloser must
-// be closed after the contents of the file have been written.
+// be closed after the contents of the file have been written. The cipher,
+// hash and compression algorithm are negotiated from the preferences of the
+// recipients, as reported by PlanEncryption.
 // If config is nil, sensible defaults will be used.
 func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	var signer *packet.PrivateKey
-	if signed != nil {
-		signKey, ok := signed.signingKey(config.Now())
-		if !ok {
-			return nil, errors.InvalidArgumentError("no valid signing keys")
-		}
-		signer = signKey.PrivateKey
-		if signer == nil {
-			return nil, errors.InvalidArgumentError("no private key in signing key")
-		}
-		if signer.Encrypted {
-			return nil, errors.InvalidArgumentError("signing key must be decrypted")
-		}
-	}
+	return encrypt(ciphertext, to, nil, signed, hints, config)
+}
+
+// EncryptWithPassphrase is like Encrypt, but the session key is also
+// encrypted with passphrase, so that the message can be decrypted either by
+// one of the recipients' keys or with the passphrase. If passphrase is nil,
+// it acts exactly like Encrypt.
+// If config is nil, sensible defaults will be used.
+func EncryptWithPassphrase(ciphertext io.Writer, to []*Entity, passphrase []byte, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	return encrypt(ciphertext, to, passphrase, signed, hints, config)
+}
+
+// EncryptionPlan describes how Encrypt would encrypt a message to a set of
+// recipients, as worked out by PlanEncryption.
+type EncryptionPlan struct {
+	// Recipients holds the key that the session key would be encrypted
+	// to for each recipient, in the order they were given.
+	Recipients []PlannedRecipient
+	// Cipher is the cipher the message would be encrypted with. There is
+	// a single session key, so it is the one cipher preferred by all of
+	// the recipients.
+	Cipher packet.CipherFunction
+	// Hash is the hash function a signature on the message would use.
+	Hash crypto.Hash
+	// Compression is the compression algorithm the message would be
+	// compressed with, which may be packet.CompressionNone. It is always
+	// packet.CompressionNone when config.DisableCompression is set.
+	Compression packet.CompressionAlgo
+	// AEAD is set if every recipient advertises support for AEAD
+	// encrypted data in its features subpacket and Cipher is a 128-bit
+	// block cipher, as AEAD needs. A single recipient without it forces
+	// MDC protected data. AEAD is advisory: Encrypt only writes AEAD
+	// encrypted data when it is set and config.AEADConfig is non-nil, so
+	// that callers opt in to it, and writes MDC protected data otherwise.
+	AEAD bool
+}
 
+// PlannedRecipient is a recipient of a message and the key, either a
+// subkey or the primary key, that the message would be encrypted to.
+type PlannedRecipient struct {
+	Entity      *Entity
+	Key         Key
+	Fingerprint []byte
+}
+
+// PlanEncryption works out which key of each recipient and which cipher
+// Encrypt would use to encrypt a message to the given recipients with
+// config, without encrypting anything. It fails as Encrypt would if any
+// recipient has no usable encryption key, or if the recipients share no
+// cipher or hash.
+// If config is nil, sensible defaults will be used.
+func PlanEncryption(to []*Entity, config *packet.Config) (*EncryptionPlan, error) {
 	// These are the possible ciphers that we'll use for the message.
 	candidateCiphers := []uint8{
 		uint8(packet.CipherAES128),
@@ -250,15 +402,35 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		hashToHashId(crypto.RIPEMD160),
 	}
 
-	encryptKeys := make([]Key, len(to))
+	// These are the compression algorithms that we can write. Unlike
+	// ciphers and hashes, they are picked in the order that the first
+	// recipient prefers them, and if the recipients share none, the
+	// message isn't compressed.
+	supportedCompression := []uint8{
+		uint8(packet.CompressionNone),
+		uint8(packet.CompressionZIP),
+		uint8(packet.CompressionZLIB),
+	}
+	// A recipient that doesn't state any preferences accepts ZIP. See
+	// RFC 4880, section 13.3.1.
+	defaultCompression := []uint8{
+		uint8(packet.CompressionZIP),
+	}
+	var candidateCompression []uint8
+
+	plan := &EncryptionPlan{Recipients: make([]PlannedRecipient, len(to)), AEAD: len(to) > 0}
 	for i := range to {
-		var ok bool
-		encryptKeys[i], ok = to[i].encryptionKey(config.Now())
+		key, ok := to[i].encryptionKey(config.Now())
 		if !ok {
 			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + strconv.FormatUint(to[i].PrimaryKey.KeyId, 16) + " because it has no encryption keys")
 		}
+		plan.Recipients[i] = PlannedRecipient{
+			Entity:      to[i],
+			Key:         key,
+			Fingerprint: append([]byte(nil), key.PublicKey.Fingerprint[:]...),
+		}
 
-		sig := to[i].primaryIdentity().SelfSignature
+		sig := to[i].primarySelfSignature()
 
 		preferredSymmetric := sig.PreferredSymmetric
 		if len(preferredSymmetric) == 0 {
@@ -268,8 +440,18 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		if len(preferredHashes) == 0 {
 			preferredHashes = defaultHashes
 		}
+		preferredCompression := sig.PreferredCompression
+		if len(preferredCompression) == 0 {
+			preferredCompression = defaultCompression
+		}
 		candidateCiphers = intersectPreferences(candidateCiphers, preferredSymmetric)
 		candidateHashes = intersectPreferences(candidateHashes, preferredHashes)
+		plan.AEAD = plan.AEAD && sig.AEAD
+		if i == 0 {
+			candidateCompression = intersectPreferences(append([]uint8(nil), preferredCompression...), supportedCompression)
+		} else {
+			candidateCompression = intersectPreferences(candidateCompression, preferredCompression)
+		}
 	}
 
 	if len(candidateCiphers) == 0 {
@@ -290,6 +472,11 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		}
 	}
 
+	// AEAD encrypted data needs a 128-bit block cipher.
+	if cipher == packet.CipherCAST5 {
+		plan.AEAD = false
+	}
+
 	var hash crypto.Hash
 	for _, hashId := range candidateHashes {
 		if h, ok := s2k.HashIdToHash(hashId); ok && h.Available() {
@@ -317,21 +504,83 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		return nil, errors.InvalidArgumentError("cannot encrypt because no candidate hash functions are compiled in. (Wanted " + name + " in this case.)")
 	}
 
-	symKey := make([]byte, cipher.KeySize())
-	if _, err := io.ReadFull(config.Random(), symKey); err != nil {
+	compression := packet.CompressionNone
+	if config != nil && config.DisableCompression {
+		candidateCompression = nil
+	}
+	if len(candidateCompression) > 0 {
+		compression = packet.CompressionAlgo(candidateCompression[0])
+	}
+	// If the compression algorithm specified by config is a candidate,
+	// we'll use that.
+	if configuredCompression := config.Compression(); configuredCompression != packet.CompressionNone {
+		for _, algo := range candidateCompression {
+			if packet.CompressionAlgo(algo) == configuredCompression {
+				compression = configuredCompression
+				break
+			}
+		}
+	}
+
+	plan.Cipher = cipher
+	plan.Hash = hash
+	plan.Compression = compression
+	return plan, nil
+}
+
+func encrypt(ciphertext io.Writer, to []*Entity, passphrase []byte, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	var signer *packet.PrivateKey
+	if signed != nil {
+		if signer, err = signed.signingPrivateKey(config); err != nil {
+			return nil, err
+		}
+	}
+
+	plan, err := PlanEncryption(to, config)
+	if err != nil {
 		return nil, err
 	}
+	cipher, hash := plan.Cipher, plan.Hash
+
+	var symKey []byte
+	if config != nil && config.SessionKey != nil {
+		if len(config.SessionKey) != cipher.KeySize() {
+			return nil, errors.InvalidArgumentError("session key doesn't match the size of the cipher")
+		}
+		symKey = config.SessionKey
+	} else {
+		symKey = make([]byte, cipher.KeySize())
+		if _, err := io.ReadFull(config.Random(), symKey); err != nil {
+			return nil, err
+		}
+	}
 
-	for _, key := range encryptKeys {
-		if err := packet.SerializeEncryptedKey(ciphertext, key.PublicKey, cipher, symKey, config); err != nil {
+	for _, recipient := range plan.Recipients {
+		if err := packet.SerializeEncryptedKey(ciphertext, recipient.Key.PublicKey, cipher, symKey, config); err != nil {
+			return nil, err
+		}
+	}
+	if passphrase != nil {
+		if err := packet.SerializeSymmetricKeyEncryptedReuseKey(ciphertext, symKey, cipher, passphrase, config); err != nil {
 			return nil, err
 		}
 	}
 
-	encryptedData, err := packet.SerializeSymmetricallyEncrypted(ciphertext, cipher, symKey, config)
+	var encryptedData io.WriteCloser
+	if plan.AEAD && config != nil && config.AEADConfig != nil {
+		encryptedData, err = packet.SerializeAEADEncrypted(ciphertext, cipher, symKey, config)
+	} else {
+		encryptedData, err = packet.SerializeSymmetricallyEncrypted(ciphertext, cipher, symKey, config)
+	}
 	if err != nil {
 		return
 	}
+	if plan.Compression != packet.CompressionNone {
+		encryptedData, err = packet.SerializeCompressedWithConfig(encryptedData, plan.Compression, config)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if signer != nil {
 		ops := &packet.OnePassSignature{
@@ -362,7 +611,7 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 	if !hints.ModTime.IsZero() {
 		epochSeconds = uint32(hints.ModTime.Unix())
 	}
-	literalData, err := packet.SerializeLiteral(w, hints.IsBinary, hints.FileName, epochSeconds)
+	literalData, err := packet.SerializeLiteralWithConfig(w, hints.IsBinary, hints.FileName, epochSeconds, config)
 	if err != nil {
 		return nil, err
 	}
@@ -397,6 +646,7 @@ func (s signatureWriter) Close() error {
 		Hash:         s.hashType,
 		CreationTime: s.config.Now(),
 		IssuerKeyId:  &s.signer.KeyId,
+		SignerUserId: signerUserId(s.config),
 	}
 
 	if err := sig.Sign(s.h, s.signer, s.config); err != nil {
@@ -441,29 +691,13 @@ func AttachedSign(out io.WriteCloser, signed Entity, hints *FileHints,
 		config = &packet.Config{}
 	}
 
-	var signer *packet.PrivateKey
-
-	signKey, ok := signed.signingKey(config.Now())
-	if !ok {
-		err = errors.InvalidArgumentError("no valid signing keys")
-		return
-	}
-	signer = signKey.PrivateKey
-	if signer == nil {
-		err = errors.InvalidArgumentError("no valid signing keys")
-		return
-	}
-	if signer.Encrypted {
-		err = errors.InvalidArgumentError("signing key must be decrypted")
+	signer, err := signed.signingPrivateKey(config)
+	if err != nil {
 		return
 	}
 
 	if algo := config.Compression(); algo != packet.CompressionNone {
-		var compConfig *packet.CompressionConfig
-		if config != nil {
-			compConfig = config.CompressionConfig
-		}
-		out, err = packet.SerializeCompressed(out, algo, compConfig)
+		out, err = packet.SerializeCompressedWithConfig(out, algo, config)
 		if err != nil {
 			return
 		}
@@ -491,7 +725,7 @@ func AttachedSign(out io.WriteCloser, signed Entity, hints *FileHints,
 	// We don't want the literal serializer to closer the output stream
 	// since we're going to need to write to it when we finish up the
 	// signature stuff.
-	in, err = packet.SerializeLiteral(noOpCloser{out}, hints.IsBinary, hints.FileName, epochSeconds)
+	in, err = packet.SerializeLiteralWithConfig(noOpCloser{out}, hints.IsBinary, hints.FileName, epochSeconds, config)
 
 	if err != nil {
 		return
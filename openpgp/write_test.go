@@ -7,7 +7,11 @@ package openpgp
 import (
 	"bytes"
 	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding"
 	"hash"
 	"io"
 	"io/ioutil"
@@ -16,6 +20,7 @@ import (
 	"time"
 
 	"github.com/keybase/go-crypto/openpgp/armor"
+	"github.com/keybase/go-crypto/openpgp/errors"
 	"github.com/keybase/go-crypto/openpgp/packet"
 	"github.com/keybase/go-crypto/rsa"
 )
@@ -44,6 +49,155 @@ func TestSignTextDetached(t *testing.T) {
 	testDetachedSignature(t, kring, out, signedInput, "check", testKey1KeyId)
 }
 
+func TestSignDetachedSignerUserId(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	var uid string
+	for name := range kring[0].Identities {
+		uid = name
+	}
+
+	out := bytes.NewBuffer(nil)
+	config := &packet.Config{SignerUserId: uid}
+	if err := DetachSign(out, kring[0], bytes.NewBufferString(signedInput), config); err != nil {
+		t.Fatal(err)
+	}
+	p, err := packet.Read(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		t.Fatalf("got %T, want *packet.Signature", p)
+	}
+	if sig.SignerUserId == nil || *sig.SignerUserId != uid {
+		t.Errorf("signer user id: got %v, want %q", sig.SignerUserId, uid)
+	}
+	testDetachedSignature(t, kring, out, signedInput, "signer uid", testKey1KeyId)
+
+	config.SignerUserId = "Nobody <nobody@example.com>"
+	err = DetachSign(new(bytes.Buffer), kring[0], bytes.NewBufferString(signedInput), config)
+	if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Errorf("signing as an unknown user id: got %v, want InvalidArgumentError", err)
+	}
+}
+
+func TestSignHash(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	h := sha256.New()
+	h.Write([]byte(signedInput))
+	digest, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := kring[0].SignHash(digest, crypto.SHA256, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Hash != crypto.SHA256 || sig.SigType != packet.SigTypeBinary {
+		t.Errorf("got hash %s and type %d", sig.Hash, sig.SigType)
+	}
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := CheckDetachedSignatureHash(kring, digest, crypto.SHA256, bytes.NewReader(out.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer != kring[0] {
+		t.Error("wrong signer")
+	}
+	testDetachedSignature(t, kring, out, signedInput, "SignHash", testKey1KeyId)
+}
+
+func TestPreferredSigningHash(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	signer, recipient := kring[0], kring[1]
+
+	recipient.primaryIdentity().SelfSignature.PreferredHash = []uint8{
+		hashToHashId(crypto.SHA512),
+		hashToHashId(crypto.SHA256),
+	}
+	if h := signer.PreferredSigningHash(recipient); h != crypto.SHA512 {
+		t.Errorf("got %s, want SHA-512", h)
+	}
+
+	recipient.primaryIdentity().SelfSignature.PreferredHash = []uint8{
+		hashToHashId(crypto.MD5),
+		hashToHashId(crypto.SHA1),
+		hashToHashId(crypto.SHA512),
+	}
+	if h := signer.PreferredSigningHash(recipient); h != crypto.SHA512 {
+		t.Errorf("got %s, want SHA-512 after weak hashes", h)
+	}
+
+	recipient.primaryIdentity().SelfSignature.PreferredHash = nil
+	if h := signer.PreferredSigningHash(recipient); h != crypto.SHA256 {
+		t.Errorf("got %s without preferences, want SHA-256", h)
+	}
+}
+
+func TestSignDetachedSubpacketConfig(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+
+	// A human-readable notation, see RFC 4880, section 5.2.3.16.
+	name, value := "build@example.com", "release-1.2"
+	notation := []byte{0x80, 0, 0, 0, 0, byte(len(name)), 0, byte(len(value))}
+	notation = append(notation, name+value...)
+	const notationSubpacket = 20
+
+	out := bytes.NewBuffer(nil)
+	config := &packet.Config{
+		SubpacketConfig: func(subpackets *[]packet.Subpacket) {
+			*subpackets = append(*subpackets, packet.Subpacket{Type: notationSubpacket, Contents: notation})
+		},
+	}
+	if err := DetachSign(out, kring[0], bytes.NewBufferString(signedInput), config); err != nil {
+		t.Fatal(err)
+	}
+	p, err := packet.Read(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		t.Fatalf("got %T, want *packet.Signature", p)
+	}
+	if len(sig.UnknownSubpackets) != 1 || sig.UnknownSubpackets[0].Type != notationSubpacket || !bytes.Equal(sig.UnknownSubpackets[0].Contents, notation) {
+		t.Errorf("got unknown subpackets %v, want the notation", sig.UnknownSubpackets)
+	}
+	if len(sig.ExtraSubpackets) != 0 {
+		t.Errorf("got extra subpackets %v on a parsed signature", sig.ExtraSubpackets)
+	}
+	if sig.IssuerKeyId == nil || *sig.IssuerKeyId != testKey1KeyId || sig.CreationTime.IsZero() {
+		t.Error("issuer or creation time subpacket missing")
+	}
+	testDetachedSignature(t, kring, out, signedInput, "subpacket config", testKey1KeyId)
+}
+
+func TestSignDetachedWithPrimaryKey(t *testing.T) {
+	e := readTestKeys(t)[0]
+	// The only subkey is for encryption, so the primary key signs.
+	if e.Subkeys[0].Sig.FlagSign {
+		t.Fatal("expected an encryption-only subkey")
+	}
+
+	out := new(bytes.Buffer)
+	if err := DetachSign(out, e, bytes.NewBufferString(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+	testDetachedSignature(t, EntityList{e}, out, signedInput, "primary", e.PrimaryKey.KeyId)
+
+	// Without private key material there is nothing to sign with.
+	public := PublicFromPrivate(EntityList{e})[0]
+	err := DetachSign(new(bytes.Buffer), public, bytes.NewBufferString(signedInput), nil)
+	if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Errorf("signing with a public key: got %v, want InvalidArgumentError", err)
+	}
+}
+
 func TestSignDetachedDSA(t *testing.T) {
 	kring, _ := ReadKeyRing(readerFromHex(dsaTestKeyPrivateHex))
 	out := bytes.NewBuffer(nil)
@@ -56,6 +210,60 @@ func TestSignDetachedDSA(t *testing.T) {
 	testDetachedSignature(t, kring, out, signedInput, "check", testKey3KeyId)
 }
 
+type countingExternalSigner struct {
+	crypto.Signer
+	calls int
+}
+
+func (s *countingExternalSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls++
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestSignDetachedExternalSigner(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	signKey, ok := kring[0].signingKey(time.Now())
+	if !ok {
+		t.Fatal("no signing key")
+	}
+	signer := &countingExternalSigner{Signer: signKey.PrivateKey.PrivateKey.(*rsa.PrivateKey)}
+
+	// Strip the private key material, as if it lived on a device.
+	stripped, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	out := bytes.NewBuffer(nil)
+	message := bytes.NewBufferString(signedInput)
+	config := &packet.Config{ExternalSigner: signer}
+	if err := DetachSign(out, stripped[0], message, config); err != nil {
+		t.Fatal(err)
+	}
+	if signer.calls != 1 {
+		t.Errorf("expected external signer to be called once, got %d", signer.calls)
+	}
+
+	testDetachedSignature(t, kring, out, signedInput, "check", testKey1KeyId)
+
+	// Certifications are made with the private key, even with the same
+	// config.
+	const identity = "Test Key 2 (RSA, encrypted private key)"
+	if err := kring[1].SignIdentity(identity, kring[0], config); err != nil {
+		t.Fatal(err)
+	}
+	if signer.calls != 1 {
+		t.Errorf("external signer was used for a certification")
+	}
+
+	// An external signer for another key must not be used.
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ExternalSigner = otherKey
+	message = bytes.NewBufferString(signedInput)
+	if err := DetachSign(out, stripped[0], message, config); err == nil {
+		t.Error("expected signing with mismatched external signer to fail")
+	}
+}
+
 type TestRSASigner struct {
 	hash.Hash
 	PublicKeyId uint64
@@ -257,6 +465,89 @@ func TestSymmetricEncryption(t *testing.T) {
 	}
 }
 
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestSymmetricEncryptionCipherFactory(t *testing.T) {
+	calls := make(map[packet.CipherFunction]int)
+	config := &packet.Config{
+		DefaultCipher: packet.CipherAES256,
+		CipherFactory: func(cipherFunc packet.CipherFunction, key []byte) (cipher.Block, error) {
+			calls[cipherFunc]++
+			return aes.NewCipher(key)
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	plaintext, err := SymmetricallyEncrypt(buf, []byte("testing"), nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("hello world\n")
+	plaintext.Write(message)
+	if err := plaintext.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// One cipher for the session key and one for the data.
+	if calls[packet.CipherAES256] != 2 {
+		t.Errorf("got %d calls to the cipher factory when encrypting, want 2", calls[packet.CipherAES256])
+	}
+
+	calls = make(map[packet.CipherFunction]int)
+	md, err := ReadMessage(buf, nil, func(keys []Key, symmetric bool) ([]byte, error) {
+		return []byte("testing"), nil
+	}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, message) {
+		t.Errorf("recovered message incorrect got '%s', want '%s'", contents, message)
+	}
+	if calls[packet.CipherAES256] != 2 {
+		t.Errorf("got %d calls to the cipher factory when decrypting, want 2", calls[packet.CipherAES256])
+	}
+}
+
+func TestSymmetricEncryptionStreams(t *testing.T) {
+	const size = 16 << 20
+	// The writer may hold back a little data for framing, but never
+	// more than this.
+	const maxBuffered = 64 << 10
+
+	out := new(byteCounter)
+	plaintext, err := SymmetricallyEncrypt(noOpCloser{out}, []byte("testing"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, 32<<10)
+	for written := int64(0); written < size; {
+		n, err := plaintext.Write(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written += int64(n)
+		if out.n < written-maxBuffered {
+			t.Fatalf("after writing %d bytes only %d bytes were emitted", written, out.n)
+		}
+	}
+	if err := plaintext.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.n < size {
+		t.Errorf("ciphertext of %d bytes is shorter than the plaintext", out.n)
+	}
+}
+
 var testEncryptionTests = []struct {
 	keyRingHex string
 	isSigned   bool
@@ -383,6 +674,347 @@ func armoredAttachedSign(w io.Writer, signer *Entity, message io.Reader, config
 	return in.Close()
 }
 
+func TestEncryptWithPassphrase(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	pubring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	passphrase := []byte("shared secret")
+
+	buf := new(bytes.Buffer)
+	w, err := EncryptWithPassphrase(buf, kring[:1], passphrase, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const message = "either key or passphrase"
+	w.Write([]byte(message))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := buf.Bytes()
+
+	for _, test := range []struct {
+		name    string
+		keyring EntityList
+		prompt  PromptFunction
+	}{
+		{"key", kring, nil},
+		{"passphrase", pubring, func(keys []Key, symmetric bool) ([]byte, error) {
+			if !symmetric {
+				t.Error("prompt: message wasn't marked as symmetrically encrypted")
+			}
+			return passphrase, nil
+		}},
+	} {
+		md, err := ReadMessage(bytes.NewReader(ciphertext), test.keyring, test.prompt, nil)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !md.IsSymmetricallyEncrypted || len(md.EncryptedToKeyIds) != 1 {
+			t.Errorf("%s: bad MessageDetails: %#v", test.name, md)
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+		if string(contents) != message {
+			t.Errorf("%s: got %q, want %q", test.name, contents, message)
+		}
+	}
+}
+
+func TestEncryptionCompressionPreferences(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	sessionKey := bytes.Repeat([]byte{0x11}, 16)
+	config := &packet.Config{SessionKey: sessionKey}
+
+	// firstPacket encrypts a message to kring[0] and returns the start of
+	// the first packet inside the encrypted data.
+	firstPacket := func() []byte {
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, kring[:1], nil, nil, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("compressible compressible compressible"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		packets := packet.NewReader(buf)
+		for {
+			p, err := packets.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			se, ok := p.(*packet.SymmetricallyEncrypted)
+			if !ok {
+				continue
+			}
+			r, err := se.Decrypt(packet.CipherAES128, sessionKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := make([]byte, 3)
+			if _, err := io.ReadFull(r, start); err != nil {
+				t.Fatal(err)
+			}
+			return start
+		}
+	}
+
+	for _, test := range []struct {
+		prefs []uint8
+		want  packet.CompressionAlgo
+	}{
+		{[]uint8{uint8(packet.CompressionZLIB)}, packet.CompressionZLIB},
+		{[]uint8{uint8(packet.CompressionZLIB), uint8(packet.CompressionZIP)}, packet.CompressionZLIB},
+		{nil, packet.CompressionZIP},
+		{[]uint8{3}, packet.CompressionNone}, // BZip2 can only be read.
+	} {
+		kring[0].primaryIdentity().SelfSignature.PreferredCompression = test.prefs
+
+		plan, err := PlanEncryption(kring[:1], config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.Compression != test.want {
+			t.Errorf("preferences %v: planned compression %d, want %d", test.prefs, plan.Compression, test.want)
+		}
+
+		// A compressed data packet has tag 8 and, after a one byte
+		// partial length, starts with the algorithm.
+		start := firstPacket()
+		if test.want == packet.CompressionNone {
+			if start[0] == 0xc8 {
+				t.Errorf("preferences %v: message was compressed", test.prefs)
+			}
+		} else if start[0] != 0xc8 || packet.CompressionAlgo(start[2]) != test.want {
+			t.Errorf("preferences %v: message starts with %x, want compression %d", test.prefs, start, test.want)
+		}
+	}
+
+	// Callers can opt out of compression altogether.
+	kring[0].primaryIdentity().SelfSignature.PreferredCompression = nil
+	config.DisableCompression = true
+	plan, err := PlanEncryption(kring[:1], config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Compression != packet.CompressionNone {
+		t.Errorf("compression disabled: planned compression %d", plan.Compression)
+	}
+	if start := firstPacket(); start[0] == 0xc8 {
+		t.Error("compression disabled: message was compressed")
+	}
+
+	// It also overrides DefaultCompressionAlgo.
+	config.DefaultCompressionAlgo = packet.CompressionZLIB
+	if plan, err = PlanEncryption(kring[:1], config); err != nil {
+		t.Fatal(err)
+	}
+	if plan.Compression != packet.CompressionNone {
+		t.Errorf("compression disabled with a default: planned compression %d", plan.Compression)
+	}
+	if start := firstPacket(); start[0] == 0xc8 {
+		t.Error("compression disabled with a default: message was compressed")
+	}
+
+	// Messages without recipients aren't compressed either.
+	buf := new(bytes.Buffer)
+	w, err := SymmetricallyEncrypt(buf, []byte("password"), nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("test"))
+	w.Close()
+	prompt := func([]Key, bool) ([]byte, error) { return []byte("password"), nil }
+	md, err := ReadMessage(buf, nil, prompt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.CompressionAlgo != packet.CompressionNone {
+		t.Errorf("compression disabled: symmetrically encrypted message compressed with %d", md.CompressionAlgo)
+	}
+}
+
+func TestEncryptionAEADFeatures(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	kring[0].primaryIdentity().SelfSignature.AEAD = true
+
+	for _, test := range []struct {
+		to   EntityList
+		aead bool
+	}{
+		{kring[:1], true},
+		{kring, false},
+	} {
+		plan, err := PlanEncryption(test.to, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.AEAD != test.aead {
+			t.Errorf("%d recipients: got AEAD %v, want %v", len(test.to), plan.AEAD, test.aead)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, kring, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("mixed recipients"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	packets := packet.NewReader(buf)
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if se, ok := p.(*packet.SymmetricallyEncrypted); ok {
+			if !se.MDC {
+				t.Error("message to mixed recipients isn't MDC protected")
+			}
+			break
+		}
+	}
+}
+
+func TestEncryptAEAD(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	kring[0].primaryIdentity().SelfSignature.AEAD = true
+	aeadConfig := &packet.Config{AEADConfig: &packet.AEADConfig{ChunkSizeByte: 1}}
+
+	for _, test := range []struct {
+		to     EntityList
+		config *packet.Config
+		aead   bool
+	}{
+		{kring[:1], aeadConfig, true},
+		{kring[:1], nil, false},
+		{kring, aeadConfig, false},
+	} {
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, test.to, nil, nil, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := strings.Repeat("AEAD message ", 50)
+		io.WriteString(w, message)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		md, err := ReadMessage(buf, kring, nil, nil)
+		if err != nil {
+			t.Fatalf("%d recipients, AEAD config %v: %s", len(test.to), test.config != nil, err)
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("%d recipients, AEAD config %v: %s", len(test.to), test.config != nil, err)
+		}
+		if string(contents) != message {
+			t.Errorf("%d recipients, AEAD config %v: wrong contents", len(test.to), test.config != nil)
+		}
+		if md.UsedAEAD != test.aead || md.UsedMDC == test.aead {
+			t.Errorf("%d recipients, AEAD config %v: got UsedAEAD %v and UsedMDC %v", len(test.to), test.config != nil, md.UsedAEAD, md.UsedMDC)
+		}
+	}
+}
+
+func TestEncryptionSessionKey(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	now := time.Unix(1500000000, 0)
+	sessionKey := bytes.Repeat([]byte{0x11}, 32)
+
+	encrypt := func(sessionKey []byte) ([]byte, error) {
+		config := &packet.Config{
+			DefaultCipher: packet.CipherAES256,
+			Rand:          bytes.NewReader(bytes.Repeat([]byte{0x42}, 1<<16)),
+			Time:          func() time.Time { return now },
+			SessionKey:    sessionKey,
+		}
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, kring[:1], kring[0], nil, config)
+		if err != nil {
+			return nil, err
+		}
+		w.Write([]byte("reproducible"))
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	first, err := encrypt(sessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encrypt(sessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("encrypting with the same session key and random stream gave different ciphertexts")
+	}
+	other, err := encrypt(bytes.Repeat([]byte{0x22}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, other) {
+		t.Error("the session key wasn't used")
+	}
+
+	md, err := ReadMessage(bytes.NewReader(first), kring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "reproducible" || md.SignatureError != nil {
+		t.Errorf("got %q, signature error %v", contents, md.SignatureError)
+	}
+
+	if _, err := encrypt(sessionKey[:16]); err == nil {
+		t.Error("a session key of the wrong size was accepted")
+	}
+}
+
+func TestPlanEncryption(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	config := &packet.Config{DefaultCipher: packet.CipherAES256}
+
+	plan, err := PlanEncryption(kring, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Recipients) != len(kring) {
+		t.Fatalf("got %d recipients, want %d", len(plan.Recipients), len(kring))
+	}
+	for i, recipient := range plan.Recipients {
+		if recipient.Entity != kring[i] {
+			t.Errorf("#%d: recipient is not the entity given", i)
+		}
+		want := kring[i].Subkeys[0].PublicKey.Fingerprint[:]
+		if !bytes.Equal(recipient.Fingerprint, want) {
+			t.Errorf("#%d: got fingerprint %x, want subkey %x", i, recipient.Fingerprint, want)
+		}
+	}
+	if plan.Cipher != packet.CipherAES256 {
+		t.Errorf("got cipher %d, want %d", plan.Cipher, packet.CipherAES256)
+	}
+
+	signOnly := *kring[1]
+	signOnly.Subkeys = nil
+	_, err = PlanEncryption([]*Entity{kring[0], &signOnly}, config)
+	if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Errorf("planning encryption to an entity without encryption keys: got %v, want InvalidArgumentError", err)
+	}
+}
+
 func TestSignAttached(t *testing.T) {
 	var testCompressionAlgos = []packet.CompressionAlgo{
 		packet.CompressionNone,